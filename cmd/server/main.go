@@ -8,11 +8,19 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/qiniu/codeagent/internal/agent"
+	"github.com/qiniu/codeagent/internal/code"
 	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/internal/dedup"
+	ghclient "github.com/qiniu/codeagent/internal/github"
+	"github.com/qiniu/codeagent/internal/locale"
+	"github.com/qiniu/codeagent/internal/permission"
+	"github.com/qiniu/codeagent/internal/queue"
+	"github.com/qiniu/codeagent/internal/usage"
 	"github.com/qiniu/codeagent/internal/webhook"
 	"github.com/qiniu/codeagent/internal/workspace"
 
@@ -50,32 +58,77 @@ func main() {
 	}
 
 	// 验证必需的配置
-	if cfg.GitHub.Token == "" {
-		log.Fatalf("GitHub Token is required. Please set it via --github-token flag or GITHUB_TOKEN environment variable")
+	if cfg.GitHub.Token == "" && !cfg.GitHub.App.Enabled() {
+		log.Fatalf("GitHub Token or GitHub App is required. Please set it via --github-token flag, GITHUB_TOKEN or GITHUB_APP_ID environment variable")
 	}
-	if cfg.Server.WebhookSecret == "" {
-		log.Fatalf("Webhook Secret is required. Please set it via --webhook-secret flag or WEBHOOK_SECRET environment variable")
+	if !cfg.Server.HasWebhookSecrets() {
+		log.Fatalf("Webhook Secret is required. Please set it via --webhook-secret flag, WEBHOOK_SECRET or WEBHOOK_SECRETS environment variable")
+	}
+	if _, ok := code.Lookup(cfg.CodeProvider); !ok {
+		log.Fatalf("Unsupported code provider: %s (available: %s)", cfg.CodeProvider, strings.Join(code.Providers(), ", "))
+	}
+	if cfg.Locale != "" && !locale.Supported(cfg.Locale) {
+		log.Fatalf("Unsupported locale: %s (available: %s)", cfg.Locale, strings.Join(locale.Names(), ", "))
+	}
+	if !permission.ValidLevel(cfg.Permissions.MinPermission) {
+		log.Fatalf("Unsupported permissions.min_permission: %s (available: %s)", cfg.Permissions.MinPermission, strings.Join(permission.Levels(), ", "))
 	}
 
 	log.Infof("Configuration validated successfully")
 
+	// 初始化 GitHub 凭证，API 请求和工作空间中的 git 命令共用
+	githubAuth, err := ghclient.NewAuth(cfg.GitHub)
+	if err != nil {
+		log.Fatalf("Failed to initialize GitHub credentials: %v", err)
+	}
+	if githubAuth.IsApp() {
+		log.Infof("Using GitHub App %d for authentication", cfg.GitHub.App.ID)
+	}
+
 	// 初始化工作空间管理器
-	workspaceManager := workspace.NewManager(cfg)
+	workspaceManager := workspace.NewManager(cfg, githubAuth)
+
+	// 初始化持久化任务队列，恢复上次退出前未完成的任务
+	jobQueue, err := queue.New(cfg.Queue.Dir, cfg.Queue.MaxAttempts)
+	if err != nil {
+		log.Fatalf("Failed to open job queue: %v", err)
+	}
+
+	// 初始化投递去重存储，避免 GitHub 重新投递导致任务重复执行
+	deliveryStore, err := dedup.NewStore(cfg.Dedup.File, cfg.Dedup.TTL)
+	if err != nil {
+		log.Fatalf("Failed to open delivery store: %v", err)
+	}
+
+	// 初始化用量记录存储，按任务记录 token 用量和费用
+	usageStore, err := usage.NewStore(cfg.Usage.File, cfg.Usage.Retention)
+	if err != nil {
+		log.Fatalf("Failed to open usage store: %v", err)
+	}
+	// 仓库、组织和用户的用量预算，用完后 webhook 直接答复而不执行任务
+	budget := usage.NewBudget(cfg.Budgets, usageStore)
 
 	var webhookHandler *webhook.Handler
+	var workerPool *agent.WorkerPool
 
 	// 根据参数选择使用原始Agent还是Enhanced Agent
 	if *useEnhanced {
 		log.Infof("Starting with Enhanced Agent (支持MCP、模式系统等新功能)")
 		
 		// 初始化 Enhanced Agent
-		enhancedAgent, err := agent.NewEnhancedAgent(cfg, workspaceManager)
+		enhancedAgent, err := agent.NewEnhancedAgent(cfg, workspaceManager, jobQueue, usageStore, githubAuth)
 		if err != nil {
 			log.Fatalf("Failed to create Enhanced Agent: %v", err)
 		}
 		
 		// 初始化 Enhanced Webhook 处理器
-		webhookHandler = webhook.NewEnhancedHandler(cfg, enhancedAgent)
+		webhookHandler = webhook.NewEnhancedHandler(cfg, enhancedAgent, jobQueue, deliveryStore, budget)
+		workerPool = agent.NewWorkerPool(jobQueue, cfg.Queue, enhancedAgent)
+		
+		// 启动定时任务
+		if err := enhancedAgent.StartSchedules(cfg.Schedules); err != nil {
+			log.Fatalf("Failed to start schedules: %v", err)
+		}
 		
 		// 注册优雅关闭处理
 		defer func() {
@@ -90,15 +143,26 @@ func main() {
 		log.Infof("Starting with Original Agent (传统模式)")
 		
 		// 初始化原始 Agent
-		originalAgent := agent.New(cfg, workspaceManager)
+		originalAgent := agent.New(cfg, workspaceManager, jobQueue, usageStore, githubAuth)
 		
 		// 初始化原始 Webhook 处理器
-		webhookHandler = webhook.NewHandler(cfg, originalAgent)
+		webhookHandler = webhook.NewHandler(cfg, originalAgent, jobQueue, deliveryStore, budget)
+		workerPool = agent.NewWorkerPool(jobQueue, cfg.Queue, originalAgent)
+		
+		if len(cfg.Schedules) > 0 {
+			log.Warnf("Schedules are only supported by the Enhanced Agent, %d schedules ignored", len(cfg.Schedules))
+		}
 	}
 
+	// 启动任务 worker
+	workerPool.Start()
+
 	// 设置路由
 	mux := http.NewServeMux()
 	mux.HandleFunc("/hook", webhookHandler.HandleWebhook)
+	mux.Handle("/usage", usage.NewHandler(usageStore, cfg.Usage.Token))
+	mux.HandleFunc("/dispatch", webhookHandler.HandleDispatch)
+	mux.HandleFunc("/webhook/signatures", webhookHandler.HandleSignatureStats)
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -142,5 +206,10 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// 停止任务 worker，被中断的任务会在下次启动时恢复
+	if err := workerPool.Stop(ctx); err != nil {
+		log.Errorf("Failed to stop job workers: %v", err)
+	}
+
 	log.Infof("Server exited")
 }
@@ -11,6 +11,16 @@ import (
 	"github.com/qiniu/codeagent/internal/code"
 	"github.com/qiniu/codeagent/internal/config"
 	ghclient "github.com/qiniu/codeagent/internal/github"
+	"github.com/qiniu/codeagent/internal/locale"
+	"github.com/qiniu/codeagent/internal/mcp"
+	"github.com/qiniu/codeagent/internal/mcp/servers"
+	"github.com/qiniu/codeagent/internal/modes"
+	"github.com/qiniu/codeagent/internal/permission"
+	"github.com/qiniu/codeagent/internal/prompt"
+	"github.com/qiniu/codeagent/internal/queue"
+	"github.com/qiniu/codeagent/internal/repoconfig"
+	"github.com/qiniu/codeagent/internal/scheduler"
+	"github.com/qiniu/codeagent/internal/usage"
 	"github.com/qiniu/codeagent/internal/workspace"
 	"github.com/qiniu/codeagent/pkg/models"
 
@@ -24,22 +34,63 @@ type Agent struct {
 	github         *ghclient.Client
 	workspace      *workspace.Manager
 	sessionManager *code.SessionManager
+	scheduler      *scheduler.Scheduler
+	tasks          *taskRegistry
+	queued         *queuedJobs
+	usage          *usage.Store
+	reviewer       *modes.ReviewHandler
+	repoConfigs    *repoconfig.Store
+	prompts        *prompt.Templates
+	permissions    *permission.Checker
+	loops          *scheduler.LoopGuard
+	suggester      *suggester
 }
 
-func New(cfg *config.Config, workspaceManager *workspace.Manager) *Agent {
+func New(cfg *config.Config, workspaceManager *workspace.Manager, jobQueue *queue.Queue, usageStore *usage.Store, auth *ghclient.Auth) *Agent {
 	// 初始化 GitHub 客户端
-	githubClient, err := ghclient.NewClient(cfg)
+	githubClient, err := ghclient.NewClient(cfg, auth)
 	if err != nil {
 		log.Errorf("Failed to create GitHub client: %v", err)
 		return nil
 	}
 
+	// 自动 PR 审查通过 github-comments MCP 服务器发布评论
+	mcpManager := mcp.NewManager()
+	if err := mcpManager.RegisterServer("github-comments", servers.NewGitHubCommentsServer(githubClient)); err != nil {
+		log.Errorf("Failed to register GitHub comments server: %v", err)
+		return nil
+	}
+	sessionManager := code.NewSessionManager(cfg)
+	repoConfigs := repoconfig.NewStore(githubClient)
+	prompts, err := prompt.Load(cfg.Prompts.Dir, cfg.Locale)
+	if err != nil {
+		log.Errorf("Failed to load prompt templates: %v", err)
+		return nil
+	}
+
 	a := &Agent{
 		config:         cfg,
 		github:         githubClient,
 		workspace:      workspaceManager,
-		sessionManager: code.NewSessionManager(cfg),
+		sessionManager: sessionManager,
+		scheduler:      scheduler.New(cfg.Concurrency),
+		tasks:          newTaskRegistry(),
+		usage:          usageStore,
+		reviewer:       modes.NewReviewHandler(githubClient, workspaceManager, mcp.NewClient(mcpManager), sessionManager, repoConfigs, prompts, cfg.PushAnalysis),
+		repoConfigs:    repoConfigs,
+		prompts:        prompts,
+		permissions:    permission.NewChecker(cfg.Permissions, githubClient),
+		loops:          scheduler.NewLoopGuard(cfg.LoopGuard),
+		suggester: &suggester{
+			config:         cfg,
+			github:         githubClient,
+			workspace:      workspaceManager,
+			sessionManager: sessionManager,
+			repoConfigs:    repoConfigs,
+			prompts:        prompts,
+		},
 	}
+	a.queued = newQueuedJobs(jobQueue, githubClient, a.messages)
 
 	go a.StartCleanupRoutine()
 
@@ -105,6 +156,12 @@ func (a *Agent) ProcessIssueCommentWithAI(ctx context.Context, event *github.Iss
 	issueNumber := event.Issue.GetNumber()
 	issueTitle := event.Issue.GetTitle()
 
+	repoConfig := a.repoConfigs.Get(ctx, event.Repo.GetOwner().GetLogin(), event.Repo.GetName())
+	if aiModel == "" {
+		aiModel = repoConfig.Provider(a.config.CodeProvider)
+	}
+	msgs := a.prompts.Messages(repoConfig)
+
 	log.Infof("Starting issue comment processing: issue=#%d, title=%s, AI model=%s", issueNumber, issueTitle, aiModel)
 
 	// 1. 创建 Issue 工作空间，包含AI模型信息
@@ -125,7 +182,7 @@ func (a *Agent) ProcessIssueCommentWithAI(ctx context.Context, event *github.Iss
 
 	// 3. 创建初始 PR
 	log.Infof("Creating initial PR")
-	pr, err := a.github.CreatePullRequest(ws)
+	pr, err := a.github.CreatePullRequest(ws, msgs)
 	if err != nil {
 		log.Errorf("Failed to create PR: %v", err)
 		return err
@@ -159,6 +216,7 @@ func (a *Agent) ProcessIssueCommentWithAI(ctx context.Context, event *github.Iss
 
 	// 7. 初始化 code client
 	log.Infof("Initializing code client")
+	trackWorkspace(ctx, ws)
 	code, err := a.sessionManager.GetSession(ws)
 	if err != nil {
 		log.Errorf("Failed to get code client: %v", err)
@@ -167,20 +225,14 @@ func (a *Agent) ProcessIssueCommentWithAI(ctx context.Context, event *github.Iss
 	log.Infof("Code client initialized successfully")
 
 	// 8. 执行代码修改
-	codePrompt := fmt.Sprintf(`根据Issue修改代码：
-
-标题：%s
-描述：%s
-
-输出格式：
-%s
-简要说明改动内容
-
-%s
-- 列出修改的文件和具体变动`, event.Issue.GetTitle(), event.Issue.GetBody(), models.SectionSummary, models.SectionChanges)
+	codePrompt, err := a.prompts.Render(prompt.IssueCode, prompt.Data{Issue: prompt.NewIssue(event.Issue)}, repoConfig)
+	if err != nil {
+		log.Errorf("Failed to build prompt: %v", err)
+		return err
+	}
 
 	log.Infof("Executing code modification with AI")
-	codeResp, err := a.promptWithRetry(ctx, code, codePrompt, 3)
+	codeResp, err := promptWithRetry(ctx, code, codePrompt, 3)
 	if err != nil {
 		log.Errorf("Failed to prompt for code modification: %v", err)
 		return err
@@ -195,6 +247,11 @@ func (a *Agent) ProcessIssueCommentWithAI(ctx context.Context, event *github.Iss
 	log.Infof("Code modification completed, output length: %d", len(codeOutput))
 	log.Debugf("LLM Output: %s", string(codeOutput))
 
+	// 任务已被取消时不再提交改动
+	if err := checkCancelled(ctx); err != nil {
+		return err
+	}
+
 	// 9. 组织结构化 PR Body（解析三段式输出）
 	aiStr := string(codeOutput)
 
@@ -205,29 +262,30 @@ func (a *Agent) ProcessIssueCommentWithAI(ctx context.Context, event *github.Iss
 	// 构建PR Body
 	prBody := ""
 	if summary != "" {
-		prBody += models.SectionSummary + "\n\n" + summary + "\n\n"
+		prBody += msgs.SectionSummary + "\n\n" + summary + "\n\n"
 	}
 
 	if changes != "" {
-		prBody += models.SectionChanges + "\n\n" + changes + "\n\n"
+		prBody += msgs.SectionChanges + "\n\n" + changes + "\n\n"
 	}
 
 	if testPlan != "" {
-		prBody += models.SectionTestPlan + "\n\n" + testPlan + "\n\n"
+		prBody += msgs.SectionTestPlan + "\n\n" + testPlan + "\n\n"
 	}
 
 	// 添加原始输出和错误信息
 	prBody += "---\n\n"
-	prBody += "<details><summary>AI 完整输出</summary>\n\n" + aiStr + "\n\n</details>\n\n"
+	prBody += "<details><summary>" + msgs.FullOutput + "</summary>\n\n" + aiStr + "\n\n</details>\n\n"
 
 	// 错误信息判断
 	errorInfo := extractErrorInfo(aiStr)
 	if errorInfo != "" {
-		prBody += "## 错误信息\n\n```text\n" + errorInfo + "\n```\n\n"
+		prBody += msgs.ErrorInfo + "\n\n```text\n" + errorInfo + "\n```\n\n"
 		log.Warnf("Error detected in AI output: %s", errorInfo)
 	}
 
-	prBody += "<details><summary>原始 Prompt</summary>\n\n" + codePrompt + "\n\n</details>"
+	prBody += "<details><summary>" + msgs.OriginalPrompt + "</summary>\n\n" + codePrompt + "\n\n</details>"
+	prBody += usage.Footer(ctx)
 
 	log.Infof("Updating PR body")
 	if err = a.github.UpdatePullRequest(pr, prBody); err != nil {
@@ -239,9 +297,10 @@ func (a *Agent) ProcessIssueCommentWithAI(ctx context.Context, event *github.Iss
 	// 10. 提交变更并推送到远程
 	result := &models.ExecutionResult{
 		Output: string(codeOutput),
+		Usage:  usage.Total(ctx),
 	}
 	log.Infof("Committing and pushing changes")
-	if err = a.github.CommitAndPush(ws, result, code); err != nil {
+	if err = a.github.CommitAndPush(ctx, ws, result, code, a.messages(ctx, ws.Org, ws.Repo)); err != nil {
 		log.Errorf("Failed to commit and push: %v", err)
 		return err
 	}
@@ -261,15 +320,9 @@ func parseStructuredOutput(output string) (summary, changes, testPlan string) {
 	for _, line := range lines {
 		trimmedLine := strings.TrimSpace(line)
 
-		// 检测章节标题
-		if strings.HasPrefix(trimmedLine, models.SectionSummary) {
-			currentSection = models.SectionSummaryID
-			continue
-		} else if strings.HasPrefix(trimmedLine, models.SectionChanges) {
-			currentSection = models.SectionChangesID
-			continue
-		} else if strings.HasPrefix(trimmedLine, models.SectionTestPlan) {
-			currentSection = models.SectionTestPlanID
+		// 检测章节标题，识别所有语言的标题
+		if section := locale.Section(trimmedLine); section != "" {
+			currentSection = section
 			continue
 		}
 
@@ -375,8 +428,8 @@ func (a *Agent) processPRWithArgsAndAI(ctx context.Context, event *github.IssueC
 		branchName := pr.GetHead().GetRef()
 		aiModel = a.workspace.ExtractAIModelFromBranch(branchName)
 		if aiModel == "" {
-			// 如果无法从分支中提取，使用默认配置
-			aiModel = a.config.CodeProvider
+			// 如果无法从分支中提取，使用仓库或全局的默认配置
+			aiModel = a.defaultAIModel(ctx, pr.GetBase().GetRepo())
 		}
 		log.Infof("Extracted AI model from branch: %s", aiModel)
 	}
@@ -401,6 +454,7 @@ func (a *Agent) processPRWithArgsAndAI(ctx context.Context, event *github.IssueC
 
 	// 6. 初始化 code client
 	log.Infof("Initializing code client")
+	trackWorkspace(ctx, ws)
 	codeClient, err := a.sessionManager.GetSession(ws)
 	if err != nil {
 		log.Errorf("Failed to create code session: %v", err)
@@ -418,21 +472,23 @@ func (a *Agent) processPRWithArgsAndAI(ctx context.Context, event *github.IssueC
 	}
 
 	// 8. 构建包含历史上下文的 prompt
-	var prompt string
 	var currentCommentID int64
 	if event.Comment != nil {
 		currentCommentID = event.Comment.GetID()
 	}
-	historicalContext := a.formatHistoricalComments(allComments, currentCommentID)
 
 	// 根据模式生成不同的 prompt
-	prompt = a.buildPrompt(mode, args, historicalContext)
+	prompt, err := a.buildPrompt(ctx, pr, mode, args, allComments, currentCommentID)
+	if err != nil {
+		log.Errorf("Failed to build prompt: %v", err)
+		return err
+	}
 
 	log.Infof("Using %s prompt with args and historical context", strings.ToLower(mode))
 
 	// 9. 执行 AI 处理
 	log.Infof("Executing AI processing for PR %s", strings.ToLower(mode))
-	resp, err := a.promptWithRetry(ctx, codeClient, prompt, 3)
+	resp, err := promptWithRetry(ctx, codeClient, prompt, 3)
 	if err != nil {
 		log.Errorf("Failed to process PR %s: %v", strings.ToLower(mode), err)
 		return fmt.Errorf("failed to process PR %s: %w", strings.ToLower(mode), err)
@@ -447,14 +503,20 @@ func (a *Agent) processPRWithArgsAndAI(ctx context.Context, event *github.IssueC
 	log.Infof("AI processing completed, output length: %d", len(output))
 	log.Debugf("PR %s Output: %s", mode, string(output))
 
+	// 任务已被取消时不再提交改动
+	if err := checkCancelled(ctx); err != nil {
+		return err
+	}
+
 	// 10. 提交变更并更新 PR
 	result := &models.ExecutionResult{
 		Output: string(output),
 		Error:  "",
+		Usage:  usage.Total(ctx),
 	}
 
 	log.Infof("Committing and pushing changes for PR %s", strings.ToLower(mode))
-	if err := a.github.CommitAndPush(ws, result, codeClient); err != nil {
+	if err := a.github.CommitAndPush(ctx, ws, result, codeClient, a.messages(ctx, ws.Org, ws.Repo)); err != nil {
 		log.Errorf("Failed to commit and push changes: %v", err)
 		// 根据模式决定是否返回错误
 		if mode == "Fix" {
@@ -466,7 +528,7 @@ func (a *Agent) processPRWithArgsAndAI(ctx context.Context, event *github.IssueC
 	}
 
 	// 11. 评论到 PR
-	commentBody := string(output)
+	commentBody := string(output) + usage.Footer(ctx)
 	log.Infof("Creating PR comment")
 	if err = a.github.CreatePullRequestComment(pr, commentBody); err != nil {
 		log.Errorf("Failed to create PR comment: %v", err)
@@ -478,58 +540,22 @@ func (a *Agent) processPRWithArgsAndAI(ctx context.Context, event *github.IssueC
 	return nil
 }
 
-// buildPrompt 构建不同模式的 prompt
-func (a *Agent) buildPrompt(mode string, args string, historicalContext string) string {
-	var prompt string
-	var taskDescription string
-	var defaultTask string
-
-	switch mode {
-	case "Continue":
-		taskDescription = "请根据上述PR描述、历史讨论和当前指令，进行相应的代码修改。"
-		defaultTask = "继续处理PR，分析代码变更并改进"
-	case "Fix":
-		taskDescription = "请根据上述PR描述、历史讨论和当前指令，进行相应的代码修复。"
-		defaultTask = "分析并修复代码问题"
-	default:
-		taskDescription = "请根据上述PR描述、历史讨论和当前指令，进行相应的代码处理。"
-		defaultTask = "处理代码任务"
-	}
-
-	if args != "" {
-		if historicalContext != "" {
-			prompt = fmt.Sprintf(`作为PR代码审查助手，请基于以下完整上下文来%s：
-
-%s
-
-## 当前指令
-%s
-
-%s注意：
-1. 当前指令是主要任务，历史信息仅作为上下文参考
-2. 请确保修改符合PR的整体目标和已有的讨论共识
-3. 如果发现与历史讨论有冲突，请优先执行当前指令并在回复中说明`,
-				strings.ToLower(mode), historicalContext, args, taskDescription)
-		} else {
-			prompt = fmt.Sprintf("根据指令%s：\n\n%s", strings.ToLower(mode), args)
-		}
-	} else {
-		if historicalContext != "" {
-			prompt = fmt.Sprintf(`作为PR代码审查助手，请基于以下完整上下文来%s：
-
-%s
-
-## 任务
-%s
-
-请根据上述PR描述和历史讨论，进行相应的代码修改和改进。`,
-				strings.ToLower(mode), historicalContext, defaultTask)
-		} else {
-			prompt = defaultTask
-		}
-	}
+// buildPrompt 使用 pr_command 模板构建不同模式的 prompt，历史上下文中不包含当前评论
+func (a *Agent) buildPrompt(ctx context.Context, pr *github.PullRequest, mode, args string, allComments *models.PRAllComments, currentCommentID int64) (string, error) {
+	repo := pr.GetBase().GetRepo()
+	repoConfig := a.repoConfigs.Get(ctx, repo.GetOwner().GetLogin(), repo.GetName())
+	return a.prompts.Render(prompt.PRCommand, prompt.Data{
+		Mode:     mode,
+		Args:     args,
+		PR:       prompt.NewPullRequest(pr),
+		History:  prompt.FormatHistory(allComments, currentCommentID, a.prompts.Messages(repoConfig)),
+		Comments: prompt.NewComments(allComments, currentCommentID),
+	}, repoConfig)
+}
 
-	return prompt
+// renderPrompt 渲染提示词模板，仓库级配置中的模板和仓库说明优先
+func (a *Agent) renderPrompt(ctx context.Context, name string, data prompt.Data, repo *github.Repository) (string, error) {
+	return a.prompts.Render(name, data, a.repoConfigs.Get(ctx, repo.GetOwner().GetLogin(), repo.GetName()))
 }
 
 // ContinuePRWithArgs 继续处理 PR 中的任务，支持命令参数
@@ -582,8 +608,8 @@ func (a *Agent) ContinuePRFromReviewCommentWithAI(ctx context.Context, event *gi
 		branchName := pr.GetHead().GetRef()
 		aiModel = a.workspace.ExtractAIModelFromBranch(branchName)
 		if aiModel == "" {
-			// 如果无法从分支中提取，使用默认配置
-			aiModel = a.config.CodeProvider
+			// 如果无法从分支中提取，使用仓库或全局的默认配置
+			aiModel = a.defaultAIModel(ctx, pr.GetBase().GetRepo())
 		}
 		log.Infof("Extracted AI model from branch: %s", aiModel)
 	}
@@ -601,6 +627,7 @@ func (a *Agent) ContinuePRFromReviewCommentWithAI(ctx context.Context, event *gi
 	}
 
 	// 4. 初始化 code client
+	trackWorkspace(ctx, ws)
 	code, err := a.sessionManager.GetSession(ws)
 	if err != nil {
 		log.Errorf("failed to get code client for PR continue from review comment: %v", err)
@@ -608,33 +635,18 @@ func (a *Agent) ContinuePRFromReviewCommentWithAI(ctx context.Context, event *gi
 	}
 
 	// 4. 构建 prompt，包含评论上下文和命令参数
-	var prompt string
-
-	// 获取行范围信息
-	startLine := event.Comment.GetStartLine()
-	endLine := event.Comment.GetLine()
-
-	var lineRangeInfo string
-	if startLine != 0 && endLine != 0 && startLine != endLine {
-		// 多行选择
-		lineRangeInfo = fmt.Sprintf("行号范围：%d-%d", startLine, endLine)
-	} else {
-		// 单行
-		lineRangeInfo = fmt.Sprintf("行号：%d", endLine)
-	}
-
-	commentContext := fmt.Sprintf("代码行评论：%s\n文件：%s\n%s",
-		event.Comment.GetBody(),
-		event.Comment.GetPath(),
-		lineRangeInfo)
-
-	if args != "" {
-		prompt = fmt.Sprintf("根据代码行评论和指令处理：\n\n%s\n\n指令：%s", commentContext, args)
-	} else {
-		prompt = fmt.Sprintf("根据代码行评论处理：\n\n%s", commentContext)
+	commentPrompt, err := a.renderPrompt(ctx, prompt.ReviewComment, prompt.Data{
+		Mode:          "Continue",
+		Args:          args,
+		PR:            prompt.NewPullRequest(pr),
+		ReviewComment: prompt.NewReviewComment(event.Comment),
+	}, pr.GetBase().GetRepo())
+	if err != nil {
+		log.Errorf("Failed to build prompt: %v", err)
+		return err
 	}
 
-	resp, err := a.promptWithRetry(ctx, code, prompt, 3)
+	resp, err := promptWithRetry(ctx, code, commentPrompt, 3)
 	if err != nil {
 		log.Errorf("Failed to prompt for PR continue from review comment: %v", err)
 		return err
@@ -649,17 +661,23 @@ func (a *Agent) ContinuePRFromReviewCommentWithAI(ctx context.Context, event *gi
 	log.Infof("PR Continue from Review Comment Output length: %d", len(output))
 	log.Debugf("PR Continue from Review Comment Output: %s", string(output))
 
+	// 任务已被取消时不再提交改动
+	if err := checkCancelled(ctx); err != nil {
+		return err
+	}
+
 	// 5. 提交变更并更新 PR
 	result := &models.ExecutionResult{
 		Output: string(output),
+		Usage:  usage.Total(ctx),
 	}
-	if err := a.github.CommitAndPush(ws, result, code); err != nil {
+	if err := a.github.CommitAndPush(ctx, ws, result, code, a.messages(ctx, ws.Org, ws.Repo)); err != nil {
 		log.Errorf("Failed to commit and push for PR continue from review comment: %v", err)
 		return err
 	}
 
 	// 6. 回复原始评论
-	commentBody := string(output)
+	commentBody := string(output) + usage.Footer(ctx)
 	if err = a.github.ReplyToReviewComment(pr, event.Comment.GetID(), commentBody); err != nil {
 		log.Errorf("failed to reply to review comment for continue: %v", err)
 		return err
@@ -689,8 +707,8 @@ func (a *Agent) FixPRFromReviewCommentWithAI(ctx context.Context, event *github.
 		branchName := pr.GetHead().GetRef()
 		aiModel = a.workspace.ExtractAIModelFromBranch(branchName)
 		if aiModel == "" {
-			// 如果无法从分支中提取，使用默认配置
-			aiModel = a.config.CodeProvider
+			// 如果无法从分支中提取，使用仓库或全局的默认配置
+			aiModel = a.defaultAIModel(ctx, pr.GetBase().GetRepo())
 		}
 		log.Infof("Extracted AI model from branch: %s", aiModel)
 	}
@@ -708,6 +726,7 @@ func (a *Agent) FixPRFromReviewCommentWithAI(ctx context.Context, event *github.
 	}
 
 	// 4. 初始化 code client
+	trackWorkspace(ctx, ws)
 	code, err := a.sessionManager.GetSession(ws)
 	if err != nil {
 		log.Errorf("failed to get code client for PR fix from review comment: %v", err)
@@ -715,33 +734,18 @@ func (a *Agent) FixPRFromReviewCommentWithAI(ctx context.Context, event *github.
 	}
 
 	// 4. 构建 prompt，包含评论上下文和命令参数
-	var prompt string
-
-	// 获取行范围信息
-	startLine := event.Comment.GetStartLine()
-	endLine := event.Comment.GetLine()
-
-	var lineRangeInfo string
-	if startLine != 0 && endLine != 0 && startLine != endLine {
-		// 多行选择
-		lineRangeInfo = fmt.Sprintf("行号范围：%d-%d", startLine, endLine)
-	} else {
-		// 单行
-		lineRangeInfo = fmt.Sprintf("行号：%d", endLine)
-	}
-
-	commentContext := fmt.Sprintf("代码行评论：%s\n文件：%s\n%s",
-		event.Comment.GetBody(),
-		event.Comment.GetPath(),
-		lineRangeInfo)
-
-	if args != "" {
-		prompt = fmt.Sprintf("根据代码行评论和指令修复：\n\n%s\n\n指令：%s", commentContext, args)
-	} else {
-		prompt = fmt.Sprintf("根据代码行评论修复：\n\n%s", commentContext)
+	commentPrompt, err := a.renderPrompt(ctx, prompt.ReviewComment, prompt.Data{
+		Mode:          "Fix",
+		Args:          args,
+		PR:            prompt.NewPullRequest(pr),
+		ReviewComment: prompt.NewReviewComment(event.Comment),
+	}, pr.GetBase().GetRepo())
+	if err != nil {
+		log.Errorf("Failed to build prompt: %v", err)
+		return err
 	}
 
-	resp, err := a.promptWithRetry(ctx, code, prompt, 3)
+	resp, err := promptWithRetry(ctx, code, commentPrompt, 3)
 	if err != nil {
 		log.Errorf("Failed to prompt for PR fix from review comment: %v", err)
 		return err
@@ -756,17 +760,23 @@ func (a *Agent) FixPRFromReviewCommentWithAI(ctx context.Context, event *github.
 	log.Infof("PR Fix from Review Comment Output length: %d", len(output))
 	log.Debugf("PR Fix from Review Comment Output: %s", string(output))
 
+	// 任务已被取消时不再提交改动
+	if err := checkCancelled(ctx); err != nil {
+		return err
+	}
+
 	// 5. 提交变更并更新 PR
 	result := &models.ExecutionResult{
 		Output: string(output),
+		Usage:  usage.Total(ctx),
 	}
-	if err := a.github.CommitAndPush(ws, result, code); err != nil {
+	if err := a.github.CommitAndPush(ctx, ws, result, code, a.messages(ctx, ws.Org, ws.Repo)); err != nil {
 		log.Errorf("Failed to commit and push for PR fix from review comment: %v", err)
 		return err
 	}
 
 	// 6. 回复原始评论
-	commentBody := string(output)
+	commentBody := string(output) + usage.Footer(ctx)
 	if err = a.github.ReplyToReviewComment(pr, event.Comment.GetID(), commentBody); err != nil {
 		log.Errorf("failed to reply to review comment for fix: %v", err)
 		return err
@@ -797,8 +807,8 @@ func (a *Agent) ProcessPRFromReviewWithTriggerUserAndAI(ctx context.Context, eve
 		branchName := pr.GetHead().GetRef()
 		aiModel = a.workspace.ExtractAIModelFromBranch(branchName)
 		if aiModel == "" {
-			// 如果无法从分支中提取，使用默认配置
-			aiModel = a.config.CodeProvider
+			// 如果无法从分支中提取，使用仓库或全局的默认配置
+			aiModel = a.defaultAIModel(ctx, pr.GetBase().GetRepo())
 		}
 		log.Infof("Extracted AI model from branch: %s", aiModel)
 	}
@@ -825,6 +835,7 @@ func (a *Agent) ProcessPRFromReviewWithTriggerUserAndAI(ctx context.Context, eve
 	}
 
 	// 5. 初始化 code client
+	trackWorkspace(ctx, ws)
 	code, err := a.sessionManager.GetSession(ws)
 	if err != nil {
 		log.Errorf("failed to get code client for PR batch processing from review: %v", err)
@@ -832,53 +843,26 @@ func (a *Agent) ProcessPRFromReviewWithTriggerUserAndAI(ctx context.Context, eve
 	}
 
 	// 6. 构建批量处理的 prompt，包含所有 review comments 和位置信息
-	var commentContexts []string
-
-	// 添加 review body 作为总体上下文
-	if event.Review.GetBody() != "" {
-		commentContexts = append(commentContexts, fmt.Sprintf("Review 总体说明：%s", event.Review.GetBody()))
-	}
-
-	// 为每个 comment 构建详细上下文
-	for i, comment := range reviewComments {
-		startLine := comment.GetStartLine()
-		endLine := comment.GetLine()
-		filePath := comment.GetPath()
-		commentBody := comment.GetBody()
-
-		var lineRangeInfo string
-		if startLine != 0 && endLine != 0 && startLine != endLine {
-			// 多行选择
-			lineRangeInfo = fmt.Sprintf("行号范围：%d-%d", startLine, endLine)
-		} else {
-			// 单行
-			lineRangeInfo = fmt.Sprintf("行号：%d", endLine)
-		}
-
-		commentContext := fmt.Sprintf("评论 %d：\n文件：%s\n%s\n内容：%s",
-			i+1, filePath, lineRangeInfo, commentBody)
-		commentContexts = append(commentContexts, commentContext)
-	}
-
-	// 组合所有上下文
-	allComments := strings.Join(commentContexts, "\n\n")
-
-	var prompt string
+	mode := "Fix"
 	if command == "/continue" {
-		if args != "" {
-			prompt = fmt.Sprintf("请根据以下 PR Review 的批量评论和指令继续处理代码：\n\n%s\n\n指令：%s\n\n请一次性处理所有评论中提到的问题，回复要简洁明了。", allComments, args)
-		} else {
-			prompt = fmt.Sprintf("请根据以下 PR Review 的批量评论继续处理代码：\n\n%s\n\n请一次性处理所有评论中提到的问题，回复要简洁明了。", allComments)
-		}
-	} else { // /fix
-		if args != "" {
-			prompt = fmt.Sprintf("请根据以下 PR Review 的批量评论和指令修复代码问题：\n\n%s\n\n指令：%s\n\n请一次性修复所有评论中提到的问题，回复要简洁明了。", allComments, args)
-		} else {
-			prompt = fmt.Sprintf("请根据以下 PR Review 的批量评论修复代码问题：\n\n%s\n\n请一次性修复所有评论中提到的问题，回复要简洁明了。", allComments)
-		}
+		mode = "Continue"
+	}
+	review := prompt.Review{Body: event.Review.GetBody()}
+	for _, comment := range reviewComments {
+		review.Comments = append(review.Comments, prompt.NewReviewComment(comment))
+	}
+	batchPrompt, err := a.renderPrompt(ctx, prompt.ReviewBatch, prompt.Data{
+		Mode:   mode,
+		Args:   args,
+		PR:     prompt.NewPullRequest(pr),
+		Review: review,
+	}, pr.GetBase().GetRepo())
+	if err != nil {
+		log.Errorf("Failed to build prompt: %v", err)
+		return err
 	}
 
-	resp, err := a.promptWithRetry(ctx, code, prompt, 3)
+	resp, err := promptWithRetry(ctx, code, batchPrompt, 3)
 	if err != nil {
 		log.Errorf("Failed to prompt for PR batch processing from review: %v", err)
 		return err
@@ -893,11 +877,17 @@ func (a *Agent) ProcessPRFromReviewWithTriggerUserAndAI(ctx context.Context, eve
 	log.Infof("PR Batch Processing from Review Output length: %d", len(output))
 	log.Debugf("PR Batch Processing from Review Output: %s", string(output))
 
+	// 任务已被取消时不再提交改动
+	if err := checkCancelled(ctx); err != nil {
+		return err
+	}
+
 	// 7. 提交变更并更新 PR
 	result := &models.ExecutionResult{
 		Output: string(output),
+		Usage:  usage.Total(ctx),
 	}
-	if err := a.github.CommitAndPush(ws, result, code); err != nil {
+	if err := a.github.CommitAndPush(ctx, ws, result, code, a.messages(ctx, ws.Org, ws.Repo)); err != nil {
 		log.Errorf("Failed to commit and push for PR batch processing from review: %v", err)
 		return err
 	}
@@ -918,6 +908,8 @@ func (a *Agent) ProcessPRFromReviewWithTriggerUserAndAI(ctx context.Context, eve
 		}
 	}
 
+	responseBody += usage.Footer(ctx)
+
 	if err = a.github.CreatePullRequestComment(pr, responseBody); err != nil {
 		log.Errorf("failed to create PR comment for batch processing result: %v", err)
 		return err
@@ -932,11 +924,60 @@ func (a *Agent) ReviewPR(ctx context.Context, pr *github.PullRequest) error {
 	log := xlog.NewWith(ctx)
 
 	log.Infof("Starting PR review for PR #%d", pr.GetNumber())
-	// TODO: 实现 PR 审查逻辑
+	if err := a.reviewer.ReviewPR(ctx, pr); err != nil {
+		log.Errorf("PR review failed for PR #%d: %v", pr.GetNumber(), err)
+		return err
+	}
 	log.Infof("PR review completed for PR #%d", pr.GetNumber())
 	return nil
 }
 
+// ReReviewPR PR 有新提交后只审查上次审查之后的变更
+func (a *Agent) ReReviewPR(ctx context.Context, pr *github.PullRequest, before string) error {
+	log := xlog.NewWith(ctx)
+
+	log.Infof("Starting incremental PR review for PR #%d", pr.GetNumber())
+	if err := a.reviewer.ReReviewPR(ctx, pr, before); err != nil {
+		log.Errorf("Incremental PR review failed for PR #%d: %v", pr.GetNumber(), err)
+		return err
+	}
+	log.Infof("Incremental PR review completed for PR #%d", pr.GetNumber())
+	return nil
+}
+
+// defaultAIModel 返回仓库默认使用的 AI 模型：仓库级配置优先，其次为全局配置
+func (a *Agent) defaultAIModel(ctx context.Context, repo *github.Repository) string {
+	return a.repoConfigs.Get(ctx, repo.GetOwner().GetLogin(), repo.GetName()).Provider(a.config.CodeProvider)
+}
+
+// messages 返回仓库配置的语言的文本
+func (a *Agent) messages(ctx context.Context, org, repo string) *locale.Messages {
+	return a.prompts.Messages(a.repoConfigs.Get(ctx, org, repo))
+}
+
+// InvalidateRepoConfig 推送到默认分支后清除仓库级配置缓存
+func (a *Agent) InvalidateRepoConfig(event *github.PushEvent) {
+	a.repoConfigs.InvalidateOnPush(event)
+}
+
+// ShouldAnalyzePush 判断 push 事件是否需要进行推送后分析
+func (a *Agent) ShouldAnalyzePush(event *github.PushEvent) bool {
+	return a.reviewer.ShouldAnalyzePush(event)
+}
+
+// AnalyzePush 分析推送到受保护分支的提交，发现问题时创建 Issue
+func (a *Agent) AnalyzePush(ctx context.Context, event *github.PushEvent) error {
+	log := xlog.NewWith(ctx)
+
+	log.Infof("Starting push analysis for %s %s", event.GetRepo().GetFullName(), event.GetRef())
+	if err := a.reviewer.AnalyzePush(ctx, event); err != nil {
+		log.Errorf("Push analysis failed for %s %s: %v", event.GetRepo().GetFullName(), event.GetRef(), err)
+		return err
+	}
+	log.Infof("Push analysis completed for %s %s", event.GetRepo().GetFullName(), event.GetRef())
+	return nil
+}
+
 // CleanupAfterPRClosed PR 关闭后清理工作区、映射、执行的code session和删除CodeAgent创建的分支
 func (a *Agent) CleanupAfterPRClosed(ctx context.Context, pr *github.PullRequest) error {
 	log := xlog.NewWith(ctx)
@@ -1000,13 +1041,16 @@ func (a *Agent) CleanupAfterPRClosed(ctx context.Context, pr *github.PullRequest
 }
 
 // promptWithRetry 带重试机制的 prompt 调用
-func (a *Agent) promptWithRetry(ctx context.Context, code code.Code, prompt string, maxRetries int) (*code.Response, error) {
+func promptWithRetry(ctx context.Context, codeClient code.Code, prompt string, maxRetries int) (*code.Response, error) {
 	log := xlog.NewWith(ctx)
 	var lastErr error
 
 	for attempt := 1; attempt <= maxRetries; attempt++ {
 		log.Debugf("Prompt attempt %d/%d", attempt, maxRetries)
-		resp, err := code.Prompt(prompt)
+		if err := checkCancelled(ctx); err != nil {
+			return nil, err
+		}
+		resp, err := codeClient.Prompt(ctx, prompt, code.PromptOptions{})
 		if err == nil {
 			log.Infof("Prompt succeeded on attempt %d", attempt)
 			return resp, nil
@@ -1025,73 +1069,14 @@ func (a *Agent) promptWithRetry(ctx context.Context, code code.Code, prompt stri
 			// 等待一段时间后重试
 			sleepDuration := time.Duration(attempt) * 500 * time.Millisecond
 			log.Infof("Waiting %v before retry", sleepDuration)
-			time.Sleep(sleepDuration)
+			select {
+			case <-ctx.Done():
+				return nil, checkCancelled(ctx)
+			case <-time.After(sleepDuration):
+			}
 		}
 	}
 
 	log.Errorf("All prompt attempts failed after %d attempts", maxRetries)
 	return nil, fmt.Errorf("failed after %d attempts, last error: %w", maxRetries, lastErr)
 }
-
-// formatHistoricalComments 格式化历史评论，用于构建上下文
-func (a *Agent) formatHistoricalComments(allComments *models.PRAllComments, currentCommentID int64) string {
-	var contextParts []string
-
-	// 添加 PR 描述
-	if allComments.PRBody != "" {
-		contextParts = append(contextParts, fmt.Sprintf("## PR 描述\n%s", allComments.PRBody))
-	}
-
-	// 添加历史的一般评论（排除当前评论）
-	if len(allComments.IssueComments) > 0 {
-		var historyComments []string
-		for _, comment := range allComments.IssueComments {
-			if comment.GetID() != currentCommentID {
-				user := comment.GetUser().GetLogin()
-				body := comment.GetBody()
-				createdAt := comment.GetCreatedAt().Format("2006-01-02 15:04:05")
-				historyComments = append(historyComments, fmt.Sprintf("**%s** (%s):\n%s", user, createdAt, body))
-			}
-		}
-		if len(historyComments) > 0 {
-			contextParts = append(contextParts, fmt.Sprintf("## 历史评论\n%s", strings.Join(historyComments, "\n\n")))
-		}
-	}
-
-	// 添加代码行评论
-	if len(allComments.ReviewComments) > 0 {
-		var reviewComments []string
-		for _, comment := range allComments.ReviewComments {
-			if comment.GetID() != currentCommentID {
-				user := comment.GetUser().GetLogin()
-				body := comment.GetBody()
-				path := comment.GetPath()
-				line := comment.GetLine()
-				createdAt := comment.GetCreatedAt().Format("2006-01-02 15:04:05")
-				reviewComments = append(reviewComments, fmt.Sprintf("**%s** (%s) - %s:%d:\n%s", user, createdAt, path, line, body))
-			}
-		}
-		if len(reviewComments) > 0 {
-			contextParts = append(contextParts, fmt.Sprintf("## 代码行评论\n%s", strings.Join(reviewComments, "\n\n")))
-		}
-	}
-
-	// 添加 Review 评论
-	if len(allComments.Reviews) > 0 {
-		var reviews []string
-		for _, review := range allComments.Reviews {
-			if review.GetBody() != "" {
-				user := review.GetUser().GetLogin()
-				body := review.GetBody()
-				state := review.GetState()
-				createdAt := review.GetSubmittedAt().Format("2006-01-02 15:04:05")
-				reviews = append(reviews, fmt.Sprintf("**%s** (%s) - %s:\n%s", user, createdAt, state, body))
-			}
-		}
-		if len(reviews) > 0 {
-			contextParts = append(contextParts, fmt.Sprintf("## Review 评论\n%s", strings.Join(reviews, "\n\n")))
-		}
-	}
-
-	return strings.Join(contextParts, "\n\n")
-}
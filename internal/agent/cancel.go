@@ -0,0 +1,197 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/qiniu/codeagent/internal/code"
+	ghclient "github.com/qiniu/codeagent/internal/github"
+	"github.com/qiniu/codeagent/internal/locale"
+	"github.com/qiniu/codeagent/internal/queue"
+	"github.com/qiniu/codeagent/internal/scheduler"
+	"github.com/qiniu/codeagent/internal/workspace"
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/qiniu/x/xlog"
+)
+
+// runningTask 正在执行的任务
+type runningTask struct {
+	jobID  string
+	key    scheduler.Key
+	cancel context.CancelCauseFunc
+
+	mu          sync.Mutex
+	workspace   *models.Workspace
+	commentID   int64
+	cancelled   bool
+	cancelledBy string
+}
+
+func (t *runningTask) setWorkspace(ws *models.Workspace) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.workspace = ws
+}
+
+func (t *runningTask) getWorkspace() *models.Workspace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.workspace
+}
+
+func (t *runningTask) setCommentID(id int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.commentID = id
+}
+
+// cancelState 返回任务是否被取消以及取消人
+func (t *runningTask) cancelState() (bool, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cancelled, t.cancelledBy
+}
+
+// matches 判断任务是否属于指定的 Issue/PR，/code 任务在创建 PR 后也可以通过 PR 编号匹配
+func (t *runningTask) matches(org, repo string, number int) bool {
+	if t.key.Org != org || t.key.Repo != repo {
+		return false
+	}
+	if t.key.Number == number {
+		return true
+	}
+	ws := t.getWorkspace()
+	return ws != nil && ws.PRNumber == number
+}
+
+type taskContextKey struct{}
+
+// trackWorkspace 记录当前任务使用的工作空间，取消任务时据此终止 provider 进程并回滚改动
+func trackWorkspace(ctx context.Context, ws *models.Workspace) {
+	if task, ok := ctx.Value(taskContextKey{}).(*runningTask); ok {
+		task.setWorkspace(ws)
+	}
+}
+
+// checkCancelled 任务被取消（或服务关闭）时停止后续的提交和评论
+func checkCancelled(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("task aborted: %w", context.Cause(ctx))
+	}
+	return nil
+}
+
+// taskRegistry 记录正在执行的任务，用于 /cancel 查找并中止
+type taskRegistry struct {
+	mu    sync.Mutex
+	tasks map[string]*runningTask
+}
+
+func newTaskRegistry() *taskRegistry {
+	return &taskRegistry{tasks: make(map[string]*runningTask)}
+}
+
+// start 注册任务并返回可被取消的 context
+func (r *taskRegistry) start(ctx context.Context, jobID string, key scheduler.Key) (context.Context, *runningTask) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	task := &runningTask{jobID: jobID, key: key, cancel: cancel}
+	ctx = context.WithValue(ctx, taskContextKey{}, task)
+
+	r.mu.Lock()
+	r.tasks[jobID] = task
+	r.mu.Unlock()
+	return ctx, task
+}
+
+func (r *taskRegistry) finish(jobID string) {
+	r.mu.Lock()
+	task, ok := r.tasks[jobID]
+	delete(r.tasks, jobID)
+	r.mu.Unlock()
+
+	if ok {
+		task.cancel(nil)
+	}
+}
+
+// cancel 取消指定 Issue/PR 上所有正在执行的任务
+func (r *taskRegistry) cancel(org, repo string, number int, user string) []*runningTask {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var cancelled []*runningTask
+	for _, task := range r.tasks {
+		if !task.matches(org, repo, number) {
+			continue
+		}
+		task.mu.Lock()
+		task.cancelled = true
+		task.cancelledBy = user
+		task.mu.Unlock()
+		task.cancel(queue.ErrCancelled)
+		cancelled = append(cancelled, task)
+	}
+	return cancelled
+}
+
+// cancelTasks 取消任务并终止对应的 provider 进程，返回取消的任务数
+func cancelTasks(ctx context.Context, tasks *taskRegistry, sessions *code.SessionManager, org, repo string, number int, user string) int {
+	xl := xlog.NewWith(ctx)
+
+	cancelled := tasks.cancel(org, repo, number, user)
+	for _, task := range cancelled {
+		xl.Infof("Cancelling job %s on %s/%s#%d requested by %s", task.jobID, org, repo, number, user)
+		if ws := task.getWorkspace(); ws != nil {
+			if err := sessions.CancelSession(ws); err != nil {
+				xl.Warnf("Failed to kill provider process for job %s: %v", task.jobID, err)
+			}
+		}
+	}
+	return len(cancelled)
+}
+
+// finishCancelledTask 回滚被取消任务在工作空间中未提交的改动，并使用 msgs 的语言更新状态评论
+func finishCancelledTask(ctx context.Context, task *runningTask, github *ghclient.Client, workspaceManager *workspace.Manager, msgs *locale.Messages) error {
+	xl := xlog.NewWith(ctx)
+	// 任务的 context 已被取消，清理工作使用不会被取消的 context
+	ctx = context.WithoutCancel(ctx)
+	_, user := task.cancelState()
+
+	body := fmt.Sprintf(msgs.CancelledBy, user)
+	if ws := task.getWorkspace(); ws != nil {
+		if err := workspaceManager.DiscardUncommittedChanges(ws); err != nil {
+			xl.Errorf("Failed to revert workspace for cancelled job %s: %v", task.jobID, err)
+			body += " " + msgs.CancelRevertFailed
+		} else {
+			body += " " + msgs.CancelReverted
+		}
+	}
+
+	task.mu.Lock()
+	commentID := task.commentID
+	task.mu.Unlock()
+
+	if github != nil && task.key.Org != "" && task.key.Number > 0 {
+		if commentID != 0 {
+			if err := github.UpdateComment(ctx, task.key.Org, task.key.Repo, commentID, body); err != nil {
+				xl.Warnf("Failed to update status comment for cancelled job %s: %v", task.jobID, err)
+			}
+		} else if _, err := github.CreateComment(ctx, task.key.Org, task.key.Repo, task.key.Number, body); err != nil {
+			xl.Warnf("Failed to comment on cancelled job %s: %v", task.jobID, err)
+		}
+	}
+
+	return fmt.Errorf("cancelled by %s: %w", user, queue.ErrCancelled)
+}
+
+// CancelTasks 取消指定 Issue/PR 上排队中和正在执行的任务，返回取消的任务数
+func (a *Agent) CancelTasks(ctx context.Context, org, repo string, number int, user string) int {
+	return a.queued.cancel(ctx, org, repo, number, user) + cancelTasks(ctx, a.tasks, a.sessionManager, org, repo, number, user)
+}
+
+// CancelTasks 取消指定 Issue/PR 上排队中和正在执行的任务，返回取消的任务数
+func (a *EnhancedAgent) CancelTasks(ctx context.Context, org, repo string, number int, user string) int {
+	return a.queued.cancel(ctx, org, repo, number, user) + cancelTasks(ctx, a.tasks, a.sessionManager, org, repo, number, user)
+}
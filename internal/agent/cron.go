@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/internal/cron"
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/qiniu/x/reqid"
+	"github.com/qiniu/x/xlog"
+)
+
+// StartSchedules 启动配置的定时任务，每次触发时为每个仓库生成 schedule 事件并加入任务队列
+func (a *EnhancedAgent) StartSchedules(schedules []config.ScheduleConfig) error {
+	c := cron.New()
+	for _, sc := range schedules {
+		sc := sc
+		if sc.Name == "" {
+			sc.Name = sc.Task
+		}
+		loc := time.UTC
+		if sc.Timezone != "" {
+			var err error
+			if loc, err = time.LoadLocation(sc.Timezone); err != nil {
+				return fmt.Errorf("invalid timezone for schedule %s: %w", sc.Name, err)
+			}
+		}
+		if err := c.Add(sc.Name, sc.Cron, loc, func(ctx context.Context) {
+			a.runSchedule(ctx, sc)
+		}); err != nil {
+			return fmt.Errorf("invalid cron expression for schedule %s: %w", sc.Name, err)
+		}
+	}
+	if c.Len() == 0 {
+		return nil
+	}
+
+	c.Start()
+	a.cron = c
+	return nil
+}
+
+// runSchedule 触发一次定时任务，配置了多个仓库时每个仓库入队一个任务
+func (a *EnhancedAgent) runSchedule(ctx context.Context, sc config.ScheduleConfig) {
+	repos := sc.Repos
+	if len(repos) == 0 {
+		repos = []string{""}
+	}
+	for _, fullName := range repos {
+		if ctx.Err() != nil {
+			return
+		}
+		a.runScheduleForRepo(ctx, sc, fullName)
+	}
+}
+
+func (a *EnhancedAgent) runScheduleForRepo(ctx context.Context, sc config.ScheduleConfig, fullName string) {
+	now := time.Now()
+	traceID := fmt.Sprintf("schedule-%s-%d", sc.Name, now.Unix())
+	ctx = reqid.NewContext(ctx, traceID)
+	xl := xlog.NewWith(ctx)
+
+	event := &models.ScheduleContext{
+		BaseContext: models.BaseContext{
+			Type:      models.EventSchedule,
+			Action:    "scheduled",
+			Timestamp: now,
+		},
+		Cron:   sc.Cron,
+		Name:   sc.Name,
+		Task:   sc.Task,
+		Inputs: sc.Inputs,
+	}
+	if fullName != "" {
+		org, repo, ok := strings.Cut(fullName, "/")
+		if !ok {
+			xl.Errorf("Invalid repository %q in schedule %s, expected org/repo", fullName, sc.Name)
+			return
+		}
+		event.Repository = &github.Repository{
+			Owner:    &github.User{Login: github.String(org)},
+			Name:     github.String(repo),
+			FullName: github.String(fullName),
+		}
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		xl.Errorf("Failed to marshal schedule %s event: %v", sc.Name, err)
+		return
+	}
+	// 与 webhook 事件一样经过任务队列，受并发限制并在重启后恢复；用量按定时任务名称记录
+	job, err := a.queue.Enqueue(JobGitHubEvent, traceID, JobPayload{
+		EventType: string(models.EventSchedule),
+		Event:     data,
+		Command:   "schedule:" + sc.Name,
+	})
+	if err != nil {
+		xl.Errorf("Failed to enqueue schedule %s for %s: %v", sc.Name, fullName, err)
+		return
+	}
+	xl.Infof("Schedule %s queued as job %s", sc.Name, job.ID)
+}
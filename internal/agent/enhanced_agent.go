@@ -2,17 +2,27 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/qiniu/codeagent/internal/code"
 	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/internal/cron"
 	"github.com/qiniu/codeagent/internal/events"
 	ghclient "github.com/qiniu/codeagent/internal/github"
 	"github.com/qiniu/codeagent/internal/interaction"
+	"github.com/qiniu/codeagent/internal/locale"
 	"github.com/qiniu/codeagent/internal/mcp"
 	"github.com/qiniu/codeagent/internal/mcp/servers"
 	"github.com/qiniu/codeagent/internal/modes"
+	"github.com/qiniu/codeagent/internal/permission"
+	"github.com/qiniu/codeagent/internal/prompt"
+	"github.com/qiniu/codeagent/internal/queue"
+	"github.com/qiniu/codeagent/internal/repoconfig"
+	"github.com/qiniu/codeagent/internal/scheduler"
+	"github.com/qiniu/codeagent/internal/usage"
 	"github.com/qiniu/codeagent/internal/workspace"
 	"github.com/qiniu/codeagent/pkg/models"
 
@@ -35,14 +45,24 @@ type EnhancedAgent struct {
 	mcpManager     mcp.MCPManager
 	mcpClient      mcp.MCPClient
 	taskFactory    *interaction.TaskFactory
+	scheduler      *scheduler.Scheduler
+	tasks          *taskRegistry
+	queue          *queue.Queue
+	queued         *queuedJobs
+	usage          *usage.Store
+	cron           *cron.Cron
+	repoConfigs    *repoconfig.Store
+	prompts        *prompt.Templates
+	loops          *scheduler.LoopGuard
+	permissions    *permission.Checker
 }
 
 // NewEnhancedAgent 创建增强版Agent
-func NewEnhancedAgent(cfg *config.Config, workspaceManager *workspace.Manager) (*EnhancedAgent, error) {
+func NewEnhancedAgent(cfg *config.Config, workspaceManager *workspace.Manager, jobQueue *queue.Queue, usageStore *usage.Store, auth *ghclient.Auth) (*EnhancedAgent, error) {
 	xl := xlog.New("")
 	
 	// 1. 初始化GitHub客户端
-	githubClient, err := ghclient.NewClient(cfg)
+	githubClient, err := ghclient.NewClient(cfg, auth)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create GitHub client: %w", err)
 	}
@@ -71,13 +91,27 @@ func NewEnhancedAgent(cfg *config.Config, workspaceManager *workspace.Manager) (
 	// 5. 初始化SessionManager
 	sessionManager := code.NewSessionManager(cfg)
 	
-	// 6. 初始化模式管理器
-	modeManager := modes.NewManager()
+	// 6. 初始化模式管理器，仓库级配置（.codeagent.yaml）覆盖全局配置
+	repoConfigs := repoconfig.NewStore(githubClient)
+	modeManager := modes.NewManager(repoConfigs)
+	
+	prompts, err := prompt.Load(cfg.Prompts.Dir, cfg.Locale)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load prompt templates: %w", err)
+	}
 	
 	// 注册处理器（按优先级顺序）
-	tagHandler := modes.NewTagHandler(githubClient, workspaceManager, mcpClient, sessionManager)
-	agentHandler := modes.NewAgentHandler(githubClient, workspaceManager, mcpClient)
-	reviewHandler := modes.NewReviewHandler(githubClient, workspaceManager, mcpClient)
+	suggester := &suggester{
+		config:         cfg,
+		github:         githubClient,
+		workspace:      workspaceManager,
+		sessionManager: sessionManager,
+		repoConfigs:    repoConfigs,
+		prompts:        prompts,
+	}
+	tagHandler := modes.NewTagHandler(githubClient, workspaceManager, mcpClient, sessionManager, repoConfigs, prompts, suggester)
+	agentHandler := modes.NewAgentHandler(githubClient, workspaceManager, mcpClient, sessionManager, repoConfigs, prompts, tagHandler, cfg.AutoProcess)
+	reviewHandler := modes.NewReviewHandler(githubClient, workspaceManager, mcpClient, sessionManager, repoConfigs, prompts, cfg.PushAnalysis)
 	
 	modeManager.RegisterHandler(tagHandler)
 	modeManager.RegisterHandler(agentHandler)
@@ -96,7 +130,16 @@ func NewEnhancedAgent(cfg *config.Config, workspaceManager *workspace.Manager) (
 		mcpManager:     mcpManager,
 		mcpClient:      mcpClient,
 		taskFactory:    taskFactory,
+		scheduler:      scheduler.New(cfg.Concurrency),
+		loops:          scheduler.NewLoopGuard(cfg.LoopGuard),
+		permissions:    permission.NewChecker(cfg.Permissions, githubClient),
+		tasks:          newTaskRegistry(),
+		queue:          jobQueue,
+		usage:          usageStore,
+		repoConfigs:    repoConfigs,
+		prompts:        prompts,
 	}
+	agent.queued = newQueuedJobs(jobQueue, githubClient, agent.messages)
 	
 	xl.Infof("Enhanced Agent initialized with %d MCP servers and %d mode handlers", 
 		len(mcpManager.GetServers()), modeManager.GetHandlerCount())
@@ -122,6 +165,13 @@ func (a *EnhancedAgent) ProcessGitHubEvent(ctx context.Context, eventType string
 	xl.Infof("Parsed event type: %s for repository: %s", 
 		githubCtx.GetEventType(), githubCtx.GetRepository().GetFullName())
 	
+	// 推送到默认分支后仓库级配置可能已变化
+	if pushCtx, ok := githubCtx.(*models.PushContext); ok {
+		if raw, ok := pushCtx.RawEvent.(*github.PushEvent); ok {
+			a.repoConfigs.InvalidateOnPush(raw)
+		}
+	}
+	
 	// 2. 选择合适的处理器
 	handler, err := a.modeManager.SelectHandler(ctx, githubCtx)
 	if err != nil {
@@ -132,6 +182,32 @@ func (a *EnhancedAgent) ProcessGitHubEvent(ctx context.Context, eventType string
 	xl.Infof("Selected handler with mode: %s (priority: %d)", 
 		handler.GetMode(), handler.GetPriority())
 	
+	task, _ := ctx.Value(taskContextKey{}).(*runningTask)
+	
+	// 命令执行前检查触发用户的权限，没有权限时答复后结束，不计入任务次数
+	if _, ok := models.HasCommand(githubCtx, code.Providers()); ok {
+		var number int
+		if task != nil {
+			number = task.key.Number
+		}
+		repo := githubCtx.GetRepository()
+		err := a.CheckPermission(ctx, repo.GetOwner().GetLogin(), repo.GetName(), number, githubCtx.GetSender().GetLogin())
+		var denied *permission.DeniedError
+		if errors.As(err, &denied) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check permission: %w", err)
+		}
+	}
+	
+	// 只统计选中了处理器的事件，普通评论不计入任务次数
+	if task != nil {
+		if err := checkLoopGuard(ctx, a.loops, a.github, a.messages(ctx, task.key.Org, task.key.Repo), task.key, a.config.LoopGuard); err != nil {
+			return err
+		}
+	}
+	
 	// 3. 执行处理
 	err = handler.Execute(ctx, githubCtx)
 	if err != nil {
@@ -161,9 +237,11 @@ func (a *EnhancedAgent) ProcessIssueCommentEnhanced(ctx context.Context, event *
 		return fmt.Errorf("invalid context type for issue comment")
 	}
 	
-	// 2. 创建进度评论管理器
+	// 2. 创建进度评论管理器，使用仓库配置的语言
+	repo := issueCommentCtx.GetRepository()
+	repoConfig := a.repoConfigs.Get(ctx, repo.GetOwner().GetLogin(), repo.GetName())
 	pcm := interaction.NewProgressCommentManager(a.github, 
-		issueCommentCtx.GetRepository(), issueCommentCtx.Issue.GetNumber())
+		repo, issueCommentCtx.Issue.GetNumber(), a.prompts.Messages(repoConfig))
 	
 	// 3. 创建任务列表
 	tasks := a.taskFactory.CreateIssueProcessingTasks()
@@ -191,11 +269,14 @@ func (a *EnhancedAgent) ProcessIssueCommentEnhanced(ctx context.Context, event *
 		// 最终化失败结果
 		failureResult := &models.ProgressExecutionResult{
 			Success: false,
+			Cancelled: errors.Is(context.Cause(ctx), queue.ErrCancelled),
 			Error:   err.Error(),
 			Duration: time.Since(pcm.GetTracker().StartTime),
+			Usage:    usage.Total(ctx),
 		}
 		
-		if finalizeErr := pcm.FinalizeComment(ctx, failureResult); finalizeErr != nil {
+		// 任务被取消时 ctx 已失效，仍需要更新进度评论
+		if finalizeErr := pcm.FinalizeComment(context.WithoutCancel(ctx), failureResult); finalizeErr != nil {
 			xl.Errorf("Failed to finalize failure comment: %v", finalizeErr)
 		}
 		
@@ -247,6 +328,7 @@ func (a *EnhancedAgent) executeIssueProcessingWithProgress(
 	if ws == nil {
 		return nil, fmt.Errorf("failed to create workspace")
 	}
+	trackWorkspace(ctx, ws)
 	
 	// 更新MCP上下文
 	mcpCtx.WorkspacePath = ws.Path
@@ -265,8 +347,35 @@ func (a *EnhancedAgent) executeIssueProcessingWithProgress(
 		return nil, err
 	}
 	
-	// 这里可以集成AI代码生成逻辑
-	// TODO: 实现AI代码生成，使用MCP工具进行文件操作
+	codeClient, err := a.sessionManager.GetSession(ws)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get code session: %w", err)
+	}
+	
+	repo := issueCtx.GetRepository()
+	repoConfig := a.repoConfigs.Get(ctx, repo.GetOwner().GetLogin(), repo.GetName())
+	codePrompt, err := a.prompts.Render(prompt.IssueCode, prompt.Data{Issue: prompt.NewIssue(issueCtx.Issue)}, repoConfig)
+	if err != nil {
+		return nil, err
+	}
+	
+	// AI 执行过程中的步骤（如编辑的文件）实时展示在进度评论中
+	resp, err := codeClient.Prompt(ctx, codePrompt, code.PromptOptions{
+		OnEvent: func(event code.Event) {
+			if err := pcm.HandleCodeEvent(ctx, event); err != nil {
+				xl.Warnf("Failed to update progress for code event: %v", err)
+			}
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to prompt for code generation: %w", err)
+	}
+	
+	output, err := io.ReadAll(resp.Out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read code generation output: %w", err)
+	}
+	xl.Infof("Code generation completed, output length: %d", len(output))
 	
 	if err := pcm.UpdateTask(ctx, "generate-code", models.TaskStatusCompleted); err != nil {
 		return nil, err
@@ -280,12 +389,17 @@ func (a *EnhancedAgent) executeIssueProcessingWithProgress(
 	// 使用现有的提交逻辑
 	execResult := &models.ExecutionResult{
 		Success:      true,
-		Output:       "Code generated successfully",
-		FilesChanged: []string{}, // TODO: 从MCP工具调用中获取
+		Output:       string(output),
+		FilesChanged: pcm.GetEditedFiles(),
+		Usage:        usage.Total(ctx),
 		Duration:     time.Since(pcm.GetTracker().StartTime),
 	}
 	
-	if err := a.github.CommitAndPush(ws, execResult, nil); err != nil {
+	if err := checkCancelled(ctx); err != nil {
+		return nil, err
+	}
+	
+	if err := a.github.CommitAndPush(ctx, ws, execResult, nil, a.prompts.Messages(repoConfig)); err != nil {
 		return nil, fmt.Errorf("failed to commit and push: %w", err)
 	}
 	
@@ -298,7 +412,7 @@ func (a *EnhancedAgent) executeIssueProcessingWithProgress(
 		return nil, err
 	}
 	
-	pr, err := a.github.CreatePullRequest(ws)
+	pr, err := a.github.CreatePullRequest(ws, a.prompts.Messages(repoConfig))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create PR: %w", err)
 	}
@@ -313,6 +427,7 @@ func (a *EnhancedAgent) executeIssueProcessingWithProgress(
 		Output:         execResult.Output,
 		FilesChanged:   execResult.FilesChanged,
 		Duration:       time.Since(pcm.GetTracker().StartTime),
+		Usage:          usage.Total(ctx),
 		Summary:        fmt.Sprintf("Successfully implemented Issue #%d", issueCtx.Issue.GetNumber()),
 		BranchName:     ws.Branch,
 		PullRequestURL: pr.GetHTMLURL(),
@@ -327,6 +442,11 @@ func (a *EnhancedAgent) GetMCPManager() mcp.MCPManager {
 	return a.mcpManager
 }
 
+// messages 返回仓库使用的语言的文本
+func (a *EnhancedAgent) messages(ctx context.Context, org, repo string) *locale.Messages {
+	return a.prompts.Messages(a.repoConfigs.Get(ctx, org, repo))
+}
+
 // GetModeManager 获取模式管理器（用于外部扩展）
 func (a *EnhancedAgent) GetModeManager() *modes.Manager {
 	return a.modeManager
@@ -336,6 +456,11 @@ func (a *EnhancedAgent) GetModeManager() *modes.Manager {
 func (a *EnhancedAgent) Shutdown(ctx context.Context) error {
 	xl := xlog.NewWith(ctx)
 	
+	// 停止定时任务
+	if a.cron != nil {
+		a.cron.Stop()
+	}
+	
 	// 关闭MCP管理器
 	if err := a.mcpManager.Shutdown(ctx); err != nil {
 		xl.Errorf("Failed to shutdown MCP manager: %v", err)
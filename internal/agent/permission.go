@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	ghclient "github.com/qiniu/codeagent/internal/github"
+	"github.com/qiniu/codeagent/internal/locale"
+	"github.com/qiniu/codeagent/internal/permission"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/qiniu/x/xlog"
+)
+
+// IsAgent 判断用户是否为 CodeAgent 自己或其他机器人
+func (a *Agent) IsAgent(ctx context.Context, user *github.User) bool {
+	return a.github.IsAgent(ctx, user)
+}
+
+// CheckPermission 检查 user 是否可以在 org/repo 中触发命令。没有权限时在 Issue/PR（number 大于 0）上礼貌地答复，
+// 并返回 *permission.DeniedError；无法查询权限时返回其他错误
+func (a *Agent) CheckPermission(ctx context.Context, org, repo string, number int, user string) error {
+	return checkPermission(ctx, a.permissions, a.github, a.messages(ctx, org, repo), org, repo, number, user)
+}
+
+// IsAgent 判断用户是否为 CodeAgent 自己或其他机器人
+func (a *EnhancedAgent) IsAgent(ctx context.Context, user *github.User) bool {
+	return a.github.IsAgent(ctx, user)
+}
+
+// CheckPermission 与 Agent.CheckPermission 相同
+func (a *EnhancedAgent) CheckPermission(ctx context.Context, org, repo string, number int, user string) error {
+	return checkPermission(ctx, a.permissions, a.github, a.messages(ctx, org, repo), org, repo, number, user)
+}
+
+func checkPermission(ctx context.Context, permissions *permission.Checker, github *ghclient.Client, msgs *locale.Messages, org, repo string, number int, user string) error {
+	xl := xlog.NewWith(ctx)
+
+	err := permissions.Check(ctx, org, repo, user)
+	var denied *permission.DeniedError
+	if !errors.As(err, &denied) {
+		return err
+	}
+	xl.Warnf("Rejected command on %s/%s#%d: %v", org, repo, number, denied)
+
+	if number > 0 {
+		if _, err := github.CreateComment(ctx, org, repo, number, fmt.Sprintf(msgs.PermissionDenied, user)); err != nil {
+			xl.Errorf("Failed to post permission comment on %s/%s#%d: %v", org, repo, number, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,214 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/qiniu/codeagent/internal/config"
+	ghclient "github.com/qiniu/codeagent/internal/github"
+	"github.com/qiniu/codeagent/internal/locale"
+	"github.com/qiniu/codeagent/internal/queue"
+	"github.com/qiniu/codeagent/internal/scheduler"
+
+	"github.com/qiniu/x/xlog"
+)
+
+// jobTarget 从原始 webhook 事件中提取仓库、Issue/PR 编号和 GitHub App 安装实例
+type jobTarget struct {
+	Repository struct {
+		Name  string `json:"name"`
+		Owner struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	} `json:"repository"`
+	Issue *struct {
+		Number int `json:"number"`
+	} `json:"issue"`
+	PullRequest *struct {
+		Number int `json:"number"`
+	} `json:"pull_request"`
+	Sender struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+	// 通过 GitHub App 投递的事件包含安装实例
+	Installation *struct {
+		ID int64 `json:"id"`
+	} `json:"installation"`
+}
+
+// schedulerKey 解析任务对应的调度维度
+func schedulerKey(job *queue.Job) (scheduler.Key, error) {
+	var payload JobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return scheduler.Key{}, fmt.Errorf("failed to unmarshal job payload: %w", err)
+	}
+
+	var target jobTarget
+	if err := json.Unmarshal(payload.Event, &target); err != nil {
+		return scheduler.Key{}, fmt.Errorf("failed to unmarshal job event: %w", err)
+	}
+
+	key := scheduler.Key{
+		Org:  target.Repository.Owner.Login,
+		Repo: target.Repository.Name,
+	}
+	if target.Issue != nil {
+		key.Number = target.Issue.Number
+	} else if target.PullRequest != nil {
+		key.Number = target.PullRequest.Number
+	}
+	return key, nil
+}
+
+// admitJob 在调度器中为任务获取执行槽位，没有空闲槽位时任务留在队列中。
+// 无法解析调度维度的任务直接放行，由 ExecuteJob 报告错误
+func admitJob(sched *scheduler.Scheduler, job *queue.Job) (func(), bool) {
+	key, err := schedulerKey(job)
+	if err != nil {
+		return func() {}, true
+	}
+	return sched.TryAcquire(key)
+}
+
+// queuedComment 排队任务的状态评论
+type queuedComment struct {
+	id       int64
+	position int
+}
+
+// queuedJobs 管理在队列中等待的任务：发布并更新排队评论，以及取消排队中的任务
+type queuedJobs struct {
+	queue    *queue.Queue
+	github   *ghclient.Client
+	messages func(ctx context.Context, org, repo string) *locale.Messages
+
+	// mu 在调用 GitHub API 期间保持，保证任务开始或被取消后不会再发布排队评论
+	mu       sync.Mutex
+	comments map[string]*queuedComment
+}
+
+// newQueuedJobs 创建排队任务管理，messages 返回仓库评论使用的语言
+func newQueuedJobs(q *queue.Queue, github *ghclient.Client, messages func(ctx context.Context, org, repo string) *locale.Messages) *queuedJobs {
+	return &queuedJobs{
+		queue:    q,
+		github:   github,
+		messages: messages,
+		comments: make(map[string]*queuedComment),
+	}
+}
+
+// notify 在 Issue/PR 上发布排队评论，排队位置变化时更新
+func (j *queuedJobs) notify(ctx context.Context, job *queue.Job, position int) {
+	xl := xlog.NewWith(ctx)
+	key, err := schedulerKey(job)
+	if err != nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if current, ok := j.queue.Get(job.ID); !ok || current.Status != queue.StatusQueued {
+		return
+	}
+	comment := j.comments[job.ID]
+	if comment != nil && comment.position == position {
+		return
+	}
+	xl.Infof("Job %s waiting in queue for %s/%s#%d, position %d", job.ID, key.Org, key.Repo, key.Number, position)
+	if j.github == nil || key.Org == "" || key.Number == 0 {
+		return
+	}
+
+	body := fmt.Sprintf(j.messages(ctx, key.Org, key.Repo).QueueWaiting, position)
+	if comment == nil {
+		created, err := j.github.CreateComment(ctx, key.Org, key.Repo, key.Number, body)
+		if err != nil {
+			xl.Warnf("Failed to create queue comment: %v", err)
+			return
+		}
+		j.comments[job.ID] = &queuedComment{id: created.GetID(), position: position}
+		return
+	}
+	if err := j.github.UpdateComment(ctx, key.Org, key.Repo, comment.id, body); err != nil {
+		xl.Warnf("Failed to update queue comment: %v", err)
+		return
+	}
+	comment.position = position
+}
+
+// start 任务开始执行时将排队评论更新为已开始，返回评论 ID（没有排队评论时为 0）
+func (j *queuedJobs) start(ctx context.Context, job *queue.Job, key scheduler.Key) int64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	comment, ok := j.comments[job.ID]
+	if !ok {
+		return 0
+	}
+	delete(j.comments, job.ID)
+
+	if err := j.github.UpdateComment(ctx, key.Org, key.Repo, comment.id, j.messages(ctx, key.Org, key.Repo).QueueStarted); err != nil {
+		xl := xlog.NewWith(ctx)
+		xl.Warnf("Failed to update queue comment: %v", err)
+	}
+	return comment.id
+}
+
+// cancel 取消指定 Issue/PR 上排队中的任务并更新排队评论，返回取消的任务数
+func (j *queuedJobs) cancel(ctx context.Context, org, repo string, number int, user string) int {
+	xl := xlog.NewWith(ctx)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	cancelled := 0
+	for _, job := range j.queue.Pending() {
+		key, err := schedulerKey(job)
+		if err != nil || key.Org != org || key.Repo != repo || key.Number != number {
+			continue
+		}
+		ok, err := j.queue.Cancel(job.ID, fmt.Errorf("cancelled by %s: %w", user, queue.ErrCancelled))
+		if err != nil {
+			xl.Errorf("Failed to cancel queued job %s: %v", job.ID, err)
+		}
+		if !ok {
+			continue
+		}
+		xl.Infof("Cancelled queued job %s on %s/%s#%d requested by %s", job.ID, org, repo, number, user)
+		cancelled++
+
+		body := fmt.Sprintf(j.messages(ctx, org, repo).CancelledBy, user)
+		if comment, ok := j.comments[job.ID]; ok {
+			delete(j.comments, job.ID)
+			if err := j.github.UpdateComment(ctx, org, repo, comment.id, body); err != nil {
+				xl.Warnf("Failed to update queue comment for cancelled job %s: %v", job.ID, err)
+			}
+		} else if j.github != nil {
+			if _, err := j.github.CreateComment(ctx, org, repo, number, body); err != nil {
+				xl.Warnf("Failed to comment on cancelled job %s: %v", job.ID, err)
+			}
+		}
+	}
+	return cancelled
+}
+
+// checkLoopGuard 检查任务所在的 Issue/PR 是否超过了任务次数限制，超过时使用 msgs 的语言在 Issue/PR 上答复一次并返回错误
+func checkLoopGuard(ctx context.Context, guard *scheduler.LoopGuard, github *ghclient.Client, msgs *locale.Messages, key scheduler.Key, limits config.LoopGuardConfig) error {
+	ok, notify := guard.Allow(key)
+	if ok {
+		return nil
+	}
+	xl := xlog.NewWith(ctx)
+	xl.Warnf("Loop guard: %s/%s#%d reached %d runs within %s, skipping", key.Org, key.Repo, key.Number, limits.MaxRuns, limits.Window)
+
+	if notify && github != nil {
+		body := fmt.Sprintf(msgs.LoopGuard, limits.MaxRuns)
+		if _, err := github.CreateComment(ctx, key.Org, key.Repo, key.Number, body); err != nil {
+			xl.Warnf("Failed to create loop guard comment: %v", err)
+		}
+	}
+	return fmt.Errorf("loop guard: %s/%s#%d reached %d runs within %s", key.Org, key.Repo, key.Number, limits.MaxRuns, limits.Window)
+}
@@ -0,0 +1,185 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qiniu/codeagent/internal/code"
+	"github.com/qiniu/codeagent/internal/config"
+	ghclient "github.com/qiniu/codeagent/internal/github"
+	"github.com/qiniu/codeagent/internal/prompt"
+	"github.com/qiniu/codeagent/internal/repoconfig"
+	"github.com/qiniu/codeagent/internal/usage"
+	"github.com/qiniu/codeagent/internal/workspace"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/qiniu/x/xlog"
+)
+
+// suggester 执行 /suggest，Agent 直接调用，EnhancedAgent 通过 TagHandler 调用
+type suggester struct {
+	config         *config.Config
+	github         *ghclient.Client
+	workspace      *workspace.Manager
+	sessionManager *code.SessionManager
+	repoConfigs    *repoconfig.Store
+	prompts        *prompt.Templates
+}
+
+// SuggestPRFromReviewCommentWithAI 根据代码行评论生成修改，以 suggestion 代码块回复评论，
+// 由评审者在 GitHub 上一键应用，不会提交到 PR 分支
+func (a *Agent) SuggestPRFromReviewCommentWithAI(ctx context.Context, event *github.PullRequestReviewCommentEvent, aiModel, args string) error {
+	return a.suggester.SuggestPRFromReviewCommentWithAI(ctx, event, aiModel, args)
+}
+
+// SuggestPRFromReviewCommentWithAI 实现 modes.ReviewCommentSuggester
+func (s *suggester) SuggestPRFromReviewCommentWithAI(ctx context.Context, event *github.PullRequestReviewCommentEvent, aiModel, args string) error {
+	log := xlog.NewWith(ctx)
+
+	pr := event.PullRequest
+	comment := event.Comment
+	path := comment.GetPath()
+	endLine := comment.GetLine()
+	startLine := comment.GetStartLine()
+	if startLine == 0 {
+		startLine = endLine
+	}
+	log.Infof("Suggest change for PR #%d %s:%d-%d with AI model %s and args: %s", pr.GetNumber(), path, startLine, endLine, aiModel, args)
+	repo := pr.GetBase().GetRepo()
+	repoConfig := s.repoConfigs.Get(ctx, repo.GetOwner().GetLogin(), repo.GetName())
+	msgs := s.prompts.Messages(repoConfig)
+
+	// 只能对变更后文件中的行给出建议
+	if endLine == 0 || comment.GetSide() == "LEFT" {
+		return s.replySuggestion(ctx, pr, comment.GetID(), msgs.SuggestNewLinesOnly)
+	}
+
+	if aiModel == "" {
+		aiModel = s.workspace.ExtractAIModelFromBranch(pr.GetHead().GetRef())
+		if aiModel == "" {
+			aiModel = repoConfig.Provider(s.config.CodeProvider)
+		}
+	}
+
+	ws := s.workspace.GetOrCreateWorkspaceForPRWithAI(pr, aiModel)
+	if ws == nil {
+		return fmt.Errorf("failed to get or create workspace for PR suggestion from review comment")
+	}
+	if err := s.github.PullLatestChanges(ws, pr); err != nil {
+		log.Errorf("Failed to pull latest changes: %v", err)
+	}
+
+	trackWorkspace(ctx, ws)
+	codeClient, err := s.sessionManager.GetSession(ws)
+	if err != nil {
+		log.Errorf("failed to get code client for PR suggestion from review comment: %v", err)
+		return err
+	}
+
+	filePath := filepath.Join(ws.Path, path)
+	original, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	// 建议只通过评论回复，AI 在工作空间中的改动在结束后丢弃
+	defer func() {
+		if err := s.workspace.DiscardUncommittedChanges(ws); err != nil {
+			log.Errorf("Failed to discard suggested changes: %v", err)
+		}
+	}()
+
+	suggestPrompt, err := s.prompts.Render(prompt.Suggest, prompt.Data{
+		Args:          args,
+		PR:            prompt.NewPullRequest(pr),
+		ReviewComment: prompt.NewReviewComment(comment),
+	}, repoConfig)
+	if err != nil {
+		log.Errorf("Failed to build prompt for PR suggestion from review comment: %v", err)
+		return err
+	}
+
+	resp, err := promptWithRetry(ctx, codeClient, suggestPrompt, 3)
+	if err != nil {
+		log.Errorf("Failed to prompt for PR suggestion from review comment: %v", err)
+		return err
+	}
+	if _, err := io.Copy(io.Discard, resp.Out); err != nil {
+		log.Errorf("Failed to read output for PR suggestion from review comment: %v", err)
+		return err
+	}
+
+	if err := checkCancelled(ctx); err != nil {
+		return err
+	}
+
+	updated, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	replacement, err := suggestedLines(splitLines(string(original)), splitLines(string(updated)), startLine, endLine)
+	if err != nil {
+		log.Warnf("Cannot post suggestion for %s:%d-%d: %v", path, startLine, endLine, err)
+		return s.replySuggestion(ctx, pr, comment.GetID(), fmt.Sprintf(msgs.SuggestFailed, err))
+	}
+
+	return s.replySuggestion(ctx, pr, comment.GetID(), formatSuggestion(replacement))
+}
+
+func (s *suggester) replySuggestion(ctx context.Context, pr *github.PullRequest, commentID int64, body string) error {
+	if err := s.github.ReplyToReviewComment(pr, commentID, body+usage.Footer(ctx)); err != nil {
+		return fmt.Errorf("failed to reply to review comment for suggestion: %w", err)
+	}
+	return nil
+}
+
+// splitLines 按行拆分文件内容，忽略末尾换行产生的空行
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// suggestedLines 计算修改后替换原文件第 start-end 行（从 1 开始，包含 end）的内容；
+// 修改超出该范围时无法用 suggestion 表达，返回错误
+func suggestedLines(original, updated []string, start, end int) ([]string, error) {
+	if start < 1 || end < start || end > len(original) {
+		return nil, fmt.Errorf("lines %d-%d are out of range", start, end)
+	}
+
+	prefix := 0
+	for prefix < len(original) && prefix < len(updated) && original[prefix] == updated[prefix] {
+		prefix++
+	}
+	if prefix == len(original) && prefix == len(updated) {
+		return nil, fmt.Errorf("no changes were made")
+	}
+	suffix := 0
+	for suffix < len(original)-prefix && suffix < len(updated)-prefix &&
+		original[len(original)-1-suffix] == updated[len(updated)-1-suffix] {
+		suffix++
+	}
+
+	// 改动必须位于评论的行范围内
+	if prefix < start-1 || suffix < len(original)-end {
+		return nil, fmt.Errorf("the change touches lines outside %d-%d", start, end)
+	}
+	return updated[start-1 : len(updated)-(len(original)-end)], nil
+}
+
+// formatSuggestion 生成 GitHub suggested change 代码块，内容包含 ``` 时使用更长的围栏
+func formatSuggestion(lines []string) string {
+	content := strings.Join(lines, "\n")
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	if len(lines) == 0 {
+		return fence + "suggestion\n" + fence
+	}
+	return fence + "suggestion\n" + content + "\n" + fence
+}
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/qiniu/codeagent/internal/locale"
+	"github.com/qiniu/codeagent/internal/queue"
+	"github.com/qiniu/codeagent/internal/scheduler"
+	"github.com/qiniu/codeagent/internal/usage"
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/qiniu/x/xlog"
+)
+
+// recordUsage 持久化任务的 token 用量和运行时长，任务没有调用 AI 时跳过
+func recordUsage(ctx context.Context, store *usage.Store, job *queue.Job, key scheduler.Key, tracker *usage.Tracker, defaultProvider string) {
+	xl := xlog.NewWith(ctx)
+
+	total := tracker.Total()
+	duration := tracker.Duration()
+	if store == nil || (total == nil && duration == 0) {
+		return
+	}
+	if total == nil {
+		total = &models.TokenUsage{}
+	}
+
+	var payload JobPayload
+	var target jobTarget
+	if err := json.Unmarshal(job.Payload, &payload); err == nil {
+		json.Unmarshal(payload.Event, &target)
+	}
+
+	entry := usage.Entry{
+		JobID:    job.ID,
+		Org:      key.Org,
+		Repo:     key.Repo,
+		Number:   key.Number,
+		User:     target.Sender.Login,
+		Command:  payload.Command,
+		Provider: payload.AIModel,
+		Usage:    *total,
+		Duration: duration,
+	}
+	if entry.User == "" {
+		entry.User = payload.TriggerUser
+	}
+	if entry.Command == "" {
+		entry.Command = job.Type
+	}
+	if entry.Provider == "" {
+		entry.Provider = defaultProvider
+	}
+
+	if err := store.Add(entry); err != nil {
+		xl.Errorf("Failed to record usage for job %s: %v", job.ID, err)
+		return
+	}
+	xl.Infof("Recorded usage for job %s: %s, ran %s", job.ID, total.Summary(), duration.Round(time.Second))
+}
+
+// PostComment 在 Issue/PR 上发表评论，用于 webhook 直接答复未入队的命令
+func (a *Agent) PostComment(ctx context.Context, org, repo string, number int, body string) error {
+	_, err := a.github.CreateComment(ctx, org, repo, number, body)
+	return err
+}
+
+// PostComment 在 Issue/PR 上发表评论，用于 webhook 直接答复未入队的命令
+func (a *EnhancedAgent) PostComment(ctx context.Context, org, repo string, number int, body string) error {
+	_, err := a.github.CreateComment(ctx, org, repo, number, body)
+	return err
+}
+
+// Messages 返回仓库使用的语言的文本，用于 webhook 直接答复未入队的命令
+func (a *Agent) Messages(ctx context.Context, org, repo string) *locale.Messages {
+	return a.messages(ctx, org, repo)
+}
+
+// Messages 返回仓库使用的语言的文本，用于 webhook 直接答复未入队的命令
+func (a *EnhancedAgent) Messages(ctx context.Context, org, repo string) *locale.Messages {
+	return a.messages(ctx, org, repo)
+}
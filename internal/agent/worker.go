@@ -0,0 +1,389 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/qiniu/codeagent/internal/config"
+	ghclient "github.com/qiniu/codeagent/internal/github"
+	"github.com/qiniu/codeagent/internal/queue"
+	"github.com/qiniu/codeagent/internal/usage"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/qiniu/x/log"
+	"github.com/qiniu/x/reqid"
+	"github.com/qiniu/x/xlog"
+)
+
+// 任务类型，对应 webhook 中触发的各类命令
+const (
+	JobIssueCode             = "issue_code"
+	JobPRContinue            = "pr_continue"
+	JobPRFix                 = "pr_fix"
+	JobReviewCommentContinue = "review_comment_continue"
+	JobReviewCommentFix      = "review_comment_fix"
+	JobReviewCommentSuggest  = "review_comment_suggest"
+	JobPRReviewBatch         = "pr_review_batch"
+	JobPRReview              = "pr_review"
+	JobPRReReview            = "pr_re_review"
+	JobPushAnalysis          = "push_analysis"
+	JobGitHubEvent           = "github_event"
+)
+
+// JobPayload 任务负载，保存原始事件和解析后的命令参数，保证重启后可以重新执行
+type JobPayload struct {
+	EventType   string          `json:"event_type,omitempty"`
+	Event       json.RawMessage `json:"event"`
+	Command     string          `json:"command,omitempty"`
+	AIModel     string          `json:"ai_model,omitempty"`
+	Args        string          `json:"args,omitempty"`
+	TriggerUser string          `json:"trigger_user,omitempty"`
+}
+
+// queueNotifyDelay 任务在队列中等待超过该时间后才通知排队位置，很快就开始执行的任务不发布排队评论
+const queueNotifyDelay = 10 * time.Second
+
+// JobRunner 执行队列中的任务
+type JobRunner interface {
+	// AdmitJob 判断任务现在能否开始，能开始时占用并发槽位并返回释放函数；
+	// 不能开始的任务留在队列中，不占用 worker
+	AdmitJob(job *queue.Job) (release func(), ok bool)
+	// ExecuteJob 执行任务
+	ExecuteJob(ctx context.Context, job *queue.Job) error
+	// JobQueued 任务在队列中等待时定期调用，position 为排队位置，从 1 开始
+	JobQueued(ctx context.Context, job *queue.Job, position int)
+}
+
+// WorkerPool 从持久化队列中取出任务并执行，只取出并发限制允许立即开始的任务
+type WorkerPool struct {
+	queue  *queue.Queue
+	cfg    config.QueueConfig
+	runner JobRunner
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewWorkerPool 创建 worker 池
+func NewWorkerPool(q *queue.Queue, cfg config.QueueConfig, runner JobRunner) *WorkerPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WorkerPool{
+		queue:  q,
+		cfg:    cfg,
+		runner: runner,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start 启动 worker 和已完成任务的定期清理
+func (p *WorkerPool) Start() {
+	workers := p.cfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	log.Infof("Starting %d job workers", workers)
+
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.work(i)
+	}
+
+	go p.pruneRoutine()
+	go p.notifyRoutine()
+}
+
+// Stop 停止接收新任务并等待运行中的任务退出；
+// 因关闭而中断的任务保持 running 状态，下次启动时会被恢复
+func (p *WorkerPool) Stop(ctx context.Context) error {
+	p.cancel()
+	p.queue.Close()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for job workers: %w", ctx.Err())
+	}
+}
+
+func (p *WorkerPool) work(id int) {
+	defer p.wg.Done()
+
+	for {
+		var release func()
+		job, err := p.queue.DequeueFunc(p.ctx, func(job *queue.Job) bool {
+			var ok bool
+			release, ok = p.runner.AdmitJob(job)
+			return ok
+		})
+		if err != nil {
+			if release != nil {
+				release()
+			}
+			if errors.Is(err, queue.ErrClosed) || p.ctx.Err() != nil {
+				return
+			}
+			log.Errorf("Worker %d failed to dequeue job: %v", id, err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		p.run(job)
+		// 释放并发槽位后唤醒 worker 重新检查因并发限制留在队列中的任务
+		release()
+		p.queue.Wake()
+	}
+}
+
+func (p *WorkerPool) run(job *queue.Job) {
+	traceID := job.TraceID
+	if traceID == "" {
+		traceID = job.ID
+	}
+	ctx := reqid.NewContext(p.ctx, traceID)
+	xl := xlog.NewWith(ctx)
+	xl.Infof("Starting job %s (%s), attempt %d", job.ID, job.Type, job.Attempts)
+
+	err := p.safeExecute(ctx, job)
+	if p.ctx.Err() != nil {
+		xl.Warnf("Job %s (%s) interrupted by shutdown, it will be resumed after restart", job.ID, job.Type)
+		return
+	}
+
+	if err != nil {
+		xl.Errorf("Job %s (%s) failed: %v", job.ID, job.Type, err)
+	} else {
+		xl.Infof("Job %s (%s) completed successfully", job.ID, job.Type)
+	}
+	if err := p.queue.Complete(job.ID, err); err != nil {
+		xl.Errorf("Failed to update job %s status: %v", job.ID, err)
+	}
+}
+
+// safeExecute 执行任务，将 panic 转换为任务失败，避免 worker 退出
+func (p *WorkerPool) safeExecute(ctx context.Context, job *queue.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return p.runner.ExecuteJob(ctx, job)
+}
+
+func (p *WorkerPool) pruneRoutine() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			if n := p.queue.Prune(p.cfg.Retention); n > 0 {
+				log.Infof("Pruned %d finished jobs", n)
+			}
+		}
+	}
+}
+
+// notifyRoutine 定期通知在队列中等待的任务的排队位置
+func (p *WorkerPool) notifyRoutine() {
+	ticker := time.NewTicker(queueNotifyDelay)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			for i, job := range p.queue.Pending() {
+				if time.Since(job.CreatedAt) < queueNotifyDelay {
+					continue
+				}
+				traceID := job.TraceID
+				if traceID == "" {
+					traceID = job.ID
+				}
+				p.runner.JobQueued(reqid.NewContext(p.ctx, traceID), job, i+1)
+			}
+		}
+	}
+}
+
+// decodeJob 解析任务负载，并将原始事件解析到 event 中
+func decodeJob(job *queue.Job, event interface{}) (*JobPayload, error) {
+	var payload JobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job payload: %w", err)
+	}
+	if event != nil {
+		if err := json.Unmarshal(payload.Event, event); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal job event: %w", err)
+		}
+	}
+	return &payload, nil
+}
+
+// registerInstallation 记录任务事件所属的 GitHub App 安装实例，任务访问该组织的仓库时使用安装实例的令牌
+func registerInstallation(client *ghclient.Client, job *queue.Job) {
+	var payload JobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return
+	}
+	var target jobTarget
+	if err := json.Unmarshal(payload.Event, &target); err != nil || target.Installation == nil {
+		return
+	}
+	client.SetInstallation(target.Repository.Owner.Login, target.Installation.ID)
+}
+
+// AdmitJob 任务受并发限制暂时不能开始时留在队列中
+func (a *Agent) AdmitJob(job *queue.Job) (func(), bool) {
+	return admitJob(a.scheduler, job)
+}
+
+// JobQueued 在 Issue/PR 上发布或更新排队评论
+func (a *Agent) JobQueued(ctx context.Context, job *queue.Job, position int) {
+	a.queued.notify(ctx, job, position)
+}
+
+// ExecuteJob 根据任务类型分发到对应的处理方法
+func (a *Agent) ExecuteJob(ctx context.Context, job *queue.Job) error {
+	key, err := schedulerKey(job)
+	if err != nil {
+		return err
+	}
+	registerInstallation(a.github, job)
+	commentID := a.queued.start(ctx, job, key)
+	if err := checkLoopGuard(ctx, a.loops, a.github, a.messages(ctx, key.Org, key.Repo), key, a.config.LoopGuard); err != nil {
+		return err
+	}
+	ctx, task := a.tasks.start(ctx, job.ID, key)
+	defer a.tasks.finish(job.ID)
+	task.setCommentID(commentID)
+
+	tracker := &usage.Tracker{}
+	ctx = usage.WithTracker(ctx, tracker)
+	defer recordUsage(ctx, a.usage, job, key, tracker, a.config.CodeProvider)
+
+	err = a.executeJob(ctx, job)
+	if cancelled, _ := task.cancelState(); cancelled {
+		return finishCancelledTask(ctx, task, a.github, a.workspace, a.messages(ctx, key.Org, key.Repo))
+	}
+	return err
+}
+
+func (a *Agent) executeJob(ctx context.Context, job *queue.Job) error {
+	switch job.Type {
+	case JobIssueCode, JobPRContinue, JobPRFix:
+		var event github.IssueCommentEvent
+		payload, err := decodeJob(job, &event)
+		if err != nil {
+			return err
+		}
+		switch job.Type {
+		case JobIssueCode:
+			return a.ProcessIssueCommentWithAI(ctx, &event, payload.AIModel, payload.Args)
+		case JobPRContinue:
+			return a.ContinuePRWithArgsAndAI(ctx, &event, payload.AIModel, payload.Args)
+		default:
+			return a.FixPRWithArgsAndAI(ctx, &event, payload.AIModel, payload.Args)
+		}
+	case JobReviewCommentContinue, JobReviewCommentFix, JobReviewCommentSuggest:
+		var event github.PullRequestReviewCommentEvent
+		payload, err := decodeJob(job, &event)
+		if err != nil {
+			return err
+		}
+		switch job.Type {
+		case JobReviewCommentContinue:
+			return a.ContinuePRFromReviewCommentWithAI(ctx, &event, payload.AIModel, payload.Args)
+		case JobReviewCommentSuggest:
+			return a.SuggestPRFromReviewCommentWithAI(ctx, &event, payload.AIModel, payload.Args)
+		default:
+			return a.FixPRFromReviewCommentWithAI(ctx, &event, payload.AIModel, payload.Args)
+		}
+	case JobPRReviewBatch:
+		var event github.PullRequestReviewEvent
+		payload, err := decodeJob(job, &event)
+		if err != nil {
+			return err
+		}
+		return a.ProcessPRFromReviewWithTriggerUserAndAI(ctx, &event, payload.Command, payload.AIModel, payload.Args, payload.TriggerUser)
+	case JobPRReview, JobPRReReview:
+		var event github.PullRequestEvent
+		if _, err := decodeJob(job, &event); err != nil {
+			return err
+		}
+		if job.Type == JobPRReview {
+			return a.ReviewPR(ctx, event.PullRequest)
+		}
+		return a.ReReviewPR(ctx, event.PullRequest, event.GetBefore())
+	case JobPushAnalysis:
+		var event github.PushEvent
+		if _, err := decodeJob(job, &event); err != nil {
+			return err
+		}
+		return a.AnalyzePush(ctx, &event)
+	default:
+		return fmt.Errorf("unsupported job type: %s", job.Type)
+	}
+}
+
+// AdmitJob 任务受并发限制暂时不能开始时留在队列中
+func (a *EnhancedAgent) AdmitJob(job *queue.Job) (func(), bool) {
+	return admitJob(a.scheduler, job)
+}
+
+// JobQueued 在 Issue/PR 上发布或更新排队评论
+func (a *EnhancedAgent) JobQueued(ctx context.Context, job *queue.Job, position int) {
+	a.queued.notify(ctx, job, position)
+}
+
+// ExecuteJob 执行 Enhanced 模式下入队的 GitHub 事件
+func (a *EnhancedAgent) ExecuteJob(ctx context.Context, job *queue.Job) error {
+	if job.Type != JobGitHubEvent {
+		return fmt.Errorf("unsupported job type: %s", job.Type)
+	}
+
+	key, err := schedulerKey(job)
+	if err != nil {
+		return err
+	}
+	registerInstallation(a.github, job)
+	commentID := a.queued.start(ctx, job, key)
+	ctx, task := a.tasks.start(ctx, job.ID, key)
+	defer a.tasks.finish(job.ID)
+	task.setCommentID(commentID)
+
+	tracker := &usage.Tracker{}
+	ctx = usage.WithTracker(ctx, tracker)
+	defer recordUsage(ctx, a.usage, job, key, tracker, a.config.CodeProvider)
+
+	err = a.executeJob(ctx, job)
+	if cancelled, _ := task.cancelState(); cancelled {
+		return finishCancelledTask(ctx, task, a.github, a.workspace, a.messages(ctx, key.Org, key.Repo))
+	}
+	return err
+}
+
+func (a *EnhancedAgent) executeJob(ctx context.Context, job *queue.Job) error {
+	var rawEvent interface{}
+	payload, err := decodeJob(job, &rawEvent)
+	if err != nil {
+		return err
+	}
+	return a.ProcessGitHubEvent(ctx, payload.EventType, rawEvent)
+}
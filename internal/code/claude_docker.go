@@ -2,11 +2,14 @@ package code
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/qiniu/codeagent/internal/config"
 	"github.com/qiniu/codeagent/pkg/models"
@@ -16,6 +19,10 @@ import (
 // claudeCode Docker 实现
 type claudeCode struct {
 	containerName string
+	timeout       time.Duration // 单次 prompt 的默认超时时间
+
+	mu  sync.Mutex
+	cmd *exec.Cmd // 正在执行的 docker exec 进程
 }
 
 func NewClaudeDocker(workspace *models.Workspace, cfg *config.Config) (Code, error) {
@@ -29,6 +36,7 @@ func NewClaudeDocker(workspace *models.Workspace, cfg *config.Config) (Code, err
 		log.Infof("Found existing container: %s, reusing it", containerName)
 		return &claudeCode{
 			containerName: containerName,
+			timeout:       cfg.Claude.Timeout,
 		}, nil
 	}
 
@@ -107,23 +115,27 @@ func NewClaudeDocker(workspace *models.Workspace, cfg *config.Config) (Code, err
 
 	return &claudeCode{
 		containerName: containerName,
+		timeout:       cfg.Claude.Timeout,
 	}, nil
 }
 
-func (c *claudeCode) Prompt(message string) (*Response, error) {
+func (c *claudeCode) Prompt(ctx context.Context, message string, opts PromptOptions) (*Response, error) {
 	args := []string{
 		"exec",
 		c.containerName,
 		"claude",
 		"--dangerously-skip-permissions",
-		"-p",
-		message,
 	}
+	args = append(args, claudeStreamArgs...)
+	args = append(args, claudeOptionArgs(opts)...)
+	args = append(args, "-p", message)
 
 	// 打印调试信息
 	log.Infof("Executing claude command: docker %s", strings.Join(args, " "))
 
-	cmd := exec.Command("docker", args...)
+	timeout := promptTimeout(opts, c.timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	cmd := exec.CommandContext(ctx, "docker", args...)
 
 	// 捕获stderr用于调试
 	var stderr bytes.Buffer
@@ -131,6 +143,7 @@ func (c *claudeCode) Prompt(message string) (*Response, error) {
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
+		cancel()
 		log.Errorf("Failed to start claude command: %v", err)
 		log.Errorf("Stderr: %s", stderr.String())
 		return nil, err
@@ -138,14 +151,31 @@ func (c *claudeCode) Prompt(message string) (*Response, error) {
 
 	// 启动命令
 	if err := cmd.Start(); err != nil {
+		cancel()
 		log.Errorf("Failed to start claude command: %v", err)
 		log.Errorf("Stderr: %s", stderr.String())
 		return nil, fmt.Errorf("failed to execute claude: %w", err)
 	}
 
-	// 不等待命令完成，让调用方处理输出流
-	// 错误处理将在调用方读取时进行
-	return &Response{Out: stdout}, nil
+	c.mu.Lock()
+	c.cmd = cmd
+	c.mu.Unlock()
+
+	// 不等待命令完成，让调用方处理输出流，执行过程中的事件实时回调给 opts.OnEvent
+	// 超时（默认 claude.timeout）或 ctx 取消时进程被终止，读取输出时返回错误
+	out := &streamOutput{out: stdout, cmd: cmd, ctx: ctx, cancel: cancel}
+	parser := &claudeStreamParser{root: "/workspace", onEvent: recordingEvents(ctx, opts.OnEvent)}
+	return &Response{Out: newClaudeStreamReader(out, parser)}, nil
+}
+
+// Cancel 终止正在执行的 docker exec 进程并删除容器
+func (c *claudeCode) Cancel() error {
+	c.mu.Lock()
+	if c.cmd != nil && c.cmd.Process != nil {
+		c.cmd.Process.Kill()
+	}
+	c.mu.Unlock()
+	return c.Close()
 }
 
 func (c *claudeCode) Close() error {
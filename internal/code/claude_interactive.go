@@ -21,6 +21,7 @@ import (
 // claudeInteractive 交互式Claude Docker实现
 type claudeInteractive struct {
 	containerName string
+	timeout       time.Duration // 单次 prompt 的默认超时时间
 	cmd           *exec.Cmd
 	stdin         io.WriteCloser
 	stdout        io.ReadCloser
@@ -50,7 +51,7 @@ func NewClaudeInteractive(workspace *models.Workspace, cfg *config.Config) (Code
 	if isContainerRunning(containerName) {
 		log.Infof("Found existing interactive container: %s, reusing it", containerName)
 		// 连接到现有容器
-		return connectToExistingContainer(containerName, workspace)
+		return connectToExistingContainer(containerName, workspace, cfg)
 	}
 
 	// 确保路径存在
@@ -151,6 +152,7 @@ func NewClaudeInteractive(workspace *models.Workspace, cfg *config.Config) (Code
 
 	claudeInteractive := &claudeInteractive{
 		containerName: containerName,
+		timeout:       cfg.Claude.Timeout,
 		cmd:           cmd,
 		stdin:         stdin,
 		stdout:        stdout,
@@ -179,7 +181,7 @@ func (c *claudeInteractive) waitForReady() error {
 }
 
 // connectToExistingContainer 连接到现有的交互式容器
-func connectToExistingContainer(containerName string, workspace *models.Workspace) (Code, error) {
+func connectToExistingContainer(containerName string, workspace *models.Workspace, cfg *config.Config) (Code, error) {
 	// 通过docker exec连接到现有容器
 	args := []string{
 		"exec",
@@ -228,6 +230,7 @@ func connectToExistingContainer(containerName string, workspace *models.Workspac
 
 	return &claudeInteractive{
 		containerName: containerName,
+		timeout:       cfg.Claude.Timeout,
 		cmd:           cmd,
 		stdin:         stdin,
 		stdout:        stdout,
@@ -238,7 +241,7 @@ func connectToExistingContainer(containerName string, workspace *models.Workspac
 	}, nil
 }
 
-func (c *claudeInteractive) Prompt(message string) (*Response, error) {
+func (c *claudeInteractive) Prompt(ctx context.Context, message string, opts PromptOptions) (*Response, error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
@@ -246,6 +249,11 @@ func (c *claudeInteractive) Prompt(message string) (*Response, error) {
 		return nil, fmt.Errorf("interactive session is closed")
 	}
 
+	// 交互式会话在启动时已确定参数，无法按次限制轮数和工具
+	if opts.MaxTurns > 0 || len(opts.AllowedTools) > 0 {
+		log.Warnf("Interactive Claude session does not support max turns or allowed tools, ignoring these options")
+	}
+
 	// 更新会话信息
 	c.session.LastActivity = time.Now()
 	c.session.MessageCount++
@@ -278,11 +286,23 @@ func (c *claudeInteractive) Prompt(message string) (*Response, error) {
 
 	log.Debugf("Creating InteractiveResponseReader for message #%d", c.session.MessageCount)
 
+	// 超时或 ctx 取消时关闭会话，阻塞中的读取随之返回
+	promptCtx, cancel := context.WithTimeout(ctx, promptTimeout(opts, c.timeout))
+	messageNumber := c.session.MessageCount
+	stop := context.AfterFunc(promptCtx, func() {
+		log.Warnf("Interactive message #%d aborted: %v, closing session", messageNumber, context.Cause(promptCtx))
+		c.Close()
+	})
+
 	// 创建响应读取器
 	responseReader := &InteractiveResponseReader{
 		stdout:  c.stdout,
 		session: c.session,
-		ctx:     c.ctx,
+		ctx:     promptCtx,
+		release: func() {
+			stop()
+			cancel()
+		},
 	}
 
 	return &Response{Out: responseReader}, nil
@@ -295,9 +315,24 @@ type InteractiveResponseReader struct {
 	buffer  bytes.Buffer
 	done    bool
 	ctx     context.Context
+	release func() // 响应结束时释放超时控制
+	once    sync.Once
 	mutex   sync.Mutex
 }
 
+// finish 响应结束时释放超时控制，返回读取被超时或取消中断时的错误
+func (r *InteractiveResponseReader) finish() error {
+	r.once.Do(func() {
+		if r.release != nil {
+			r.release()
+		}
+	})
+	if r.ctx != nil && r.ctx.Err() != nil {
+		return fmt.Errorf("interactive prompt aborted: %w", context.Cause(r.ctx))
+	}
+	return nil
+}
+
 func (r *InteractiveResponseReader) Read(p []byte) (n int, err error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -317,6 +352,10 @@ func (r *InteractiveResponseReader) Read(p []byte) (n int, err error) {
 			r.done = true
 			log.Infof("InteractiveResponseReader: EOF reached, total buffer size: %d", r.buffer.Len())
 		}
+		if abortErr := r.finish(); abortErr != nil {
+			r.done = true
+			return 0, abortErr
+		}
 		return 0, err
 	}
 
@@ -334,6 +373,7 @@ func (r *InteractiveResponseReader) Read(p []byte) (n int, err error) {
 	if r.isResponseComplete(buffer[:n]) {
 		r.done = true
 		log.Infof("InteractiveResponseReader: Response complete detected, total buffer size: %d", r.buffer.Len())
+		r.finish()
 		return n, io.EOF
 	}
 
@@ -376,6 +416,14 @@ func (r *InteractiveResponseReader) isResponseComplete(data []byte) bool {
 	return false
 }
 
+// Cancel 终止交互式会话进程并删除容器
+func (c *claudeInteractive) Cancel() error {
+	if err := c.Close(); err != nil {
+		log.Warnf("Failed to close interactive session %s: %v", c.containerName, err)
+	}
+	return exec.Command("docker", "rm", "-f", c.containerName).Run()
+}
+
 func (c *claudeInteractive) Close() error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
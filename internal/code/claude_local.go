@@ -6,8 +6,9 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/qiniu/codeagent/internal/config"
 	"github.com/qiniu/codeagent/pkg/models"
@@ -18,6 +19,9 @@ import (
 type claudeLocal struct {
 	workspace *models.Workspace
 	config    *config.Config
+
+	mu  sync.Mutex
+	cmd *exec.Cmd // 正在执行的 CLI 进程
 }
 
 // NewClaudeLocal 创建本地 Claude CLI 实现
@@ -43,9 +47,9 @@ func checkClaudeCLI() error {
 }
 
 // Prompt 实现 Code 接口 - 本地 CLI 版本
-func (c *claudeLocal) Prompt(message string) (*Response, error) {
+func (c *claudeLocal) Prompt(ctx context.Context, message string, opts PromptOptions) (*Response, error) {
 	// 执行本地 claude CLI 调用
-	output, err := c.executeClaudeLocal(message)
+	output, err := c.executeClaudeLocal(ctx, message, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute claude prompt: %w", err)
 	}
@@ -57,19 +61,15 @@ func (c *claudeLocal) Prompt(message string) (*Response, error) {
 }
 
 // executeClaudeLocal 执行本地 claude CLI 调用
-func (c *claudeLocal) executeClaudeLocal(prompt string) ([]byte, error) {
+func (c *claudeLocal) executeClaudeLocal(ctx context.Context, prompt string, opts PromptOptions) ([]byte, error) {
 	// 构建 claude CLI 命令
-	args := []string{
-		"-p",
-		prompt,
-	}
+	args := append([]string{}, claudeStreamArgs...)
+	args = append(args, claudeOptionArgs(opts)...)
+	args = append(args, "-p", prompt)
 
-	// 设置超时 - 使用配置中的超时时间，默认为 5 分钟
-	timeout := c.config.Claude.Timeout
-	if timeout == 0 {
-		timeout = 5 * time.Minute
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	// 设置超时 - 调用方未指定时使用配置中的超时时间，默认为 5 分钟
+	timeout := promptTimeout(opts, c.config.Claude.Timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, "claude", args...)
@@ -80,16 +80,35 @@ func (c *claudeLocal) executeClaudeLocal(prompt string) ([]byte, error) {
 
 	log.Infof("Executing local claude CLI in directory %s: claude %s", c.workspace.Path, strings.Join(args, " "))
 
-	// 执行命令并获取输出
-	output, err := cmd.CombinedOutput()
+	c.mu.Lock()
+	c.cmd = cmd
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.cmd = nil
+		c.mu.Unlock()
+	}()
+
+	// 逐行解析 stream-json 输出，执行过程中的事件实时回调给 opts.OnEvent
+	root, _ := filepath.Abs(c.workspace.Path)
+	stream := &claudeStreamWriter{parser: &claudeStreamParser{root: root, onEvent: recordingEvents(ctx, opts.OnEvent)}}
+	var stderr bytes.Buffer
+	cmd.Stdout = stream
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	output := stream.Result()
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			log.Warnf("Claude CLI execution timed out after %s, this might be due to large codebase or complex task", timeout)
 			return nil, fmt.Errorf("claude CLI execution timed out: %w", err)
 		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("claude CLI execution aborted: %w", context.Cause(ctx))
+		}
 
 		// 检查是否是 API 密钥相关错误
-		outputStr := string(output)
+		outputStr := stderr.String() + string(output)
 		if strings.Contains(outputStr, "API Error") || strings.Contains(outputStr, "fetch failed") || strings.Contains(outputStr, "authentication") {
 			return nil, fmt.Errorf("claude API error - please check CLAUDE_API_KEY: %w, output: %s", err, outputStr)
 		}
@@ -106,6 +125,17 @@ func (c *claudeLocal) executeClaudeLocal(prompt string) ([]byte, error) {
 	return output, nil
 }
 
+// Cancel 终止正在执行的 claude CLI 进程
+func (c *claudeLocal) Cancel() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cmd != nil && c.cmd.Process != nil {
+		return c.cmd.Process.Kill()
+	}
+	return nil
+}
+
 // Close 实现 Code 接口
 func (c *claudeLocal) Close() error {
 	// 单次 prompt 模式不需要特殊的清理
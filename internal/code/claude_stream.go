@@ -0,0 +1,175 @@
+package code
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// claudeStreamArgs 让 claude CLI 以 stream-json 格式逐行输出执行过程（-p 模式下需要 --verbose）
+var claudeStreamArgs = []string{"--output-format", "stream-json", "--verbose"}
+
+// maxStreamLineSize stream-json 单行的最大长度，工具结果可能包含完整文件内容
+const maxStreamLineSize = 16 * 1024 * 1024
+
+// claudeFileEditTools 会修改文件的 claude 工具
+var claudeFileEditTools = map[string]bool{
+	"Edit":         true,
+	"MultiEdit":    true,
+	"Write":        true,
+	"NotebookEdit": true,
+}
+
+// claudeStreamMessage stream-json 中的一行
+type claudeStreamMessage struct {
+	Type    string `json:"type"`
+	Subtype string `json:"subtype"`
+	Message struct {
+		Content []struct {
+			Type  string                 `json:"type"`
+			Text  string                 `json:"text"`
+			Name  string                 `json:"name"`
+			Input map[string]interface{} `json:"input"`
+		} `json:"content"`
+	} `json:"message"`
+
+	// result 消息的字段
+	Result       string  `json:"result"`
+	IsError      bool    `json:"is_error"`
+	NumTurns     int     `json:"num_turns"`
+	DurationMS   int64   `json:"duration_ms"`
+	TotalCostUSD float64 `json:"total_cost_usd"`
+	Usage        Usage   `json:"usage"`
+}
+
+// claudeStreamParser 将 stream-json 输出转换为 Event，并提取最终结果文本
+type claudeStreamParser struct {
+	root    string // 工作空间根目录，用于将文件路径转换为相对路径
+	onEvent func(Event)
+}
+
+// parseLine 解析一行输出，返回需要写入结果的文本；
+// 无法解析为 JSON 的行原样返回，兼容不支持 stream-json 的 CLI 版本和错误输出
+func (p *claudeStreamParser) parseLine(line []byte) string {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return ""
+	}
+
+	var msg claudeStreamMessage
+	if err := json.Unmarshal(line, &msg); err != nil || msg.Type == "" {
+		return string(line) + "\n"
+	}
+	// usage 中不含费用，费用在 total_cost_usd 中单独给出
+	msg.Usage.CostUSD = msg.TotalCostUSD
+
+	switch msg.Type {
+	case "assistant":
+		for _, content := range msg.Message.Content {
+			switch content.Type {
+			case "text":
+				p.emit(Event{Type: EventText, Text: content.Text})
+			case "tool_use":
+				p.emit(p.toolEvent(content.Name, content.Input))
+			}
+		}
+	case "result":
+		p.emit(Event{
+			Type:     EventResult,
+			Text:     msg.Result,
+			IsError:  msg.IsError,
+			NumTurns: msg.NumTurns,
+			Duration: time.Duration(msg.DurationMS) * time.Millisecond,
+			Usage:    msg.Usage,
+		})
+		return msg.Result
+	}
+	return ""
+}
+
+// toolEvent 将工具调用转换为事件，修改文件的工具转换为 EventFileEdit
+func (p *claudeStreamParser) toolEvent(tool string, input map[string]interface{}) Event {
+	event := Event{Type: EventToolUse, Tool: tool, Input: input}
+	if claudeFileEditTools[tool] {
+		event.Type = EventFileEdit
+	}
+	if path, _ := input["file_path"].(string); path != "" {
+		event.File = p.relativePath(path)
+	} else if path, _ := input["notebook_path"].(string); path != "" {
+		event.File = p.relativePath(path)
+	}
+	return event
+}
+
+func (p *claudeStreamParser) relativePath(path string) string {
+	if p.root != "" && filepath.IsAbs(path) {
+		if rel, err := filepath.Rel(p.root, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return path
+}
+
+func (p *claudeStreamParser) emit(event Event) {
+	if p.onEvent != nil {
+		p.onEvent(event)
+	}
+}
+
+// newClaudeStreamReader 逐行解析 stream-json 输出，实时回调事件，返回的 Reader 只包含最终结果文本；
+// 底层读取的错误（如超时终止）在结果读取完后返回
+func newClaudeStreamReader(r io.Reader, parser *claudeStreamParser) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxStreamLineSize)
+		for scanner.Scan() {
+			if text := parser.parseLine(scanner.Bytes()); text != "" {
+				if _, err := io.WriteString(pw, text); err != nil {
+					// 调用方不再读取，继续消费输出以便进程退出
+					io.Copy(io.Discard, r)
+					return
+				}
+			}
+		}
+		err := scanner.Err()
+		if err != nil {
+			io.Copy(io.Discard, r)
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// claudeStreamWriter 以 io.Writer 的方式逐行解析 stream-json，结果文本写入 result
+type claudeStreamWriter struct {
+	parser *claudeStreamParser
+	buf    []byte
+	result bytes.Buffer
+}
+
+func (w *claudeStreamWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.result.WriteString(w.parser.parseLine(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Result 处理剩余的不完整行并返回结果文本
+func (w *claudeStreamWriter) Result() []byte {
+	if len(w.buf) > 0 {
+		w.result.WriteString(w.parser.parseLine(w.buf))
+		w.buf = nil
+	}
+	return w.result.Bytes()
+}
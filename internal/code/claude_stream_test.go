@@ -0,0 +1,61 @@
+package code
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qiniu/codeagent/internal/locale"
+)
+
+const claudeStreamSample = `{"type":"system","subtype":"init","session_id":"s1","tools":["Read","Edit"]}
+{"type":"assistant","message":{"content":[{"type":"text","text":"I'll update foo.go"},{"type":"tool_use","id":"t1","name":"Read","input":{"file_path":"/workspace/internal/foo.go"}}]}}
+{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"t1","content":"package foo"}]}}
+{"type":"assistant","message":{"content":[{"type":"tool_use","id":"t2","name":"Edit","input":{"file_path":"/workspace/internal/foo.go","old_string":"a","new_string":"b"}}]}}
+{"type":"assistant","message":{"content":[{"type":"tool_use","id":"t3","name":"Bash","input":{"command":"go test ./...\necho done"}}]}}
+{"type":"result","subtype":"success","is_error":false,"duration_ms":1500,"num_turns":4,"result":"Updated internal/foo.go","total_cost_usd":0.0123,"usage":{"input_tokens":100,"output_tokens":20,"cache_read_input_tokens":50}}
+`
+
+func TestClaudeStreamReader(t *testing.T) {
+	var events []Event
+	parser := &claudeStreamParser{root: "/workspace", onEvent: func(e Event) { events = append(events, e) }}
+
+	out, err := io.ReadAll(newClaudeStreamReader(strings.NewReader(claudeStreamSample), parser))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(out) != "Updated internal/foo.go" {
+		t.Errorf("Expected only the final result in output, got %q", out)
+	}
+
+	var steps []string
+	for _, e := range events {
+		if step := e.Describe(locale.Get(locale.English)); step != "" {
+			steps = append(steps, step)
+		}
+	}
+	expected := []string{"reading internal/foo.go", "editing internal/foo.go", "running `go test ./...`"}
+	if strings.Join(steps, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected steps %v, got %v", expected, steps)
+	}
+
+	result := events[len(events)-1]
+	if result.Type != EventResult || result.NumTurns != 4 || result.Duration != 1500*time.Millisecond {
+		t.Errorf("Unexpected result event: %+v", result)
+	}
+	if result.Usage.CostUSD != 0.0123 || result.Usage.InputTokens != 100 || result.Usage.OutputTokens != 20 || result.Usage.CacheReadInputTokens != 50 {
+		t.Errorf("Unexpected usage in result event: %+v", result)
+	}
+}
+
+func TestClaudeStreamWriterFallsBackToPlainText(t *testing.T) {
+	w := &claudeStreamWriter{parser: &claudeStreamParser{root: "/repo"}}
+	// 分多次写入，覆盖跨 Write 的行
+	w.Write([]byte("Error: invalid API key\n{\"type\":\"result\",\"res"))
+	w.Write([]byte("ult\":\"done\"}"))
+
+	if got := string(w.Result()); got != "Error: invalid API key\ndone" {
+		t.Errorf("Unexpected result: %q", got)
+	}
+}
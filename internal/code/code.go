@@ -1,8 +1,10 @@
 package code
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/qiniu/codeagent/internal/config"
 	"github.com/qiniu/codeagent/pkg/models"
@@ -11,14 +13,30 @@ import (
 const (
 	ProviderClaude = "claude"
 	ProviderGemini = "gemini"
+	ProviderOpenAI = "openai"
 )
 
 type Response struct {
 	Out io.Reader
 }
 
+// PromptOptions 单次 prompt 的执行选项，零值表示使用 provider 的默认行为
+type PromptOptions struct {
+	// Timeout 本次调用的超时时间，为 0 时使用配置中 provider 的 timeout
+	Timeout time.Duration
+	// MaxTurns 限制 agent 的最大轮数，为 0 时使用 provider 的默认值
+	MaxTurns int
+	// AllowedTools 允许 agent 使用的工具，为空时不限制
+	AllowedTools []string
+	// OnEvent 执行过程中的结构化事件回调，仅支持结构化输出的 provider 会调用
+	OnEvent func(Event)
+}
+
 type Code interface {
-	Prompt(message string) (*Response, error)
+	// Prompt 执行一次 prompt，ctx 被取消或超时后终止 provider 进程
+	Prompt(ctx context.Context, message string, opts PromptOptions) (*Response, error)
+	// Cancel 中止正在执行的 prompt 并终止 provider 进程，调用后 session 不再可用
+	Cancel() error
 	Close() error
 }
 
@@ -31,23 +49,10 @@ func New(workspace *models.Workspace, cfg *config.Config) (Code, error) {
 		provider = cfg.CodeProvider
 	}
 
-	// 根据 code provider 和 use_docker 配置创建相应的代码提供者
-	switch provider {
-	case ProviderClaude:
-		if cfg.UseDocker {
-			// 检查是否启用交互式模式
-			if cfg.Claude.Interactive {
-				return NewClaudeInteractive(workspace, cfg)
-			}
-			return NewClaudeDocker(workspace, cfg)
-		}
-		return NewClaudeLocal(workspace, cfg)
-	case ProviderGemini:
-		if cfg.UseDocker {
-			return NewGeminiDocker(workspace, cfg)
-		}
-		return NewGeminiLocal(workspace, cfg)
-	default:
+	// 根据注册表中的 provider 和 use_docker 配置创建相应的代码提供者
+	p, ok := Lookup(provider)
+	if !ok {
 		return nil, fmt.Errorf("unsupported code provider: %s", provider)
 	}
+	return p.create(workspace, cfg)
 }
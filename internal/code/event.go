@@ -0,0 +1,101 @@
+package code
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qiniu/codeagent/internal/locale"
+	"github.com/qiniu/codeagent/internal/usage"
+	"github.com/qiniu/codeagent/pkg/models"
+)
+
+// EventType provider 执行过程中产生的事件类型
+type EventType string
+
+const (
+	// EventText 模型输出的中间文本
+	EventText EventType = "text"
+	// EventToolUse 模型调用了工具（文件修改除外）
+	EventToolUse EventType = "tool_use"
+	// EventFileEdit 模型修改了文件
+	EventFileEdit EventType = "file_edit"
+	// EventResult 执行结束，包含最终结果和用量
+	EventResult EventType = "result"
+)
+
+// Event provider 执行过程中的结构化事件，通过 PromptOptions.OnEvent 实时回调
+type Event struct {
+	Type EventType
+	// Text 文本内容，EventResult 时为最终结果
+	Text string
+	// Tool 工具名，如 Bash、Edit
+	Tool string
+	// Input 工具的输入参数
+	Input map[string]interface{}
+	// File 被修改或读取的文件，相对工作空间根目录
+	File string
+
+	// 以下字段仅在 EventResult 中有效
+	IsError  bool
+	NumTurns int
+	Duration time.Duration
+	Usage    Usage
+}
+
+// Usage token 用量和费用
+type Usage = models.TokenUsage
+
+// Describe 返回适合展示给用户的简短步骤描述，如 "editing internal/foo.go"，使用 msgs 的语言，无需展示时返回空
+func (e Event) Describe(msgs *locale.Messages) string {
+	switch e.Type {
+	case EventFileEdit:
+		return fmt.Sprintf(msgs.StepEditing, e.File)
+	case EventToolUse:
+		if e.File != "" {
+			return fmt.Sprintf(msgs.StepReading, e.File)
+		}
+		if command, _ := e.Input["command"].(string); command != "" {
+			return fmt.Sprintf(msgs.StepRunning, shortCommand(command))
+		}
+		if pattern, _ := e.Input["pattern"].(string); pattern != "" {
+			return fmt.Sprintf(msgs.StepSearching, pattern)
+		}
+		return fmt.Sprintf(msgs.StepUsing, e.Tool)
+	default:
+		return ""
+	}
+}
+
+// maxCommandLength 步骤描述中命令的最大长度
+const maxCommandLength = 60
+
+// shortCommand 截取命令的第一行，过长时截断，避免破坏评论格式
+func shortCommand(command string) string {
+	command, _, _ = strings.Cut(strings.TrimSpace(command), "\n")
+	command = strings.ReplaceAll(command, "`", "'")
+	if runes := []rune(command); len(runes) > maxCommandLength {
+		command = string(runes[:maxCommandLength]) + "..."
+	}
+	return command
+}
+
+// recordingEvents 包装事件回调：结束事件中的用量和耗时记录到 ctx 中的 usage.Tracker，再转发给调用方
+func recordingEvents(ctx context.Context, onEvent func(Event)) func(Event) {
+	start := time.Now()
+	return func(event Event) {
+		if event.Type == EventResult {
+			usage.Record(ctx, event.Usage)
+			// provider 未报告耗时时以回调创建到结束事件的时间计
+			duration := event.Duration
+			if duration <= 0 {
+				duration = time.Since(start)
+			}
+			usage.RecordDuration(ctx, duration)
+		}
+		if onEvent != nil {
+			onEvent(event)
+		}
+	}
+}
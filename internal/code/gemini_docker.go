@@ -2,11 +2,14 @@ package code
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/qiniu/codeagent/internal/config"
 	"github.com/qiniu/codeagent/pkg/models"
@@ -16,6 +19,10 @@ import (
 // geminiDocker Docker 实现（交互式模式）
 type geminiDocker struct {
 	containerName string
+	timeout       time.Duration // 单次 prompt 的默认超时时间
+
+	mu  sync.Mutex
+	cmd *exec.Cmd // 正在执行的 docker exec 进程
 }
 
 // getGoogleCloudProject 获取 Google Cloud 项目ID，优先使用配置文件中的值
@@ -38,6 +45,7 @@ func NewGeminiDocker(workspace *models.Workspace, cfg *config.Config) (Code, err
 		log.Infof("Found existing container: %s, reusing it", containerName)
 		return &geminiDocker{
 			containerName: containerName,
+			timeout:       cfg.Gemini.Timeout,
 		}, nil
 	}
 
@@ -118,35 +126,55 @@ func NewGeminiDocker(workspace *models.Workspace, cfg *config.Config) (Code, err
 
 	return &geminiDocker{
 		containerName: containerName,
+		timeout:       cfg.Gemini.Timeout,
 	}, nil
 }
 
 // Prompt 实现 Code 接口
-func (g *geminiDocker) Prompt(message string) (*Response, error) {
+func (g *geminiDocker) Prompt(ctx context.Context, message string, opts PromptOptions) (*Response, error) {
 	args := []string{
 		"exec",
 		g.containerName,
 		"gemini",
 		"-y",
-		"-p",
-		message,
 	}
+	args = append(args, geminiOutputArgs...)
+	args = append(args, geminiOptionArgs(opts)...)
+	args = append(args, "-p", message)
 
-	cmd := exec.Command("docker", args...)
+	ctx, cancel := context.WithTimeout(ctx, promptTimeout(opts, g.timeout))
+	cmd := exec.CommandContext(ctx, "docker", args...)
 
 	log.Infof("Executing gemini CLI with docker: %s", strings.Join(args, " "))
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
 	// 启动命令
 	if err := cmd.Start(); err != nil {
+		cancel()
 		return nil, fmt.Errorf("failed to execute gemini: %w", err)
 	}
 
-	return &Response{Out: stdout}, nil
+	g.mu.Lock()
+	g.cmd = cmd
+	g.mu.Unlock()
+
+	out := &streamOutput{out: stdout, cmd: cmd, ctx: ctx, cancel: cancel}
+	return &Response{Out: &geminiOutputReader{r: out, onEvent: recordingEvents(ctx, opts.OnEvent)}}, nil
+}
+
+// Cancel 终止正在执行的 docker exec 进程并删除容器
+func (g *geminiDocker) Cancel() error {
+	g.mu.Lock()
+	if g.cmd != nil && g.cmd.Process != nil {
+		g.cmd.Process.Kill()
+	}
+	g.mu.Unlock()
+	return g.Close()
 }
 
 // Close 实现 Code 接口
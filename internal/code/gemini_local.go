@@ -7,7 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/qiniu/codeagent/internal/config"
 	"github.com/qiniu/codeagent/pkg/models"
@@ -18,6 +18,9 @@ import (
 type geminiLocal struct {
 	workspace *models.Workspace
 	config    *config.Config
+
+	mu  sync.Mutex
+	cmd *exec.Cmd // 正在执行的 CLI 进程
 }
 
 // NewGeminiLocal 创建本地 Gemini CLI 实现
@@ -43,9 +46,9 @@ func checkGeminiCLI() error {
 }
 
 // Prompt 实现 Code 接口 - 本地 CLI 版本
-func (g *geminiLocal) Prompt(message string) (*Response, error) {
+func (g *geminiLocal) Prompt(ctx context.Context, message string, opts PromptOptions) (*Response, error) {
 	// 执行本地 gemini CLI 调用
-	output, err := g.executeGeminiLocal(message)
+	output, err := g.executeGeminiLocal(ctx, message, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute gemini prompt: %w", err)
 	}
@@ -57,19 +60,16 @@ func (g *geminiLocal) Prompt(message string) (*Response, error) {
 }
 
 // executeGeminiLocal 执行本地 gemini CLI 调用
-func (g *geminiLocal) executeGeminiLocal(prompt string) ([]byte, error) {
+func (g *geminiLocal) executeGeminiLocal(ctx context.Context, prompt string, opts PromptOptions) ([]byte, error) {
 	// 构建 gemini CLI 命令
-	args := []string{
-		"-y",
-		"--prompt", prompt,
-	}
-
-	// 设置超时 - 使用配置中的超时时间，默认为 5 分钟
-	timeout := g.config.Gemini.Timeout
-	if timeout == 0 {
-		timeout = 5 * time.Minute
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	args := []string{"-y"}
+	args = append(args, geminiOutputArgs...)
+	args = append(args, geminiOptionArgs(opts)...)
+	args = append(args, "--prompt", prompt)
+
+	// 设置超时 - 调用方未指定时使用配置中的超时时间，默认为 5 分钟
+	timeout := promptTimeout(opts, g.config.Gemini.Timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, "gemini", args...)
@@ -80,16 +80,32 @@ func (g *geminiLocal) executeGeminiLocal(prompt string) ([]byte, error) {
 
 	log.Infof("Executing local gemini CLI in directory %s: gemini %s", g.workspace.Path, strings.Join(args, " "))
 
-	// 执行命令并获取输出
-	output, err := cmd.CombinedOutput()
+	g.mu.Lock()
+	g.cmd = cmd
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		g.cmd = nil
+		g.mu.Unlock()
+	}()
+
+	// 执行命令并获取输出，stderr 单独收集以免破坏 JSON 输出
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	output := parseGeminiOutput(stdout.Bytes(), recordingEvents(ctx, opts.OnEvent))
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			log.Warnf("Gemini CLI execution timed out after %s, this might be due to large codebase or complex task", timeout)
 			return nil, fmt.Errorf("gemini CLI execution timed out: %w", err)
 		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("gemini CLI execution aborted: %w", context.Cause(ctx))
+		}
 
 		// 检查是否是 API 密钥相关错误
-		outputStr := string(output)
+		outputStr := stderr.String() + string(output)
 		if strings.Contains(outputStr, "API Error") || strings.Contains(outputStr, "fetch failed") {
 			return nil, fmt.Errorf("gemini API error - please check GOOGLE_API_KEY: %w, output: %s", err, outputStr)
 		}
@@ -106,6 +122,17 @@ func (g *geminiLocal) executeGeminiLocal(prompt string) ([]byte, error) {
 	return output, nil
 }
 
+// Cancel 终止正在执行的 gemini CLI 进程
+func (g *geminiLocal) Cancel() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.cmd != nil && g.cmd.Process != nil {
+		return g.cmd.Process.Kill()
+	}
+	return nil
+}
+
 // Close 实现 Code 接口
 func (g *geminiLocal) Close() error {
 	// 单次 prompt 模式不需要特殊的清理
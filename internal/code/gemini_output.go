@@ -0,0 +1,67 @@
+package code
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// geminiOutputArgs 让 gemini CLI 以 JSON 输出结果和用量统计
+var geminiOutputArgs = []string{"--output-format", "json"}
+
+// geminiJSONOutput gemini CLI --output-format json 的输出
+type geminiJSONOutput struct {
+	Response *string `json:"response"`
+	Stats    struct {
+		Models map[string]struct {
+			Tokens struct {
+				Prompt     int `json:"prompt"`
+				Candidates int `json:"candidates"`
+				Cached     int `json:"cached"`
+				Thoughts   int `json:"thoughts"`
+			} `json:"tokens"`
+		} `json:"models"`
+	} `json:"stats"`
+}
+
+// parseGeminiOutput 从 JSON 输出中提取结果文本并通过 onEvent 报告用量；
+// 无法解析时原样返回，兼容不支持 JSON 输出的 CLI 版本
+func parseGeminiOutput(data []byte, onEvent func(Event)) []byte {
+	var out geminiJSONOutput
+	if err := json.Unmarshal(bytes.TrimSpace(data), &out); err != nil || out.Response == nil {
+		return data
+	}
+
+	var usage Usage
+	for _, model := range out.Stats.Models {
+		// prompt 包含命中缓存的部分，thoughts 按输出计
+		usage.InputTokens += model.Tokens.Prompt - model.Tokens.Cached
+		usage.CacheReadInputTokens += model.Tokens.Cached
+		usage.OutputTokens += model.Tokens.Candidates + model.Tokens.Thoughts
+	}
+	if onEvent != nil {
+		onEvent(Event{Type: EventResult, Text: *out.Response, Usage: usage})
+	}
+	return []byte(*out.Response)
+}
+
+// geminiOutputReader 读取完整的 JSON 输出后再返回结果文本，底层读取的错误在结果读取完后返回
+type geminiOutputReader struct {
+	r       io.Reader
+	onEvent func(Event)
+	result  *bytes.Reader
+	err     error
+}
+
+func (g *geminiOutputReader) Read(p []byte) (int, error) {
+	if g.result == nil {
+		data, err := io.ReadAll(g.r)
+		g.result = bytes.NewReader(parseGeminiOutput(data, g.onEvent))
+		g.err = err
+	}
+	n, err := g.result.Read(p)
+	if err == io.EOF && g.err != nil {
+		return n, g.err
+	}
+	return n, err
+}
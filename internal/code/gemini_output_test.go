@@ -0,0 +1,35 @@
+package code
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestGeminiOutputReader(t *testing.T) {
+	output := `{"response":"Done","stats":{"models":{"gemini-2.5-pro":{"tokens":{"prompt":120,"candidates":30,"total":170,"cached":20,"thoughts":20}}}}}`
+
+	var result *Event
+	r := &geminiOutputReader{r: strings.NewReader(output), onEvent: func(e Event) { result = &e }}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(out) != "Done" {
+		t.Errorf("Expected response text, got %q", out)
+	}
+	if result == nil || result.Type != EventResult {
+		t.Fatalf("Expected result event, got %+v", result)
+	}
+	if u := result.Usage; u.InputTokens != 100 || u.CacheReadInputTokens != 20 || u.OutputTokens != 50 {
+		t.Errorf("Unexpected usage: %+v", u)
+	}
+}
+
+func TestGeminiOutputFallsBackToPlainText(t *testing.T) {
+	called := false
+	out := parseGeminiOutput([]byte("plain text output\n"), func(Event) { called = true })
+	if string(out) != "plain text output\n" || called {
+		t.Errorf("Expected plain text to pass through without events, got %q (event: %v)", out, called)
+	}
+}
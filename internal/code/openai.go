@@ -0,0 +1,350 @@
+package code
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/internal/mcp"
+	"github.com/qiniu/codeagent/pkg/models"
+	"github.com/qiniu/x/log"
+)
+
+// openAISystemPrompt 引导模型通过工具在工作空间中完成修改
+const openAISystemPrompt = `You are a coding agent working inside a git repository checked out at the current workspace.
+Use the provided tools to inspect and edit files. Always write complete file contents when editing.
+Do not commit or push, the changes will be committed for you.
+When the task is finished, reply with a summary of the changes without calling any tool.`
+
+// openAICode OpenAI 兼容 HTTP 接口实现，通过 MCP 工具在工作空间中执行修改
+type openAICode struct {
+	config     config.OpenAIConfig
+	httpClient *http.Client
+	mcpClient  *mcp.Client
+	mcpCtx     *models.MCPContext
+
+	mu     sync.Mutex
+	cancel context.CancelFunc // 正在执行的 prompt
+}
+
+// openAIMessage chat completions 消息
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAITool struct {
+	Type     string             `json:"type"`
+	Function openAIToolFunction `json:"function"`
+}
+
+type openAIToolFunction struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"`
+}
+
+type openAIRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+	Tools    []openAITool    `json:"tools,omitempty"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens        int `json:"prompt_tokens"`
+		CompletionTokens    int `json:"completion_tokens"`
+		PromptTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details"`
+	} `json:"usage,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// NewOpenAI 创建 OpenAI 兼容接口实现
+func NewOpenAI(workspace *models.Workspace, cfg *config.Config) (Code, error) {
+	if err := validateOpenAIConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	workspacePath, err := filepath.Abs(workspace.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve workspace path: %w", err)
+	}
+
+	// 工具只操作本地工作空间，修改由 CommitAndPush 统一提交
+	manager := mcp.NewManager()
+	if err := manager.RegisterServer("workspace", mcp.NewWorkspaceServer()); err != nil {
+		return nil, fmt.Errorf("failed to register workspace server: %w", err)
+	}
+
+	return &openAICode{
+		config:     cfg.OpenAI,
+		httpClient: &http.Client{},
+		mcpClient:  mcp.NewClient(manager),
+		mcpCtx: &models.MCPContext{
+			WorkspacePath: workspacePath,
+			BranchName:    workspace.Branch,
+			Permissions:   []string{"filesystem:read", "filesystem:write"},
+		},
+	}, nil
+}
+
+// validateOpenAIConfig 校验 openai 配置段的必填项
+func validateOpenAIConfig(cfg *config.Config) error {
+	if cfg.OpenAI.BaseURL == "" {
+		return fmt.Errorf("openai base_url is not configured")
+	}
+	if cfg.OpenAI.Model == "" {
+		return fmt.Errorf("openai model is not configured")
+	}
+	return nil
+}
+
+// Prompt 运行 agent 循环：模型请求工具调用时执行工具并回传结果，直到模型给出最终回复
+func (o *openAICode) Prompt(ctx context.Context, message string, opts PromptOptions) (*Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, promptTimeout(opts, o.config.Timeout))
+	defer cancel()
+
+	o.mu.Lock()
+	o.cancel = cancel
+	o.mu.Unlock()
+	defer func() {
+		o.mu.Lock()
+		o.cancel = nil
+		o.mu.Unlock()
+	}()
+
+	tools, err := o.tools(ctx, opts.AllowedTools)
+	if err != nil {
+		return nil, err
+	}
+
+	// 调用方未指定时使用配置的轮数，配置也为空时使用默认值，工具循环始终有上限
+	maxTurns := opts.MaxTurns
+	if maxTurns <= 0 {
+		maxTurns = o.config.MaxTurns
+	}
+	if maxTurns <= 0 {
+		maxTurns = config.DefaultOpenAIMaxTurns
+	}
+
+	messages := []openAIMessage{
+		{Role: "system", Content: openAISystemPrompt},
+		{Role: "user", Content: message},
+	}
+
+	// 每轮的用量累加，失败时已消耗的用量同样需要记录
+	var total Usage
+	var result string
+	var turns int
+	onEvent := recordingEvents(ctx, opts.OnEvent)
+	defer func() {
+		onEvent(Event{Type: EventResult, Text: result, NumTurns: turns, Usage: total})
+	}()
+
+	for turn := 1; turn <= maxTurns; turn++ {
+		turns = turn
+		reply, err := o.chat(ctx, messages, tools, &total)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, reply)
+
+		if len(reply.ToolCalls) == 0 {
+			log.Infof("OpenAI agent finished after %d turn(s)", turn)
+			result = reply.Content
+			return &Response{Out: strings.NewReader(reply.Content)}, nil
+		}
+
+		log.Infof("OpenAI agent turn %d requested %d tool call(s)", turn, len(reply.ToolCalls))
+		for _, call := range reply.ToolCalls {
+			onEvent(o.toolEvent(call))
+			messages = append(messages, openAIMessage{
+				Role:       "tool",
+				ToolCallID: call.ID,
+				Content:    o.executeToolCall(ctx, call, opts.AllowedTools),
+			})
+		}
+	}
+
+	return nil, fmt.Errorf("openai agent exceeded max turns (%d)", maxTurns)
+}
+
+// tools 将 MCP 工具定义转换为 OpenAI function calling 格式
+func (o *openAICode) tools(ctx context.Context, allowed []string) ([]openAITool, error) {
+	definitions, err := o.mcpClient.GetToolDefinitions(ctx, o.mcpCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tool definitions: %w", err)
+	}
+
+	var tools []openAITool
+	for _, definition := range definitions {
+		name, _ := definition["name"].(string)
+		if len(allowed) > 0 && !slices.Contains(allowed, name) {
+			continue
+		}
+		description, _ := definition["description"].(string)
+		tools = append(tools, openAITool{
+			Type: "function",
+			Function: openAIToolFunction{
+				Name:        name,
+				Description: description,
+				Parameters:  definition["input_schema"],
+			},
+		})
+	}
+	return tools, nil
+}
+
+// toolEvent 将工具调用转换为事件，写文件的工具转换为 EventFileEdit
+func (o *openAICode) toolEvent(call openAIToolCall) Event {
+	args := make(map[string]interface{})
+	json.Unmarshal([]byte(call.Function.Arguments), &args)
+
+	event := Event{Type: EventToolUse, Tool: call.Function.Name, Input: args}
+	switch call.Function.Name {
+	case "workspace_write_file":
+		event.Type = EventFileEdit
+		event.File, _ = args["path"].(string)
+	case "workspace_read_file":
+		event.File, _ = args["path"].(string)
+	}
+	return event
+}
+
+// executeToolCall 执行一次工具调用，返回回传给模型的内容；失败信息同样回传，由模型决定如何处理
+func (o *openAICode) executeToolCall(ctx context.Context, call openAIToolCall, allowed []string) string {
+	if len(allowed) > 0 && !slices.Contains(allowed, call.Function.Name) {
+		return fmt.Sprintf("error: tool %s is not allowed", call.Function.Name)
+	}
+
+	args := make(map[string]interface{})
+	if call.Function.Arguments != "" {
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+			return fmt.Sprintf("error: invalid tool arguments: %v", err)
+		}
+	}
+
+	toolCall := &models.ToolCall{ID: call.ID}
+	toolCall.Function.Name = call.Function.Name
+	toolCall.Function.Arguments = args
+
+	results, err := o.mcpClient.ExecuteToolCalls(ctx, []*models.ToolCall{toolCall}, o.mcpCtx)
+	if err != nil || len(results) == 0 {
+		return fmt.Sprintf("error: tool call failed: %v", err)
+	}
+
+	result := results[0]
+	if !result.Success {
+		return "error: " + result.Error
+	}
+	if text, ok := result.Content.(string); ok {
+		return text
+	}
+	data, err := json.Marshal(result.Content)
+	if err != nil {
+		return fmt.Sprintf("error: failed to encode tool result: %v", err)
+	}
+	return string(data)
+}
+
+// chat 调用 chat completions 接口，返回模型的回复消息，本轮用量累加到 total
+func (o *openAICode) chat(ctx context.Context, messages []openAIMessage, tools []openAITool, total *Usage) (openAIMessage, error) {
+	body, err := json.Marshal(openAIRequest{
+		Model:    o.config.Model,
+		Messages: messages,
+		Tools:    tools,
+	})
+	if err != nil {
+		return openAIMessage{}, fmt.Errorf("failed to marshal openai request: %w", err)
+	}
+
+	url := strings.TrimSuffix(o.config.BaseURL, "/") + "/chat/completions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return openAIMessage{}, fmt.Errorf("failed to create openai request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.config.APIKey)
+	}
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return openAIMessage{}, fmt.Errorf("openai request aborted: %w", context.Cause(ctx))
+		}
+		return openAIMessage{}, fmt.Errorf("failed to call openai api: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openAIMessage{}, fmt.Errorf("failed to read openai response: %w", err)
+	}
+
+	var result openAIResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return openAIMessage{}, fmt.Errorf("failed to parse openai response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if result.Error != nil {
+			return openAIMessage{}, fmt.Errorf("openai api error (status %d): %s", resp.StatusCode, result.Error.Message)
+		}
+		return openAIMessage{}, fmt.Errorf("openai api error (status %d): %s", resp.StatusCode, string(data))
+	}
+	if result.Usage != nil {
+		cached := result.Usage.PromptTokensDetails.CachedTokens
+		total.Add(Usage{
+			InputTokens:          result.Usage.PromptTokens - cached,
+			CacheReadInputTokens: cached,
+			OutputTokens:         result.Usage.CompletionTokens,
+		})
+	}
+	if len(result.Choices) == 0 {
+		return openAIMessage{}, fmt.Errorf("openai api returned no choices")
+	}
+	return result.Choices[0].Message, nil
+}
+
+// Cancel 中止正在执行的 prompt
+func (o *openAICode) Cancel() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.cancel != nil {
+		o.cancel()
+	}
+	return nil
+}
+
+// Close 实现 Code 接口，HTTP 调用无需清理
+func (o *openAICode) Close() error {
+	return nil
+}
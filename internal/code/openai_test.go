@@ -0,0 +1,192 @@
+package code
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/internal/usage"
+	"github.com/qiniu/codeagent/pkg/models"
+)
+
+// stubOpenAI 按顺序返回预设回复的 chat completions 服务
+type stubOpenAI struct {
+	mu       sync.Mutex
+	replies  []string
+	requests []openAIRequest
+	auth     []string
+}
+
+func (s *stubOpenAI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/chat/completions" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req openAIRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	s.auth = append(s.auth, r.Header.Get("Authorization"))
+	if len(s.replies) == 0 {
+		http.Error(w, `{"error":{"message":"no more replies"}}`, http.StatusInternalServerError)
+		return
+	}
+	reply := s.replies[0]
+	s.replies = s.replies[1:]
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(reply))
+}
+
+func newTestOpenAI(t *testing.T, baseURL string) (Code, string) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		OpenAI: config.OpenAIConfig{
+			BaseURL:  baseURL + "/v1",
+			APIKey:   "test-key",
+			Model:    "test-model",
+			MaxTurns: 5,
+		},
+	}
+	c, err := NewOpenAI(&models.Workspace{Path: dir}, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create openai provider: %v", err)
+	}
+	return c, dir
+}
+
+func TestOpenAIAgentLoopWritesWorkspace(t *testing.T) {
+	stub := &stubOpenAI{replies: []string{
+		`{"choices":[{"message":{"role":"assistant","content":"","tool_calls":[{"id":"call-1","type":"function","function":{"name":"workspace_write_file","arguments":"{\"path\":\"pkg/hello.go\",\"content\":\"package pkg\\n\"}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":100,"completion_tokens":20,"prompt_tokens_details":{"cached_tokens":40}}}`,
+		`{"choices":[{"message":{"role":"assistant","content":"Added pkg/hello.go"},"finish_reason":"stop"}],"usage":{"prompt_tokens":150,"completion_tokens":10}}`,
+	}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	c, dir := newTestOpenAI(t, server.URL)
+	ctx := usage.WithTracker(context.Background(), &usage.Tracker{})
+	var edited []string
+	resp, err := c.Prompt(ctx, "create hello.go", PromptOptions{
+		OnEvent: func(e Event) {
+			if e.Type == EventFileEdit {
+				edited = append(edited, e.File)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Prompt failed: %v", err)
+	}
+	out, _ := io.ReadAll(resp.Out)
+	if string(out) != "Added pkg/hello.go" {
+		t.Errorf("Unexpected output: %q", out)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "pkg", "hello.go"))
+	if err != nil || string(content) != "package pkg\n" {
+		t.Errorf("Expected file to be written in workspace, got %q (err: %v)", content, err)
+	}
+
+	if len(edited) != 1 || edited[0] != "pkg/hello.go" {
+		t.Errorf("Expected file edit event for pkg/hello.go, got %v", edited)
+	}
+	total := usage.Total(ctx)
+	if total == nil || total.InputTokens != 210 || total.CacheReadInputTokens != 40 || total.OutputTokens != 30 {
+		t.Errorf("Unexpected usage: %+v", total)
+	}
+
+	if len(stub.requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(stub.requests))
+	}
+	first := stub.requests[0]
+	if first.Model != "test-model" || len(first.Tools) == 0 {
+		t.Errorf("Expected model and tools in request, got model=%s tools=%d", first.Model, len(first.Tools))
+	}
+	if stub.auth[0] != "Bearer test-key" {
+		t.Errorf("Unexpected Authorization header: %q", stub.auth[0])
+	}
+	second := stub.requests[1].Messages
+	toolMsg := second[len(second)-1]
+	if toolMsg.Role != "tool" || toolMsg.ToolCallID != "call-1" || strings.HasPrefix(toolMsg.Content, "error") {
+		t.Errorf("Unexpected tool result message: %+v", toolMsg)
+	}
+}
+
+func TestOpenAIAllowedToolsAndMaxTurns(t *testing.T) {
+	toolReply := `{"choices":[{"message":{"role":"assistant","content":"","tool_calls":[{"id":"call-1","type":"function","function":{"name":"workspace_write_file","arguments":"{\"path\":\"a.txt\",\"content\":\"x\"}"}}]}}]}`
+	stub := &stubOpenAI{replies: []string{toolReply, toolReply}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	c, dir := newTestOpenAI(t, server.URL)
+	_, err := c.Prompt(context.Background(), "edit", PromptOptions{
+		MaxTurns:     2,
+		AllowedTools: []string{"workspace_read_file"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "max turns") {
+		t.Fatalf("Expected max turns error, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected disallowed tool not to write files")
+	}
+	if tools := stub.requests[0].Tools; len(tools) != 1 || tools[0].Function.Name != "workspace_read_file" {
+		t.Errorf("Expected only allowed tools to be offered, got %+v", tools)
+	}
+	if content := stub.requests[1].Messages[3].Content; !strings.Contains(content, "not allowed") {
+		t.Errorf("Expected disallowed tool error, got %q", content)
+	}
+}
+
+func TestOpenAIDefaultMaxTurns(t *testing.T) {
+	toolReply := `{"choices":[{"message":{"role":"assistant","content":"","tool_calls":[{"id":"call-1","type":"function","function":{"name":"workspace_read_file","arguments":"{\"path\":\"a.txt\"}"}}]}}]}`
+	stub := &stubOpenAI{}
+	for i := 0; i <= config.DefaultOpenAIMaxTurns; i++ {
+		stub.replies = append(stub.replies, toolReply)
+	}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	// 配置和调用方都未指定轮数时同样受默认上限约束
+	cfg := &config.Config{OpenAI: config.OpenAIConfig{BaseURL: server.URL + "/v1", Model: "test-model"}}
+	c, err := NewOpenAI(&models.Workspace{Path: t.TempDir()}, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create openai provider: %v", err)
+	}
+	_, err = c.Prompt(context.Background(), "loop", PromptOptions{})
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("max turns (%d)", config.DefaultOpenAIMaxTurns)) {
+		t.Fatalf("Expected default max turns error, got %v", err)
+	}
+	if len(stub.requests) != config.DefaultOpenAIMaxTurns {
+		t.Errorf("Expected %d requests, got %d", config.DefaultOpenAIMaxTurns, len(stub.requests))
+	}
+}
+
+func TestOpenAITimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	c, _ := newTestOpenAI(t, server.URL)
+	_, err := c.Prompt(context.Background(), "slow", PromptOptions{Timeout: 100 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("Expected timeout error, got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package code
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/pkg/models"
+)
+
+// Factory 根据工作空间和配置创建 Code 实例
+type Factory func(workspace *models.Workspace, cfg *config.Config) (Code, error)
+
+// Provider 描述一个 code provider，新增 provider 只需在此注册，命令解析和 session 创建都从注册表读取
+type Provider struct {
+	// Name provider 名称，对应 code_provider 配置和 workspace 的 AI 模型，命令中用 - 加名称选择，如 -claude
+	Name string
+	// ConfigSection provider 在配置文件中的配置段
+	ConfigSection string
+	// Docker use_docker 为 true 时使用的工厂
+	Docker Factory
+	// Local use_docker 为 false 时使用的工厂
+	Local Factory
+	// Validate 创建前校验配置，可为空
+	Validate func(cfg *config.Config) error
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]*Provider)
+)
+
+func init() {
+	Register(&Provider{
+		Name:          ProviderClaude,
+		ConfigSection: "claude",
+		Docker: func(workspace *models.Workspace, cfg *config.Config) (Code, error) {
+			// 检查是否启用交互式模式
+			if cfg.Claude.Interactive {
+				return NewClaudeInteractive(workspace, cfg)
+			}
+			return NewClaudeDocker(workspace, cfg)
+		},
+		Local: NewClaudeLocal,
+	})
+	Register(&Provider{
+		Name:          ProviderGemini,
+		ConfigSection: "gemini",
+		Docker:        NewGeminiDocker,
+		Local:         NewGeminiLocal,
+	})
+	// 直接调用 HTTP 接口，与 use_docker 无关
+	Register(&Provider{
+		Name:          ProviderOpenAI,
+		ConfigSection: "openai",
+		Docker:        NewOpenAI,
+		Local:         NewOpenAI,
+		Validate:      validateOpenAIConfig,
+	})
+}
+
+// Register 注册 provider，名称重复时 panic
+func Register(p *Provider) {
+	if p.Name == "" || p.Docker == nil || p.Local == nil {
+		panic(fmt.Sprintf("code: invalid provider %q", p.Name))
+	}
+
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	if _, exists := providers[p.Name]; exists {
+		panic(fmt.Sprintf("code: provider %q already registered", p.Name))
+	}
+	providers[p.Name] = p
+}
+
+// Lookup 按名称查找 provider
+func Lookup(name string) (*Provider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	p, ok := providers[name]
+	return p, ok
+}
+
+// Providers 返回已注册的 provider 名称（按字母序）
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// create 按 use_docker 配置选择工厂创建 Code 实例
+func (p *Provider) create(workspace *models.Workspace, cfg *config.Config) (Code, error) {
+	if p.Validate != nil {
+		if err := p.Validate(cfg); err != nil {
+			return nil, fmt.Errorf("invalid %s config: %w", p.ConfigSection, err)
+		}
+	}
+	if cfg.UseDocker {
+		return p.Docker(workspace, cfg)
+	}
+	return p.Local(workspace, cfg)
+}
@@ -0,0 +1,78 @@
+package code
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/pkg/models"
+)
+
+func TestBuiltinProviders(t *testing.T) {
+	expected := []string{ProviderClaude, ProviderGemini, ProviderOpenAI}
+	if got := Providers(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected providers %v, got %v", expected, got)
+	}
+
+	for _, name := range expected {
+		aiModel, args := models.ParseAIModelFlag("-"+name+" implement it", Providers())
+		if aiModel != name || args != "implement it" {
+			t.Errorf("Expected flag -%s to select %s, got ai_model=%q args=%q", name, name, aiModel, args)
+		}
+	}
+}
+
+func TestRegisterCustomProvider(t *testing.T) {
+	var created []string
+	factory := func(mode string) Factory {
+		return func(workspace *models.Workspace, cfg *config.Config) (Code, error) {
+			created = append(created, mode)
+			return nil, nil
+		}
+	}
+	Register(&Provider{
+		Name:   "test-custom",
+		Docker: factory("docker"),
+		Local:  factory("local"),
+	})
+	defer func() {
+		providersMu.Lock()
+		delete(providers, "test-custom")
+		providersMu.Unlock()
+	}()
+
+	// 新 provider 的命令参数无需修改解析器即可识别
+	if aiModel, args := models.ParseAIModelFlag("-test-custom fix it", Providers()); aiModel != "test-custom" || args != "fix it" {
+		t.Errorf("Unexpected parse result: ai_model=%q args=%q", aiModel, args)
+	}
+
+	if _, err := New(&models.Workspace{AIModel: "test-custom"}, &config.Config{UseDocker: true}); err != nil {
+		t.Fatalf("Failed to create custom provider: %v", err)
+	}
+	if _, err := New(&models.Workspace{}, &config.Config{CodeProvider: "test-custom"}); err != nil {
+		t.Fatalf("Failed to create custom provider: %v", err)
+	}
+	if !reflect.DeepEqual(created, []string{"docker", "local"}) {
+		t.Errorf("Expected docker then local factory, got %v", created)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected duplicate registration to panic")
+		}
+	}()
+	Register(&Provider{Name: "test-custom", Docker: factory("docker"), Local: factory("local")})
+}
+
+func TestNewValidatesProviderConfig(t *testing.T) {
+	_, err := New(&models.Workspace{AIModel: ProviderOpenAI}, &config.Config{})
+	if err == nil || !strings.Contains(err.Error(), "invalid openai config") {
+		t.Errorf("Expected openai config validation error, got %v", err)
+	}
+
+	_, err = New(&models.Workspace{AIModel: "unknown"}, &config.Config{})
+	if err == nil || !strings.Contains(err.Error(), "unsupported code provider") {
+		t.Errorf("Expected unsupported provider error, got %v", err)
+	}
+}
@@ -21,10 +21,19 @@ func NewSessionManager(cfg *config.Config) *SessionManager {
 	}
 }
 
+// DefaultProvider returns the code provider configured for tasks that do not specify one.
+func (sm *SessionManager) DefaultProvider() string {
+	return sm.cfg.CodeProvider
+}
+
+// sessionKey returns the key of a workspace's session, including the AI model: aimodel-org-repo-pr-number.
+func sessionKey(workspace *models.Workspace) string {
+	return fmt.Sprintf("%s-%s-%s-%d", workspace.AIModel, workspace.Org, workspace.Repo, workspace.PRNumber)
+}
+
 // GetSession retrieves an existing Code session or creates a new one.
 func (sm *SessionManager) GetSession(workspace *models.Workspace) (Code, error) {
-	// 新的session key包含AI模型信息：aimodel-org-repo-pr-number
-	key := fmt.Sprintf("%s-%s-%s-%d", workspace.AIModel, workspace.Org, workspace.Repo, workspace.PRNumber)
+	key := sessionKey(workspace)
 	sm.mu.RLock()
 	c, ok := sm.codes[key]
 	sm.mu.RUnlock()
@@ -49,13 +58,35 @@ func (sm *SessionManager) GetSession(workspace *models.Workspace) (Code, error)
 	return c, nil
 }
 
+// NewSession creates a Code session that is not cached by the manager, for one-off tasks
+// on temporary workspaces. The caller must Close it.
+func (sm *SessionManager) NewSession(workspace *models.Workspace) (Code, error) {
+	c, err := New(workspace, sm.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new code session: %w", err)
+	}
+	return c, nil
+}
+
+// CancelSession aborts the running prompt of a Code session, kills the provider process and removes the session.
+func (sm *SessionManager) CancelSession(workspace *models.Workspace) error {
+	sm.mu.Lock()
+	key := sessionKey(workspace)
+	c, ok := sm.codes[key]
+	delete(sm.codes, key)
+	sm.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return c.Cancel()
+}
+
 // CloseSession closes and removes a Code session from the manager.
 func (sm *SessionManager) CloseSession(workspace *models.Workspace) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	// 新的session key包含AI模型信息：aimodel-org-repo-pr-number
-	key := fmt.Sprintf("%s-%s-%s-%d", workspace.AIModel, workspace.Org, workspace.Repo, workspace.PRNumber)
-
+	key := sessionKey(workspace)
 	if c, ok := sm.codes[key]; ok {
 		delete(sm.codes, key)
 		return c.Close()
@@ -1,9 +1,14 @@
 package code
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os/exec"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/qiniu/x/log"
 )
@@ -35,3 +40,70 @@ func extractRepoName(repoURL string) string {
 	// 如果不是标准格式，返回一个安全的名称
 	return "repo"
 }
+
+// defaultPromptTimeout 配置中未设置 timeout 时使用的超时时间
+const defaultPromptTimeout = 5 * time.Minute
+
+// promptTimeout 返回本次调用的超时时间，调用方指定的优先于配置
+func promptTimeout(opts PromptOptions, configured time.Duration) time.Duration {
+	if opts.Timeout > 0 {
+		return opts.Timeout
+	}
+	if configured > 0 {
+		return configured
+	}
+	return defaultPromptTimeout
+}
+
+// claudeOptionArgs 将执行选项转换为 claude CLI 参数
+func claudeOptionArgs(opts PromptOptions) []string {
+	var args []string
+	if opts.MaxTurns > 0 {
+		args = append(args, "--max-turns", strconv.Itoa(opts.MaxTurns))
+	}
+	if len(opts.AllowedTools) > 0 {
+		args = append(args, "--allowedTools", strings.Join(opts.AllowedTools, ","))
+	}
+	return args
+}
+
+// geminiOptionArgs gemini CLI 不支持限制轮数和工具，忽略相应选项
+func geminiOptionArgs(opts PromptOptions) []string {
+	if opts.MaxTurns > 0 || len(opts.AllowedTools) > 0 {
+		log.Warnf("gemini CLI does not support max turns or allowed tools, ignoring these options")
+	}
+	return nil
+}
+
+// streamOutput 流式读取命令输出，读取结束时回收进程并释放 context；
+// 因超时或取消被终止时，读取返回对应的错误
+type streamOutput struct {
+	out    io.Reader
+	cmd    *exec.Cmd
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	once sync.Once
+	err  error
+}
+
+func (s *streamOutput) Read(p []byte) (int, error) {
+	n, err := s.out.Read(p)
+	if err != nil {
+		s.finish()
+		if s.err != nil {
+			return n, s.err
+		}
+	}
+	return n, err
+}
+
+func (s *streamOutput) finish() {
+	s.once.Do(func() {
+		s.cmd.Wait()
+		if s.ctx.Err() != nil {
+			s.err = fmt.Errorf("prompt aborted: %w", context.Cause(s.ctx))
+		}
+		s.cancel()
+	})
+}
@@ -0,0 +1,72 @@
+package code
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPromptTimeout(t *testing.T) {
+	if got := promptTimeout(PromptOptions{Timeout: time.Minute}, time.Hour); got != time.Minute {
+		t.Errorf("Expected per-call timeout to take precedence, got %s", got)
+	}
+	if got := promptTimeout(PromptOptions{}, time.Hour); got != time.Hour {
+		t.Errorf("Expected configured timeout, got %s", got)
+	}
+	if got := promptTimeout(PromptOptions{}, 0); got != defaultPromptTimeout {
+		t.Errorf("Expected default timeout, got %s", got)
+	}
+}
+
+func TestClaudeOptionArgs(t *testing.T) {
+	if args := claudeOptionArgs(PromptOptions{}); len(args) != 0 {
+		t.Errorf("Expected no args for zero options, got %v", args)
+	}
+
+	args := claudeOptionArgs(PromptOptions{MaxTurns: 5, AllowedTools: []string{"Read", "Edit"}})
+	expected := []string{"--max-turns", "5", "--allowedTools", "Read,Edit"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+}
+
+func startStream(t *testing.T, ctx context.Context, name string, args ...string) io.Reader {
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(ctx, name, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("Failed to create stdout pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("%s not available: %v", name, err)
+	}
+	return &streamOutput{out: stdout, cmd: cmd, ctx: ctx, cancel: cancel}
+}
+
+func TestStreamOutputCompletes(t *testing.T) {
+	out, err := io.ReadAll(startStream(t, context.Background(), "echo", "hello"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(out) != "hello\n" {
+		t.Errorf("Unexpected output: %q", out)
+	}
+}
+
+func TestStreamOutputTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := io.ReadAll(startStream(t, ctx, "sleep", "10"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected process to be killed on timeout, took %s", elapsed)
+	}
+}
@@ -4,21 +4,39 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Server       ServerConfig    `yaml:"server"`
-	GitHub       GitHubConfig    `yaml:"github"`
-	Workspace    WorkspaceConfig `yaml:"workspace"`
-	Claude       ClaudeConfig    `yaml:"claude"`
-	Gemini       GeminiConfig    `yaml:"gemini"`
-	Docker       DockerConfig    `yaml:"docker"`
-	CodeProvider string          `yaml:"code_provider"`
-	UseDocker    bool            `yaml:"use_docker"`
+	Server       ServerConfig       `yaml:"server"`
+	GitHub       GitHubConfig       `yaml:"github"`
+	Workspace    WorkspaceConfig    `yaml:"workspace"`
+	Claude       ClaudeConfig       `yaml:"claude"`
+	Gemini       GeminiConfig       `yaml:"gemini"`
+	OpenAI       OpenAIConfig       `yaml:"openai"`
+	Docker       DockerConfig       `yaml:"docker"`
+	Queue        QueueConfig        `yaml:"queue"`
+	Dedup        DedupConfig        `yaml:"dedup"`
+	Usage        UsageConfig        `yaml:"usage"`
+	Concurrency  ConcurrencyConfig  `yaml:"concurrency"`
+	Budgets      BudgetConfig       `yaml:"budgets"`
+	AutoProcess  AutoProcessConfig  `yaml:"auto_process"`
+	Schedules    []ScheduleConfig   `yaml:"schedules"`
+	Dispatch     DispatchConfig     `yaml:"dispatch"`
+	Permissions  PermissionConfig   `yaml:"permissions"`
+	LoopGuard    LoopGuardConfig    `yaml:"loop_guard"`
+	SecretScan   SecretScanConfig   `yaml:"secret_scan"`
+	PushAnalysis PushAnalysisConfig `yaml:"push_analysis"`
+	Prompts      PromptsConfig      `yaml:"prompts"`
+	CodeProvider string             `yaml:"code_provider"`
+	UseDocker    bool               `yaml:"use_docker"`
+	// PR 描述、进度评论和提示词使用的语言（zh、en），默认为 zh
+	Locale string `yaml:"locale"`
 }
 
 type GeminiConfig struct {
@@ -28,14 +46,89 @@ type GeminiConfig struct {
 	GoogleCloudProject string        `yaml:"google_cloud_project"`
 }
 
+// OpenAIConfig OpenAI 兼容接口（如 vLLM、Ollama 网关）的配置
+type OpenAIConfig struct {
+	BaseURL string        `yaml:"base_url"` // 例如 http://gateway:8000/v1
+	APIKey  string        `yaml:"api_key"`
+	Model   string        `yaml:"model"`
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxTurns 单次 prompt 中模型与工具交互的最大轮数，默认 DefaultOpenAIMaxTurns
+	MaxTurns int `yaml:"max_turns"`
+}
+
+// DefaultOpenAIMaxTurns 未配置 openai.max_turns 时的最大轮数
+const DefaultOpenAIMaxTurns = 30
+
 type ServerConfig struct {
 	Port          int    `yaml:"port"`
 	WebhookSecret string `yaml:"webhook_secret"`
+	// 同时有效的其他 webhook secret。轮换时先加入新 secret，确认旧 secret 不再被匹配后再移除
+	WebhookSecrets []string `yaml:"webhook_secrets"`
+	// 仓库（org/repo）或组织（org）单独配置的 webhook secret
+	RepoWebhookSecrets map[string][]string `yaml:"repo_webhook_secrets"`
+	// GitHub App 安装实例单独配置的 webhook secret，key 为安装实例 ID
+	InstallationWebhookSecrets map[int64][]string `yaml:"installation_webhook_secrets"`
+	// /webhook/signatures 接口的访问令牌，为空时接口关闭，建议通过 SIGNATURE_STATS_TOKEN 环境变量设置
+	SignatureStatsToken string `yaml:"signature_stats_token"`
+}
+
+// NamedSecret 验证 webhook 签名的 secret，Name 标识其在配置中的位置，用于统计匹配情况而不暴露 secret
+type NamedSecret struct {
+	Name  string
+	Value string
+}
+
+// HasWebhookSecrets 是否配置了任意 webhook secret，未配置时不验证签名
+func (c ServerConfig) HasWebhookSecrets() bool {
+	return c.WebhookSecret != "" || len(c.WebhookSecrets) > 0 || len(c.RepoWebhookSecrets) > 0 || len(c.InstallationWebhookSecrets) > 0
+}
+
+// WebhookSecretsFor 返回验证仓库（org/repo）或 GitHub App 安装实例的投递时依次尝试的 secret：
+// 仓库、组织和安装实例的 secret 优先，然后是全局的 webhook_secret 和 webhook_secrets
+func (c ServerConfig) WebhookSecretsFor(fullName string, installationID int64) []NamedSecret {
+	var secrets []NamedSecret
+	add := func(name string, values []string) {
+		for i, value := range values {
+			if value != "" {
+				secrets = append(secrets, NamedSecret{Name: fmt.Sprintf("%s#%d", name, i), Value: value})
+			}
+		}
+	}
+
+	if fullName != "" {
+		add("repo:"+fullName, c.RepoWebhookSecrets[fullName])
+		if org, _, ok := strings.Cut(fullName, "/"); ok {
+			add("org:"+org, c.RepoWebhookSecrets[org])
+		}
+	}
+	if installationID != 0 {
+		add(fmt.Sprintf("installation:%d", installationID), c.InstallationWebhookSecrets[installationID])
+	}
+	if c.WebhookSecret != "" {
+		secrets = append(secrets, NamedSecret{Name: "webhook_secret", Value: c.WebhookSecret})
+	}
+	add("webhook_secrets", c.WebhookSecrets)
+	return secrets
 }
 
 type GitHubConfig struct {
 	Token      string `yaml:"token"`
 	WebhookURL string `yaml:"webhook_url"`
+	// GitHub App 认证，配置后代替 token
+	App GitHubAppConfig `yaml:"app"`
+}
+
+// GitHubAppConfig GitHub App 配置，每个组织或用户使用其安装实例的令牌访问 API 和推送代码
+type GitHubAppConfig struct {
+	ID int64 `yaml:"id"`
+	// PEM 格式的私钥，或通过 private_key_file 指定私钥文件
+	PrivateKey     string `yaml:"private_key"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+}
+
+// Enabled 是否配置了 GitHub App
+func (c GitHubAppConfig) Enabled() bool {
+	return c.ID != 0
 }
 
 type WorkspaceConfig struct {
@@ -57,6 +150,196 @@ type DockerConfig struct {
 	Network string `yaml:"network"`
 }
 
+// QueueConfig 持久化任务队列配置
+type QueueConfig struct {
+	// 任务文件存放目录，默认为 {workspace.base_dir}/.queue
+	Dir string `yaml:"dir"`
+	// 并发执行任务的 worker 数量
+	Workers int `yaml:"workers"`
+	// 任务最多执行次数（服务重启时中断的任务会被恢复执行，直到达到该次数）
+	MaxAttempts int `yaml:"max_attempts"`
+	// 已结束任务的保留时间
+	Retention time.Duration `yaml:"retention"`
+}
+
+// PromptsConfig 提示词模板配置
+type PromptsConfig struct {
+	// 自定义模板目录，目录中的 {name}.tmpl 覆盖同名的内置模板，为空时使用内置模板
+	Dir string `yaml:"dir"`
+}
+
+// ConcurrencyConfig 任务并发限制，0 表示不限制
+type ConcurrencyConfig struct {
+	// 全局同时执行的任务数
+	Global int `yaml:"global"`
+	// 每个组织同时执行的任务数
+	PerOrg int `yaml:"per_org"`
+	// 每个仓库同时执行的任务数
+	PerRepo int `yaml:"per_repo"`
+	// 每个 Issue/PR 同时执行的任务数
+	PerPR int `yaml:"per_pr"`
+	// 按仓库单独配置的并发数，key 为 org/repo，优先于 per_repo
+	Repos map[string]int `yaml:"repos"`
+}
+
+// DedupConfig webhook 投递去重配置
+type DedupConfig struct {
+	// 已接收投递 ID 的持久化文件，默认为 {workspace.base_dir}/.deliveries.json
+	File string `yaml:"file"`
+	// 投递 ID 的保留时间，GitHub 允许重新投递最近 3 天内的事件
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// UsageConfig token 用量统计配置
+type UsageConfig struct {
+	// 用量记录文件（JSON Lines），默认为 {workspace.base_dir}/.usage.jsonl
+	File string `yaml:"file"`
+	// /usage 接口的访问令牌，为空时接口关闭，建议通过 USAGE_TOKEN 环境变量设置
+	Token string `yaml:"token"`
+	// 用量记录的保留时间，默认 90 天，不能短于预算的统计周期（自然月按 31 天计），否则加载配置失败
+	Retention time.Duration `yaml:"retention"`
+}
+
+// BudgetConfig 用量预算，预计会超出预算的命令不会被执行
+type BudgetConfig struct {
+	// 每个仓库、组织、用户的默认预算
+	PerRepo BudgetLimit `yaml:"per_repo"`
+	PerOrg  BudgetLimit `yaml:"per_org"`
+	PerUser BudgetLimit `yaml:"per_user"`
+	// 单独配置的预算，优先于默认值，key 分别为 org/repo、org 和用户名
+	Repos map[string]BudgetLimit `yaml:"repos"`
+	Orgs  map[string]BudgetLimit `yaml:"orgs"`
+	Users map[string]BudgetLimit `yaml:"users"`
+	// 不受预算限制的用户（如管理员），不区分大小写
+	Exempt []string `yaml:"exempt"`
+}
+
+// BudgetLimit 按自然日和自然月（UTC）计算的预算，0 表示不限制
+type BudgetLimit struct {
+	// token 数（输入 + 输出，不含缓存）
+	DailyTokens   int `yaml:"daily_tokens"`
+	MonthlyTokens int `yaml:"monthly_tokens"`
+	// AI 运行时长（分钟）
+	DailyMinutes   int `yaml:"daily_minutes"`
+	MonthlyMinutes int `yaml:"monthly_minutes"`
+}
+
+// AutoProcessConfig 自动处理 Issue 的触发条件，未配置时不自动处理
+type AutoProcessConfig struct {
+	AutoProcessRule `yaml:",inline"`
+	// 按仓库单独配置的触发条件，key 为 org/repo，优先于默认值
+	Repos map[string]AutoProcessRule `yaml:"repos"`
+}
+
+// AutoProcessRule 自动处理 Issue 的触发条件
+type AutoProcessRule struct {
+	// 添加这些标签时自动处理（不区分大小写）
+	Labels []string `yaml:"labels"`
+	// Issue 被分配给该账号时自动处理，通常为 CodeAgent 使用的 bot 账号
+	Assignee string `yaml:"assignee"`
+	// 是否自动处理所有新创建的 Issue
+	OnOpen bool `yaml:"on_open"`
+}
+
+// ForRepo 返回仓库（org/repo）的自动处理触发条件
+func (c AutoProcessConfig) ForRepo(fullName string) AutoProcessRule {
+	if rule, ok := c.Repos[fullName]; ok {
+		return rule
+	}
+	return c.AutoProcessRule
+}
+
+// ScheduleConfig 定时任务配置，仅 Enhanced Agent 支持
+type ScheduleConfig struct {
+	// 任务名称，用于日志和用量统计
+	Name string `yaml:"name"`
+	// 标准 5 段 cron 表达式（分 时 日 月 周），也支持 @daily、@hourly 等简写
+	Cron string `yaml:"cron"`
+	// cron 表达式使用的时区，默认为 UTC
+	Timezone string `yaml:"timezone"`
+	// 任务类型：stale_issues、code、workspace_report
+	Task string `yaml:"task"`
+	// 任务作用的仓库（org/repo），每次触发时逐个执行；为空时只执行一次且不关联仓库
+	Repos []string `yaml:"repos"`
+	// 传给任务的参数
+	Inputs map[string]string `yaml:"inputs"`
+}
+
+// DispatchConfig 手动任务接口（POST /dispatch）配置，仅 Enhanced Agent 支持
+type DispatchConfig struct {
+	// 接口的访问令牌，为空时不启用接口，建议通过 DISPATCH_TOKEN 环境变量设置
+	Token string `yaml:"token"`
+}
+
+// PermissionConfig 触发命令（/code、/continue、/fix 等）的权限要求
+type PermissionConfig struct {
+	// 触发命令需要的最低仓库权限：read、triage、write、maintain、admin，默认为 write
+	MinPermission string `yaml:"min_permission"`
+	// 不论仓库权限都允许触发命令的用户
+	AllowUsers []string `yaml:"allow_users"`
+	// 不论仓库权限都允许触发命令的团队（org/team-slug）
+	AllowTeams []string `yaml:"allow_teams"`
+	// 禁止触发命令的用户，优先于允许列表和仓库权限
+	DenyUsers []string `yaml:"deny_users"`
+	// 禁止触发命令的团队（org/team-slug），优先于允许列表和仓库权限
+	DenyTeams []string `yaml:"deny_teams"`
+}
+
+// LoopGuardConfig 同一 Issue/PR 上的任务次数限制，防止 CodeAgent 被自己或其他机器人的评论、推送反复触发
+type LoopGuardConfig struct {
+	// window 内同一 Issue/PR 最多执行的任务数，默认为 10，负数表示不限制
+	MaxRuns int `yaml:"max_runs"`
+	// 统计任务数的时间窗口，默认为 1h
+	Window time.Duration `yaml:"window"`
+}
+
+// SecretScanConfig 提交前扫描 AI 改动中的密钥和凭证，发现时不推送并还原相关文件
+type SecretScanConfig struct {
+	// 关闭扫描，默认开启
+	Disabled bool `yaml:"disabled"`
+	// 在内置规则之外追加的规则
+	Rules []SecretRule `yaml:"rules"`
+	// 不扫描的文件，glob 匹配仓库中的相对路径或文件名
+	AllowPaths []string `yaml:"allow_paths"`
+	// 忽略的匹配内容（正则表达式），例如文档中的示例密钥
+	Allowlist []string `yaml:"allowlist"`
+}
+
+// SecretRule 密钥扫描规则，Pattern 为匹配新增行的正则表达式
+type SecretRule struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+}
+
+// PushAnalysisConfig 推送后分析配置：分析推送到受保护分支的提交，发现可能的回归、安全问题或缺失的测试时创建 Issue
+type PushAnalysisConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// 需要分析的分支名，为空时只分析仓库的默认分支
+	Branches []string `yaml:"branches"`
+	// 需要分析的仓库（org/repo），为空时分析所有仓库
+	Repos []string `yaml:"repos"`
+	// 创建的 Issue 添加的标签
+	Labels []string `yaml:"labels"`
+}
+
+// ShouldAnalyze 判断仓库（org/repo）中推送到 ref 的提交是否需要分析
+func (c PushAnalysisConfig) ShouldAnalyze(fullName, ref, defaultBranch string) bool {
+	if !c.Enabled {
+		return false
+	}
+	if len(c.Repos) > 0 && !slices.Contains(c.Repos, fullName) {
+		return false
+	}
+	branch, ok := strings.CutPrefix(ref, "refs/heads/")
+	if !ok {
+		return false
+	}
+	if len(c.Branches) == 0 {
+		return branch != "" && branch == defaultBranch
+	}
+	return slices.Contains(c.Branches, branch)
+}
+
 func Load(configPath string) (*Config, error) {
 	// 首先尝试从文件加载
 	if _, err := os.Stat(configPath); err == nil {
@@ -75,6 +358,10 @@ func Load(configPath string) (*Config, error) {
 
 		// 将相对路径转换为绝对路径
 		config.resolvePaths(filepath.Dir(configPath))
+		config.setDefaults()
+		if err := config.validate(); err != nil {
+			return nil, err
+		}
 
 		return &config, nil
 	}
@@ -83,6 +370,10 @@ func Load(configPath string) (*Config, error) {
 	config := loadFromEnv()
 	// 将相对路径转换为绝对路径（相对于当前工作目录）
 	config.resolvePaths(".")
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
 	return config, nil
 }
 
@@ -108,6 +399,15 @@ func (c *Config) loadFromEnv() {
 	if project := os.Getenv("GOOGLE_CLOUD_PROJECT"); project != "" {
 		c.Gemini.GoogleCloudProject = project
 	}
+	if baseURL := os.Getenv("OPENAI_BASE_URL"); baseURL != "" {
+		c.OpenAI.BaseURL = baseURL
+	}
+	if apiKey := os.Getenv("OPENAI_API_KEY"); apiKey != "" {
+		c.OpenAI.APIKey = apiKey
+	}
+	if model := os.Getenv("OPENAI_MODEL"); model != "" {
+		c.OpenAI.Model = model
+	}
 	if provider := os.Getenv("CODE_PROVIDER"); provider != "" {
 		c.CodeProvider = provider
 	} else {
@@ -117,6 +417,35 @@ func (c *Config) loadFromEnv() {
 	if secret := os.Getenv("WEBHOOK_SECRET"); secret != "" {
 		c.Server.WebhookSecret = secret
 	}
+	if secrets := os.Getenv("WEBHOOK_SECRETS"); secrets != "" {
+		c.Server.WebhookSecrets = splitList(secrets)
+	}
+	if token := os.Getenv("SIGNATURE_STATS_TOKEN"); token != "" {
+		c.Server.SignatureStatsToken = token
+	}
+	if token := os.Getenv("USAGE_TOKEN"); token != "" {
+		c.Usage.Token = token
+	}
+	if token := os.Getenv("DISPATCH_TOKEN"); token != "" {
+		c.Dispatch.Token = token
+	}
+	if dir := os.Getenv("PROMPTS_DIR"); dir != "" {
+		c.Prompts.Dir = dir
+	}
+	if locale := os.Getenv("LOCALE"); locale != "" {
+		c.Locale = locale
+	}
+	if appID := os.Getenv("GITHUB_APP_ID"); appID != "" {
+		if id, err := strconv.ParseInt(appID, 10, 64); err == nil {
+			c.GitHub.App.ID = id
+		}
+	}
+	if key := os.Getenv("GITHUB_APP_PRIVATE_KEY"); key != "" {
+		c.GitHub.App.PrivateKey = key
+	}
+	if keyFile := os.Getenv("GITHUB_APP_PRIVATE_KEY_FILE"); keyFile != "" {
+		c.GitHub.App.PrivateKeyFile = keyFile
+	}
 	if portStr := os.Getenv("PORT"); portStr != "" {
 		if port, err := strconv.Atoi(portStr); err == nil {
 			c.Server.Port = port
@@ -136,15 +465,28 @@ func loadFromEnv() *Config {
 			port = p
 		}
 	}
+	var appID int64
+	if appIDStr := os.Getenv("GITHUB_APP_ID"); appIDStr != "" {
+		if id, err := strconv.ParseInt(appIDStr, 10, 64); err == nil {
+			appID = id
+		}
+	}
 
 	return &Config{
 		Server: ServerConfig{
-			Port:          port,
-			WebhookSecret: os.Getenv("WEBHOOK_SECRET"),
+			Port:                port,
+			WebhookSecret:       os.Getenv("WEBHOOK_SECRET"),
+			WebhookSecrets:      splitList(os.Getenv("WEBHOOK_SECRETS")),
+			SignatureStatsToken: os.Getenv("SIGNATURE_STATS_TOKEN"),
 		},
 		GitHub: GitHubConfig{
 			Token:      os.Getenv("GITHUB_TOKEN"),
 			WebhookURL: os.Getenv("WEBHOOK_URL"),
+			App: GitHubAppConfig{
+				ID:             appID,
+				PrivateKey:     os.Getenv("GITHUB_APP_PRIVATE_KEY"),
+				PrivateKeyFile: os.Getenv("GITHUB_APP_PRIVATE_KEY_FILE"),
+			},
 		},
 		Workspace: WorkspaceConfig{
 			BaseDir:      getEnvOrDefault("WORKSPACE_BASE_DIR", "/tmp/codeagent"),
@@ -164,12 +506,31 @@ func loadFromEnv() *Config {
 			Timeout:            30 * time.Minute,
 			GoogleCloudProject: os.Getenv("GOOGLE_CLOUD_PROJECT"),
 		},
+		OpenAI: OpenAIConfig{
+			BaseURL: os.Getenv("OPENAI_BASE_URL"),
+			APIKey:  os.Getenv("OPENAI_API_KEY"),
+			Model:   os.Getenv("OPENAI_MODEL"),
+			Timeout: 30 * time.Minute,
+		},
 		Docker: DockerConfig{
 			Socket:  getEnvOrDefault("DOCKER_SOCKET", "unix:///var/run/docker.sock"),
 			Network: getEnvOrDefault("DOCKER_NETWORK", "bridge"),
 		},
+		Queue: QueueConfig{
+			Dir: os.Getenv("QUEUE_DIR"),
+		},
+		Usage: UsageConfig{
+			Token: os.Getenv("USAGE_TOKEN"),
+		},
+		Dispatch: DispatchConfig{
+			Token: os.Getenv("DISPATCH_TOKEN"),
+		},
+		Prompts: PromptsConfig{
+			Dir: os.Getenv("PROMPTS_DIR"),
+		},
 		CodeProvider: getEnvOrDefault("CODE_PROVIDER", "claude"),
 		UseDocker:    getEnvBoolOrDefault("USE_DOCKER", true),
+		Locale:       os.Getenv("LOCALE"),
 	}
 }
 
@@ -185,6 +546,128 @@ func (c *Config) resolvePaths(configDir string) {
 			}
 		}
 	}
+
+	// 处理任务队列目录
+	if c.Queue.Dir != "" && !filepath.IsAbs(c.Queue.Dir) {
+		absPath, err := filepath.Abs(filepath.Join(configDir, c.Queue.Dir))
+		if err == nil {
+			c.Queue.Dir = absPath
+		}
+	}
+
+	// 处理投递去重文件
+	if c.Dedup.File != "" && !filepath.IsAbs(c.Dedup.File) {
+		absPath, err := filepath.Abs(filepath.Join(configDir, c.Dedup.File))
+		if err == nil {
+			c.Dedup.File = absPath
+		}
+	}
+
+	// 处理用量记录文件
+	if c.Usage.File != "" && !filepath.IsAbs(c.Usage.File) {
+		absPath, err := filepath.Abs(filepath.Join(configDir, c.Usage.File))
+		if err == nil {
+			c.Usage.File = absPath
+		}
+	}
+
+	// 处理提示词模板目录
+	if c.Prompts.Dir != "" && !filepath.IsAbs(c.Prompts.Dir) {
+		absPath, err := filepath.Abs(filepath.Join(configDir, c.Prompts.Dir))
+		if err == nil {
+			c.Prompts.Dir = absPath
+		}
+	}
+
+	// 处理 GitHub App 私钥文件
+	if c.GitHub.App.PrivateKeyFile != "" && !filepath.IsAbs(c.GitHub.App.PrivateKeyFile) {
+		absPath, err := filepath.Abs(filepath.Join(configDir, c.GitHub.App.PrivateKeyFile))
+		if err == nil {
+			c.GitHub.App.PrivateKeyFile = absPath
+		}
+	}
+}
+
+// setDefaults 为未配置的可选项填充默认值
+func (c *Config) setDefaults() {
+	if c.Queue.Dir == "" {
+		c.Queue.Dir = filepath.Join(c.Workspace.BaseDir, ".queue")
+	}
+	if c.Queue.Workers <= 0 {
+		// 受并发限制的任务留在队列中，不占用 worker
+		c.Queue.Workers = 16
+	}
+	if c.Queue.MaxAttempts <= 0 {
+		c.Queue.MaxAttempts = 2
+	}
+	if c.Queue.Retention <= 0 {
+		c.Queue.Retention = 72 * time.Hour
+	}
+	if c.Dedup.File == "" {
+		c.Dedup.File = filepath.Join(c.Workspace.BaseDir, ".deliveries.json")
+	}
+	if c.Dedup.TTL <= 0 {
+		c.Dedup.TTL = 72 * time.Hour
+	}
+	if c.OpenAI.MaxTurns <= 0 {
+		c.OpenAI.MaxTurns = DefaultOpenAIMaxTurns
+	}
+	if c.Usage.File == "" {
+		c.Usage.File = filepath.Join(c.Workspace.BaseDir, ".usage.jsonl")
+	}
+	if c.Usage.Retention <= 0 {
+		c.Usage.Retention = 90 * 24 * time.Hour
+	}
+	if c.Permissions.MinPermission == "" {
+		c.Permissions.MinPermission = "write"
+	}
+	if c.LoopGuard.MaxRuns == 0 {
+		c.LoopGuard.MaxRuns = 10
+	}
+	if c.LoopGuard.Window <= 0 {
+		c.LoopGuard.Window = time.Hour
+	}
+}
+
+// validate 检查配置项之间的约束
+func (c *Config) validate() error {
+	// 被清理的用量记录不再计入预算，保留时间短于统计周期会低估已用预算
+	if period := c.Budgets.longestPeriod(); c.Usage.Retention < period {
+		return fmt.Errorf("usage.retention (%s) must not be shorter than the longest budget period (%s)", c.Usage.Retention, period)
+	}
+	return nil
+}
+
+// longestPeriod 返回已配置预算中最长的统计周期（自然月按 31 天计），未配置预算时返回 0
+func (c BudgetConfig) longestPeriod() time.Duration {
+	limits := []BudgetLimit{c.PerRepo, c.PerOrg, c.PerUser}
+	for _, m := range []map[string]BudgetLimit{c.Repos, c.Orgs, c.Users} {
+		for _, limit := range m {
+			limits = append(limits, limit)
+		}
+	}
+
+	var period time.Duration
+	for _, limit := range limits {
+		if limit.MonthlyTokens > 0 || limit.MonthlyMinutes > 0 {
+			return 31 * 24 * time.Hour
+		}
+		if limit.DailyTokens > 0 || limit.DailyMinutes > 0 {
+			period = 24 * time.Hour
+		}
+	}
+	return period
+}
+
+// splitList 解析逗号分隔的列表，忽略空项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestResolvePaths(t *testing.T) {
@@ -125,6 +127,23 @@ func TestClaudeEnvironmentVariables(t *testing.T) {
 	}
 }
 
+func TestGitHubAppEnvironmentVariables(t *testing.T) {
+	t.Setenv("GITHUB_APP_ID", "12345")
+	t.Setenv("GITHUB_APP_PRIVATE_KEY_FILE", "keys/app.pem")
+
+	config, err := Load("nonexistent.yaml")
+	if err != nil {
+		t.Fatalf("Failed to load config from env: %v", err)
+	}
+
+	if !config.GitHub.App.Enabled() || config.GitHub.App.ID != 12345 {
+		t.Errorf("Expected GitHub App 12345, got %d", config.GitHub.App.ID)
+	}
+	if !filepath.IsAbs(config.GitHub.App.PrivateKeyFile) || !strings.HasSuffix(config.GitHub.App.PrivateKeyFile, filepath.Join("keys", "app.pem")) {
+		t.Errorf("Expected absolute private key path, got %s", config.GitHub.App.PrivateKeyFile)
+	}
+}
+
 func TestClaudeConfigFileOverride(t *testing.T) {
 	// 创建临时目录
 	tempDir, err := os.MkdirTemp("", "config-test")
@@ -172,3 +191,204 @@ func TestClaudeConfigFileOverride(t *testing.T) {
 		t.Errorf("Expected Claude base URL to be %s (from env), got %s", envBaseURL, config.Claude.BaseURL)
 	}
 }
+
+func TestAutoProcessForRepo(t *testing.T) {
+	tempDir := t.TempDir()
+
+	configContent := `auto_process:
+  labels: [codeagent]
+  assignee: codeagent-bot
+  repos:
+    org/busy:
+      labels: [ai-assist]
+      on_open: true
+`
+	configPath := filepath.Join(tempDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	config, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	rule := config.AutoProcess.ForRepo("org/other")
+	if len(rule.Labels) != 1 || rule.Labels[0] != "codeagent" || rule.Assignee != "codeagent-bot" || rule.OnOpen {
+		t.Errorf("Unexpected default rule: %+v", rule)
+	}
+
+	// 单独配置的仓库完全覆盖默认值
+	rule = config.AutoProcess.ForRepo("org/busy")
+	if len(rule.Labels) != 1 || rule.Labels[0] != "ai-assist" || rule.Assignee != "" || !rule.OnOpen {
+		t.Errorf("Unexpected repo rule: %+v", rule)
+	}
+}
+
+func TestWebhookSecretsFor(t *testing.T) {
+	tempDir := t.TempDir()
+
+	configContent := `server:
+  webhook_secret: current
+  webhook_secrets: [previous]
+  repo_webhook_secrets:
+    org/repo: [repo-new, repo-old]
+    org: [org-secret]
+  installation_webhook_secrets:
+    42: [install-secret]
+`
+	configPath := filepath.Join(tempDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	config, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if !config.Server.HasWebhookSecrets() {
+		t.Fatal("Expected webhook secrets to be configured")
+	}
+
+	names := func(secrets []NamedSecret) string {
+		var parts []string
+		for _, secret := range secrets {
+			parts = append(parts, secret.Name+"="+secret.Value)
+		}
+		return strings.Join(parts, ",")
+	}
+
+	// 仓库、组织、安装实例的 secret 优先于全局 secret
+	got := names(config.Server.WebhookSecretsFor("org/repo", 42))
+	want := "repo:org/repo#0=repo-new,repo:org/repo#1=repo-old,org:org#0=org-secret,installation:42#0=install-secret,webhook_secret=current,webhook_secrets#0=previous"
+	if got != want {
+		t.Errorf("Unexpected secrets for org/repo:\n got: %s\nwant: %s", got, want)
+	}
+
+	got = names(config.Server.WebhookSecretsFor("other/repo", 0))
+	want = "webhook_secret=current,webhook_secrets#0=previous"
+	if got != want {
+		t.Errorf("Unexpected secrets for other/repo:\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestWebhookSecretsEnvironmentVariable(t *testing.T) {
+	t.Setenv("WEBHOOK_SECRETS", "new, old,")
+
+	config, err := Load("nonexistent.yaml")
+	if err != nil {
+		t.Fatalf("Failed to load config from env: %v", err)
+	}
+
+	if len(config.Server.WebhookSecrets) != 2 || config.Server.WebhookSecrets[0] != "new" || config.Server.WebhookSecrets[1] != "old" {
+		t.Errorf("Expected webhook secrets [new old], got %v", config.Server.WebhookSecrets)
+	}
+	if !config.Server.HasWebhookSecrets() {
+		t.Error("Expected webhook secrets to be configured")
+	}
+}
+
+func TestPushAnalysisShouldAnalyze(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   PushAnalysisConfig
+		repo     string
+		ref      string
+		expected bool
+	}{
+		{"disabled", PushAnalysisConfig{}, "org/repo", "refs/heads/main", false},
+		{"default branch", PushAnalysisConfig{Enabled: true}, "org/repo", "refs/heads/main", true},
+		{"other branch", PushAnalysisConfig{Enabled: true}, "org/repo", "refs/heads/feature", false},
+		{"tag", PushAnalysisConfig{Enabled: true}, "org/repo", "refs/tags/main", false},
+		{"configured branch", PushAnalysisConfig{Enabled: true, Branches: []string{"release"}}, "org/repo", "refs/heads/release", true},
+		{"configured branches exclude default", PushAnalysisConfig{Enabled: true, Branches: []string{"release"}}, "org/repo", "refs/heads/main", false},
+		{"repo not in allowlist", PushAnalysisConfig{Enabled: true, Repos: []string{"org/other"}}, "org/repo", "refs/heads/main", false},
+		{"repo in allowlist", PushAnalysisConfig{Enabled: true, Repos: []string{"org/repo"}}, "org/repo", "refs/heads/main", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.ShouldAnalyze(tt.repo, tt.ref, "main"); got != tt.expected {
+				t.Errorf("ShouldAnalyze() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateUsageRetention(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		name      string
+		budgets   BudgetConfig
+		retention time.Duration
+		wantErr   bool
+	}{
+		{"no budgets", BudgetConfig{}, time.Hour, false},
+		{"daily budget", BudgetConfig{PerUser: BudgetLimit{DailyTokens: 1000}}, day, false},
+		{"daily budget with short retention", BudgetConfig{PerUser: BudgetLimit{DailyMinutes: 60}}, 12 * time.Hour, true},
+		{"monthly budget", BudgetConfig{PerRepo: BudgetLimit{MonthlyTokens: 1000}}, 90 * day, false},
+		{"monthly budget with short retention", BudgetConfig{PerRepo: BudgetLimit{MonthlyTokens: 1000}}, 7 * day, true},
+		{"monthly repo override with short retention", BudgetConfig{Repos: map[string]BudgetLimit{"org/repo": {MonthlyMinutes: 600}}}, 30 * day, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{Budgets: tt.budgets, Usage: UsageConfig{Retention: tt.retention}}
+			if err := c.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseRepoConfig(t *testing.T) {
+	rc, err := ParseRepoConfig([]byte(`code_provider: gemini
+modes: [tag, review]
+auto_process:
+  labels: [ai]
+instructions: |
+  Run make lint before committing.
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse repo config: %v", err)
+	}
+	if rc.Provider("claude") != "gemini" {
+		t.Errorf("Provider() = %s, want gemini", rc.Provider("claude"))
+	}
+	if !rc.ModeEnabled("tag") || rc.ModeEnabled("agent") {
+		t.Errorf("Unexpected modes: %v", rc.Modes)
+	}
+	global := AutoProcessConfig{AutoProcessRule: AutoProcessRule{Assignee: "codeagent-bot"}}
+	if rule := rc.AutoProcessRule(global, "org/repo"); len(rule.Labels) != 1 || rule.Labels[0] != "ai" || rule.Assignee != "" {
+		t.Errorf("Unexpected auto process rule: %+v", rule)
+	}
+	if got := rc.AppendInstructions("prompt", "## Repository instructions"); got != "prompt\n\n## Repository instructions\nRun make lint before committing." {
+		t.Errorf("AppendInstructions() = %q", got)
+	}
+
+	// 空文件和没有配置文件的仓库使用全局配置
+	for _, rc := range []*RepoConfig{mustParseRepoConfig(t, ""), nil} {
+		if rc.Provider("claude") != "claude" || !rc.ModeEnabled("agent") || rc.AppendInstructions("prompt", "## Repository instructions") != "prompt" {
+			t.Errorf("Expected global defaults for %+v", rc)
+		}
+		if rule := rc.AutoProcessRule(global, "org/repo"); rule.Assignee != "codeagent-bot" {
+			t.Errorf("Unexpected auto process rule: %+v", rule)
+		}
+	}
+
+	// 拼写错误的字段和不支持的模式视为错误
+	for _, content := range []string{"code_providr: gemini\n", "modes: [tags]\n"} {
+		if _, err := ParseRepoConfig([]byte(content)); err == nil {
+			t.Errorf("Expected error for %q", content)
+		}
+	}
+}
+
+func mustParseRepoConfig(t *testing.T, content string) *RepoConfig {
+	t.Helper()
+	rc, err := ParseRepoConfig([]byte(content))
+	if err != nil {
+		t.Fatalf("Failed to parse repo config: %v", err)
+	}
+	return rc
+}
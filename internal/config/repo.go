@@ -0,0 +1,100 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RepoConfigFile 仓库级配置文件名，从仓库默认分支的根目录读取
+const RepoConfigFile = ".codeagent.yaml"
+
+// repoModes 仓库级配置中可以启用的模式
+var repoModes = []string{"tag", "agent", "review"}
+
+// RepoConfig 仓库级配置（.codeagent.yaml），合并在服务端全局配置之上，未设置的字段使用全局配置
+type RepoConfig struct {
+	// 默认使用的 AI 模型，覆盖 code_provider
+	CodeProvider string `yaml:"code_provider"`
+	// 启用的模式：tag（命令）、agent（自动处理 Issue、定时和手动任务）、review（自动审查和推送分析），为空时全部启用
+	Modes []string `yaml:"modes"`
+	// 自动处理 Issue 的触发条件，覆盖 auto_process
+	AutoProcess *AutoProcessRule `yaml:"auto_process"`
+	// 追加到提示词中的仓库说明，例如代码规范、测试要求
+	Instructions string `yaml:"instructions"`
+	// 覆盖提示词模板，key 为模板名称（如 issue_code），value 为 text/template 模板内容
+	Prompts map[string]string `yaml:"prompts"`
+	// PR 描述、进度评论和提示词使用的语言，覆盖 locale
+	Locale string `yaml:"locale"`
+}
+
+// ParseRepoConfig 解析仓库级配置，未知字段和模式视为错误，避免拼写错误被静默忽略
+func ParseRepoConfig(data []byte) (*RepoConfig, error) {
+	var rc RepoConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&rc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse %s: %w", RepoConfigFile, err)
+	}
+	for _, mode := range rc.Modes {
+		if !slices.Contains(repoModes, mode) {
+			return nil, fmt.Errorf("unsupported mode in %s: %s (available: %s)", RepoConfigFile, mode, strings.Join(repoModes, ", "))
+		}
+	}
+	rc.Instructions = strings.TrimSpace(rc.Instructions)
+	return &rc, nil
+}
+
+// Provider 返回仓库的默认 AI 模型，未配置时返回全局默认值 def
+func (rc *RepoConfig) Provider(def string) string {
+	if rc == nil || rc.CodeProvider == "" {
+		return def
+	}
+	return rc.CodeProvider
+}
+
+// Language 返回仓库使用的语言，未配置时返回全局配置 def
+func (rc *RepoConfig) Language(def string) string {
+	if rc == nil || rc.Locale == "" {
+		return def
+	}
+	return rc.Locale
+}
+
+// ModeEnabled 判断仓库是否启用了模式，未配置 modes 时全部启用
+func (rc *RepoConfig) ModeEnabled(mode string) bool {
+	if rc == nil || len(rc.Modes) == 0 {
+		return true
+	}
+	return slices.Contains(rc.Modes, mode)
+}
+
+// AutoProcessRule 返回仓库（org/repo）的自动处理触发条件，仓库级配置优先于全局配置
+func (rc *RepoConfig) AutoProcessRule(global AutoProcessConfig, fullName string) AutoProcessRule {
+	if rc == nil || rc.AutoProcess == nil {
+		return global.ForRepo(fullName)
+	}
+	return *rc.AutoProcess
+}
+
+// Prompt 返回仓库覆盖的提示词模板
+func (rc *RepoConfig) Prompt(name string) (string, bool) {
+	if rc == nil {
+		return "", false
+	}
+	text, ok := rc.Prompts[name]
+	return text, ok
+}
+
+// AppendInstructions 将仓库说明追加到提示词末尾，heading 为仓库所用语言的标题
+func (rc *RepoConfig) AppendInstructions(prompt, heading string) string {
+	if rc == nil || rc.Instructions == "" {
+		return prompt
+	}
+	return prompt + "\n\n" + heading + "\n" + rc.Instructions
+}
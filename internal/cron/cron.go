@@ -0,0 +1,274 @@
+package cron
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qiniu/x/log"
+)
+
+// Schedule 解析后的 5 段 cron 表达式（分 时 日 月 周）
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// 日和周都被限制时，两者满足其一即可（与 Vixie cron 一致）
+	domStar, dowStar bool
+}
+
+type field struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{min: 0, max: 59}
+	hourField   = field{min: 0, max: 23}
+	domField    = field{min: 1, max: 31}
+	monthField  = field{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 周日可以写作 0 或 7
+	dowField = field{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse 解析 cron 表达式，支持 *、列表、范围、步长、月份和星期的英文缩写以及 @daily 等简写
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expanded, ok := macros[strings.ToLower(spec)]; ok {
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in cron expression %q, got %d", spec, len(fields))
+	}
+
+	s := &Schedule{
+		domStar: fields[2] == "*" || fields[2] == "?",
+		dowStar: fields[4] == "*" || fields[4] == "?",
+	}
+	var err error
+	if s.minute, err = parseField(fields[0], minuteField); err != nil {
+		return nil, fmt.Errorf("invalid minute field: %w", err)
+	}
+	if s.hour, err = parseField(fields[1], hourField); err != nil {
+		return nil, fmt.Errorf("invalid hour field: %w", err)
+	}
+	if s.dom, err = parseField(fields[2], domField); err != nil {
+		return nil, fmt.Errorf("invalid day of month field: %w", err)
+	}
+	if s.month, err = parseField(fields[3], monthField); err != nil {
+		return nil, fmt.Errorf("invalid month field: %w", err)
+	}
+	if s.dow, err = parseField(fields[4], dowField); err != nil {
+		return nil, fmt.Errorf("invalid day of week field: %w", err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// parseField 将单个字段解析为位图
+func parseField(expr string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangeExpr, step = part[:i], n
+		}
+
+		start, end := f.min, f.max
+		switch {
+		case rangeExpr == "*" || rangeExpr == "?":
+		case strings.Contains(rangeExpr, "-"):
+			bounds := strings.SplitN(rangeExpr, "-", 2)
+			var err error
+			if start, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if end, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+		default:
+			var err error
+			if start, err = f.value(rangeExpr); err != nil {
+				return 0, err
+			}
+			// 单个值带步长时（如 5/15）表示从该值到最大值
+			if step == 1 {
+				end = start
+			}
+		}
+		if start > end {
+			return 0, fmt.Errorf("invalid range %q", part)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next 返回 t 之后（不含 t）的下一次触发时间，使用 t 所在的时区；
+// 5 年内都不会触发时（如 2 月 30 日）返回零值
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// entry 注册的定时任务
+type entry struct {
+	name     string
+	schedule *Schedule
+	loc      *time.Location
+	run      func(ctx context.Context)
+}
+
+// Cron 按 cron 表达式周期执行任务。
+// 每个任务在独立的 goroutine 中串行执行，上一次执行未结束时错过的触发时间会被跳过
+type Cron struct {
+	mu      sync.Mutex
+	entries []*entry
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// New 创建定时任务调度器
+func New() *Cron {
+	return &Cron{}
+}
+
+// Add 注册定时任务，loc 为 nil 时使用 UTC；需在 Start 之前调用
+func (c *Cron) Add(name, spec string, loc *time.Location, run func(ctx context.Context)) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, &entry{name: name, schedule: schedule, loc: loc, run: run})
+	return nil
+}
+
+// Len 返回已注册的任务数
+func (c *Cron) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Start 启动所有已注册的任务
+func (c *Cron) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	for _, e := range c.entries {
+		c.wg.Add(1)
+		go c.loop(ctx, e)
+	}
+}
+
+// Stop 停止调度并等待正在执行的任务结束
+func (c *Cron) Stop() {
+	c.mu.Lock()
+	cancel := c.cancel
+	c.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	c.wg.Wait()
+}
+
+func (c *Cron) loop(ctx context.Context, e *entry) {
+	defer c.wg.Done()
+	for {
+		next := e.schedule.Next(time.Now().In(e.loc))
+		if next.IsZero() {
+			log.Warnf("Schedule %s will never run", e.name)
+			return
+		}
+		log.Infof("Schedule %s next run at %s", e.name, next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		e.run(ctx)
+	}
+}
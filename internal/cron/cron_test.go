@@ -0,0 +1,94 @@
+package cron
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRejectsInvalidExpressions(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"a * * * *",
+	} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestNext(t *testing.T) {
+	base := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC) // 周一
+
+	tests := []struct {
+		spec     string
+		from     time.Time
+		expected time.Time
+	}{
+		{"* * * * *", base, time.Date(2024, 1, 15, 10, 31, 0, 0, time.UTC)},
+		{"@hourly", base, time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@daily", base, time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 2 * * *", base, time.Date(2024, 1, 16, 2, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", base, time.Date(2024, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"5/20 * * * *", base, time.Date(2024, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", base, time.Date(2024, 1, 15, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * sun", base, time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", base, time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 feb,mar *", base, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", base, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// 日和周同时限制时满足其一即可
+		{"0 0 20 * fri", base, time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)},
+		// 触发时间本身不算
+		{"30 10 * * *", base, time.Date(2024, 1, 16, 10, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		schedule, err := Parse(tt.spec)
+		require.NoError(t, err, tt.spec)
+		assert.Equal(t, tt.expected, schedule.Next(tt.from), tt.spec)
+	}
+}
+
+func TestNextUsesLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	schedule, err := Parse("0 2 * * *")
+	require.NoError(t, err)
+
+	next := schedule.Next(time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC).In(loc))
+	assert.Equal(t, time.Date(2024, 1, 15, 18, 0, 0, 0, time.UTC), next.UTC())
+}
+
+func TestNextNeverMatches(t *testing.T) {
+	schedule, err := Parse("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, schedule.Next(time.Now()).IsZero())
+}
+
+func TestCronStartStop(t *testing.T) {
+	c := New()
+	require.Error(t, c.Add("bad", "bad", nil, func(ctx context.Context) {}))
+	require.NoError(t, c.Add("job", "@yearly", nil, func(ctx context.Context) {}))
+	assert.Equal(t, 1, c.Len())
+
+	c.Start()
+	done := make(chan struct{})
+	go func() {
+		c.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not return")
+	}
+}
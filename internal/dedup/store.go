@@ -0,0 +1,120 @@
+package dedup
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/qiniu/x/log"
+)
+
+// Store 记录已接收的 webhook 投递 ID（X-GitHub-Delivery），
+// 在 TTL 内重复出现的投递会被识别出来，数据持久化到本地文件以便重启后仍然生效
+type Store struct {
+	mu   sync.Mutex
+	path string
+	ttl  time.Duration
+	seen map[string]time.Time
+	now  func() time.Time
+}
+
+// NewStore 创建投递记录存储，path 为空时仅保存在内存中
+func NewStore(path string, ttl time.Duration) (*Store, error) {
+	s := &Store{
+		path: path,
+		ttl:  ttl,
+		seen: make(map[string]time.Time),
+		now:  time.Now,
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read delivery store: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.seen); err != nil {
+		return nil, fmt.Errorf("failed to parse delivery store: %w", err)
+	}
+	s.expireLocked()
+	return s, nil
+}
+
+// Add 记录一次投递，返回 false 表示该投递在 TTL 内已经接收过
+func (s *Store) Add(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expireLocked()
+	if _, ok := s.seen[id]; ok {
+		return false
+	}
+	s.seen[id] = s.now()
+	s.saveLocked()
+	return true
+}
+
+// Remove 删除投递记录，用于处理失败时允许 GitHub 重新投递
+func (s *Store) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.seen[id]; !ok {
+		return
+	}
+	delete(s.seen, id)
+	s.saveLocked()
+}
+
+// Len 返回未过期的投递记录数
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expireLocked()
+	return len(s.seen)
+}
+
+func (s *Store) expireLocked() {
+	if s.ttl <= 0 {
+		return
+	}
+	cutoff := s.now().Add(-s.ttl)
+	for id, at := range s.seen {
+		if at.Before(cutoff) {
+			delete(s.seen, id)
+		}
+	}
+}
+
+// saveLocked 持久化失败只记录日志，内存中的记录仍然有效
+func (s *Store) saveLocked() {
+	if s.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(s.seen)
+	if err != nil {
+		log.Warnf("Failed to marshal delivery store: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		log.Warnf("Failed to create delivery store directory: %v", err)
+		return
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Warnf("Failed to write delivery store: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		log.Warnf("Failed to persist delivery store: %v", err)
+	}
+}
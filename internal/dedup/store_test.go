@@ -0,0 +1,52 @@
+package dedup
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreAddAndRemove(t *testing.T) {
+	s, err := NewStore("", time.Hour)
+	require.NoError(t, err)
+
+	assert.True(t, s.Add("delivery-1"))
+	assert.False(t, s.Add("delivery-1"))
+	assert.True(t, s.Add("delivery-2"))
+
+	s.Remove("delivery-1")
+	assert.True(t, s.Add("delivery-1"))
+	assert.Equal(t, 2, s.Len())
+}
+
+func TestStoreTTL(t *testing.T) {
+	s, err := NewStore("", time.Hour)
+	require.NoError(t, err)
+
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	assert.True(t, s.Add("delivery-1"))
+
+	now = now.Add(30 * time.Minute)
+	assert.False(t, s.Add("delivery-1"))
+
+	now = now.Add(2 * time.Hour)
+	assert.True(t, s.Add("delivery-1"))
+}
+
+func TestStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deliveries.json")
+
+	s, err := NewStore(path, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, s.Add("delivery-1"))
+
+	// 模拟重启后重新加载
+	reloaded, err := NewStore(path, time.Hour)
+	require.NoError(t, err)
+	assert.False(t, reloaded.Add("delivery-1"))
+	assert.True(t, reloaded.Add("delivery-2"))
+}
@@ -29,14 +29,23 @@ func NewEventParser() *EventParser {
 }
 
 // ParseEvent 解析通用事件（兼容性方法）
+// 已构造好的上下文（如内部定时任务生成的 schedule 事件）直接返回，
+// 其他格式（如从任务队列解码的 JSON）按 webhook 载荷解析
 func (p *EventParser) ParseEvent(ctx context.Context, eventType string, rawEvent interface{}) (models.GitHubContext, error) {
+	if githubCtx, ok := rawEvent.(models.GitHubContext); ok {
+		return githubCtx, nil
+	}
 	switch models.EventType(eventType) {
 	case models.EventIssueComment:
 		if event, ok := rawEvent.(*github.IssueCommentEvent); ok {
 			return p.ParseIssueCommentEvent(ctx, event)
 		}
 	}
-	return nil, fmt.Errorf("unsupported event type or format: %s", eventType)
+	payload, err := json.Marshal(rawEvent)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported event type or format: %s", eventType)
+	}
+	return p.ParseWebhookEvent(ctx, eventType, "", payload)
 }
 
 // ParseIssueCommentEvent 解析Issue评论事件（从原始GitHub事件）
@@ -92,6 +101,10 @@ func (p *EventParser) ParseWebhookEvent(
 		return p.parsePullRequestEvent(ctx, payload, deliveryID)
 	case models.EventPush:
 		return p.parsePushEvent(ctx, payload, deliveryID)
+	case models.EventWorkflowDispatch:
+		return p.parseWorkflowDispatchEvent(ctx, payload, deliveryID)
+	case models.EventSchedule:
+		return p.parseScheduleEvent(payload, deliveryID)
 	default:
 		return nil, fmt.Errorf("event type %s not implemented yet", eventType)
 	}
@@ -338,4 +351,55 @@ func (p *EventParser) parsePushEvent(
 		Before:  event.GetBefore(),
 		After:   event.GetAfter(),
 	}, nil
-}
\ No newline at end of file
+}
+
+// parseWorkflowDispatchEvent 解析workflow_dispatch事件
+func (p *EventParser) parseWorkflowDispatchEvent(
+	ctx context.Context,
+	payload []byte,
+	deliveryID string,
+) (*models.WorkflowDispatchContext, error) {
+	var event github.WorkflowDispatchEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal workflow dispatch event: %w", err)
+	}
+
+	// 检查必需字段
+	if event.Repo == nil {
+		return nil, fmt.Errorf("missing repository in workflow dispatch event")
+	}
+
+	var inputs map[string]interface{}
+	if len(event.Inputs) > 0 {
+		if err := json.Unmarshal(event.Inputs, &inputs); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal workflow dispatch inputs: %w", err)
+		}
+	}
+
+	return &models.WorkflowDispatchContext{
+		BaseContext: models.BaseContext{
+			Type:       models.EventWorkflowDispatch,
+			Repository: event.Repo,
+			Sender:     event.Sender,
+			RawEvent:   &event,
+			Action:     "dispatch",
+			DeliveryID: deliveryID,
+			Timestamp:  time.Now(),
+		},
+		Ref:    event.GetRef(),
+		Inputs: inputs,
+	}, nil
+}
+
+// parseScheduleEvent 解析定时任务入队时序列化的 schedule 上下文
+func (p *EventParser) parseScheduleEvent(payload []byte, deliveryID string) (*models.ScheduleContext, error) {
+	var event models.ScheduleContext
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schedule event: %w", err)
+	}
+	event.Type = models.EventSchedule
+	if deliveryID != "" {
+		event.DeliveryID = deliveryID
+	}
+	return &event, nil
+}
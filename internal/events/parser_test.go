@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/qiniu/codeagent/pkg/models"
 
@@ -146,6 +147,17 @@ func TestHasCommand(t *testing.T) {
 			},
 			hasCmd: true,
 		},
+		{
+			name:    "suggest command",
+			content: "/suggest use a constant here",
+			expected: &models.CommandInfo{
+				Command: "/suggest",
+				AIModel: "",
+				Args:    "use a constant here",
+				RawText: "/suggest use a constant here",
+			},
+			hasCmd: true,
+		},
 		{
 			name:    "no command",
 			content: "just a regular comment",
@@ -169,7 +181,7 @@ func TestHasCommand(t *testing.T) {
 				},
 			}
 
-			cmdInfo, hasCmd := models.HasCommand(ctx)
+			cmdInfo, hasCmd := models.HasCommand(ctx, []string{"claude", "gemini"})
 			assert.Equal(t, tt.hasCmd, hasCmd)
 			
 			if tt.hasCmd {
@@ -183,4 +195,87 @@ func TestHasCommand(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestHasCommandIgnoresBots(t *testing.T) {
+	for _, sender := range []*github.User{
+		{Login: github.String("codeagent[bot]"), Type: github.String("Bot")},
+		{Login: github.String("renovate[bot]")},
+	} {
+		ctx := &models.IssueCommentContext{
+			BaseContext: models.BaseContext{Sender: sender},
+			Comment: &github.IssueComment{
+				Body: github.String("/fix quoted from the original prompt"),
+			},
+		}
+		cmdInfo, hasCmd := models.HasCommand(ctx, []string{"claude", "gemini"})
+		assert.False(t, hasCmd, "sender %s", sender.GetLogin())
+		assert.Nil(t, cmdInfo)
+	}
+}
+
+func TestEventParser_ParseEvent(t *testing.T) {
+	parser := NewEventParser()
+	ctx := context.Background()
+
+	// 内部生成的上下文直接返回
+	schedule := &models.ScheduleContext{
+		BaseContext: models.BaseContext{Type: models.EventSchedule},
+		Name:        "nightly",
+	}
+	parsed, err := parser.ParseEvent(ctx, string(models.EventSchedule), schedule)
+	require.NoError(t, err)
+	assert.Same(t, schedule, parsed)
+
+	// 从任务队列解码的 JSON 按 webhook 载荷解析
+	var raw interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"action": "labeled",
+		"issue": {"number": 5, "title": "Add login"},
+		"label": {"name": "codeagent"},
+		"repository": {"name": "repo", "full_name": "test/repo", "owner": {"login": "test"}},
+		"sender": {"login": "alice"}
+	}`), &raw))
+	parsed, err = parser.ParseEvent(ctx, string(models.EventIssues), raw)
+	require.NoError(t, err)
+	issuesCtx, ok := parsed.(*models.IssuesContext)
+	require.True(t, ok)
+	assert.Equal(t, "labeled", issuesCtx.GetEventAction())
+	assert.Equal(t, 5, issuesCtx.Issue.GetNumber())
+	assert.Equal(t, "test/repo", issuesCtx.GetRepository().GetFullName())
+
+	// 手动任务的 workflow_dispatch 事件
+	parsed, err = parser.ParseWebhookEvent(ctx, string(models.EventWorkflowDispatch), "", []byte(`{
+		"ref": "release-1.0",
+		"inputs": {"instruction": "Bump version", "inputs": {"version": "1.0.1"}},
+		"repository": {"name": "repo", "full_name": "test/repo", "owner": {"login": "test"}},
+		"sender": {"login": "alice"}
+	}`))
+	require.NoError(t, err)
+	dispatchCtx, ok := parsed.(*models.WorkflowDispatchContext)
+	require.True(t, ok)
+	assert.Equal(t, "release-1.0", dispatchCtx.Ref)
+	assert.Equal(t, "Bump version", dispatchCtx.Inputs["instruction"])
+
+	// 定时任务入队时序列化的 schedule 事件
+	scheduled := &models.ScheduleContext{
+		BaseContext: models.BaseContext{
+			Type:       models.EventSchedule,
+			Repository: &github.Repository{Name: github.String("repo"), FullName: github.String("test/repo")},
+			Timestamp:  time.Date(2024, 1, 15, 3, 0, 0, 0, time.UTC),
+		},
+		Name:   "triage",
+		Task:   "stale_issues",
+		Inputs: map[string]string{"days": "60"},
+	}
+	data, err := json.Marshal(scheduled)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &raw))
+	parsed, err = parser.ParseEvent(ctx, string(models.EventSchedule), raw)
+	require.NoError(t, err)
+	scheduleCtx, ok := parsed.(*models.ScheduleContext)
+	require.True(t, ok)
+	assert.Equal(t, models.EventSchedule, scheduleCtx.GetEventType())
+	assert.Equal(t, "test/repo", scheduleCtx.GetRepository().GetFullName())
+	assert.Equal(t, "60", scheduleCtx.Inputs["days"])
+	assert.True(t, scheduled.Timestamp.Equal(scheduleCtx.GetTimestamp()))
+}
@@ -0,0 +1,349 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qiniu/codeagent/internal/config"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/qiniu/x/log"
+)
+
+// tokenRefreshBefore 安装实例令牌在过期前多久刷新，避免长时间运行的 git 操作中途令牌过期
+const tokenRefreshBefore = 10 * time.Minute
+
+// Auth 访问 GitHub 的凭证：个人访问令牌（github.token），或 GitHub App 各安装实例的令牌（github.app）。
+// 同一个 Auth 同时用于 REST API 和工作空间中的 git 命令
+type Auth struct {
+	token string
+	app   *appAuth // 未配置 GitHub App 时为 nil
+
+	mu    sync.Mutex
+	login string // 凭证对应的账号，首次使用时查询
+}
+
+// NewAuth 根据配置创建凭证，配置了 GitHub App 时优先使用 GitHub App
+func NewAuth(cfg config.GitHubConfig) (*Auth, error) {
+	if !cfg.App.Enabled() {
+		if cfg.Token == "" {
+			return nil, fmt.Errorf("GitHub token or GitHub App is required")
+		}
+		return &Auth{token: cfg.Token}, nil
+	}
+
+	key, err := loadPrivateKey(cfg.App)
+	if err != nil {
+		return nil, err
+	}
+	return &Auth{app: newAppAuth(cfg.App.ID, key)}, nil
+}
+
+// IsApp 是否使用 GitHub App 认证
+func (a *Auth) IsApp() bool {
+	return a.app != nil
+}
+
+// SetInstallation 记录 owner（组织或用户）对应的 GitHub App 安装实例，通常来自 webhook 负载中的 installation。
+// 未记录的 owner 在首次使用时通过 API 查找。使用个人访问令牌时忽略
+func (a *Auth) SetInstallation(owner string, installationID int64) {
+	if a.app == nil || owner == "" || installationID == 0 {
+		return
+	}
+	a.app.setInstallation(owner, installationID)
+}
+
+// Token 返回访问 owner/repo 使用的令牌
+func (a *Auth) Token(ctx context.Context, owner, repo string) (string, error) {
+	if a.app == nil {
+		return a.token, nil
+	}
+	return a.app.token(ctx, owner, repo)
+}
+
+// Login 返回凭证对应的账号：个人访问令牌所属的用户，或 GitHub App 的机器人账号（{app-slug}[bot]）。
+// 查询成功后缓存，用于识别 CodeAgent 自己发布的评论和推送
+func (a *Auth) Login(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.login != "" {
+		return a.login, nil
+	}
+
+	if a.app != nil {
+		app, _, err := a.app.client.Apps.Get(ctx, "")
+		if err != nil {
+			return "", fmt.Errorf("failed to get GitHub App: %w", err)
+		}
+		a.login = app.GetSlug() + "[bot]"
+	} else {
+		user, _, err := github.NewClient(nil).WithAuthToken(a.token).Users.Get(ctx, "")
+		if err != nil {
+			return "", fmt.Errorf("failed to get authenticated user: %w", err)
+		}
+		a.login = user.GetLogin()
+	}
+	return a.login, nil
+}
+
+// GitEnv 返回访问 owner/repo 的 git 命令需要追加的环境变量，令牌通过 http.extraheader 传递，不会写入仓库配置或命令行。
+// 使用个人访问令牌时返回 nil，沿用主机上的 git 凭证配置
+func (a *Auth) GitEnv(ctx context.Context, owner, repo string) ([]string, error) {
+	if a.app == nil {
+		return nil, nil
+	}
+	token, err := a.app.token(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	basic := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.https://github.com/.extraheader",
+		"GIT_CONFIG_VALUE_0=AUTHORIZATION: basic " + basic,
+	}, nil
+}
+
+// Transport 返回按请求的仓库添加令牌的 http.RoundTripper
+func (a *Auth) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &authTransport{auth: a, base: base}
+}
+
+// authTransport 从请求路径（/repos/{owner}/{repo}/...）或搜索条件（repo:owner/repo）中识别仓库，使用对应安装实例的令牌
+type authTransport struct {
+	auth *Auth
+	base http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	owner, repo := requestRepo(req)
+	token, err := t.auth.Token(req.Context(), owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
+
+// requestRepo 识别 API 请求访问的仓库，无法识别时返回空
+func requestRepo(req *http.Request) (owner, repo string) {
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		switch parts[i] {
+		case "repos":
+			if i+2 < len(parts) {
+				return parts[i+1], parts[i+2]
+			}
+			return parts[i+1], ""
+		case "orgs", "users":
+			return parts[i+1], ""
+		}
+	}
+	for _, field := range strings.Fields(req.URL.Query().Get("q")) {
+		if fullName, ok := strings.CutPrefix(field, "repo:"); ok {
+			owner, repo, _ = strings.Cut(fullName, "/")
+			return owner, repo
+		}
+	}
+	return "", ""
+}
+
+// appAuth GitHub App 认证：使用私钥签发 JWT，为各安装实例换取令牌并缓存到过期前
+type appAuth struct {
+	id     int64
+	key    *rsa.PrivateKey
+	client *github.Client // 使用 JWT 认证，只用于查找安装实例和换取令牌
+	now    func() time.Time
+
+	mu            sync.Mutex
+	installations map[string]int64 // owner（小写）-> 安装实例 ID
+	tokens        map[int64]*github.InstallationToken
+}
+
+func newAppAuth(id int64, key *rsa.PrivateKey) *appAuth {
+	a := &appAuth{
+		id:            id,
+		key:           key,
+		now:           time.Now,
+		installations: make(map[string]int64),
+		tokens:        make(map[int64]*github.InstallationToken),
+	}
+	a.client = github.NewClient(&http.Client{Transport: &jwtTransport{app: a}})
+	return a
+}
+
+func (a *appAuth) setInstallation(owner string, installationID int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.installations[strings.ToLower(owner)] = installationID
+}
+
+// token 返回 owner 所属安装实例的令牌，缓存的令牌即将过期时重新换取
+func (a *appAuth) token(ctx context.Context, owner, repo string) (string, error) {
+	id, err := a.installationID(ctx, owner, repo)
+	if err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	cached := a.tokens[id]
+	a.mu.Unlock()
+	if cached != nil && a.now().Add(tokenRefreshBefore).Before(cached.GetExpiresAt().Time) {
+		return cached.GetToken(), nil
+	}
+
+	token, _, err := a.client.Apps.CreateInstallationToken(ctx, id, nil)
+	if err != nil {
+		// 安装实例可能已被卸载，下次重新查找
+		a.mu.Lock()
+		for name, installationID := range a.installations {
+			if installationID == id {
+				delete(a.installations, name)
+			}
+		}
+		delete(a.tokens, id)
+		a.mu.Unlock()
+		return "", fmt.Errorf("failed to create installation token for %s: %w", owner, err)
+	}
+	log.Infof("Created GitHub App installation token for %s (installation %d), expires at %s", owner, id, token.GetExpiresAt().Format(time.RFC3339))
+
+	a.mu.Lock()
+	a.tokens[id] = token
+	a.mu.Unlock()
+	return token.GetToken(), nil
+}
+
+// installationID 返回 owner 的安装实例，没有记录时通过仓库、组织或用户查找
+func (a *appAuth) installationID(ctx context.Context, owner, repo string) (int64, error) {
+	if owner == "" {
+		return a.onlyInstallation()
+	}
+	key := strings.ToLower(owner)
+
+	a.mu.Lock()
+	id, ok := a.installations[key]
+	a.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	var installation *github.Installation
+	var err error
+	if repo != "" {
+		installation, _, err = a.client.Apps.FindRepositoryInstallation(ctx, owner, repo)
+	} else {
+		installation, _, err = a.client.Apps.FindOrganizationInstallation(ctx, owner)
+		if err != nil {
+			installation, _, err = a.client.Apps.FindUserInstallation(ctx, owner)
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find GitHub App installation for %s: %w", owner, err)
+	}
+
+	a.setInstallation(owner, installation.GetID())
+	log.Infof("Found GitHub App installation %d for %s", installation.GetID(), owner)
+	return installation.GetID(), nil
+}
+
+// onlyInstallation 无法识别请求的仓库时，只有一个已知安装实例才能使用
+func (a *appAuth) onlyInstallation() (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var id int64
+	for _, installationID := range a.installations {
+		if id != 0 && installationID != id {
+			return 0, errors.New("cannot determine GitHub App installation for request")
+		}
+		id = installationID
+	}
+	if id == 0 {
+		return 0, errors.New("cannot determine GitHub App installation for request")
+	}
+	return id, nil
+}
+
+// jwt 签发 GitHub App 的 JWT（RS256），有效期 9 分钟，签发时间提前 1 分钟以容忍时钟偏差
+func (a *appAuth) jwt() (string, error) {
+	now := a.now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(a.id, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// jwtTransport 使用 GitHub App 的 JWT 认证请求
+type jwtTransport struct {
+	app *appAuth
+}
+
+func (t *jwtTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.app.jwt()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// loadPrivateKey 读取 GitHub App 的 PEM 私钥，支持 PKCS#1（GitHub 下载的格式）和 PKCS#8
+func loadPrivateKey(cfg config.GitHubAppConfig) (*rsa.PrivateKey, error) {
+	data := []byte(cfg.PrivateKey)
+	if cfg.PrivateKeyFile != "" {
+		var err error
+		if data, err = os.ReadFile(cfg.PrivateKeyFile); err != nil {
+			return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+		}
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("GitHub App private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("GitHub App private key is not an RSA key")
+	}
+	return key, nil
+}
@@ -4,11 +4,17 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/qiniu/codeagent/internal/code"
 	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/internal/locale"
+	"github.com/qiniu/codeagent/internal/secretscan"
 	"github.com/qiniu/codeagent/pkg/models"
 
 	"github.com/google/go-github/v58/github"
@@ -17,27 +23,60 @@ import (
 )
 
 type Client struct {
-	client *github.Client
-	config *config.Config
+	client  *github.Client
+	config  *config.Config
+	auth    *Auth
+	scanner *secretscan.Scanner // 提交前扫描密钥，关闭扫描时为 nil
 }
 
-func NewClient(cfg *config.Config) (*Client, error) {
-	if cfg.GitHub.Token == "" {
-		return nil, fmt.Errorf("GitHub token is required")
+// NewClient 创建 GitHub 客户端，API 请求和 git 命令都使用 auth 提供的凭证
+func NewClient(cfg *config.Config, auth *Auth) (*Client, error) {
+	if auth == nil {
+		return nil, fmt.Errorf("GitHub credentials are required")
 	}
 
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: cfg.GitHub.Token},
-	)
-	tc := oauth2.NewClient(context.Background(), ts)
+	var tc *http.Client
+	if auth.IsApp() {
+		tc = &http.Client{Transport: auth.Transport(nil)}
+	} else {
+		ts := oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: auth.token},
+		)
+		tc = oauth2.NewClient(context.Background(), ts)
+	}
 	client := github.NewClient(tc)
 
+	scanner, err := secretscan.New(cfg.SecretScan)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Client{
-		client: client,
-		config: cfg,
+		client:  client,
+		config:  cfg,
+		auth:    auth,
+		scanner: scanner,
 	}, nil
 }
 
+// SetInstallation 记录 owner 对应的 GitHub App 安装实例，之后访问 owner 的仓库使用该实例的令牌
+func (c *Client) SetInstallation(owner string, installationID int64) {
+	c.auth.SetInstallation(owner, installationID)
+}
+
+// remoteGitCommand 创建访问远程仓库的 git 命令，附加工作空间所属仓库的凭证
+func (c *Client) remoteGitCommand(workspace *models.Workspace, args ...string) *exec.Cmd {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = workspace.Path
+	env, err := c.auth.GitEnv(context.Background(), workspace.Org, workspace.Repo)
+	if err != nil {
+		log.Errorf("Failed to get git credentials for %s/%s: %v", workspace.Org, workspace.Repo, err)
+	} else if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd
+}
+
 // CreateBranch 在本地创建分支并推送到远程
 func (c *Client) CreateBranch(workspace *models.Workspace) error {
 	log.Infof("Creating branch for workspace: %s, path: %s", workspace.Branch, workspace.Path)
@@ -70,8 +109,7 @@ func (c *Client) CreateBranch(workspace *models.Workspace) error {
 	}
 
 	// 推送分支到远程
-	cmd = exec.Command("git", "push", "-u", "origin", workspace.Branch)
-	cmd.Dir = workspace.Path
+	cmd = c.remoteGitCommand(workspace, "push", "-u", "origin", workspace.Branch)
 
 	// 捕获命令的输出和错误
 	pushOutput, err := cmd.CombinedOutput()
@@ -117,41 +155,29 @@ func (c *Client) checkGitConfig(workspacePath string) {
 	}
 }
 
-// CreatePullRequest 创建 Pull Request
-func (c *Client) CreatePullRequest(workspace *models.Workspace) (*github.PullRequest, error) {
+// CreatePullRequest 创建 Pull Request，标题和描述使用 msgs 的语言
+func (c *Client) CreatePullRequest(workspace *models.Workspace, msgs *locale.Messages) (*github.PullRequest, error) {
 	// 解析仓库信息
 	repoOwner, repoName := c.parseRepoURL(workspace.Repository)
 	if repoOwner == "" || repoName == "" {
 		return nil, fmt.Errorf("invalid repository URL: %s", workspace.Repository)
 	}
 
-	// 获取仓库的默认分支
-	defaultBranch, err := c.getDefaultBranch(repoOwner, repoName)
-	if err != nil {
-		log.Errorf("Failed to get default branch for %s/%s, using 'main' as fallback: %v", repoOwner, repoName, err)
-		defaultBranch = "main"
+	// 获取仓库的默认分支，工作空间指定了目标分支时使用目标分支
+	defaultBranch := workspace.BaseBranch
+	if defaultBranch == "" {
+		var err error
+		defaultBranch, err = c.getDefaultBranch(repoOwner, repoName)
+		if err != nil {
+			log.Errorf("Failed to get default branch for %s/%s, using 'main' as fallback: %v", repoOwner, repoName, err)
+			defaultBranch = "main"
+		}
 	}
-	log.Infof("Using default branch '%s' for repository %s/%s", defaultBranch, repoOwner, repoName)
+	log.Infof("Using base branch '%s' for repository %s/%s", defaultBranch, repoOwner, repoName)
 
 	// 创建 PR
-	prTitle := fmt.Sprintf("实现 Issue #%d: %s", workspace.Issue.GetNumber(), workspace.Issue.GetTitle())
-	prBody := fmt.Sprintf(`## 实现计划
-
-这是由 Code Agent 自动生成的 PR，用于实现 Issue #%d。
-
-### Issue 描述
-%s
-
-### 实现计划
-- [ ] 分析需求并制定实现方案
-- [ ] 编写核心代码
-- [ ] 添加测试用例
-- [ ] 代码审查和优化
-
----
-*此 PR 由 Code Agent(https://github.com/qiniu/codeagent) 自动创建，将逐步完善实现*`,
-		workspace.Issue.GetNumber(),
-		workspace.Issue.GetBody())
+	prTitle := fmt.Sprintf(msgs.PRTitle, workspace.Issue.GetNumber(), workspace.Issue.GetTitle())
+	prBody := fmt.Sprintf(msgs.PRBody, workspace.Issue.GetNumber(), workspace.Issue.GetBody())
 
 	newPR := &github.NewPullRequest{
 		Title: &prTitle,
@@ -184,8 +210,9 @@ func (c *Client) getDefaultBranch(owner, repo string) (string, error) {
 	return defaultBranch, nil
 }
 
-// CommitAndPush 检测文件变更并提交推送
-func (c *Client) CommitAndPush(workspace *models.Workspace, result *models.ExecutionResult, codeClient code.Code) error {
+// CommitAndPush 检测文件变更并提交推送，ctx 取消时（如 /cancel）停止生成 commit message，
+// msgs 为密钥扫描报告使用的语言
+func (c *Client) CommitAndPush(ctx context.Context, workspace *models.Workspace, result *models.ExecutionResult, codeClient code.Code, msgs *locale.Messages) error {
 	// 检查是否有文件变更
 	cmd := exec.Command("git", "status", "--porcelain")
 	cmd.Dir = workspace.Path
@@ -207,8 +234,13 @@ func (c *Client) CommitAndPush(workspace *models.Workspace, result *models.Execu
 		return fmt.Errorf("failed to add changes: %w\nCommand output: %s", err, string(addOutput))
 	}
 
+	// 提交前扫描新增内容中的密钥，发现时不提交
+	if err := c.scanChanges(ctx, workspace, msgs); err != nil {
+		return err
+	}
+
 	// 使用AI生成标准的英文commit message
-	commitMsg, err := c.generateCommitMessage(workspace, result, codeClient)
+	commitMsg, err := c.generateCommitMessage(ctx, workspace, result, codeClient)
 	if err != nil {
 		log.Errorf("Failed to generate commit message with AI, using fallback: %v", err)
 		// 使用fallback的commit message
@@ -227,8 +259,7 @@ func (c *Client) CommitAndPush(workspace *models.Workspace, result *models.Execu
 	}
 
 	// 推送到远程（带冲突处理）
-	cmd = exec.Command("git", "push")
-	cmd.Dir = workspace.Path
+	cmd = c.remoteGitCommand(workspace, "push")
 	pushOutput, err := cmd.CombinedOutput()
 	if err != nil {
 		pushOutputStr := string(pushOutput)
@@ -239,8 +270,7 @@ func (c *Client) CommitAndPush(workspace *models.Workspace, result *models.Execu
 			log.Infof("Push failed due to remote changes, attempting to resolve conflict")
 
 			// 拉取成功后，再次尝试推送
-			cmd = exec.Command("git", "push")
-			cmd.Dir = workspace.Path
+			cmd = c.remoteGitCommand(workspace, "push")
 			pushOutput2, err2 := cmd.CombinedOutput()
 			if err2 != nil {
 				log.Errorf("Push still failed after pull, attempting force push")
@@ -258,6 +288,90 @@ func (c *Client) CommitAndPush(workspace *models.Workspace, result *models.Execu
 	return nil
 }
 
+// scanChanges 扫描将要推送的内容：暂存的改动和 AI 在任务中自己创建、尚未推送的提交。
+// 发现疑似密钥时撤销这些提交并取消暂存（改动保留在工作空间中）、还原相关文件，
+// 在 PR（或 Issue）上报告并返回 *secretscan.FoundError
+func (c *Client) scanChanges(ctx context.Context, workspace *models.Workspace, msgs *locale.Messages) error {
+	if c.scanner == nil {
+		return nil
+	}
+
+	staged, err := gitOutput(workspace.Path, "-c", "core.quotePath=false", "diff", "--cached", "-U0", "--no-color", "--no-ext-diff")
+	if err != nil {
+		return fmt.Errorf("failed to get staged changes: %w", err)
+	}
+	// 不在任何远端分支上的提交都会随 push 一起推送
+	unpushed, err := gitOutput(workspace.Path, "-c", "core.quotePath=false", "log", "-p", "-U0", "--no-color", "--no-ext-diff", "--format=", "HEAD", "--not", "--remotes")
+	if err != nil {
+		return fmt.Errorf("failed to get unpushed commits: %w", err)
+	}
+
+	findings := c.scanner.Scan(unpushed)
+	inCommits := len(findings) > 0
+	findings = append(findings, c.scanner.Scan(staged)...)
+	if len(findings) == 0 {
+		return nil
+	}
+	files := secretscan.Files(findings)
+	log.Warnf("Secret scan found %d potential secrets in %s, push blocked", len(findings), strings.Join(files, ", "))
+
+	// 有问题的内容在提交中时回退到第一个未推送提交之前，否则只取消暂存
+	resetArgs := []string{"reset", "-q"}
+	if inCommits {
+		commits, err := gitOutput(workspace.Path, "rev-list", "--reverse", "HEAD", "--not", "--remotes")
+		if err != nil {
+			return fmt.Errorf("failed to list unpushed commits: %w", err)
+		}
+		first, _, _ := strings.Cut(commits, "\n")
+		resetArgs = append(resetArgs, first+"^")
+	}
+	cmd := exec.Command("git", resetArgs...)
+	cmd.Dir = workspace.Path
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to unstage changes: %w\nCommand output: %s", err, string(output))
+	}
+	for _, file := range files {
+		if err := revertFile(workspace.Path, file); err != nil {
+			log.Errorf("Failed to revert %s: %v", file, err)
+		}
+	}
+
+	number := workspace.PRNumber
+	if number == 0 {
+		number = workspace.Issue.GetNumber()
+	}
+	if number > 0 {
+		if _, err := c.CreateComment(ctx, workspace.Org, workspace.Repo, number, secretscan.Report(findings, msgs)); err != nil {
+			log.Errorf("Failed to report secret scan findings: %v", err)
+		}
+	}
+	return &secretscan.FoundError{Findings: findings}
+}
+
+// gitOutput 在 dir 中执行 git 命令并返回标准输出
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	return string(output), err
+}
+
+// revertFile 将文件还原为 HEAD 中的内容，HEAD 中没有的新文件直接删除
+func revertFile(repoPath, file string) error {
+	cmd := exec.Command("git", "cat-file", "-e", "HEAD:"+file)
+	cmd.Dir = repoPath
+	if cmd.Run() != nil {
+		return os.Remove(filepath.Join(repoPath, file))
+	}
+
+	cmd = exec.Command("git", "checkout", "HEAD", "--", file)
+	cmd.Dir = repoPath
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, string(output))
+	}
+	return nil
+}
+
 // PullLatestChanges 拉取远端最新代码（优先使用rebase策略）
 func (c *Client) PullLatestChanges(workspace *models.Workspace, pr *github.PullRequest) error {
 	log.Infof("Pulling latest changes for workspace: %s (PR #%d)", workspace.Path, pr.GetNumber())
@@ -279,8 +393,7 @@ func (c *Client) PullLatestChanges(workspace *models.Workspace, pr *github.PullR
 	log.Infof("PR #%d: %s -> %s", pr.GetNumber(), headBranch, baseBranch)
 
 	// 1. 获取所有远程引用
-	cmd := exec.Command("git", "fetch", "--all", "--prune")
-	cmd.Dir = workspace.Path
+	cmd := c.remoteGitCommand(workspace, "fetch", "--all", "--prune")
 	fetchOutput, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to fetch latest changes: %w\nCommand output: %s", err, string(fetchOutput))
@@ -310,8 +423,7 @@ func (c *Client) PullLatestChanges(workspace *models.Workspace, pr *github.PullR
 	// 3. 尝试直接获取 PR 内容
 	prNumber := pr.GetNumber()
 	log.Infof("Attempting to fetch PR #%d content directly", prNumber)
-	cmd = exec.Command("git", "fetch", "origin", fmt.Sprintf("pull/%d/head", prNumber))
-	cmd.Dir = workspace.Path
+	cmd = c.remoteGitCommand(workspace, "fetch", "origin", fmt.Sprintf("pull/%d/head", prNumber))
 	fetchOutput, err = cmd.CombinedOutput()
 	if err == nil {
 		// 直接获取成功，使用rebase合并更新
@@ -382,6 +494,33 @@ func (c *Client) GetPullRequest(owner, repo string, prNumber int) (*github.PullR
 	return pr, nil
 }
 
+// GetPullRequestDiff 获取 PR 的 unified diff
+func (c *Client) GetPullRequestDiff(ctx context.Context, owner, repo string, prNumber int) (string, error) {
+	diff, _, err := c.client.PullRequests.GetRaw(ctx, owner, repo, prNumber, github.RawOptions{Type: github.Diff})
+	if err != nil {
+		return "", fmt.Errorf("failed to get diff of PR #%d: %w", prNumber, err)
+	}
+	return diff, nil
+}
+
+// CompareCommitsDiff 获取两个提交之间的 unified diff
+func (c *Client) CompareCommitsDiff(ctx context.Context, owner, repo, base, head string) (string, error) {
+	diff, _, err := c.client.Repositories.CompareCommitsRaw(ctx, owner, repo, base, head, github.RawOptions{Type: github.Diff})
+	if err != nil {
+		return "", fmt.Errorf("failed to compare %s...%s: %w", base, head, err)
+	}
+	return diff, nil
+}
+
+// UpdateReviewComment 更新 PR 的行内评论
+func (c *Client) UpdateReviewComment(ctx context.Context, owner, repo string, commentID int64, body string) error {
+	_, _, err := c.client.PullRequests.EditComment(ctx, owner, repo, commentID, &github.PullRequestComment{Body: github.String(body)})
+	if err != nil {
+		return fmt.Errorf("failed to update review comment: %w", err)
+	}
+	return nil
+}
+
 // CreatePullRequestComment 在 PR 上创建评论
 func (c *Client) CreatePullRequestComment(pr *github.PullRequest, commentBody string) error {
 	prURL := pr.GetHTMLURL()
@@ -549,7 +688,7 @@ func extractSummaryFromOutput(output string) string {
 		trimmedLine := strings.TrimSpace(line)
 
 		// 检测改动摘要章节开始
-		if strings.HasPrefix(trimmedLine, models.SectionSummary) {
+		if locale.Section(trimmedLine) == models.SectionSummaryID {
 			inSummarySection = true
 			continue
 		}
@@ -583,7 +722,11 @@ func extractSummaryFromOutput(output string) string {
 }
 
 // generateCommitMessage 使用AI生成标准的英文commit message
-func (c *Client) generateCommitMessage(workspace *models.Workspace, result *models.ExecutionResult, codeClient code.Code) (string, error) {
+func (c *Client) generateCommitMessage(ctx context.Context, workspace *models.Workspace, result *models.ExecutionResult, codeClient code.Code) (string, error) {
+	if codeClient == nil {
+		return "", fmt.Errorf("no code client to generate commit message")
+	}
+
 	// 获取git status和diff信息
 	cmd := exec.Command("git", "status", "--porcelain")
 	cmd.Dir = workspace.Path
@@ -631,7 +774,7 @@ Important: Please return only the plain text commit message content, do not incl
 	)
 
 	// 调用AI生成commit message
-	resp, err := codeClient.Prompt(prompt)
+	resp, err := codeClient.Prompt(ctx, prompt, code.PromptOptions{})
 	if err != nil {
 		return "", fmt.Errorf("failed to generate commit message: %w", err)
 	}
@@ -715,6 +858,145 @@ func (c *Client) GetComment(ctx context.Context, owner, repo string, commentID i
 	return comment, nil
 }
 
+// ListStaleIssues 列出在 before 之后没有更新的打开状态 Issue（不含 PR），按更新时间从旧到新排列
+func (c *Client) ListStaleIssues(ctx context.Context, owner, repo string, before time.Time) ([]*github.Issue, error) {
+	opts := &github.IssueListByRepoOptions{
+		State:       "open",
+		Sort:        "updated",
+		Direction:   "asc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var stale []*github.Issue
+	for {
+		issues, resp, err := c.client.Issues.ListByRepo(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list issues: %w", err)
+		}
+		for _, issue := range issues {
+			if !issue.GetUpdatedAt().Before(before) {
+				return stale, nil
+			}
+			if !issue.IsPullRequest() {
+				stale = append(stale, issue)
+			}
+		}
+		if resp.NextPage == 0 {
+			return stale, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// GetIssue 获取Issue或PR对应的Issue信息
+func (c *Client) GetIssue(ctx context.Context, owner, repo string, number int) (*github.Issue, error) {
+	issue, _, err := c.client.Issues.Get(ctx, owner, repo, number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get issue #%d: %w", number, err)
+	}
+	return issue, nil
+}
+
+// GetFileContent 获取仓库中文件的内容，ref 为空时读取默认分支；文件不存在时返回 nil, nil
+func (c *Client) GetFileContent(ctx context.Context, owner, repo, path, ref string) ([]byte, error) {
+	file, _, resp, err := c.client.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{Ref: ref})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get %s: %w", path, err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("%s is not a file", path)
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return []byte(content), nil
+}
+
+// AddLabels 为Issue或PR添加标签
+func (c *Client) AddLabels(ctx context.Context, owner, repo string, number int, labels []string) error {
+	_, _, err := c.client.Issues.AddLabelsToIssue(ctx, owner, repo, number, labels)
+	if err != nil {
+		return fmt.Errorf("failed to add labels to #%d: %w", number, err)
+	}
+	return nil
+}
+
+// CreateIssue 创建Issue
+func (c *Client) CreateIssue(ctx context.Context, owner, repo, title, body string, labels []string) (*github.Issue, error) {
+	req := &github.IssueRequest{
+		Title: github.String(title),
+		Body:  github.String(body),
+	}
+	if len(labels) > 0 {
+		req.Labels = &labels
+	}
+
+	issue, _, err := c.client.Issues.Create(ctx, owner, repo, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create issue: %w", err)
+	}
+	return issue, nil
+}
+
+// Login 返回 CodeAgent 认证使用的账号的登录名
+func (c *Client) Login(ctx context.Context) (string, error) {
+	return c.auth.Login(ctx)
+}
+
+// IsAgent 判断用户是否为 CodeAgent 自己（当前凭证对应的账号）或其他机器人，这些账号的评论和推送不触发任务
+func (c *Client) IsAgent(ctx context.Context, user *github.User) bool {
+	if models.IsBot(user) {
+		return true
+	}
+	login, err := c.auth.Login(ctx)
+	if err != nil {
+		log.Warnf("Failed to get CodeAgent account, cannot detect its own events: %v", err)
+		return false
+	}
+	return strings.EqualFold(user.GetLogin(), login)
+}
+
+// repoPermissions 协作者权限中的 key 与仓库权限的对应关系，从高到低排列
+var repoPermissions = []struct{ key, level string }{
+	{"admin", "admin"},
+	{"maintain", "maintain"},
+	{"push", "write"},
+	{"triage", "triage"},
+	{"pull", "read"},
+}
+
+// GetPermissionLevel 获取用户在仓库中的权限：admin、maintain、write、triage、read 或 none
+func (c *Client) GetPermissionLevel(ctx context.Context, owner, repo, user string) (string, error) {
+	level, _, err := c.client.Repositories.GetPermissionLevel(ctx, owner, repo, user)
+	if err != nil {
+		return "", fmt.Errorf("failed to get permission of %s on %s/%s: %w", user, owner, repo, err)
+	}
+	// permission 字段只区分 admin、write、read，maintain 和 triage 需要从 user.permissions 中读取
+	permissions := level.GetUser().Permissions
+	for _, p := range repoPermissions {
+		if permissions[p.key] {
+			return p.level, nil
+		}
+	}
+	return level.GetPermission(), nil
+}
+
+// IsTeamMember 判断用户是否为组织中团队的成员，邀请尚未接受时不算成员
+func (c *Client) IsTeamMember(ctx context.Context, org, team, user string) (bool, error) {
+	membership, resp, err := c.client.Teams.GetTeamMembershipBySlug(ctx, org, team, user)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get membership of %s in %s/%s: %w", user, org, team, err)
+	}
+	return membership.GetState() == "active", nil
+}
+
 // GetClient 获取底层的GitHub客户端（用于MCP服务器）
 func (c *Client) GetClient() *github.Client {
 	return c.client
@@ -3,10 +3,13 @@ package interaction
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/qiniu/codeagent/internal/code"
+	"github.com/qiniu/codeagent/internal/locale"
 	"github.com/qiniu/codeagent/pkg/models"
 
 	githubapi "github.com/google/go-github/v58/github"
@@ -23,17 +26,25 @@ type GitHubCommentClient interface {
 // 对应claude-code-action中的CommentManager
 type ProgressCommentManager struct {
 	github      GitHubCommentClient
+	msgs        *locale.Messages // 评论使用的语言
 	context     *models.CommentContext
 	tracker     *models.ProgressTracker
 	lastUpdate  time.Time
 	updateMutex sync.Mutex
 	testMode    bool // 测试模式下不限制更新频率
+	
+	steps       []string // AI 执行过程中的步骤，如 "editing internal/foo.go"
+	editedFiles []string // AI 修改过的文件
 }
 
-// NewProgressCommentManager 创建进度评论管理器
-func NewProgressCommentManager(github GitHubCommentClient, repo *githubapi.Repository, issueNumber int) *ProgressCommentManager {
+// maxRenderedSteps 进度评论中展示的最近步骤数
+const maxRenderedSteps = 10
+
+// NewProgressCommentManager 创建进度评论管理器，评论使用 msgs 的语言
+func NewProgressCommentManager(github GitHubCommentClient, repo *githubapi.Repository, issueNumber int, msgs *locale.Messages) *ProgressCommentManager {
 	return &ProgressCommentManager{
 		github: github,
+		msgs:   msgs,
 		context: &models.CommentContext{
 			Repository:  repo,
 			IssueNumber: issueNumber,
@@ -134,6 +145,32 @@ func (pcm *ProgressCommentManager) ShowSpinner(ctx context.Context, message stri
 	return pcm.updateComment(ctx)
 }
 
+// HandleCodeEvent 处理 code provider 的结构化事件，在评论中实时展示 AI 的执行步骤
+func (pcm *ProgressCommentManager) HandleCodeEvent(ctx context.Context, event code.Event) error {
+	step := event.Describe(pcm.msgs)
+	if step == "" {
+		return nil
+	}
+	
+	pcm.updateMutex.Lock()
+	defer pcm.updateMutex.Unlock()
+	
+	if event.Type == code.EventFileEdit && event.File != "" && !slices.Contains(pcm.editedFiles, event.File) {
+		pcm.editedFiles = append(pcm.editedFiles, event.File)
+	}
+	pcm.steps = append(pcm.steps, step)
+	pcm.tracker.StartSpinner(step)
+	return pcm.updateComment(ctx)
+}
+
+// GetEditedFiles 获取 AI 执行过程中修改过的文件
+func (pcm *ProgressCommentManager) GetEditedFiles() []string {
+	pcm.updateMutex.Lock()
+	defer pcm.updateMutex.Unlock()
+	
+	return slices.Clone(pcm.editedFiles)
+}
+
 // HideSpinner 隐藏Spinner动画
 func (pcm *ProgressCommentManager) HideSpinner(ctx context.Context) error {
 	pcm.updateMutex.Lock()
@@ -223,15 +260,15 @@ func (pcm *ProgressCommentManager) updateComment(ctx context.Context) error {
 func (pcm *ProgressCommentManager) renderInitialComment() string {
 	var sb strings.Builder
 	
-	sb.WriteString("## 🤖 CodeAgent is working on this...\n\n")
+	sb.WriteString(pcm.msgs.Working + "\n\n")
 	
 	// 任务列表
 	for _, task := range pcm.tracker.Tasks {
-		sb.WriteString(fmt.Sprintf("%s %s\n", task.GetStatusIcon(), task.Description))
+		sb.WriteString(fmt.Sprintf("%s %s\n", task.GetStatusIcon(), pcm.msgs.Task(task.Description)))
 	}
 	
 	sb.WriteString("\n---\n")
-	sb.WriteString(fmt.Sprintf("*Started at: %s*\n", pcm.tracker.StartTime.Format("15:04:05 MST")))
+	sb.WriteString("*" + fmt.Sprintf(pcm.msgs.StartedAt, pcm.tracker.StartTime.Format("15:04:05 MST")) + "*\n")
 	
 	return sb.String()
 }
@@ -240,19 +277,19 @@ func (pcm *ProgressCommentManager) renderInitialComment() string {
 func (pcm *ProgressCommentManager) renderProgressUpdate() string {
 	var sb strings.Builder
 	
-	sb.WriteString("## 🤖 CodeAgent is working on this...\n\n")
+	sb.WriteString(pcm.msgs.Working + "\n\n")
 	
 	// 任务列表
 	for _, task := range pcm.tracker.Tasks {
 		icon := task.GetStatusIcon()
-		description := task.Description
+		description := pcm.msgs.Task(task.Description)
 		
 		// 为当前任务添加额外信息
 		if task.ID == pcm.tracker.CurrentTaskID && task.IsActive() {
 			if pcm.tracker.Spinner.Active {
 				icon = pcm.tracker.Spinner.GetCurrentFrame()
 				if pcm.tracker.Spinner.Message != "" {
-					description += fmt.Sprintf(" - %s", pcm.tracker.Spinner.Message)
+					description += fmt.Sprintf(" - %s", pcm.msgs.Task(pcm.tracker.Spinner.Message))
 				}
 			}
 		}
@@ -264,7 +301,7 @@ func (pcm *ProgressCommentManager) renderProgressUpdate() string {
 		
 		// 添加错误信息（对于失败的任务）
 		if task.IsFailed() && task.Error != "" {
-			description += fmt.Sprintf(" - **Error**: %s", task.Error)
+			description += fmt.Sprintf(" - %s: %s", pcm.msgs.Error, task.Error)
 		}
 		
 		sb.WriteString(fmt.Sprintf("%s %s\n", icon, description))
@@ -272,9 +309,22 @@ func (pcm *ProgressCommentManager) renderProgressUpdate() string {
 	
 	// 当前Spinner信息
 	if pcm.tracker.Spinner.Active && pcm.tracker.Spinner.Message != "" {
-		sb.WriteString(fmt.Sprintf("\n%s Working on: %s\n", 
+		sb.WriteString(fmt.Sprintf("\n%s %s\n", 
 			pcm.tracker.Spinner.GetCurrentFrame(), 
-			pcm.tracker.Spinner.Message))
+			fmt.Sprintf(pcm.msgs.WorkingOn, pcm.msgs.Task(pcm.tracker.Spinner.Message))))
+	}
+	
+	// AI 执行步骤，只展示最近的若干条
+	if len(pcm.steps) > 0 {
+		sb.WriteString("\n" + pcm.msgs.Steps + "\n")
+		steps := pcm.steps
+		if len(steps) > maxRenderedSteps {
+			sb.WriteString("- *" + fmt.Sprintf(pcm.msgs.EarlierSteps, len(steps)-maxRenderedSteps) + "*\n")
+			steps = steps[len(steps)-maxRenderedSteps:]
+		}
+		for _, step := range steps {
+			sb.WriteString(fmt.Sprintf("- %s\n", step))
+		}
 	}
 	
 	// 进度信息
@@ -282,15 +332,15 @@ func (pcm *ProgressCommentManager) renderProgressUpdate() string {
 	completedTasks := pcm.tracker.GetCompletedTasksCount()
 	totalTasks := len(pcm.tracker.Tasks)
 	
-	sb.WriteString(fmt.Sprintf("\n**Progress**: %.0f%% (%d/%d tasks completed)\n", 
-		progress*100, completedTasks, totalTasks))
+	sb.WriteString("\n" + fmt.Sprintf(pcm.msgs.Progress, 
+		progress*100, completedTasks, totalTasks) + "\n")
 	
 	sb.WriteString("\n---\n")
-	sb.WriteString(fmt.Sprintf("*Started: %s", pcm.tracker.StartTime.Format("15:04:05 MST")))
+	sb.WriteString("*" + fmt.Sprintf(pcm.msgs.Started, pcm.tracker.StartTime.Format("15:04:05 MST")))
 	
 	if pcm.tracker.Status == models.TaskStatusInProgress {
 		elapsed := time.Since(pcm.tracker.StartTime)
-		sb.WriteString(fmt.Sprintf(" | Elapsed: %s*\n", formatDuration(elapsed)))
+		sb.WriteString(fmt.Sprintf(pcm.msgs.Elapsed, formatDuration(elapsed)) + "*\n")
 	} else {
 		sb.WriteString("*\n")
 	}
@@ -303,15 +353,17 @@ func (pcm *ProgressCommentManager) renderFinalComment(result *models.ProgressExe
 	var sb strings.Builder
 	
 	if result.Success {
-		sb.WriteString("## ✅ CodeAgent completed successfully!\n\n")
+		sb.WriteString(pcm.msgs.Completed + "\n\n")
+	} else if result.Cancelled {
+		sb.WriteString(pcm.msgs.Cancelled + "\n\n")
 	} else {
-		sb.WriteString("## ❌ CodeAgent encountered an error\n\n")
+		sb.WriteString(pcm.msgs.Failed + "\n\n")
 	}
 	
 	// 最终任务状态
 	for _, task := range pcm.tracker.Tasks {
 		icon := task.GetStatusIcon()
-		description := task.Description
+		description := pcm.msgs.Task(task.Description)
 		
 		// 添加持续时间
 		if task.Duration > 0 {
@@ -320,7 +372,7 @@ func (pcm *ProgressCommentManager) renderFinalComment(result *models.ProgressExe
 		
 		// 添加错误信息
 		if task.IsFailed() && task.Error != "" {
-			description += fmt.Sprintf(" - **Error**: %s", task.Error)
+			description += fmt.Sprintf(" - %s: %s", pcm.msgs.Error, task.Error)
 		}
 		
 		sb.WriteString(fmt.Sprintf("%s %s\n", icon, description))
@@ -328,12 +380,12 @@ func (pcm *ProgressCommentManager) renderFinalComment(result *models.ProgressExe
 	
 	// 结果摘要
 	if result.Summary != "" {
-		sb.WriteString(fmt.Sprintf("\n### Summary\n%s\n", result.Summary))
+		sb.WriteString(fmt.Sprintf("\n%s\n%s\n", pcm.msgs.Summary, result.Summary))
 	}
 	
 	// 文件变更信息
 	if len(result.FilesChanged) > 0 {
-		sb.WriteString("\n### Files Changed\n")
+		sb.WriteString("\n" + pcm.msgs.FilesChanged + "\n")
 		for _, file := range result.FilesChanged {
 			sb.WriteString(fmt.Sprintf("- `%s`\n", file))
 		}
@@ -341,21 +393,30 @@ func (pcm *ProgressCommentManager) renderFinalComment(result *models.ProgressExe
 	
 	// 分支和PR信息
 	if result.BranchName != "" {
-		sb.WriteString(fmt.Sprintf("\n### Branch\n`%s`\n", result.BranchName))
+		sb.WriteString(fmt.Sprintf("\n%s\n`%s`\n", pcm.msgs.Branch, result.BranchName))
 	}
 	
 	if result.PullRequestURL != "" {
-		sb.WriteString(fmt.Sprintf("\n### Pull Request\n[View Pull Request](%s)\n", result.PullRequestURL))
+		sb.WriteString(fmt.Sprintf("\n%s\n[%s](%s)\n", pcm.msgs.PullRequest, pcm.msgs.ViewPullRequest, result.PullRequestURL))
 	}
 	
 	// 错误信息
-	if !result.Success && result.Error != "" {
-		sb.WriteString(fmt.Sprintf("\n### Error Details\n```\n%s\n```\n", result.Error))
+	if !result.Success && !result.Cancelled && result.Error != "" {
+		sb.WriteString(fmt.Sprintf("\n%s\n```\n%s\n```\n", pcm.msgs.ErrorDetails, result.Error))
 	}
 	
-	// 时间统计
+	// 时间和用量统计
 	sb.WriteString("\n---\n")
-	sb.WriteString(fmt.Sprintf("*Completed in %s*\n", formatDuration(result.Duration)))
+	var stats string
+	if result.Cancelled {
+		stats = fmt.Sprintf(pcm.msgs.CancelledAfter, formatDuration(result.Duration))
+	} else {
+		stats = fmt.Sprintf(pcm.msgs.CompletedIn, formatDuration(result.Duration))
+	}
+	if result.Usage != nil {
+		stats += " · " + result.Usage.Summary()
+	}
+	sb.WriteString(fmt.Sprintf("*%s*\n", stats))
 	
 	return sb.String()
 }
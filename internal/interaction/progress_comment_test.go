@@ -5,6 +5,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/qiniu/codeagent/internal/code"
+	"github.com/qiniu/codeagent/internal/locale"
 	"github.com/qiniu/codeagent/pkg/models"
 
 	githubapi "github.com/google/go-github/v58/github"
@@ -55,7 +57,7 @@ func TestProgressCommentManager_BasicFlow(t *testing.T) {
 		},
 	}
 	
-	pcm := NewProgressCommentManager(mockGitHub, repo, 123)
+	pcm := NewProgressCommentManager(mockGitHub, repo, 123, locale.Get(locale.English))
 	pcm.SetTestMode(true) // 启用测试模式，禁用频率限制
 	ctx := context.Background()
 	
@@ -104,6 +106,7 @@ func TestProgressCommentManager_BasicFlow(t *testing.T) {
 		BranchName:     "feature/issue-123",
 		PullRequestURL: "https://github.com/test-owner/test-repo/pull/456",
 		Duration:       30 * time.Second,
+		Usage:          &models.TokenUsage{InputTokens: 1200, OutputTokens: 300, CostUSD: 0.05},
 	}
 	
 	err = pcm.FinalizeComment(ctx, result)
@@ -115,6 +118,7 @@ func TestProgressCommentManager_BasicFlow(t *testing.T) {
 	assert.Contains(t, finalContent, "Successfully implemented the requested feature")
 	assert.Contains(t, finalContent, "src/main.go")
 	assert.Contains(t, finalContent, "feature/issue-123")
+	assert.Contains(t, finalContent, "Tokens: 1200 input / 300 output · Cost: $0.0500")
 }
 
 func TestProgressCommentManager_TaskFailure(t *testing.T) {
@@ -126,7 +130,7 @@ func TestProgressCommentManager_TaskFailure(t *testing.T) {
 		},
 	}
 	
-	pcm := NewProgressCommentManager(mockGitHub, repo, 123)
+	pcm := NewProgressCommentManager(mockGitHub, repo, 123, locale.Get(locale.English))
 	pcm.SetTestMode(true) // 启用测试模式，禁用频率限制
 	ctx := context.Background()
 	
@@ -169,6 +173,37 @@ func TestProgressCommentManager_TaskFailure(t *testing.T) {
 	assert.Contains(t, finalContent, "❌") // failed icon
 }
 
+func TestProgressCommentManager_Cancelled(t *testing.T) {
+	mockGitHub := NewMockGitHubClient()
+	repo := &githubapi.Repository{
+		Name: githubapi.String("test-repo"),
+		Owner: &githubapi.User{
+			Login: githubapi.String("test-owner"),
+		},
+	}
+
+	pcm := NewProgressCommentManager(mockGitHub, repo, 123, locale.Get(locale.English))
+	pcm.SetTestMode(true)
+	ctx := context.Background()
+
+	err := pcm.InitializeProgress(ctx, []*models.Task{models.NewTask("task1", "task1", "First task")})
+	require.NoError(t, err)
+
+	result := &models.ProgressExecutionResult{
+		Success:   false,
+		Cancelled: true,
+		Error:     "task aborted: job cancelled",
+		Duration:  5 * time.Second,
+	}
+	err = pcm.FinalizeComment(ctx, result)
+	require.NoError(t, err)
+
+	finalContent := mockGitHub.GetComment(*pcm.context.CommentID)
+	assert.Contains(t, finalContent, "CodeAgent task was cancelled")
+	assert.Contains(t, finalContent, "Cancelled after")
+	assert.NotContains(t, finalContent, "Error Details")
+}
+
 func TestSpinnerState(t *testing.T) {
 	spinner := &models.SpinnerState{}
 	
@@ -212,4 +247,79 @@ func TestTaskFactory(t *testing.T) {
 	
 	fixTasks := factory.GetTasksForCommand(models.CommandFix, true)
 	assert.Len(t, fixTasks, 5) // /fix命令
-}
\ No newline at end of file
+}
+func TestProgressCommentManager_HandleCodeEvent(t *testing.T) {
+	mockGitHub := NewMockGitHubClient()
+	repo := &githubapi.Repository{
+		Name: githubapi.String("test-repo"),
+		Owner: &githubapi.User{
+			Login: githubapi.String("test-owner"),
+		},
+	}
+	
+	pcm := NewProgressCommentManager(mockGitHub, repo, 123, locale.Get(locale.English))
+	pcm.SetTestMode(true)
+	ctx := context.Background()
+	
+	require.NoError(t, pcm.InitializeProgress(ctx, NewTaskFactory().CreateIssueProcessingTasks()))
+	require.NoError(t, pcm.UpdateTask(ctx, "generate-code", models.TaskStatusInProgress, "Generating code implementation"))
+	
+	events := []code.Event{
+		{Type: code.EventText, Text: "Let me look at the code"},
+		{Type: code.EventToolUse, Tool: "Read", File: "internal/foo.go"},
+		{Type: code.EventFileEdit, Tool: "Edit", File: "internal/foo.go"},
+		{Type: code.EventToolUse, Tool: "Bash", Input: map[string]interface{}{"command": "go test ./..."}},
+		{Type: code.EventFileEdit, Tool: "Write", File: "internal/foo.go"},
+	}
+	for _, event := range events {
+		require.NoError(t, pcm.HandleCodeEvent(ctx, event))
+	}
+	
+	content := mockGitHub.GetComment(*pcm.context.CommentID)
+	assert.Contains(t, content, "### Steps")
+	assert.Contains(t, content, "- reading internal/foo.go")
+	assert.Contains(t, content, "- editing internal/foo.go")
+	assert.Contains(t, content, "- running `go test ./...`")
+	assert.NotContains(t, content, "Let me look at the code")
+	assert.Equal(t, []string{"internal/foo.go"}, pcm.GetEditedFiles())
+}
+
+func TestProgressCommentManager_Chinese(t *testing.T) {
+	mockGitHub := NewMockGitHubClient()
+	repo := &githubapi.Repository{
+		Name: githubapi.String("test-repo"),
+		Owner: &githubapi.User{
+			Login: githubapi.String("test-owner"),
+		},
+	}
+
+	pcm := NewProgressCommentManager(mockGitHub, repo, 123, locale.Get(locale.Chinese))
+	pcm.SetTestMode(true)
+	ctx := context.Background()
+
+	require.NoError(t, pcm.InitializeProgress(ctx, NewTaskFactory().CreateIssueProcessingTasks()))
+	require.NoError(t, pcm.UpdateTask(ctx, "gather-context", models.TaskStatusInProgress, "Gathering context"))
+
+	content := mockGitHub.GetComment(*pcm.context.CommentID)
+	assert.Contains(t, content, "## 🤖 CodeAgent 正在处理...")
+	assert.Contains(t, content, "收集上下文并分析 Issue - 收集上下文")
+	assert.Contains(t, content, "**进度**：0%（已完成 0/5 个任务）")
+
+	require.NoError(t, pcm.HandleCodeEvent(ctx, code.Event{Type: code.EventFileEdit, Tool: "Edit", File: "internal/foo.go"}))
+	content = mockGitHub.GetComment(*pcm.context.CommentID)
+	assert.Contains(t, content, "- 编辑 internal/foo.go")
+
+	result := &models.ProgressExecutionResult{
+		Success:        true,
+		BranchName:     "codeagent/issue-123",
+		PullRequestURL: "https://github.com/test-owner/test-repo/pull/124",
+		Duration:       30 * time.Second,
+	}
+	require.NoError(t, pcm.FinalizeComment(ctx, result))
+
+	finalContent := mockGitHub.GetComment(*pcm.context.CommentID)
+	assert.Contains(t, finalContent, "## ✅ CodeAgent 已完成！")
+	assert.Contains(t, finalContent, "### 分支\n`codeagent/issue-123`")
+	assert.Contains(t, finalContent, "[查看 Pull Request](https://github.com/test-owner/test-repo/pull/124)")
+	assert.Contains(t, finalContent, "耗时 30.0s")
+}
@@ -0,0 +1,426 @@
+// Package locale 提供 CodeAgent 发布到 GitHub 的内容（PR 描述、进度评论等）的多语言文本
+package locale
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/qiniu/codeagent/pkg/models"
+)
+
+// 支持的语言
+const (
+	Chinese = "zh"
+	English = "en"
+)
+
+// Default 未配置语言时使用的语言
+const Default = Chinese
+
+// Messages 一种语言的文本，包含 % 占位符的文本用于 fmt.Sprintf
+type Messages struct {
+	// 语言名称，如 zh、en
+	Name string
+
+	// AI 输出和 PR 描述中的章节标题
+	SectionSummary  string
+	SectionChanges  string
+	SectionTestPlan string
+
+	// PR 描述中 AI 输出之后的附加信息
+	FullOutput     string
+	ErrorInfo      string
+	OriginalPrompt string
+
+	// 根据 Issue 创建的 PR 的标题（Issue 编号、标题）和初始描述（Issue 编号、描述）
+	PRTitle string
+	PRBody  string
+
+	// 提示词中的历史上下文标题
+	HistoryDescription    string
+	HistoryComments       string
+	HistoryReviewComments string
+	HistoryReviews        string
+
+	// 提示词末尾仓库说明（.codeagent.yaml 的 instructions）的标题
+	RepoInstructions string
+
+	// 进度评论
+	Working         string
+	Completed       string
+	Cancelled       string
+	Failed          string
+	StartedAt       string // 开始时间
+	Started         string // 开始时间
+	Elapsed         string // 已用时间
+	WorkingOn       string // 当前步骤
+	Steps           string
+	EarlierSteps    string // 省略的步骤数
+	Progress        string // 百分比、已完成任务数、任务总数
+	Error           string
+	Summary         string
+	FilesChanged    string
+	Branch          string
+	PullRequest     string
+	ViewPullRequest string
+	ErrorDetails    string
+	CompletedIn     string // 耗时
+	CancelledAfter  string // 耗时
+
+	// 没有权限触发命令时的答复（用户名）
+	PermissionDenied string
+
+	// 自动审查：审查总结的标题（同时用于识别之前的审查）、AI 没有给出总结时的内容、
+	// 无法作为行内评论发布的意见的标题，以及过时的行内评论的标记（修改所在的提交）
+	ReviewHeader        string
+	ReviewNoSummary     string
+	ReviewOtherFindings string
+	ReviewOutdated      string
+
+	// 审查的 diff 过长被截断时的说明（提示词中包含的 KB 数）
+	ReviewDiffTruncated string
+
+	// 推送分析创建的 Issue 的标题（问题数、分支、提交）
+	PushAnalysisTitle string
+
+	// /suggest 用于旧版本文件中的行时的答复，以及无法生成建议时的答复（原因）
+	SuggestNewLinesOnly string
+	SuggestFailed       string
+
+	// 改动中发现疑似密钥、推送被阻止时的报告（表格行）
+	SecretScanBlocked string
+
+	// stale_issues 定时任务默认的提醒评论（不活跃天数、标签）
+	StaleIssue string
+
+	// 进度评论中 AI 的执行步骤（文件、命令、搜索内容、工具名）
+	StepEditing   string
+	StepReading   string
+	StepRunning   string
+	StepSearching string
+	StepUsing     string
+
+	// 任务排队时的状态评论（排队位置）和开始执行时的更新
+	QueueWaiting string
+	QueueStarted string
+
+	// 任务被取消时的状态评论（取消人），以及工作空间改动的还原结果
+	CancelledBy        string
+	CancelReverted     string
+	CancelRevertFailed string
+
+	// 同一 Issue/PR 上任务次数超过 loop_guard 限制时的答复（次数）
+	LoopGuard string
+
+	// 预算用完或执行命令后会超出时的答复：周期、单位、统计对象、名称、已用量、上限、单位（复数）、
+	// 每个任务的平均用量、重置时间，周期、单位和统计对象通过 BudgetTerm 翻译
+	BudgetExceeded string
+
+	// 任务描述和进度消息的翻译，key 为英文原文
+	tasks map[string]string
+	// 预算周期、单位和统计对象的翻译，key 为英文原文
+	budgetTerms map[string]string
+}
+
+// BudgetTerm 返回预算周期、单位或统计对象的翻译，没有翻译时原样返回
+func (m *Messages) BudgetTerm(term string) string {
+	if translated, ok := m.budgetTerms[term]; ok {
+		return translated
+	}
+	return term
+}
+
+// Task 返回任务描述或进度消息的翻译，没有翻译时原样返回
+func (m *Messages) Task(text string) string {
+	if translated, ok := m.tasks[text]; ok {
+		return translated
+	}
+	return text
+}
+
+var chinese = &Messages{
+	Name: Chinese,
+
+	SectionSummary:  models.SectionSummary,
+	SectionChanges:  models.SectionChanges,
+	SectionTestPlan: models.SectionTestPlan,
+
+	FullOutput:     "AI 完整输出",
+	ErrorInfo:      "## 错误信息",
+	OriginalPrompt: "原始 Prompt",
+
+	PRTitle: "实现 Issue #%d: %s",
+	PRBody: `## 实现计划
+
+这是由 Code Agent 自动生成的 PR，用于实现 Issue #%d。
+
+### Issue 描述
+%s
+
+### 实现计划
+- [ ] 分析需求并制定实现方案
+- [ ] 编写核心代码
+- [ ] 添加测试用例
+- [ ] 代码审查和优化
+
+---
+*此 PR 由 Code Agent(https://github.com/qiniu/codeagent) 自动创建，将逐步完善实现*`,
+
+	HistoryDescription:    "## PR 描述",
+	HistoryComments:       "## 历史评论",
+	HistoryReviewComments: "## 代码行评论",
+	HistoryReviews:        "## Review 评论",
+
+	RepoInstructions: "## 仓库说明",
+
+	Working:         "## 🤖 CodeAgent 正在处理...",
+	Completed:       "## ✅ CodeAgent 已完成！",
+	Cancelled:       "## 🛑 CodeAgent 任务已取消",
+	Failed:          "## ❌ CodeAgent 执行出错",
+	StartedAt:       "开始于：%s",
+	Started:         "开始：%s",
+	Elapsed:         " | 已用时：%s",
+	WorkingOn:       "正在进行：%s",
+	Steps:           "### 执行步骤",
+	EarlierSteps:    "... 之前的 %d 个步骤",
+	Progress:        "**进度**：%.0f%%（已完成 %d/%d 个任务）",
+	Error:           "**错误**",
+	Summary:         "### 摘要",
+	FilesChanged:    "### 修改的文件",
+	Branch:          "### 分支",
+	PullRequest:     "### Pull Request",
+	ViewPullRequest: "查看 Pull Request",
+	ErrorDetails:    "### 错误详情",
+	CompletedIn:     "耗时 %s",
+	CancelledAfter:  "已在 %s 后取消",
+
+	PermissionDenied: "@%s 抱歉，你没有在此仓库触发 CodeAgent 命令的权限，命令未被执行。如有需要，请联系仓库维护者代为执行，或请管理员调整 CodeAgent 配置中的 `permissions`。",
+
+	ReviewHeader:        "## CodeAgent 审查",
+	ReviewNoSummary:     "未提供总结。",
+	ReviewOtherFindings: "### 其他问题",
+	ReviewOutdated:      "> **已过时**：这段代码已在 %s 中修改。",
+
+	ReviewDiffTruncated: "⚠️ 此 PR 的 diff 超过 %[1]d KB，审查时只向 AI 提供了前 %[1]d KB，其余变更由 AI 在工作空间中自行查看，审查结果可能不完整。",
+
+	PushAnalysisTitle: "推送分析：%[2]s@%[3]s 中发现 %[1]d 个潜在问题",
+
+	SuggestNewLinesOnly: "只能对文件新版本中的行给出修改建议。",
+	SuggestFailed:       "无法生成修改建议：%v。可以使用 `/fix` 让 CodeAgent 直接提交修改。",
+
+	StaleIssue: "这个 Issue 已经 %d 天没有动态，已标记为 `%s`。如果仍需处理，请留言说明。",
+
+	StepEditing:   "编辑 %s",
+	StepReading:   "读取 %s",
+	StepRunning:   "运行 `%s`",
+	StepSearching: "搜索 %s",
+	StepUsing:     "使用 %s",
+
+	QueueWaiting: "⏳ CodeAgent 正忙，此任务正在排队（第 %d 位），有空闲时会自动开始。",
+	QueueStarted: "🚀 CodeAgent 已开始处理此任务。",
+
+	CancelledBy:        "🛑 任务已被 @%s 取消。",
+	CancelReverted:     "工作空间中未提交的改动已还原。",
+	CancelRevertFailed: "还原工作空间中未提交的改动失败。",
+
+	LoopGuard: "🔁 CodeAgent 最近已在此讨论中运行了 %d 次，为避免机器人之间可能的循环，暂时不再接受新任务，稍后会自动恢复。管理员可以在 CodeAgent 配置中调整 `loop_guard`。",
+
+	BudgetExceeded: "此命令未执行：%[3]s `%[4]s` 的%[1]s预算（%[2]s）已用 %[5]d / %[6]d %[7]s，每个任务平均使用约 %[8]d %[7]s，执行后会超出预算。\n\n预算将于 %[9]s 重置。管理员可以在 CodeAgent 配置的 `budgets` 中提高额度或豁免用户。",
+	budgetTerms: map[string]string{
+		"daily":        "每日",
+		"monthly":      "每月",
+		"token":        "token",
+		"tokens":       "token",
+		"minute":       "运行时长",
+		"minutes":      "分钟",
+		"repository":   "仓库",
+		"organization": "组织",
+		"user":         "用户",
+	},
+
+	SecretScanBlocked: `## 🔐 CodeAgent 阻止了包含疑似密钥的推送
+
+本次任务产生的改动中有疑似凭证的内容，因此没有推送任何代码。下列文件已在工作空间中还原，任务中的提交已撤销，其余改动保留为未提交状态。
+
+| 文件 | 行 | 规则 | 匹配内容 |
+|------|----|------|----------|
+%s
+如果是误报，管理员可以在 CodeAgent 配置的 ` + "`secret_scan.allowlist` 或 `secret_scan.allow_paths`" + ` 中添加例外。`,
+
+	tasks: map[string]string{
+		"Gathering context and analyzing issue":       "收集上下文并分析 Issue",
+		"Setting up workspace and creating branch":    "准备工作空间并创建分支",
+		"Generating code implementation":              "生成代码实现",
+		"Committing changes to repository":            "提交改动到仓库",
+		"Creating pull request":                       "创建 Pull Request",
+		"Gathering PR context and comments":           "收集 PR 上下文和评论",
+		"Analyzing existing changes and requirements": "分析已有改动和需求",
+		"Preparing workspace for modifications":       "准备工作空间",
+		"Implementing requested changes":              "实现要求的改动",
+		"Committing updates to PR branch":             "提交改动到 PR 分支",
+		"Gathering PR context and issue details":      "收集 PR 上下文和问题详情",
+		"Identifying problems and errors":             "定位问题和错误",
+		"Preparing workspace for fixes":               "准备工作空间",
+		"Applying fixes to resolve issues":            "修复问题",
+		"Committing fixes to PR branch":               "提交修复到 PR 分支",
+		"Gathering PR details and changed files":      "收集 PR 详情和修改的文件",
+		"Analyzing code quality and changes":          "分析代码质量和改动",
+		"Running automated checks and tests":          "运行自动检查和测试",
+		"Generating review comments":                  "生成审查意见",
+		"Submitting review to GitHub":                 "提交审查到 GitHub",
+		"Gathering PR and review context":             "收集 PR 和 Review 上下文",
+		"Processing review comments":                  "处理 Review 评论",
+		"Preparing workspace for changes":             "准备工作空间",
+		"Implementing review feedback":                "根据 Review 意见修改",
+		"Committing feedback implementations":         "提交修改",
+		"Gathering context":                           "收集上下文",
+		"Processing request":                          "处理请求",
+		"Generating response":                         "生成回复",
+		"Finalizing results":                          "整理结果",
+		"Analyzing issue and requirements":            "分析 Issue 和需求",
+		"Creating workspace and branch":               "创建工作空间和分支",
+		"Committing changes":                          "提交改动",
+	},
+}
+
+var english = &Messages{
+	Name: English,
+
+	SectionSummary:  "## Summary",
+	SectionChanges:  "## Changes",
+	SectionTestPlan: "## Test Plan",
+
+	FullOutput:     "Full AI output",
+	ErrorInfo:      "## Errors",
+	OriginalPrompt: "Prompt",
+
+	PRTitle: "Implement issue #%d: %s",
+	PRBody: `## Implementation Plan
+
+This PR was created by Code Agent to implement issue #%d.
+
+### Issue Description
+%s
+
+### Plan
+- [ ] Analyze the requirements and design the implementation
+- [ ] Write the core code
+- [ ] Add tests
+- [ ] Review and polish
+
+---
+*This PR was created by Code Agent(https://github.com/qiniu/codeagent) and will be updated as the implementation progresses*`,
+
+	HistoryDescription:    "## PR Description",
+	HistoryComments:       "## Comments",
+	HistoryReviewComments: "## Review Comments",
+	HistoryReviews:        "## Reviews",
+
+	RepoInstructions: "## Repository instructions",
+
+	Working:         "## 🤖 CodeAgent is working on this...",
+	Completed:       "## ✅ CodeAgent completed successfully!",
+	Cancelled:       "## 🛑 CodeAgent task was cancelled",
+	Failed:          "## ❌ CodeAgent encountered an error",
+	StartedAt:       "Started at: %s",
+	Started:         "Started: %s",
+	Elapsed:         " | Elapsed: %s",
+	WorkingOn:       "Working on: %s",
+	Steps:           "### Steps",
+	EarlierSteps:    "... %d earlier steps",
+	Progress:        "**Progress**: %.0f%% (%d/%d tasks completed)",
+	Error:           "**Error**",
+	Summary:         "### Summary",
+	FilesChanged:    "### Files Changed",
+	Branch:          "### Branch",
+	PullRequest:     "### Pull Request",
+	ViewPullRequest: "View Pull Request",
+	ErrorDetails:    "### Error Details",
+	CompletedIn:     "Completed in %s",
+	CancelledAfter:  "Cancelled after %s",
+
+	PermissionDenied: "@%s sorry, you don't have permission to trigger CodeAgent commands in this repository, so this command was not run. Please ask a maintainer to run it for you, or ask an administrator to adjust `permissions` in the CodeAgent configuration.",
+
+	ReviewHeader:        "## CodeAgent Review",
+	ReviewNoSummary:     "No summary provided.",
+	ReviewOtherFindings: "### Other findings",
+	ReviewOutdated:      "> **Outdated**: this code was changed in %s.",
+
+	ReviewDiffTruncated: "⚠️ The diff of this PR is larger than %[1]d KB, so only the first %[1]d KB was given to the AI for review. The AI looks at the remaining changes in the workspace on its own, and the review may be incomplete.",
+
+	PushAnalysisTitle: "Push analysis: %d potential issue(s) in %s@%s",
+
+	SuggestNewLinesOnly: "Suggestions can only be made on lines of the new version of the file.",
+	SuggestFailed:       "Could not produce a suggestion: %v. Use `/fix` to let CodeAgent commit the change instead.",
+
+	StaleIssue: "This issue has had no activity for %d days and has been marked as `%s`. Please comment if it is still relevant.",
+
+	StepEditing:   "editing %s",
+	StepReading:   "reading %s",
+	StepRunning:   "running `%s`",
+	StepSearching: "searching %s",
+	StepUsing:     "using %s",
+
+	QueueWaiting: "⏳ CodeAgent is busy, this task is waiting in queue (position %d). It will start automatically when a slot is free.",
+	QueueStarted: "🚀 CodeAgent has picked up this task and is now working on it.",
+
+	CancelledBy:        "🛑 Task cancelled by @%s.",
+	CancelReverted:     "Uncommitted changes in the workspace have been reverted.",
+	CancelRevertFailed: "Failed to revert uncommitted changes in the workspace.",
+
+	LoopGuard: "🔁 CodeAgent has already run %d times on this thread recently, so new tasks are skipped for now to avoid a possible loop between bots. They will be accepted again later; administrators can adjust `loop_guard` in the CodeAgent configuration.",
+
+	BudgetExceeded: "this command was not started because it would exceed the %[1]s %[2]s budget of %[3]s `%[4]s`: %[5]d of %[6]d %[7]s are used and a task uses about %[8]d %[7]s on average.\n\nThe budget resets at %[9]s. Administrators can raise the limit or exempt users in the `budgets` section of the CodeAgent configuration.",
+
+	SecretScanBlocked: `## 🔐 CodeAgent blocked a push containing potential secrets
+
+The changes produced for this task contain content that looks like credentials, so nothing was pushed. The files below were reverted in the workspace, commits made during the task were undone, and the remaining changes were left uncommitted.
+
+| File | Line | Rule | Match |
+|------|------|------|-------|
+%s
+If a finding is a false positive, administrators can add it to ` + "`secret_scan.allowlist` or `secret_scan.allow_paths`" + ` in the CodeAgent configuration.`,
+}
+
+var all = []*Messages{chinese, english}
+
+// Get 返回语言的文本，name 为空或不支持时使用默认语言
+func Get(name string) *Messages {
+	for _, m := range all {
+		if m.Name == name {
+			return m
+		}
+	}
+	return Get(Default)
+}
+
+// Supported 判断是否支持该语言
+func Supported(name string) bool {
+	return slices.Contains(Names(), name)
+}
+
+// Names 返回支持的语言
+func Names() []string {
+	names := make([]string, 0, len(all))
+	for _, m := range all {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+// Section 判断一行是否为章节标题并返回章节标识（models.SectionSummaryID 等），不是章节标题时返回空。
+// 所有语言的标题都能识别，AI 使用了与配置不同的语言回复时也能解析
+func Section(line string) string {
+	line = strings.TrimSpace(line)
+	for _, m := range all {
+		switch {
+		case strings.HasPrefix(line, m.SectionSummary):
+			return models.SectionSummaryID
+		case strings.HasPrefix(line, m.SectionChanges):
+			return models.SectionChangesID
+		case strings.HasPrefix(line, m.SectionTestPlan):
+			return models.SectionTestPlanID
+		}
+	}
+	return ""
+}
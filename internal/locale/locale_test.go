@@ -0,0 +1,59 @@
+package locale
+
+import (
+	"testing"
+
+	"github.com/qiniu/codeagent/pkg/models"
+)
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"", Default},
+		{Chinese, Chinese},
+		{English, English},
+		{"fr", Default},
+	}
+
+	for _, tt := range tests {
+		if got := Get(tt.name).Name; got != tt.expected {
+			t.Errorf("Get(%q) = %q, want %q", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestSection(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"## 改动摘要", models.SectionSummaryID},
+		{"  ## 具体改动", models.SectionChangesID},
+		{"## 测试计划", models.SectionTestPlanID},
+		{"## Summary", models.SectionSummaryID},
+		{"## Changes", models.SectionChangesID},
+		{"## Test Plan", models.SectionTestPlanID},
+		{"## Notes", ""},
+		{"Summary of the changes", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Section(tt.line); got != tt.expected {
+			t.Errorf("Section(%q) = %q, want %q", tt.line, got, tt.expected)
+		}
+	}
+}
+
+func TestTask(t *testing.T) {
+	if got := Get(Chinese).Task("Creating pull request"); got != "创建 Pull Request" {
+		t.Errorf("Unexpected translation: %q", got)
+	}
+	if got := Get(English).Task("Creating pull request"); got != "Creating pull request" {
+		t.Errorf("Unexpected English task: %q", got)
+	}
+	if got := Get(Chinese).Task("reading main.go"); got != "reading main.go" {
+		t.Errorf("Untranslated text should be returned as is, got %q", got)
+	}
+}
@@ -3,6 +3,7 @@ package servers
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/qiniu/codeagent/internal/github"
@@ -113,6 +114,33 @@ func NewGitHubCommentsServer(client *github.Client) *GitHubCommentsServer {
 							Required: []string{"pull_number", "body", "commit_id", "path", "line"},
 						},
 					},
+					{
+						Name:        "create_review",
+						Description: "Submit a review with a summary on a pull request",
+						InputSchema: &models.JSONSchema{
+							Type: "object",
+							Properties: map[string]*models.JSONSchema{
+								"pull_number": {
+									Type:        "integer",
+									Description: "Pull request number",
+								},
+								"body": {
+									Type:        "string",
+									Description: "Review summary (Markdown supported)",
+								},
+								"commit_id": {
+									Type:        "string",
+									Description: "SHA of the commit being reviewed",
+								},
+								"event": {
+									Type:        "string",
+									Description: "Review action, defaults to COMMENT",
+									Enum:        []interface{}{"COMMENT", "APPROVE", "REQUEST_CHANGES"},
+								},
+							},
+							Required: []string{"pull_number", "body"},
+						},
+					},
 					{
 						Name:        "list_pr_comments",
 						Description: "List all comments on a pull request (issue + review comments)",
@@ -180,7 +208,8 @@ func (s *GitHubCommentsServer) HandleToolCall(ctx context.Context, call *models.
 	
 	xl.Infof("Executing GitHub comments tool: %s on %s/%s", call.Function.Name, owner, repo)
 	
-	switch call.Function.Name {
+	// manager 传入的工具名带有服务器前缀
+	switch strings.TrimPrefix(call.Function.Name, "github-comments_") {
 	case "create_comment":
 		return s.createComment(ctx, call, owner, repo, mcpCtx)
 	case "update_comment":
@@ -189,6 +218,8 @@ func (s *GitHubCommentsServer) HandleToolCall(ctx context.Context, call *models.
 		return s.listComments(ctx, call, owner, repo)
 	case "create_review_comment":
 		return s.createReviewComment(ctx, call, owner, repo, mcpCtx)
+	case "create_review":
+		return s.createReview(ctx, call, owner, repo, mcpCtx)
 	case "list_pr_comments":
 		return s.listPRComments(ctx, call, owner, repo)
 	default:
@@ -212,7 +243,7 @@ func (s *GitHubCommentsServer) Shutdown(ctx context.Context) error {
 
 // createComment 创建评论
 func (s *GitHubCommentsServer) createComment(ctx context.Context, call *models.ToolCall, owner, repo string, mcpCtx *models.MCPContext) (*models.ToolResult, error) {
-	issueNumber := int(call.Function.Arguments["issue_number"].(float64))
+	issueNumber := intArgument(call.Function.Arguments, "issue_number")
 	body := call.Function.Arguments["body"].(string)
 	
 	// 检查写权限
@@ -253,7 +284,7 @@ func (s *GitHubCommentsServer) createComment(ctx context.Context, call *models.T
 
 // updateComment 更新评论
 func (s *GitHubCommentsServer) updateComment(ctx context.Context, call *models.ToolCall, owner, repo string, mcpCtx *models.MCPContext) (*models.ToolResult, error) {
-	commentID := int64(call.Function.Arguments["comment_id"].(float64))
+	commentID := int64(intArgument(call.Function.Arguments, "comment_id"))
 	body := call.Function.Arguments["body"].(string)
 	
 	// 检查写权限
@@ -290,7 +321,7 @@ func (s *GitHubCommentsServer) updateComment(ctx context.Context, call *models.T
 
 // listComments 列出评论
 func (s *GitHubCommentsServer) listComments(ctx context.Context, call *models.ToolCall, owner, repo string) (*models.ToolResult, error) {
-	issueNumber := int(call.Function.Arguments["issue_number"].(float64))
+	issueNumber := intArgument(call.Function.Arguments, "issue_number")
 	
 	opts := &githubapi.IssueListCommentsOptions{
 		ListOptions: githubapi.ListOptions{PerPage: 100},
@@ -339,11 +370,11 @@ func (s *GitHubCommentsServer) listComments(ctx context.Context, call *models.To
 
 // createReviewComment 创建review评论
 func (s *GitHubCommentsServer) createReviewComment(ctx context.Context, call *models.ToolCall, owner, repo string, mcpCtx *models.MCPContext) (*models.ToolResult, error) {
-	pullNumber := int(call.Function.Arguments["pull_number"].(float64))
+	pullNumber := intArgument(call.Function.Arguments, "pull_number")
 	body := call.Function.Arguments["body"].(string)
 	commitID := call.Function.Arguments["commit_id"].(string)
 	path := call.Function.Arguments["path"].(string)
-	line := int(call.Function.Arguments["line"].(float64))
+	line := intArgument(call.Function.Arguments, "line")
 	
 	// 检查写权限
 	if !s.hasWritePermission(mcpCtx) {
@@ -390,9 +421,59 @@ func (s *GitHubCommentsServer) createReviewComment(ctx context.Context, call *mo
 	}, nil
 }
 
+// createReview 提交带总结的review
+func (s *GitHubCommentsServer) createReview(ctx context.Context, call *models.ToolCall, owner, repo string, mcpCtx *models.MCPContext) (*models.ToolResult, error) {
+	pullNumber := intArgument(call.Function.Arguments, "pull_number")
+	body := call.Function.Arguments["body"].(string)
+	
+	// 检查写权限
+	if !s.hasWritePermission(mcpCtx) {
+		return &models.ToolResult{
+			ID:      call.ID,
+			Success: false,
+			Error:   "insufficient permissions for review creation",
+			Type:    "error",
+		}, nil
+	}
+	
+	request := &githubapi.PullRequestReviewRequest{
+		Body:  &body,
+		Event: githubapi.String("COMMENT"),
+	}
+	if event, ok := call.Function.Arguments["event"].(string); ok && event != "" {
+		request.Event = &event
+	}
+	if commitID, ok := call.Function.Arguments["commit_id"].(string); ok && commitID != "" {
+		request.CommitID = &commitID
+	}
+	
+	review, _, err := s.client.GetClient().PullRequests.CreateReview(ctx, owner, repo, pullNumber, request)
+	if err != nil {
+		return &models.ToolResult{
+			ID:      call.ID,
+			Success: false,
+			Error:   fmt.Sprintf("failed to create review: %v", err),
+			Type:    "error",
+		}, nil
+	}
+	
+	return &models.ToolResult{
+		ID:      call.ID,
+		Success: true,
+		Content: map[string]interface{}{
+			"id":          review.GetID(),
+			"url":         review.GetHTMLURL(),
+			"state":       review.GetState(),
+			"commit_id":   review.GetCommitID(),
+			"pull_number": pullNumber,
+		},
+		Type: "json",
+	}, nil
+}
+
 // listPRComments 列出PR的所有评论
 func (s *GitHubCommentsServer) listPRComments(ctx context.Context, call *models.ToolCall, owner, repo string) (*models.ToolResult, error) {
-	pullNumber := int(call.Function.Arguments["pull_number"].(float64))
+	pullNumber := intArgument(call.Function.Arguments, "pull_number")
 	
 	// 获取PR详情
 	pr, _, err := s.client.GetClient().PullRequests.Get(ctx, owner, repo, pullNumber)
@@ -482,6 +563,19 @@ func (s *GitHubCommentsServer) listPRComments(ctx context.Context, call *models.
 	}, nil
 }
 
+// intArgument 读取整数参数，JSON 解码得到 float64，直接调用时为 int
+func intArgument(args map[string]interface{}, name string) int {
+	switch v := args[name].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case int64:
+		return int(v)
+	}
+	return 0
+}
+
 // hasWritePermission 检查是否有写权限
 func (s *GitHubCommentsServer) hasWritePermission(mcpCtx *models.MCPContext) bool {
 	if mcpCtx.Permissions == nil {
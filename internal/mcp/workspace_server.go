@@ -0,0 +1,234 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qiniu/codeagent/pkg/models"
+	"github.com/qiniu/x/xlog"
+)
+
+// maxListedFiles list_files 最多返回的文件数，避免大仓库撑爆上下文
+const maxListedFiles = 500
+
+// WorkspaceServer 本地工作空间文件操作MCP服务器
+// 直接读写 mcpCtx.WorkspacePath 下的文件，改动由后续的提交流程统一提交
+type WorkspaceServer struct {
+	info *models.MCPServerInfo
+}
+
+// NewWorkspaceServer 创建工作空间文件操作服务器
+func NewWorkspaceServer() *WorkspaceServer {
+	return &WorkspaceServer{
+		info: &models.MCPServerInfo{
+			Name:        "workspace",
+			Version:     "1.0.0",
+			Description: "File operations inside the local workspace",
+			Capabilities: models.MCPServerCapabilities{
+				Tools: []models.Tool{
+					{
+						Name:        "read_file",
+						Description: "Read a file from the workspace",
+						InputSchema: &models.JSONSchema{
+							Type: "object",
+							Properties: map[string]*models.JSONSchema{
+								"path": {
+									Type:        "string",
+									Description: "File path relative to the workspace root",
+								},
+							},
+							Required: []string{"path"},
+						},
+					},
+					{
+						Name:        "write_file",
+						Description: "Create or overwrite a file in the workspace",
+						InputSchema: &models.JSONSchema{
+							Type: "object",
+							Properties: map[string]*models.JSONSchema{
+								"path": {
+									Type:        "string",
+									Description: "File path relative to the workspace root",
+								},
+								"content": {
+									Type:        "string",
+									Description: "Full content of the file",
+								},
+							},
+							Required: []string{"path", "content"},
+						},
+					},
+					{
+						Name:        "list_files",
+						Description: "List files under a directory of the workspace",
+						InputSchema: &models.JSONSchema{
+							Type: "object",
+							Properties: map[string]*models.JSONSchema{
+								"path": {
+									Type:        "string",
+									Description: "Directory relative to the workspace root, defaults to the root",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// GetInfo 获取服务器信息
+func (s *WorkspaceServer) GetInfo() *models.MCPServerInfo {
+	return s.info
+}
+
+// GetTools 获取工具列表
+func (s *WorkspaceServer) GetTools() []models.Tool {
+	return s.info.Capabilities.Tools
+}
+
+// IsAvailable 只有在上下文中存在工作空间时可用
+func (s *WorkspaceServer) IsAvailable(ctx context.Context, mcpCtx *models.MCPContext) bool {
+	return mcpCtx != nil && mcpCtx.WorkspacePath != ""
+}
+
+// HandleToolCall 处理工具调用
+func (s *WorkspaceServer) HandleToolCall(ctx context.Context, call *models.ToolCall, mcpCtx *models.MCPContext) (*models.ToolResult, error) {
+	xl := xlog.NewWith(ctx)
+
+	if mcpCtx == nil || mcpCtx.WorkspacePath == "" {
+		return nil, fmt.Errorf("no workspace available")
+	}
+
+	path, _ := call.Function.Arguments["path"].(string)
+	fullPath, err := resolveWorkspacePath(mcpCtx.WorkspacePath, path)
+	if err != nil {
+		return s.errorResult(call.ID, err), nil
+	}
+
+	xl.Infof("Executing workspace tool: %s on %s", call.Function.Name, path)
+
+	// manager 转发的工具名带有服务器前缀
+	switch strings.TrimPrefix(call.Function.Name, "workspace_") {
+	case "read_file":
+		content, err := os.ReadFile(fullPath)
+		if err != nil {
+			return s.errorResult(call.ID, fmt.Errorf("failed to read file: %w", err)), nil
+		}
+		return &models.ToolResult{ID: call.ID, Success: true, Content: string(content), Type: "text"}, nil
+	case "write_file":
+		content, _ := call.Function.Arguments["content"].(string)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return s.errorResult(call.ID, fmt.Errorf("failed to create directory: %w", err)), nil
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			return s.errorResult(call.ID, fmt.Errorf("failed to write file: %w", err)), nil
+		}
+		return &models.ToolResult{
+			ID:      call.ID,
+			Success: true,
+			Content: map[string]interface{}{"path": path, "size": len(content)},
+			Type:    "json",
+		}, nil
+	case "list_files":
+		files, err := listWorkspaceFiles(mcpCtx.WorkspacePath, fullPath)
+		if err != nil {
+			return s.errorResult(call.ID, fmt.Errorf("failed to list files: %w", err)), nil
+		}
+		return &models.ToolResult{ID: call.ID, Success: true, Content: files, Type: "json"}, nil
+	default:
+		return nil, fmt.Errorf("unknown tool: %s", call.Function.Name)
+	}
+}
+
+// Initialize 初始化服务器
+func (s *WorkspaceServer) Initialize(ctx context.Context) error {
+	return nil
+}
+
+// Shutdown 关闭服务器
+func (s *WorkspaceServer) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (s *WorkspaceServer) errorResult(id string, err error) *models.ToolResult {
+	return &models.ToolResult{ID: id, Success: false, Error: err.Error(), Type: "error"}
+}
+
+// resolveWorkspacePath 将路径限定在工作空间内解析，禁止访问 .git 目录。
+// 路径中的符号链接会被解析，指向工作空间之外的链接（仓库中提交的或模型创建的）一律拒绝
+func resolveWorkspacePath(root, path string) (string, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve workspace: %w", err)
+	}
+	fullPath, err := evalExistingSymlinks(filepath.Join(realRoot, filepath.Clean("/"+path)))
+	if err != nil {
+		return "", fmt.Errorf("path %q is not accessible", path)
+	}
+	rel, err := filepath.Rel(realRoot, fullPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) ||
+		rel == ".git" || strings.HasPrefix(rel, ".git"+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q is not accessible", path)
+	}
+	return fullPath, nil
+}
+
+// evalExistingSymlinks 解析路径中已存在部分的符号链接，尚不存在的部分（如要写入的新文件）原样拼接。
+// 悬空的符号链接无法确定写入位置，返回错误
+func evalExistingSymlinks(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return resolved, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	if _, lerr := os.Lstat(path); lerr == nil {
+		return "", err
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return "", err
+	}
+	dir, err := evalExistingSymlinks(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+// listWorkspaceFiles 列出目录下的文件（相对工作空间根目录），跳过 .git
+func listWorkspaceFiles(root, dir string) ([]string, error) {
+	// dir 已解析符号链接，root 也需要解析后才能计算相对路径
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(files) >= maxListedFiles {
+			return filepath.SkipAll
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,120 @@
+package mcp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspaceServer(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref"), 0644))
+
+	manager := NewManager()
+	require.NoError(t, manager.RegisterServer("workspace", NewWorkspaceServer()))
+
+	ctx := context.Background()
+	mcpCtx := &models.MCPContext{
+		WorkspacePath: dir,
+		Permissions:   []string{"filesystem:read", "filesystem:write"},
+	}
+
+	tools, err := manager.GetAvailableTools(ctx, mcpCtx)
+	require.NoError(t, err)
+	assert.Len(t, tools, 3)
+
+	call := func(name string, args map[string]interface{}) *models.ToolResult {
+		result, err := manager.HandleToolCall(ctx, &models.ToolCall{
+			ID:       "call",
+			Function: models.ToolFunction{Name: name, Arguments: args},
+		}, mcpCtx)
+		require.NoError(t, err)
+		return result
+	}
+
+	result := call("workspace_write_file", map[string]interface{}{"path": "pkg/util.go", "content": "package pkg\n"})
+	require.True(t, result.Success, result.Error)
+	content, err := os.ReadFile(filepath.Join(dir, "pkg", "util.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "package pkg\n", string(content))
+
+	result = call("workspace_read_file", map[string]interface{}{"path": "main.go"})
+	require.True(t, result.Success, result.Error)
+	assert.Equal(t, "package main\n", result.Content)
+
+	result = call("workspace_list_files", map[string]interface{}{})
+	require.True(t, result.Success, result.Error)
+	assert.ElementsMatch(t, []string{"main.go", "pkg/util.go"}, result.Content)
+
+	// 路径不能越出工作空间，也不能修改 .git
+	result = call("workspace_read_file", map[string]interface{}{"path": "../../etc/passwd"})
+	assert.False(t, result.Success)
+	result = call("workspace_write_file", map[string]interface{}{"path": ".git/HEAD", "content": "x"})
+	assert.False(t, result.Success)
+
+	// 缺少写权限时拒绝写入
+	readOnly := &models.MCPContext{WorkspacePath: dir, Permissions: []string{"filesystem:read"}}
+	result, err = manager.HandleToolCall(ctx, &models.ToolCall{
+		ID:       "call",
+		Function: models.ToolFunction{Name: "workspace_write_file", Arguments: map[string]interface{}{"path": "a.txt", "content": "x"}},
+	}, readOnly)
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+}
+
+func TestWorkspaceServerRejectsSymlinksOutsideWorkspace(t *testing.T) {
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret.txt")
+	require.NoError(t, os.WriteFile(secret, []byte("top secret"), 0644))
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644))
+	require.NoError(t, os.Symlink(secret, filepath.Join(dir, "leak.txt")))
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "outside")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "missing.txt"), filepath.Join(dir, "dangling.txt")))
+	require.NoError(t, os.Symlink("main.go", filepath.Join(dir, "alias.go")))
+
+	server := NewWorkspaceServer()
+	ctx := context.Background()
+	mcpCtx := &models.MCPContext{WorkspacePath: dir}
+	call := func(name string, args map[string]interface{}) *models.ToolResult {
+		result, err := server.HandleToolCall(ctx, &models.ToolCall{
+			ID:       "call",
+			Function: models.ToolFunction{Name: name, Arguments: args},
+		}, mcpCtx)
+		require.NoError(t, err)
+		return result
+	}
+
+	for _, path := range []string{"leak.txt", "outside/secret.txt", "dangling.txt"} {
+		result := call("read_file", map[string]interface{}{"path": path})
+		assert.False(t, result.Success, path)
+		result = call("write_file", map[string]interface{}{"path": path, "content": "owned"})
+		assert.False(t, result.Success, path)
+	}
+	result := call("write_file", map[string]interface{}{"path": "outside/new.txt", "content": "owned"})
+	assert.False(t, result.Success)
+	result = call("list_files", map[string]interface{}{"path": "outside"})
+	assert.False(t, result.Success)
+
+	content, err := os.ReadFile(secret)
+	require.NoError(t, err)
+	assert.Equal(t, "top secret", string(content))
+	_, err = os.Stat(filepath.Join(outside, "missing.txt"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(outside, "new.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	// 工作空间内的符号链接仍然可以使用
+	result = call("read_file", map[string]interface{}{"path": "alias.go"})
+	require.True(t, result.Success, result.Error)
+	assert.Equal(t, "package main\n", result.Content)
+}
@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/qiniu/codeagent/internal/code"
+	"github.com/qiniu/codeagent/internal/config"
 	ghclient "github.com/qiniu/codeagent/internal/github"
 	"github.com/qiniu/codeagent/internal/mcp"
+	"github.com/qiniu/codeagent/internal/prompt"
+	"github.com/qiniu/codeagent/internal/repoconfig"
 	"github.com/qiniu/codeagent/internal/workspace"
 	"github.com/qiniu/codeagent/pkg/models"
 
@@ -19,22 +23,39 @@ import (
 // 处理自动化触发的事件（Issue分配、标签添加等）
 type AgentHandler struct {
 	*BaseHandler
-	github    *ghclient.Client
-	workspace *workspace.Manager
-	mcpClient mcp.MCPClient
+	github         *ghclient.Client
+	workspace      *workspace.Manager
+	mcpClient      mcp.MCPClient
+	sessionManager *code.SessionManager
+	repoConfigs    *repoconfig.Store
+	prompts        *prompt.Templates
+	issues         IssueProcessor
+	autoProcess    config.AutoProcessConfig
 }
 
-// NewAgentHandler 创建Agent模式处理器
-func NewAgentHandler(github *ghclient.Client, workspace *workspace.Manager, mcpClient mcp.MCPClient) *AgentHandler {
+// IssueProcessor 执行 Issue 到 PR 的处理流程，由 TagHandler 实现
+type IssueProcessor interface {
+	ProcessIssue(ctx context.Context, issue *github.Issue, aiModel string) error
+	ProcessIssueOnBranch(ctx context.Context, issue *github.Issue, aiModel, base string) error
+}
+
+// NewAgentHandler 创建Agent模式处理器，autoProcess 配置自动处理 Issue 的触发条件，可被仓库级配置覆盖，
+// prompts 提供定时任务评论使用的语言
+func NewAgentHandler(github *ghclient.Client, workspace *workspace.Manager, mcpClient mcp.MCPClient, sessionManager *code.SessionManager, repoConfigs *repoconfig.Store, prompts *prompt.Templates, issues IssueProcessor, autoProcess config.AutoProcessConfig) *AgentHandler {
 	return &AgentHandler{
 		BaseHandler: NewBaseHandler(
 			AgentMode,
 			20, // 较低优先级，在Tag模式之后
 			"Handle automated triggers (issue assignment, labels, etc.)",
 		),
-		github:    github,
-		workspace: workspace,
-		mcpClient: mcpClient,
+		github:         github,
+		workspace:      workspace,
+		mcpClient:      mcpClient,
+		sessionManager: sessionManager,
+		repoConfigs:    repoConfigs,
+		prompts:        prompts,
+		issues:         issues,
+		autoProcess:    autoProcess,
 	}
 }
 
@@ -72,22 +93,31 @@ func (ah *AgentHandler) CanHandle(ctx context.Context, event models.GitHubContex
 func (ah *AgentHandler) canHandleIssuesEvent(ctx context.Context, event *models.IssuesContext) bool {
 	xl := xlog.NewWith(ctx)
 	
+	repo := event.GetRepository()
+	rule := ah.repoConfigs.Get(ctx, repo.GetOwner().GetLogin(), repo.GetName()).AutoProcessRule(ah.autoProcess, repo.GetFullName())
+	raw, _ := event.RawEvent.(*github.IssuesEvent)
+	
 	switch event.GetEventAction() {
 	case "assigned":
-		// Issue被分配给某人时自动触发
-		xl.Infof("Agent mode can handle issue assignment")
+		// Issue被分配给配置的bot账号时自动触发
+		if !ah.isAutoAssignee(rule, raw.GetAssignee()) {
+			return false
+		}
+		xl.Infof("Agent mode can handle issue assignment to %s", rule.Assignee)
 		return true
 		
 	case "labeled":
-		// Issue被添加特定标签时触发
-		// 这里可以检查是否包含特定的标签（如"ai-assist", "codeagent"等）
-		xl.Infof("Agent mode can handle issue labeling")
-		return ah.hasAutoTriggerLabel(event.Issue)
+		// 只有新添加的标签是触发标签时才处理，避免添加其他标签时重复处理
+		if !ah.isAutoTriggerLabel(rule, raw.GetLabel().GetName()) {
+			return false
+		}
+		xl.Infof("Agent mode can handle issue labeled %s", raw.GetLabel().GetName())
+		return true
 		
 	case "opened":
 		// Issue创建时的自动处理（可选）
 		xl.Debugf("Issue opened, checking for auto-trigger conditions")
-		return ah.shouldAutoProcessIssue(event.Issue)
+		return ah.shouldAutoProcessIssue(rule, event.Issue)
 		
 	default:
 		return false
@@ -179,39 +209,49 @@ func (ah *AgentHandler) handlePREvent(ctx context.Context, event *models.PullReq
 // handleWorkflowDispatch 处理工作流调度事件
 func (ah *AgentHandler) handleWorkflowDispatch(ctx context.Context, event *models.WorkflowDispatchContext) error {
 	xl := xlog.NewWith(ctx)
-	xl.Infof("Processing workflow dispatch event with inputs: %+v", event.Inputs)
+	xl.Infof("Processing workflow dispatch event for %s (ref: %s) with inputs: %+v",
+		event.GetRepository().GetFullName(), event.Ref, event.Inputs)
 	
-	// 这里可以根据inputs中的参数执行不同的自动化任务
-	// 例如：批量处理Issues、生成报告、清理资源等
+	inputs, err := parseDispatchInputs(event.Inputs)
+	if err != nil {
+		return err
+	}
 	
-	return fmt.Errorf("workflow_dispatch handling not implemented yet")
+	if inputs.Output == models.DispatchOutputComment {
+		return ah.dispatchComment(ctx, event, inputs)
+	}
+	return ah.dispatchPR(ctx, event, inputs)
 }
 
 // handleSchedule 处理定时任务事件
 func (ah *AgentHandler) handleSchedule(ctx context.Context, event *models.ScheduleContext) error {
 	xl := xlog.NewWith(ctx)
-	xl.Infof("Processing schedule event with cron: %s", event.Cron)
-	
-	// 这里可以执行定时任务，例如：
-	// - 清理过期的工作空间
-	// - 生成周期性报告
-	// - 检查待处理的Issues
+	xl.Infof("Processing schedule %s (task: %s, cron: %s) for repository: %s",
+		event.Name, event.Task, event.Cron, event.GetRepository().GetFullName())
 	
-	return fmt.Errorf("schedule handling not implemented yet")
+	switch event.Task {
+	case ScheduleTaskStaleIssues:
+		return ah.runStaleIssues(ctx, event)
+	case ScheduleTaskCode:
+		return ah.runCodeTask(ctx, event)
+	case ScheduleTaskWorkspaceReport:
+		return ah.runWorkspaceReport(ctx, event)
+	default:
+		return fmt.Errorf("unsupported schedule task: %s", event.Task)
+	}
 }
 
 // autoProcessIssue 自动处理Issue
 func (ah *AgentHandler) autoProcessIssue(ctx context.Context, event *models.IssuesContext) error {
 	xl := xlog.NewWith(ctx)
 	
-	// 将事件转换为IssueCommentEvent格式（模拟/code命令）
-	// 这样可以复用现有的agent逻辑
-	_ = event.RawEvent.(*github.IssuesEvent)
+	if ah.issues == nil {
+		return fmt.Errorf("issue processing is not configured")
+	}
 	
-	xl.Infof("Auto-processing issue with new architecture")
-	// TODO: 实现自动Issue处理逻辑，使用MCP工具
-	xl.Infof("Auto-processing for Issue #%d is not yet implemented", event.Issue.GetNumber())
-	return nil
+	// 与 /code 命令使用相同的 Issue 到 PR 流程，使用默认的 AI 模型
+	xl.Infof("Auto-processing issue #%d: %s", event.Issue.GetNumber(), event.Issue.GetTitle())
+	return ah.issues.ProcessIssue(ctx, event.Issue, "")
 }
 
 // generateAutoPrompt 为Issue生成自动化提示
@@ -233,27 +273,38 @@ func (ah *AgentHandler) generateAutoPrompt(issue *github.Issue) string {
 	return prompt
 }
 
-// hasAutoTriggerLabel 检查Issue是否包含自动触发标签
-func (ah *AgentHandler) hasAutoTriggerLabel(issue *github.Issue) bool {
-	autoTriggerLabels := []string{"ai-assist", "codeagent", "auto-code", "ai-help"}
-	
-	for _, label := range issue.Labels {
-		labelName := strings.ToLower(label.GetName())
-		for _, triggerLabel := range autoTriggerLabels {
-			if labelName == triggerLabel {
-				return true
-			}
+// isAutoTriggerLabel 检查标签是否为仓库配置的自动触发标签
+func (ah *AgentHandler) isAutoTriggerLabel(rule config.AutoProcessRule, label string) bool {
+	for _, triggerLabel := range rule.Labels {
+		if label != "" && strings.EqualFold(label, triggerLabel) {
+			return true
 		}
 	}
-	
 	return false
 }
 
-// shouldAutoProcessIssue 检查是否应该自动处理Issue
-func (ah *AgentHandler) shouldAutoProcessIssue(issue *github.Issue) bool {
-	// 这里可以根据配置或其他条件决定是否自动处理
-	// 例如：特定的仓库、特定的标签、特定的用户等
-	return false // 默认不自动处理新创建的Issue
+// isAutoAssignee 检查被分配的账号是否为仓库配置的bot账号
+func (ah *AgentHandler) isAutoAssignee(rule config.AutoProcessRule, assignee *github.User) bool {
+	return rule.Assignee != "" && strings.EqualFold(assignee.GetLogin(), rule.Assignee)
+}
+
+// shouldAutoProcessIssue 检查是否应该自动处理新创建的Issue：
+// 仓库开启了 on_open，或创建时已带有触发标签、已分配给bot账号
+func (ah *AgentHandler) shouldAutoProcessIssue(rule config.AutoProcessRule, issue *github.Issue) bool {
+	if rule.OnOpen {
+		return true
+	}
+	for _, label := range issue.Labels {
+		if ah.isAutoTriggerLabel(rule, label.GetName()) {
+			return true
+		}
+	}
+	for _, assignee := range issue.Assignees {
+		if ah.isAutoAssignee(rule, assignee) {
+			return true
+		}
+	}
+	return false
 }
 
 // shouldAutoReviewPR 检查是否应该自动审查PR
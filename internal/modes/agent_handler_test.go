@@ -0,0 +1,270 @@
+package modes
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIssueProcessor 记录被自动处理的 Issue
+type fakeIssueProcessor struct {
+	processed []int
+	aiModels  []string
+}
+
+func (f *fakeIssueProcessor) ProcessIssue(ctx context.Context, issue *github.Issue, aiModel string) error {
+	return f.ProcessIssueOnBranch(ctx, issue, aiModel, "")
+}
+
+func (f *fakeIssueProcessor) ProcessIssueOnBranch(ctx context.Context, issue *github.Issue, aiModel, base string) error {
+	f.processed = append(f.processed, issue.GetNumber())
+	f.aiModels = append(f.aiModels, aiModel)
+	return nil
+}
+
+func newIssuesContext(repo, action string, issue *github.Issue, raw *github.IssuesEvent) *models.IssuesContext {
+	raw.Action = github.String(action)
+	raw.Issue = issue
+	return &models.IssuesContext{
+		BaseContext: models.BaseContext{
+			Type:       models.EventIssues,
+			Repository: &github.Repository{FullName: github.String(repo)},
+			RawEvent:   raw,
+			Action:     action,
+		},
+		Issue: issue,
+	}
+}
+
+func TestAgentHandler_CanHandleIssuesEvent(t *testing.T) {
+	autoProcess := config.AutoProcessConfig{
+		AutoProcessRule: config.AutoProcessRule{
+			Labels:   []string{"ai-assist", "codeagent"},
+			Assignee: "codeagent-bot",
+		},
+		Repos: map[string]config.AutoProcessRule{
+			"org/eager": {Labels: []string{"todo"}, OnOpen: true},
+		},
+	}
+	handler := NewAgentHandler(nil, nil, nil, nil, nil, nil, &fakeIssueProcessor{}, autoProcess)
+	issue := &github.Issue{Number: github.Int(1)}
+
+	tests := []struct {
+		name     string
+		repo     string
+		action   string
+		issue    *github.Issue
+		raw      *github.IssuesEvent
+		expected bool
+	}{
+		{
+			name:     "trigger label",
+			repo:     "org/repo",
+			action:   "labeled",
+			issue:    issue,
+			raw:      &github.IssuesEvent{Label: &github.Label{Name: github.String("CodeAgent")}},
+			expected: true,
+		},
+		{
+			name:     "other label",
+			repo:     "org/repo",
+			action:   "labeled",
+			issue:    issue,
+			raw:      &github.IssuesEvent{Label: &github.Label{Name: github.String("bug")}},
+			expected: false,
+		},
+		{
+			name:     "assigned to bot",
+			repo:     "org/repo",
+			action:   "assigned",
+			issue:    issue,
+			raw:      &github.IssuesEvent{Assignee: &github.User{Login: github.String("codeagent-bot")}},
+			expected: true,
+		},
+		{
+			name:     "assigned to someone else",
+			repo:     "org/repo",
+			action:   "assigned",
+			issue:    issue,
+			raw:      &github.IssuesEvent{Assignee: &github.User{Login: github.String("alice")}},
+			expected: false,
+		},
+		{
+			name:     "opened without trigger",
+			repo:     "org/repo",
+			action:   "opened",
+			issue:    issue,
+			raw:      &github.IssuesEvent{},
+			expected: false,
+		},
+		{
+			name:   "opened with trigger label",
+			repo:   "org/repo",
+			action: "opened",
+			issue: &github.Issue{
+				Number: github.Int(2),
+				Labels: []*github.Label{{Name: github.String("ai-assist")}},
+			},
+			raw:      &github.IssuesEvent{},
+			expected: true,
+		},
+		{
+			name:     "repo override replaces default labels",
+			repo:     "org/eager",
+			action:   "labeled",
+			issue:    issue,
+			raw:      &github.IssuesEvent{Label: &github.Label{Name: github.String("ai-assist")}},
+			expected: false,
+		},
+		{
+			name:     "repo override has no assignee",
+			repo:     "org/eager",
+			action:   "assigned",
+			issue:    issue,
+			raw:      &github.IssuesEvent{Assignee: &github.User{Login: github.String("codeagent-bot")}},
+			expected: false,
+		},
+		{
+			name:     "repo override processes opened issues",
+			repo:     "org/eager",
+			action:   "opened",
+			issue:    issue,
+			raw:      &github.IssuesEvent{},
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := newIssuesContext(tt.repo, tt.action, tt.issue, tt.raw)
+			assert.Equal(t, tt.expected, handler.CanHandle(context.Background(), event))
+		})
+	}
+}
+
+func TestAgentHandler_ExecuteProcessesIssue(t *testing.T) {
+	issues := &fakeIssueProcessor{}
+	autoProcess := config.AutoProcessConfig{AutoProcessRule: config.AutoProcessRule{Labels: []string{"codeagent"}}}
+	handler := NewAgentHandler(nil, nil, nil, nil, nil, nil, issues, autoProcess)
+
+	event := newIssuesContext("org/repo", "labeled", &github.Issue{Number: github.Int(42)},
+		&github.IssuesEvent{Label: &github.Label{Name: github.String("codeagent")}})
+	require.True(t, handler.CanHandle(context.Background(), event))
+	require.NoError(t, handler.Execute(context.Background(), event))
+
+	assert.Equal(t, []int{42}, issues.processed)
+	assert.Equal(t, []string{""}, issues.aiModels)
+}
+
+func TestAgentHandler_ScheduleTaskValidation(t *testing.T) {
+	handler := NewAgentHandler(nil, nil, nil, nil, nil, nil, &fakeIssueProcessor{}, config.AutoProcessConfig{})
+	repo := &github.Repository{
+		Owner:    &github.User{Login: github.String("org")},
+		Name:     github.String("repo"),
+		FullName: github.String("org/repo"),
+	}
+
+	tests := []struct {
+		name  string
+		event *models.ScheduleContext
+		err   string
+	}{
+		{
+			name:  "unknown task",
+			event: &models.ScheduleContext{Name: "nightly", Task: "unknown"},
+			err:   "unsupported schedule task: unknown",
+		},
+		{
+			name:  "stale issues without repository",
+			event: &models.ScheduleContext{Name: "triage", Task: ScheduleTaskStaleIssues},
+			err:   "schedule triage has no repository configured",
+		},
+		{
+			name: "code task without prompt",
+			event: &models.ScheduleContext{
+				BaseContext: models.BaseContext{Repository: repo},
+				Name:        "deps",
+				Task:        ScheduleTaskCode,
+				Inputs:      map[string]string{"title": "Update dependencies"},
+			},
+			err: "code task requires title and prompt inputs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.event.Type = models.EventSchedule
+			require.True(t, handler.CanHandle(context.Background(), tt.event))
+			err := handler.Execute(context.Background(), tt.event)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestFormatWorkspaceReport(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	expired := []*models.Workspace{{
+		Org:       "org",
+		Repo:      "repo",
+		PRNumber:  7,
+		AIModel:   "claude",
+		Path:      "/tmp/codeagent/org/repo/pr-7",
+		CreatedAt: now.Add(-48 * time.Hour),
+	}}
+
+	report := formatWorkspaceReport(3, 2, 3, expired, now)
+	assert.Contains(t, report, "- Workspaces: 3")
+	assert.Contains(t, report, "- Expired (pending cleanup): 1")
+	assert.Contains(t, report, "| org/repo#7 | claude | 48h0m0s | `/tmp/codeagent/org/repo/pr-7` |")
+
+	assert.NotContains(t, formatWorkspaceReport(0, 0, 0, nil, now), "| Workspace |")
+}
+
+func TestParseDispatchInputs(t *testing.T) {
+	inputs, err := parseDispatchInputs(map[string]interface{}{
+		"instruction": "  Upgrade the logging library\nand fix call sites  ",
+		"inputs":      map[string]interface{}{"version": "v2"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.DispatchOutputPR, inputs.Output)
+	assert.Equal(t, "Upgrade the logging library", dispatchTitle(inputs))
+	assert.Equal(t, "Upgrade the logging library\nand fix call sites\n\n## Inputs\n\n```json\n{\n  \"version\": \"v2\"\n}\n```", buildDispatchPrompt(inputs))
+
+	inputs, err = parseDispatchInputs(map[string]interface{}{
+		"instruction": "Summarize the open TODOs",
+		"output":      "comment",
+		"issue":       float64(12),
+		"title":       "TODO summary",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 12, inputs.Issue)
+	assert.Equal(t, "TODO summary", dispatchTitle(inputs))
+	assert.Equal(t, "Summarize the open TODOs", buildDispatchPrompt(inputs))
+
+	for _, raw := range []map[string]interface{}{
+		{},
+		{"instruction": "x", "output": "comment"},
+		{"instruction": "x", "output": "email"},
+		{"instruction": "x", "issue": "twelve"},
+	} {
+		_, err := parseDispatchInputs(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestDispatchTitleIsTruncated(t *testing.T) {
+	inputs := &models.DispatchInputs{Instruction: strings.Repeat("很长的任务说明", 20)}
+	title := dispatchTitle(inputs)
+	assert.Equal(t, maxDispatchTitleLength, utf8.RuneCountInString(title))
+	assert.True(t, strings.HasSuffix(title, "..."))
+}
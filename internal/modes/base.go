@@ -3,8 +3,13 @@ package modes
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/qiniu/codeagent/internal/code"
+	"github.com/qiniu/codeagent/internal/repoconfig"
 	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/google/go-github/v58/github"
 )
 
 // ExecutionMode 执行模式类型
@@ -75,6 +80,24 @@ func (bh *BaseHandler) GetHandlerName() string {
 	return string(bh.mode) + "_handler"
 }
 
+// defaultAIModel 返回仓库默认使用的 AI 模型：仓库级配置优先，其次为全局配置
+func defaultAIModel(ctx context.Context, repoConfigs *repoconfig.Store, sessionManager *code.SessionManager, owner, repo string) string {
+	return repoConfigs.Get(ctx, owner, repo).Provider(sessionManager.DefaultProvider())
+}
+
+// issueRepo 返回 Issue 所属仓库的 owner 和名称
+func issueRepo(issue *github.Issue) (owner, repo string) {
+	if r := issue.GetRepository(); r != nil {
+		return r.GetOwner().GetLogin(), r.GetName()
+	}
+	// repository_url 格式：https://api.github.com/repos/{owner}/{repo}
+	parts := strings.Split(strings.TrimSuffix(issue.GetRepositoryURL(), "/"), "/")
+	if len(parts) < 2 {
+		return "", ""
+	}
+	return parts[len(parts)-2], parts[len(parts)-1]
+}
+
 // ModeManager 模式管理器
 // 对应claude-code-action中的模式选择逻辑
 type ModeManager struct {
@@ -0,0 +1,156 @@
+package modes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/qiniu/codeagent/internal/code"
+	"github.com/qiniu/codeagent/internal/usage"
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/qiniu/x/xlog"
+)
+
+// maxDispatchTitleLength 由任务说明生成标题时的最大长度
+const maxDispatchTitleLength = 80
+
+// parseDispatchInputs 将 workflow_dispatch 事件的 inputs 解析为手动任务参数
+func parseDispatchInputs(raw map[string]interface{}) (*models.DispatchInputs, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal dispatch inputs: %w", err)
+	}
+	var inputs models.DispatchInputs
+	if err := json.Unmarshal(data, &inputs); err != nil {
+		return nil, fmt.Errorf("invalid dispatch inputs: %w", err)
+	}
+
+	inputs.Instruction = strings.TrimSpace(inputs.Instruction)
+	if inputs.Instruction == "" {
+		return nil, fmt.Errorf("dispatch inputs require an instruction")
+	}
+	switch inputs.Output {
+	case "":
+		inputs.Output = models.DispatchOutputPR
+	case models.DispatchOutputPR:
+	case models.DispatchOutputComment:
+		if inputs.Issue <= 0 {
+			return nil, fmt.Errorf("comment output requires an issue number")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported dispatch output: %s", inputs.Output)
+	}
+	return &inputs, nil
+}
+
+// dispatchTitle 返回任务标题，未指定时取任务说明的第一行
+func dispatchTitle(inputs *models.DispatchInputs) string {
+	if inputs.Title != "" {
+		return inputs.Title
+	}
+	title := strings.TrimSpace(strings.SplitN(inputs.Instruction, "\n", 2)[0])
+	if utf8.RuneCountInString(title) > maxDispatchTitleLength {
+		title = string([]rune(title)[:maxDispatchTitleLength-3]) + "..."
+	}
+	return title
+}
+
+// buildDispatchPrompt 将任务说明和结构化参数组合为 prompt
+func buildDispatchPrompt(inputs *models.DispatchInputs) string {
+	if len(inputs.Inputs) == 0 {
+		return inputs.Instruction
+	}
+	data, err := json.MarshalIndent(inputs.Inputs, "", "  ")
+	if err != nil {
+		return inputs.Instruction
+	}
+	return fmt.Sprintf("%s\n\n## Inputs\n\n```json\n%s\n```", inputs.Instruction, data)
+}
+
+// dispatchPR 创建跟踪 Issue，并走与 /code 相同的流程向 ref 分支提交 PR
+func (ah *AgentHandler) dispatchPR(ctx context.Context, event *models.WorkflowDispatchContext, inputs *models.DispatchInputs) error {
+	xl := xlog.NewWith(ctx)
+
+	if ah.issues == nil {
+		return fmt.Errorf("issue processing is not configured")
+	}
+	repo := event.GetRepository()
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+
+	body := buildDispatchPrompt(inputs)
+	body += fmt.Sprintf("\n\n---\n*Requested by @%s via the CodeAgent dispatch API*", event.GetSender().GetLogin())
+
+	issue, err := ah.github.CreateIssue(ctx, owner, name, dispatchTitle(inputs), body, nil)
+	if err != nil {
+		return err
+	}
+	xl.Infof("Created issue #%d for dispatched task on %s/%s (ref: %s)", issue.GetNumber(), owner, name, event.Ref)
+	return ah.issues.ProcessIssueOnBranch(ctx, issue, inputs.AIModel, event.Ref)
+}
+
+// dispatchComment 在 ref（未指定时为目标 PR 的 head 或默认分支）的临时工作空间中执行任务，
+// 将 AI 的输出作为评论发布到目标 Issue/PR，不提交代码
+func (ah *AgentHandler) dispatchComment(ctx context.Context, event *models.WorkflowDispatchContext, inputs *models.DispatchInputs) error {
+	xl := xlog.NewWith(ctx)
+
+	repo := event.GetRepository()
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+
+	issue, err := ah.github.GetIssue(ctx, owner, name, inputs.Issue)
+	if err != nil {
+		return err
+	}
+	ref := event.Ref
+	if ref == "" && issue.IsPullRequest() {
+		ref = fmt.Sprintf("refs/pull/%d/head", inputs.Issue)
+	}
+	aiModel := inputs.AIModel
+	if aiModel == "" {
+		aiModel = defaultAIModel(ctx, ah.repoConfigs, ah.sessionManager, owner, name)
+	}
+
+	ws := ah.workspace.CreateWorkspaceFromIssueOnBranch(issue, aiModel, ref)
+	if ws == nil {
+		return fmt.Errorf("failed to create workspace for %s/%s", owner, name)
+	}
+	defer func() {
+		if err := ah.workspace.RemoveTemporaryWorkspace(ws); err != nil {
+			xl.Warnf("Failed to remove temporary workspace %s: %v", ws.Path, err)
+		}
+	}()
+
+	suffix := strconv.FormatInt(ws.CreatedAt.Unix(), 10)
+	sessionPath, err := ah.workspace.CreateSessionPath(filepath.Dir(ws.Path), aiModel, name, inputs.Issue, suffix)
+	if err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+	ws.SessionPath = sessionPath
+
+	codeClient, err := ah.sessionManager.NewSession(ws)
+	if err != nil {
+		return err
+	}
+	defer codeClient.Close()
+
+	xl.Infof("Running dispatched task on %s/%s (ref: %s), output to #%d", owner, name, ref, inputs.Issue)
+	repoConfig := ah.repoConfigs.Get(ctx, owner, name)
+	prompt := repoConfig.AppendInstructions(buildDispatchPrompt(inputs), ah.prompts.Messages(repoConfig).RepoInstructions)
+	resp, err := codeClient.Prompt(ctx, prompt, code.PromptOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to run dispatched task: %w", err)
+	}
+	output, err := io.ReadAll(resp.Out)
+	if err != nil {
+		return fmt.Errorf("failed to read output: %w", err)
+	}
+
+	comment := strings.TrimSpace(string(output)) + usage.Footer(ctx)
+	_, err = ah.github.CreateComment(ctx, owner, name, inputs.Issue, comment)
+	return err
+}
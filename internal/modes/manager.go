@@ -5,19 +5,22 @@ import (
 	"fmt"
 	"sort"
 
+	"github.com/qiniu/codeagent/internal/repoconfig"
 	"github.com/qiniu/codeagent/pkg/models"
 	"github.com/qiniu/x/xlog"
 )
 
 // Manager 模式管理器
 type Manager struct {
-	handlers []ModeHandler
+	handlers    []ModeHandler
+	repoConfigs *repoconfig.Store
 }
 
-// NewManager 创建新的模式管理器
-func NewManager() *Manager {
+// NewManager 创建新的模式管理器，仓库级配置（.codeagent.yaml）可以关闭部分模式，repoConfigs 为 nil 时启用全部模式
+func NewManager(repoConfigs *repoconfig.Store) *Manager {
 	return &Manager{
-		handlers: make([]ModeHandler, 0),
+		handlers:    make([]ModeHandler, 0),
+		repoConfigs: repoConfigs,
 	}
 }
 
@@ -40,8 +43,15 @@ func (m *Manager) GetHandlerCount() int {
 func (m *Manager) SelectHandler(ctx context.Context, event models.GitHubContext) (ModeHandler, error) {
 	xl := xlog.NewWith(ctx)
 	
+	repo := event.GetRepository()
+	repoConfig := m.repoConfigs.Get(ctx, repo.GetOwner().GetLogin(), repo.GetName())
+	
 	// 按优先级顺序查找能处理的处理器
 	for _, handler := range m.handlers {
+		if !repoConfig.ModeEnabled(string(handler.GetMode())) {
+			xl.Debugf("Handler %s is disabled by repository config of %s", handler.GetHandlerName(), repo.GetFullName())
+			continue
+		}
 		if handler.CanHandle(ctx, event) {
 			xl.Infof("Selected handler: %s for event type: %s", 
 				handler.GetHandlerName(), event.GetEventType())
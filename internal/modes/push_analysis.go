@@ -0,0 +1,220 @@
+package modes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/qiniu/codeagent/internal/code"
+	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/internal/prompt"
+	"github.com/qiniu/codeagent/internal/usage"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/qiniu/x/xlog"
+)
+
+// 推送分析发现的问题类别
+const (
+	PushFindingRegression   = "regression"
+	PushFindingSecurity     = "security"
+	PushFindingMissingTests = "missing_tests"
+)
+
+// 推送分析 Issue 的标题，用于识别 CodeAgent 创建的分析报告
+const pushAnalysisHeader = "## CodeAgent Push Analysis"
+
+// zeroSHA 分支创建或删除时 push 事件中 before/after 的值
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// pushFinding AI 在推送的提交中发现的问题
+type pushFinding struct {
+	Category    string `json:"category"`
+	Severity    string `json:"severity"`
+	Title       string `json:"title"`
+	Path        string `json:"path"`
+	Line        int    `json:"line"`
+	Description string `json:"description"`
+}
+
+// pushAnalysisResult AI 的推送分析结果
+type pushAnalysisResult struct {
+	Findings []pushFinding `json:"findings"`
+}
+
+// ShouldAnalyzePush 判断 push 事件是否需要分析：分支需符合配置，且为已有分支上的新提交
+// （不分析分支的创建和删除）
+func (rh *ReviewHandler) ShouldAnalyzePush(event *github.PushEvent) bool {
+	if event == nil || len(event.Commits) == 0 {
+		return false
+	}
+	if event.GetBefore() == zeroSHA || event.GetAfter() == zeroSHA || event.GetDeleted() || event.GetCreated() {
+		return false
+	}
+	repo := event.GetRepo()
+	return rh.pushAnalysis.ShouldAnalyze(repo.GetFullName(), event.GetRef(), repo.GetDefaultBranch())
+}
+
+// AnalyzePush 让 AI 分析推送的提交（before..after），发现可能的回归、安全问题或缺失的测试时创建 Issue
+func (rh *ReviewHandler) AnalyzePush(ctx context.Context, event *github.PushEvent) error {
+	xl := xlog.NewWith(ctx)
+
+	owner := event.GetRepo().GetOwner().GetLogin()
+	repo := event.GetRepo().GetName()
+	before, after := event.GetBefore(), event.GetAfter()
+	xl.Infof("Starting push analysis for %s/%s %s (%s..%s, %d commits)", owner, repo, event.GetRef(), shortSHA(before), shortSHA(after), len(event.Commits))
+
+	// 1. 获取推送的变更
+	diff, err := rh.github.CompareCommitsDiff(ctx, owner, repo, before, after)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(diff) == "" {
+		xl.Infof("Push to %s/%s has no changes to analyze", owner, repo)
+		return nil
+	}
+
+	// 2. 在推送后的提交上准备临时工作空间，AI 可以查看完整的仓库代码
+	repoConfig := rh.repoConfigs.Get(ctx, owner, repo)
+	aiModel := repoConfig.Provider(rh.sessionManager.DefaultProvider())
+	ws := rh.workspace.CreateWorkspaceAtCommit(owner, repo, aiModel, after)
+	if ws == nil {
+		return fmt.Errorf("failed to create workspace for %s/%s at %s", owner, repo, shortSHA(after))
+	}
+	defer func() {
+		if err := rh.workspace.RemoveTemporaryWorkspace(ws); err != nil {
+			xl.Warnf("Failed to remove temporary workspace %s: %v", ws.Path, err)
+		}
+	}()
+
+	suffix := strconv.FormatInt(ws.CreatedAt.Unix(), 10)
+	sessionPath, err := rh.workspace.CreateSessionPath(filepath.Dir(ws.Path), aiModel, repo, 0, suffix)
+	if err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+	ws.SessionPath = sessionPath
+
+	codeClient, err := rh.sessionManager.NewSession(ws)
+	if err != nil {
+		return err
+	}
+	defer codeClient.Close()
+
+	// 3. 执行分析
+	analysisPrompt, err := rh.buildPushAnalysisPrompt(repoConfig, event, diff)
+	if err != nil {
+		return err
+	}
+	resp, err := codeClient.Prompt(ctx, analysisPrompt, code.PromptOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to analyze push to %s/%s: %w", owner, repo, err)
+	}
+	output, err := io.ReadAll(resp.Out)
+	if err != nil {
+		return fmt.Errorf("failed to read analysis output: %w", err)
+	}
+	result, err := parsePushAnalysisOutput(string(output))
+	if err != nil {
+		return fmt.Errorf("failed to parse analysis output: %w", err)
+	}
+	if len(result.Findings) == 0 {
+		xl.Infof("Push analysis of %s/%s found no issues", owner, repo)
+		return nil
+	}
+
+	// 4. 创建 Issue 报告发现的问题
+	title := fmt.Sprintf(rh.prompts.Messages(repoConfig).PushAnalysisTitle, len(result.Findings), pushBranch(event), shortSHA(after))
+	body := formatPushAnalysisIssue(event, result.Findings) + usage.Footer(ctx)
+	issue, err := rh.github.CreateIssue(ctx, owner, repo, title, body, rh.pushAnalysis.Labels)
+	if err != nil {
+		return err
+	}
+	xl.Infof("Created issue #%d for %d push analysis finding(s) on %s/%s", issue.GetNumber(), len(result.Findings), owner, repo)
+	return nil
+}
+
+func pushBranch(event *github.PushEvent) string {
+	return strings.TrimPrefix(event.GetRef(), "refs/heads/")
+}
+
+// buildPushAnalysisPrompt 使用 push_analysis 模板构建推送分析提示词，要求 AI 以 JSON 返回发现的问题
+func (rh *ReviewHandler) buildPushAnalysisPrompt(repoConfig *config.RepoConfig, event *github.PushEvent, diff string) (string, error) {
+	diff, truncated := truncateDiff(diff)
+	push := prompt.Push{Branch: pushBranch(event), Before: event.GetBefore(), After: event.GetAfter()}
+	for _, c := range event.Commits {
+		push.Commits = append(push.Commits, prompt.Commit{SHA: shortSHA(c.GetID()), Message: firstLine(c.GetMessage())})
+	}
+	return rh.prompts.Render(prompt.PushAnalysis, prompt.Data{Diff: diff, DiffTruncated: truncated, Push: push}, repoConfig)
+}
+
+// parsePushAnalysisOutput 从 AI 输出中提取 JSON 分析结果，忽略未知类别和没有标题的问题
+func parsePushAnalysisOutput(output string) (*pushAnalysisResult, error) {
+	var result pushAnalysisResult
+	if err := unmarshalJSONObject(output, &result); err != nil {
+		return nil, err
+	}
+
+	findings := result.Findings[:0]
+	for _, f := range result.Findings {
+		switch f.Category {
+		case PushFindingRegression, PushFindingSecurity, PushFindingMissingTests:
+		default:
+			continue
+		}
+		if strings.TrimSpace(f.Title) == "" {
+			continue
+		}
+		findings = append(findings, f)
+	}
+	result.Findings = findings
+	return &result, nil
+}
+
+// formatPushAnalysisIssue 生成推送分析 Issue 的正文
+func formatPushAnalysisIssue(event *github.PushEvent, findings []pushFinding) string {
+	var b strings.Builder
+	b.WriteString(pushAnalysisHeader + "\n\n")
+
+	commits := fmt.Sprintf("%d commit(s)", len(event.Commits))
+	if event.GetCompare() != "" {
+		commits = fmt.Sprintf("[%s](%s)", commits, event.GetCompare())
+	}
+	fmt.Fprintf(&b, "Analyzed %s pushed to `%s` by @%s.\n\n", commits, pushBranch(event), event.GetSender().GetLogin())
+
+	b.WriteString("### Commits\n")
+	for _, c := range event.Commits {
+		sha := "`" + shortSHA(c.GetID()) + "`"
+		if c.GetURL() != "" {
+			sha = fmt.Sprintf("[%s](%s)", sha, c.GetURL())
+		}
+		fmt.Fprintf(&b, "\n- %s %s", sha, firstLine(c.GetMessage()))
+	}
+
+	b.WriteString("\n\n### Findings\n")
+	for i, f := range findings {
+		severity := f.Severity
+		if severity == "" {
+			severity = "unknown"
+		}
+		fmt.Fprintf(&b, "\n#### %d. [%s/%s] %s\n", i+1, f.Category, severity, strings.TrimSpace(f.Title))
+		if f.Path != "" {
+			if f.Line > 0 {
+				fmt.Fprintf(&b, "\n`%s:%d`\n", f.Path, f.Line)
+			} else {
+				fmt.Fprintf(&b, "\n`%s`\n", f.Path)
+			}
+		}
+		if desc := strings.TrimSpace(f.Description); desc != "" {
+			b.WriteString("\n" + desc + "\n")
+		}
+	}
+	return b.String()
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
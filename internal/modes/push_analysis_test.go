@@ -0,0 +1,100 @@
+package modes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPushEvent(ref, before, after string) *github.PushEvent {
+	return &github.PushEvent{
+		Ref:     github.String(ref),
+		Before:  github.String(before),
+		After:   github.String(after),
+		Compare: github.String("https://github.com/org/repo/compare/1111111...2222222"),
+		Repo: &github.PushEventRepository{
+			Name:          github.String("repo"),
+			FullName:      github.String("org/repo"),
+			DefaultBranch: github.String("main"),
+			Owner:         &github.User{Login: github.String("org")},
+		},
+		Sender: &github.User{Login: github.String("alice")},
+		Commits: []*github.HeadCommit{{
+			ID:      github.String("2222222222222222222222222222222222222222"),
+			Message: github.String("Rework token refresh\n\nDetails"),
+			URL:     github.String("https://github.com/org/repo/commit/2222222"),
+		}},
+	}
+}
+
+func TestReviewHandler_CanHandlePushEvent(t *testing.T) {
+	rh := NewReviewHandler(nil, nil, nil, nil, nil, nil, config.PushAnalysisConfig{Enabled: true})
+	before := "1111111111111111111111111111111111111111"
+	after := "2222222222222222222222222222222222222222"
+
+	tests := []struct {
+		name     string
+		event    *github.PushEvent
+		expected bool
+	}{
+		{"default branch", newPushEvent("refs/heads/main", before, after), true},
+		{"other branch", newPushEvent("refs/heads/feature", before, after), false},
+		{"branch created", newPushEvent("refs/heads/main", zeroSHA, after), false},
+		{"branch deleted", newPushEvent("refs/heads/main", before, zeroSHA), false},
+		{"no commits", func() *github.PushEvent {
+			e := newPushEvent("refs/heads/main", before, after)
+			e.Commits = nil
+			return e
+		}(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &models.PushContext{
+				BaseContext: models.BaseContext{Type: models.EventPush, RawEvent: tt.event},
+				Ref:         tt.event.GetRef(),
+			}
+			assert.Equal(t, tt.expected, rh.CanHandle(context.Background(), event))
+		})
+	}
+
+	disabled := NewReviewHandler(nil, nil, nil, nil, nil, nil, config.PushAnalysisConfig{})
+	assert.False(t, disabled.ShouldAnalyzePush(newPushEvent("refs/heads/main", before, after)))
+}
+
+func TestParsePushAnalysisOutput(t *testing.T) {
+	output := "分析完成：\n```json\n" + `{"findings": [
+  {"category": "security", "severity": "high", "title": "Token logged in plain text", "path": "auth/refresh.go", "line": 42, "description": "Remove the log line."},
+  {"category": "style", "title": "Naming"},
+  {"category": "missing_tests", "title": " "}
+]}` + "\n```"
+
+	result, err := parsePushAnalysisOutput(output)
+	require.NoError(t, err)
+	require.Len(t, result.Findings, 1)
+	assert.Equal(t, PushFindingSecurity, result.Findings[0].Category)
+	assert.Equal(t, 42, result.Findings[0].Line)
+
+	_, err = parsePushAnalysisOutput("no findings")
+	assert.Error(t, err)
+}
+
+func TestFormatPushAnalysisIssue(t *testing.T) {
+	event := newPushEvent("refs/heads/main", "1111111111111111111111111111111111111111", "2222222222222222222222222222222222222222")
+	body := formatPushAnalysisIssue(event, []pushFinding{
+		{Category: PushFindingSecurity, Severity: "high", Title: "Token logged in plain text", Path: "auth/refresh.go", Line: 42, Description: "Remove the log line."},
+		{Category: PushFindingMissingTests, Title: "Refresh retry is untested", Path: "auth/refresh.go"},
+	})
+
+	assert.Contains(t, body, pushAnalysisHeader)
+	assert.Contains(t, body, "Analyzed [1 commit(s)](https://github.com/org/repo/compare/1111111...2222222) pushed to `main` by @alice.")
+	assert.Contains(t, body, "- [`2222222`](https://github.com/org/repo/commit/2222222) Rework token refresh")
+	assert.Contains(t, body, "#### 1. [security/high] Token logged in plain text\n\n`auth/refresh.go:42`\n\nRemove the log line.")
+	assert.Contains(t, body, "#### 2. [missing_tests/unknown] Refresh retry is untested\n\n`auth/refresh.go`\n")
+}
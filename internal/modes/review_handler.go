@@ -1,14 +1,27 @@
 package modes
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
 
+	"github.com/qiniu/codeagent/internal/code"
+	"github.com/qiniu/codeagent/internal/config"
 	ghclient "github.com/qiniu/codeagent/internal/github"
+	"github.com/qiniu/codeagent/internal/locale"
 	"github.com/qiniu/codeagent/internal/mcp"
+	"github.com/qiniu/codeagent/internal/prompt"
+	"github.com/qiniu/codeagent/internal/repoconfig"
+	"github.com/qiniu/codeagent/internal/usage"
 	"github.com/qiniu/codeagent/internal/workspace"
 	"github.com/qiniu/codeagent/pkg/models"
 
+	"github.com/google/go-github/v58/github"
 	"github.com/qiniu/x/xlog"
 )
 
@@ -17,22 +30,35 @@ import (
 // 处理自动代码审查相关的事件
 type ReviewHandler struct {
 	*BaseHandler
-	github    *ghclient.Client
-	workspace *workspace.Manager
-	mcpClient mcp.MCPClient
+	github         *ghclient.Client
+	workspace      *workspace.Manager
+	mcpClient      mcp.MCPClient
+	sessionManager *code.SessionManager
+	repoConfigs    *repoconfig.Store
+	prompts        *prompt.Templates
+	pushAnalysis   config.PushAnalysisConfig
+
+	mu       sync.Mutex
+	reviewed map[string]string // org/repo#number -> 上次审查的 head SHA
 }
 
-// NewReviewHandler 创建Review模式处理器
-func NewReviewHandler(github *ghclient.Client, workspace *workspace.Manager, mcpClient mcp.MCPClient) *ReviewHandler {
+// NewReviewHandler 创建Review模式处理器，pushAnalysis 配置推送后分析，repoConfigs 提供仓库级配置，
+// prompts 提供审查总结和评论使用的语言
+func NewReviewHandler(github *ghclient.Client, workspace *workspace.Manager, mcpClient mcp.MCPClient, sessionManager *code.SessionManager, repoConfigs *repoconfig.Store, prompts *prompt.Templates, pushAnalysis config.PushAnalysisConfig) *ReviewHandler {
 	return &ReviewHandler{
 		BaseHandler: NewBaseHandler(
 			ReviewMode,
 			30, // 最低优先级
 			"Handle automatic code review events",
 		),
-		github:    github,
-		workspace: workspace,
-		mcpClient: mcpClient,
+		github:         github,
+		workspace:      workspace,
+		mcpClient:      mcpClient,
+		sessionManager: sessionManager,
+		repoConfigs:    repoConfigs,
+		prompts:        prompts,
+		pushAnalysis:   pushAnalysis,
+		reviewed:       make(map[string]string),
 	}
 }
 
@@ -59,6 +85,12 @@ func (rh *ReviewHandler) CanHandle(ctx context.Context, event models.GitHubConte
 func (rh *ReviewHandler) canHandlePREvent(ctx context.Context, event *models.PullRequestContext) bool {
 	xl := xlog.NewWith(ctx)
 	
+	// CodeAgent 自己创建的 PR 和推送的提交不再审查，避免审查自己的输出
+	if rh.github.IsAgent(ctx, event.GetSender()) {
+		xl.Infof("Ignoring PR %s event from CodeAgent account %s", event.GetEventAction(), event.GetSender().GetLogin())
+		return false
+	}
+	
 	switch event.GetEventAction() {
 	case "opened":
 		// PR打开时自动审查
@@ -84,14 +116,13 @@ func (rh *ReviewHandler) canHandlePREvent(ctx context.Context, event *models.Pul
 func (rh *ReviewHandler) canHandlePushEvent(ctx context.Context, event *models.PushContext) bool {
 	xl := xlog.NewWith(ctx)
 	
-	// 只处理主分支的Push事件
-	if event.Ref == "refs/heads/main" || event.Ref == "refs/heads/master" {
-		xl.Infof("Review mode can handle push to main branch")
-		return true
+	// 只分析配置的受保护分支（默认为仓库的默认分支）
+	raw, ok := event.RawEvent.(*github.PushEvent)
+	if !ok || !rh.ShouldAnalyzePush(raw) {
+		return false
 	}
-	
-	// 可以扩展到处理其他重要分支
-	return false
+	xl.Infof("Review mode can handle push to %s", event.Ref)
+	return true
 }
 
 // Execute 执行Review模式处理逻辑
@@ -115,13 +146,18 @@ func (rh *ReviewHandler) handlePREvent(ctx context.Context, event *models.PullRe
 	xl := xlog.NewWith(ctx)
 	
 	switch event.GetEventAction() {
-	case "opened", "synchronize", "ready_for_review":
+	case "opened":
 		xl.Infof("Auto-reviewing PR #%d", event.PullRequest.GetNumber())
+		return rh.ReviewPR(ctx, event.PullRequest)
 		
-		// 执行自动代码审查
-		// TODO: 实现自动PR审查逻辑，使用MCP工具
-		xl.Infof("Auto-review for PR #%d is not yet implemented", event.PullRequest.GetNumber())
-		return nil
+	case "synchronize", "ready_for_review":
+		// 已审查过的 PR 只审查新的提交
+		var before string
+		if raw, ok := event.RawEvent.(*github.PullRequestEvent); ok {
+			before = raw.GetBefore()
+		}
+		xl.Infof("Re-reviewing PR #%d", event.PullRequest.GetNumber())
+		return rh.ReReviewPR(ctx, event.PullRequest, before)
 		
 	default:
 		return fmt.Errorf("unsupported action for PR event in ReviewHandler: %s", event.GetEventAction())
@@ -133,9 +169,422 @@ func (rh *ReviewHandler) handlePushEvent(ctx context.Context, event *models.Push
 	xl := xlog.NewWith(ctx)
 	xl.Infof("Processing push event to %s with %d commits", event.Ref, len(event.Commits))
 	
-	// 这里可以实现对主分支Push的自动分析
-	// 例如：代码质量检查、安全扫描、性能分析等
-	
-	// 暂时返回未实现错误
-	return fmt.Errorf("push event handling in ReviewHandler not implemented yet")
-}
\ No newline at end of file
+	raw, ok := event.RawEvent.(*github.PushEvent)
+	if !ok {
+		return fmt.Errorf("push event is missing raw event data")
+	}
+	return rh.AnalyzePush(ctx, raw)
+}
+
+// maxReviewDiffSize 提示词中包含的 diff 最大字节数，超出部分由 AI 在工作空间中自行查看
+const maxReviewDiffSize = 100 * 1024
+
+// 行内评论中的隐藏标记，用于识别 CodeAgent 之前发布的行内评论
+const (
+	reviewCommentMarker  = "<!-- codeagent-review -->"
+	outdatedReviewMarker = "<!-- codeagent-review outdated -->"
+)
+
+// reviewComment AI 给出的行内审查意见
+type reviewComment struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Body string `json:"body"`
+}
+
+// reviewResult AI 的审查结果
+type reviewResult struct {
+	Summary  string          `json:"summary"`
+	Comments []reviewComment `json:"comments"`
+}
+
+// ReviewPR 审查 PR 的全部变更：获取 diff，让 AI 结合工作空间中的仓库代码给出意见，
+// 通过 MCP 工具发布行内评论和审查总结
+func (rh *ReviewHandler) ReviewPR(ctx context.Context, pr *github.PullRequest) error {
+	return rh.review(ctx, pr, "", "")
+}
+
+// ReReviewPR 在 PR 有新提交后只审查上次审查之后的变更，并标记行已变化的旧评论；
+// 没有审查记录时以 before 为起点，before 为空时审查全部变更
+func (rh *ReviewHandler) ReReviewPR(ctx context.Context, pr *github.PullRequest, before string) error {
+	xl := xlog.NewWith(ctx)
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+
+	allComments, err := rh.github.GetAllPRComments(pr)
+	if err != nil {
+		xl.Warnf("Failed to get PR comments, reviewing full diff: %v", err)
+		return rh.review(ctx, pr, "", "")
+	}
+
+	// 只有 CodeAgent 自己发布的审查和评论可信，其他用户可以伪造相同格式的内容
+	self, err := rh.github.Login(ctx)
+	if err != nil {
+		xl.Warnf("Failed to get CodeAgent account, previous reviews are ignored: %v", err)
+	}
+
+	base := rh.lastReviewedSHA(pr, allComments.Reviews, self)
+	if base == "" {
+		base = before
+	}
+	head := pr.GetHead().GetSHA()
+	if base == head {
+		xl.Infof("PR #%d head %s was already reviewed", pr.GetNumber(), head)
+		return nil
+	}
+
+	var diff string
+	if base != "" {
+		if diff, err = rh.github.CompareCommitsDiff(ctx, owner, repo, base, head); err == nil {
+			msgs := rh.prompts.Messages(rh.repoConfigs.Get(ctx, owner, repo))
+			rh.markOutdatedComments(ctx, owner, repo, head, outdatedReviewComments(allComments.ReviewComments, diffLines(diff), self), msgs)
+		} else {
+			// 强制推送后旧提交可能已不存在，退回全量审查
+			xl.Warnf("Failed to get incremental diff, reviewing full diff: %v", err)
+			base = ""
+		}
+	}
+	return rh.review(ctx, pr, base, diff)
+}
+
+// review 审查 base 到 PR head 的变更 diff，base 为空时审查 PR 的全部变更
+func (rh *ReviewHandler) review(ctx context.Context, pr *github.PullRequest, base, diff string) error {
+	xl := xlog.NewWith(ctx)
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	number := pr.GetNumber()
+	head := pr.GetHead().GetSHA()
+	xl.Infof("Starting PR review for %s/%s#%d (base: %q, head: %s)", owner, repo, number, base, head)
+
+	// 1. 获取 diff，行内评论只能发布在 PR 的完整 diff 中
+	prDiff, err := rh.github.GetPullRequestDiff(ctx, owner, repo, number)
+	if err != nil {
+		return err
+	}
+	if base == "" {
+		diff = prDiff
+	}
+	if strings.TrimSpace(diff) == "" {
+		xl.Infof("PR #%d has no new changes to review", number)
+		rh.setLastReviewedSHA(pr, head)
+		return nil
+	}
+
+	// 2. 准备工作空间，AI 可以查看完整的仓库代码作为上下文
+	aiModel := rh.workspace.ExtractAIModelFromBranch(pr.GetHead().GetRef())
+	if aiModel == "" {
+		aiModel = defaultAIModel(ctx, rh.repoConfigs, rh.sessionManager, owner, repo)
+	}
+	ws := rh.workspace.GetOrCreateWorkspaceForPRWithAI(pr, aiModel)
+	if ws == nil {
+		return fmt.Errorf("failed to get or create workspace for PR #%d review", number)
+	}
+	if err := rh.github.PullLatestChanges(ws, pr); err != nil {
+		xl.Warnf("Failed to pull latest changes: %v", err)
+	}
+
+	codeClient, err := rh.sessionManager.GetSession(ws)
+	if err != nil {
+		return fmt.Errorf("failed to create code session: %w", err)
+	}
+
+	// 3. 执行审查，diff 过长时截断，并在 PR 中说明审查可能不完整
+	repoConfig := rh.repoConfigs.Get(ctx, owner, repo)
+	msgs := rh.prompts.Messages(repoConfig)
+	diff, truncated := truncateDiff(diff)
+	if truncated {
+		xl.Warnf("Diff of PR #%d exceeds %d bytes, truncating it in the review prompt", number, maxReviewDiffSize)
+		if _, err := rh.github.CreateComment(ctx, owner, repo, number, fmt.Sprintf(msgs.ReviewDiffTruncated, maxReviewDiffSize/1024)); err != nil {
+			xl.Warnf("Failed to comment on truncated diff of PR #%d: %v", number, err)
+		}
+	}
+	reviewPrompt, err := rh.buildReviewPrompt(repoConfig, pr, diff, truncated, base)
+	if err != nil {
+		return err
+	}
+	resp, err := codeClient.Prompt(ctx, reviewPrompt, code.PromptOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to review PR #%d: %w", number, err)
+	}
+	output, err := io.ReadAll(resp.Out)
+	if err != nil {
+		return fmt.Errorf("failed to read review output: %w", err)
+	}
+	result, err := parseReviewOutput(string(output))
+	if err != nil {
+		return fmt.Errorf("failed to parse review output: %w", err)
+	}
+	xl.Infof("AI review of PR #%d produced %d inline comment(s)", number, len(result.Comments))
+
+	// 4. 发布审查意见
+	if err := rh.publishReview(ctx, pr, prDiff, result, msgs); err != nil {
+		return err
+	}
+	rh.setLastReviewedSHA(pr, head)
+	return nil
+}
+
+// publishReview 发布行内评论和审查总结，不在 diff 中的行无法评论，归入总结
+func (rh *ReviewHandler) publishReview(ctx context.Context, pr *github.PullRequest, diff string, result *reviewResult, msgs *locale.Messages) error {
+	xl := xlog.NewWith(ctx)
+
+	mcpCtx := &models.MCPContext{
+		Repository: &models.PullRequestContext{
+			BaseContext: models.BaseContext{
+				Repository: pr.GetBase().GetRepo(),
+			},
+			PullRequest: pr,
+		},
+		Permissions: []string{"github:read", "github:write"},
+		Constraints: []string{},
+	}
+
+	lines := diffLines(diff)
+	var calls []*models.ToolCall
+	var outside []reviewComment
+	for i, c := range result.Comments {
+		if _, ok := lines[c.Path][c.Line]; !ok {
+			outside = append(outside, c)
+			continue
+		}
+		calls = append(calls, &models.ToolCall{
+			ID: fmt.Sprintf("review_comment_%d_%d", pr.GetNumber(), i),
+			Function: models.ToolFunction{
+				Name: "github-comments_create_review_comment",
+				Arguments: map[string]interface{}{
+					"pull_number": pr.GetNumber(),
+					"body":        c.Body + "\n\n" + reviewCommentMarker,
+					"commit_id":   pr.GetHead().GetSHA(),
+					"path":        c.Path,
+					"line":        c.Line,
+				},
+			},
+		})
+	}
+
+	results, err := rh.mcpClient.ExecuteToolCalls(ctx, calls, mcpCtx)
+	if err != nil {
+		return fmt.Errorf("failed to create review comments: %w", err)
+	}
+	posted := 0
+	for i, r := range results {
+		if r.Success {
+			posted++
+		} else {
+			// 行内评论失败时保留到总结中，避免丢失审查意见
+			xl.Warnf("Failed to create review comment: %s", r.Error)
+			args := calls[i].Function.Arguments
+			body := strings.TrimSuffix(args["body"].(string), "\n\n"+reviewCommentMarker)
+			outside = append(outside, reviewComment{Path: args["path"].(string), Line: args["line"].(int), Body: body})
+		}
+	}
+
+	reviewCall := &models.ToolCall{
+		ID: fmt.Sprintf("review_%d", pr.GetNumber()),
+		Function: models.ToolFunction{
+			Name: "github-comments_create_review",
+			Arguments: map[string]interface{}{
+				"pull_number": pr.GetNumber(),
+				"body":        formatReviewSummary(result.Summary, outside, msgs) + usage.Footer(ctx),
+				"commit_id":   pr.GetHead().GetSHA(),
+				"event":       "COMMENT",
+			},
+		},
+	}
+	results, err = rh.mcpClient.ExecuteToolCalls(ctx, []*models.ToolCall{reviewCall}, mcpCtx)
+	if err != nil {
+		return fmt.Errorf("failed to create review: %w", err)
+	}
+	if len(results) > 0 && !results[0].Success {
+		return fmt.Errorf("failed to create review: %s", results[0].Error)
+	}
+
+	xl.Infof("Published review for PR #%d with %d inline comment(s)", pr.GetNumber(), posted)
+	return nil
+}
+
+// lastReviewedSHA 返回上次审查的 head SHA，优先使用内存记录，
+// 服务重启后从 PR 上 CodeAgent（登录名为 self）发布的最近一次审查中恢复
+func (rh *ReviewHandler) lastReviewedSHA(pr *github.PullRequest, reviews []*github.PullRequestReview, self string) string {
+	rh.mu.Lock()
+	sha, ok := rh.reviewed[reviewKey(pr)]
+	rh.mu.Unlock()
+	if ok {
+		return sha
+	}
+
+	var latest *github.PullRequestReview
+	for _, review := range reviews {
+		if !isAuthor(review.GetUser(), self) || !isReviewSummary(review.GetBody()) {
+			continue
+		}
+		if latest == nil || review.GetSubmittedAt().After(latest.GetSubmittedAt().Time) {
+			latest = review
+		}
+	}
+	return latest.GetCommitID()
+}
+
+func (rh *ReviewHandler) setLastReviewedSHA(pr *github.PullRequest, sha string) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+	rh.reviewed[reviewKey(pr)] = sha
+}
+
+func reviewKey(pr *github.PullRequest) string {
+	return fmt.Sprintf("%s#%d", pr.GetBase().GetRepo().GetFullName(), pr.GetNumber())
+}
+
+// isAuthor 判断 user 是否为登录名为 self 的账号，self 为空时不匹配任何用户
+func isAuthor(user *github.User, self string) bool {
+	return self != "" && strings.EqualFold(user.GetLogin(), self)
+}
+
+// isReviewSummary 判断审查内容是否为 CodeAgent 的审查总结，仓库切换过语言时之前的总结也能识别
+func isReviewSummary(body string) bool {
+	for _, name := range locale.Names() {
+		if strings.HasPrefix(body, locale.Get(name).ReviewHeader) {
+			return true
+		}
+	}
+	return false
+}
+
+// markOutdatedComments 将过时的行内评论标记为在 head 中已修改
+func (rh *ReviewHandler) markOutdatedComments(ctx context.Context, owner, repo, head string, comments []*github.PullRequestComment, msgs *locale.Messages) {
+	xl := xlog.NewWith(ctx)
+
+	for _, comment := range comments {
+		body := fmt.Sprintf(msgs.ReviewOutdated+"\n\n%s", shortSHA(head),
+			strings.Replace(comment.GetBody(), reviewCommentMarker, outdatedReviewMarker, 1))
+		if err := rh.github.UpdateReviewComment(ctx, owner, repo, comment.GetID(), body); err != nil {
+			xl.Warnf("Failed to mark review comment %d as outdated: %v", comment.GetID(), err)
+		}
+	}
+}
+
+// outdatedReviewComments 找出 CodeAgent（登录名为 self）的行内评论中已经过时的评论：
+// GitHub 已无法定位到当前行，或所在行在新的变更中被修改
+func outdatedReviewComments(comments []*github.PullRequestComment, changed map[string]map[int]bool, self string) []*github.PullRequestComment {
+	var outdated []*github.PullRequestComment
+	for _, comment := range comments {
+		if !isAuthor(comment.GetUser(), self) || !strings.Contains(comment.GetBody(), reviewCommentMarker) {
+			continue
+		}
+		if comment.Line == nil || changed[comment.GetPath()][comment.GetLine()] {
+			outdated = append(outdated, comment)
+		}
+	}
+	return outdated
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// buildReviewPrompt 使用 pr_review 模板构建审查提示词，要求 AI 以 JSON 返回总结和行内意见；
+// truncated 表示 diff 已被截断，base 非空时 diff 只包含上次审查之后的新提交
+func (rh *ReviewHandler) buildReviewPrompt(repoConfig *config.RepoConfig, pr *github.PullRequest, diff string, truncated bool, base string) (string, error) {
+	data := prompt.Data{PR: prompt.NewPullRequest(pr), Diff: diff, DiffTruncated: truncated}
+	if base != "" {
+		data.ReviewedSHA = shortSHA(base)
+	}
+	return rh.prompts.Render(prompt.PRReview, data, repoConfig)
+}
+
+// truncateDiff 截断超过 maxReviewDiffSize 的 diff，返回截断后的 diff 和是否被截断
+func truncateDiff(diff string) (string, bool) {
+	if len(diff) <= maxReviewDiffSize {
+		return diff, false
+	}
+	return diff[:maxReviewDiffSize], true
+}
+
+// parseReviewOutput 从 AI 输出中提取 JSON 审查结果，兼容 markdown 代码块包裹
+func parseReviewOutput(output string) (*reviewResult, error) {
+	var result reviewResult
+	if err := unmarshalJSONObject(output, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// unmarshalJSONObject 解析 AI 输出中的 JSON 对象（第一个 { 到最后一个 } 之间的内容）
+func unmarshalJSONObject(output string, v interface{}) error {
+	start := strings.Index(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return fmt.Errorf("no JSON object found in output")
+	}
+	return json.Unmarshal([]byte(output[start:end+1]), v)
+}
+
+// diffLines 解析 unified diff，返回每个文件变更后可以添加行内评论的行（新增行和上下文行），
+// 值为 true 表示该行是新增或修改的行
+func diffLines(diff string) map[string]map[int]bool {
+	lines := make(map[string]map[int]bool)
+	var path string
+	var line int
+	inHunk := false
+
+	scanner := bufio.NewScanner(strings.NewReader(diff))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+		switch {
+		case strings.HasPrefix(text, "diff --git "):
+			path, inHunk = "", false
+		case !inHunk && strings.HasPrefix(text, "+++ "):
+			path = strings.TrimPrefix(strings.TrimPrefix(text, "+++ "), "b/")
+			if path == "/dev/null" {
+				path = ""
+			}
+		case strings.HasPrefix(text, "@@ "):
+			// @@ -a,b +c,d @@
+			inHunk = false
+			fields := strings.Fields(text)
+			if len(fields) < 3 || path == "" {
+				continue
+			}
+			start, _, _ := strings.Cut(strings.TrimPrefix(fields[2], "+"), ",")
+			n, err := strconv.Atoi(start)
+			if err != nil {
+				continue
+			}
+			line, inHunk = n, true
+			if lines[path] == nil {
+				lines[path] = make(map[int]bool)
+			}
+		case inHunk && strings.HasPrefix(text, "+"):
+			lines[path][line] = true
+			line++
+		case inHunk && (strings.HasPrefix(text, " ") || text == ""):
+			lines[path][line] = false
+			line++
+		}
+	}
+	return lines
+}
+
+// formatReviewSummary 生成审查总结，附上无法作为行内评论发布的意见
+func formatReviewSummary(summary string, outside []reviewComment, msgs *locale.Messages) string {
+	var b strings.Builder
+	b.WriteString(msgs.ReviewHeader + "\n\n")
+	if strings.TrimSpace(summary) == "" {
+		summary = msgs.ReviewNoSummary
+	}
+	b.WriteString(strings.TrimSpace(summary))
+
+	if len(outside) > 0 {
+		b.WriteString("\n\n" + msgs.ReviewOtherFindings + "\n")
+		for _, c := range outside {
+			fmt.Fprintf(&b, "\n- `%s:%d`: %s", c.Path, c.Line, c.Body)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,179 @@
+package modes
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/internal/locale"
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const reviewTestDiff = `diff --git a/internal/foo.go b/internal/foo.go
+index 1111111..2222222 100644
+--- a/internal/foo.go
++++ b/internal/foo.go
+@@ -10,4 +10,5 @@ func Foo() {
+ 	a := 1
+-	b := 2
++	b := 3
++	c := 4
+ 	return a + b
+@@ -40,2 +41,2 @@ func Bar() {
+-	old()
++	updated()
+ }
+diff --git a/old.txt b/old.txt
+deleted file mode 100644
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-removed
+`
+
+func TestDiffLines(t *testing.T) {
+	lines := diffLines(reviewTestDiff)
+
+	require.Contains(t, lines, "internal/foo.go")
+	file := lines["internal/foo.go"]
+	for _, line := range []int{10, 11, 12, 13, 41, 42} {
+		assert.Contains(t, file, line, "line %d should be commentable", line)
+	}
+	assert.NotContains(t, file, 14)
+	assert.NotContains(t, file, 40)
+	// 只有新增的行标记为修改
+	assert.Equal(t, map[int]bool{10: false, 11: true, 12: true, 13: false, 41: true, 42: false}, file)
+	assert.NotContains(t, lines, "old.txt")
+}
+
+func TestOutdatedReviewComments(t *testing.T) {
+	comment := func(id int64, path string, line *int, body string) *github.PullRequestComment {
+		return &github.PullRequestComment{ID: github.Int64(id), Path: github.String(path), Line: line, Body: github.String(body), User: &github.User{Login: github.String("codeagent[bot]")}}
+	}
+	forged := comment(6, "internal/foo.go", github.Int(11), "copied marker\n\n"+reviewCommentMarker)
+	forged.User = &github.User{Login: github.String("mallory")}
+	comments := []*github.PullRequestComment{
+		comment(1, "internal/foo.go", github.Int(11), "b looks wrong\n\n"+reviewCommentMarker),
+		comment(2, "internal/foo.go", github.Int(10), "a is fine\n\n"+reviewCommentMarker),
+		comment(3, "internal/foo.go", nil, "line is gone\n\n"+reviewCommentMarker),
+		comment(4, "internal/foo.go", github.Int(12), "human comment"),
+		comment(5, "internal/foo.go", github.Int(12), "already marked\n\n"+outdatedReviewMarker),
+		forged,
+	}
+
+	outdated := outdatedReviewComments(comments, diffLines(reviewTestDiff), "CodeAgent[bot]")
+	var ids []int64
+	for _, c := range outdated {
+		ids = append(ids, c.GetID())
+	}
+	assert.Equal(t, []int64{1, 3}, ids)
+}
+
+func TestReviewHandler_IgnoresPREventsFromBots(t *testing.T) {
+	rh := NewReviewHandler(nil, nil, nil, nil, nil, nil, config.PushAnalysisConfig{})
+	for _, action := range []string{"opened", "synchronize", "ready_for_review"} {
+		event := &models.PullRequestContext{
+			BaseContext: models.BaseContext{
+				Type:   models.EventPullRequest,
+				Action: action,
+				Sender: &github.User{Login: github.String("codeagent[bot]"), Type: github.String("Bot")},
+			},
+			PullRequest: &github.PullRequest{Number: github.Int(3)},
+		}
+		assert.False(t, rh.CanHandle(context.Background(), event), action)
+	}
+}
+
+func TestLastReviewedSHA(t *testing.T) {
+	rh := NewReviewHandler(nil, nil, nil, nil, nil, nil, config.PushAnalysisConfig{})
+	pr := &github.PullRequest{
+		Number: github.Int(7),
+		Base:   &github.PullRequestBranch{Repo: &github.Repository{FullName: github.String("org/repo")}},
+	}
+	at := func(hour int) *github.Timestamp {
+		return &github.Timestamp{Time: time.Date(2024, 5, 1, hour, 0, 0, 0, time.UTC)}
+	}
+	agent := &github.User{Login: github.String("codeagent[bot]")}
+	user := &github.User{Login: github.String("mallory")}
+	reviews := []*github.PullRequestReview{
+		{User: agent, Body: github.String(locale.Get(locale.English).ReviewHeader + "\n\nfirst"), CommitID: github.String("aaa"), SubmittedAt: at(1)},
+		{User: agent, Body: github.String(locale.Get(locale.Chinese).ReviewHeader + "\n\nsecond"), CommitID: github.String("bbb"), SubmittedAt: at(2)},
+		{User: agent, Body: github.String("LGTM"), CommitID: github.String("ccc"), SubmittedAt: at(3)},
+		// 其他用户伪造的审查总结不能跳过新的提交
+		{User: user, Body: github.String(locale.Get(locale.English).ReviewHeader + "\n\nforged"), CommitID: github.String("eee"), SubmittedAt: at(4)},
+	}
+
+	assert.Empty(t, rh.lastReviewedSHA(pr, nil, "codeagent[bot]"))
+	assert.Equal(t, "bbb", rh.lastReviewedSHA(pr, reviews, "codeagent[bot]"))
+	assert.Empty(t, rh.lastReviewedSHA(pr, reviews, ""))
+
+	rh.setLastReviewedSHA(pr, "ddd")
+	assert.Equal(t, "ddd", rh.lastReviewedSHA(pr, reviews, "codeagent[bot]"))
+}
+
+func TestParseReviewOutput(t *testing.T) {
+	output := "Here is my review:\n```json\n" + `{
+  "summary": "Looks mostly good.",
+  "comments": [{"path": "internal/foo.go", "line": 12, "body": "c is unused"}]
+}` + "\n```\n"
+
+	result, err := parseReviewOutput(output)
+	require.NoError(t, err)
+	assert.Equal(t, "Looks mostly good.", result.Summary)
+	require.Len(t, result.Comments, 1)
+	assert.Equal(t, reviewComment{Path: "internal/foo.go", Line: 12, Body: "c is unused"}, result.Comments[0])
+
+	_, err = parseReviewOutput("no review here")
+	assert.Error(t, err)
+}
+
+func TestFormatReviewSummary(t *testing.T) {
+	en := locale.Get(locale.English)
+	summary := formatReviewSummary("Looks good.", []reviewComment{{Path: "README.md", Line: 3, Body: "typo"}}, en)
+	assert.True(t, strings.HasPrefix(summary, "## CodeAgent Review\n\n"))
+	assert.Contains(t, summary, "Looks good.")
+	assert.Contains(t, summary, "### Other findings")
+	assert.Contains(t, summary, "- `README.md:3`: typo")
+
+	assert.NotContains(t, formatReviewSummary("Looks good.", nil, en), "Other findings")
+
+	zh := formatReviewSummary("", []reviewComment{{Path: "README.md", Line: 3, Body: "typo"}}, locale.Get(locale.Chinese))
+	assert.True(t, isReviewSummary(zh))
+	assert.Contains(t, zh, "未提供总结。")
+	assert.Contains(t, zh, "### 其他问题")
+}
+
+func TestBuildReviewPromptTruncatesDiff(t *testing.T) {
+	rh := NewReviewHandler(nil, nil, nil, nil, nil, nil, config.PushAnalysisConfig{})
+	pr := &github.PullRequest{Title: github.String("Add foo"), Body: github.String("Implements foo")}
+
+	prompt, err := rh.buildReviewPrompt(nil, pr, reviewTestDiff, false, "")
+	require.NoError(t, err)
+	assert.Contains(t, prompt, "Add foo")
+	assert.Contains(t, prompt, "+\tc := 4")
+	assert.NotContains(t, prompt, "diff 过长已截断")
+	assert.NotContains(t, prompt, "上次审查")
+
+	diff, truncated := truncateDiff(strings.Repeat("+x\n", maxReviewDiffSize))
+	require.True(t, truncated)
+	assert.Len(t, diff, maxReviewDiffSize)
+	prompt, err = rh.buildReviewPrompt(nil, pr, diff, truncated, "0123456789abcdef")
+	require.NoError(t, err)
+	assert.Contains(t, prompt, "diff 过长已截断")
+	assert.Contains(t, prompt, "上次审查（0123456）之后的新变更")
+
+	// 仓库配置的语言和提示词模板同样适用于审查
+	prompt, err = rh.buildReviewPrompt(&config.RepoConfig{Locale: locale.English}, pr, reviewTestDiff, false, "")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(prompt, "Review the following PR as a senior code reviewer."))
+
+	prompt, err = rh.buildReviewPrompt(&config.RepoConfig{Prompts: map[string]string{"pr_review": "Review {{.PR.Title}}"}}, pr, reviewTestDiff, false, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Review Add foo", prompt)
+}
@@ -0,0 +1,179 @@
+package modes
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/qiniu/x/xlog"
+)
+
+// 定时任务类型
+const (
+	// ScheduleTaskStaleIssues 为长时间没有更新的 Issue 添加标签并评论提醒
+	ScheduleTaskStaleIssues = "stale_issues"
+	// ScheduleTaskCode 按 prompt 创建 Issue 并走 /code 流程提交 PR，例如定期升级依赖
+	ScheduleTaskCode = "code"
+	// ScheduleTaskWorkspaceReport 汇报工作空间数量和已过期待清理的工作空间
+	ScheduleTaskWorkspaceReport = "workspace_report"
+)
+
+const (
+	defaultStaleDays  = 30
+	defaultStaleLabel = "stale"
+)
+
+// runStaleIssues 处理 stale_issues 任务。
+// 参数：days 不活跃天数（默认 30），label 添加的标签（默认 stale），message 提醒评论内容
+func (ah *AgentHandler) runStaleIssues(ctx context.Context, event *models.ScheduleContext) error {
+	xl := xlog.NewWith(ctx)
+
+	owner, repo, err := scheduleRepo(event)
+	if err != nil {
+		return err
+	}
+	days := defaultStaleDays
+	if v := event.Inputs["days"]; v != "" {
+		if days, err = strconv.Atoi(v); err != nil || days <= 0 {
+			return fmt.Errorf("invalid days input %q for stale_issues", v)
+		}
+	}
+	label := event.Inputs["label"]
+	if label == "" {
+		label = defaultStaleLabel
+	}
+	message := event.Inputs["message"]
+	if message == "" {
+		message = fmt.Sprintf(ah.prompts.Messages(ah.repoConfigs.Get(ctx, owner, repo)).StaleIssue, days, label)
+	}
+
+	cutoff := event.GetTimestamp().AddDate(0, 0, -days)
+	issues, err := ah.github.ListStaleIssues(ctx, owner, repo, cutoff)
+	if err != nil {
+		return err
+	}
+
+	marked := 0
+	for _, issue := range issues {
+		if hasLabel(issue, label) {
+			continue
+		}
+		if _, err := ah.github.CreateComment(ctx, owner, repo, issue.GetNumber(), message); err != nil {
+			xl.Errorf("Failed to comment on stale issue #%d: %v", issue.GetNumber(), err)
+			continue
+		}
+		if err := ah.github.AddLabels(ctx, owner, repo, issue.GetNumber(), []string{label}); err != nil {
+			xl.Errorf("Failed to label stale issue #%d: %v", issue.GetNumber(), err)
+			continue
+		}
+		marked++
+	}
+	xl.Infof("Marked %d of %d inactive issues in %s/%s as %s", marked, len(issues), owner, repo, label)
+	return nil
+}
+
+// runCodeTask 处理 code 任务：创建 Issue 后走与 /code 相同的流程提交 PR。
+// 参数：title Issue 标题（会追加日期），prompt Issue 内容，labels 逗号分隔的标签，ai_model 使用的模型
+func (ah *AgentHandler) runCodeTask(ctx context.Context, event *models.ScheduleContext) error {
+	xl := xlog.NewWith(ctx)
+
+	owner, repo, err := scheduleRepo(event)
+	if err != nil {
+		return err
+	}
+	title, prompt := event.Inputs["title"], event.Inputs["prompt"]
+	if title == "" || prompt == "" {
+		return fmt.Errorf("code task requires title and prompt inputs")
+	}
+	if ah.issues == nil {
+		return fmt.Errorf("issue processing is not configured")
+	}
+
+	var labels []string
+	for _, label := range strings.Split(event.Inputs["labels"], ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	title = fmt.Sprintf("%s (%s)", title, event.GetTimestamp().Format("2006-01-02"))
+	body := fmt.Sprintf("%s\n\n---\n*Created by CodeAgent schedule `%s`*", prompt, event.Name)
+
+	issue, err := ah.github.CreateIssue(ctx, owner, repo, title, body, labels)
+	if err != nil {
+		return err
+	}
+	xl.Infof("Created issue #%d for schedule %s, processing it", issue.GetNumber(), event.Name)
+	return ah.issues.ProcessIssue(ctx, issue, event.Inputs["ai_model"])
+}
+
+// runWorkspaceReport 处理 workspace_report 任务。
+// 参数：issue 发布报告的 Issue 编号，未配置时只输出到日志
+func (ah *AgentHandler) runWorkspaceReport(ctx context.Context, event *models.ScheduleContext) error {
+	xl := xlog.NewWith(ctx)
+
+	report := formatWorkspaceReport(
+		ah.workspace.GetWorkspaceCount(),
+		ah.workspace.GetRepoManagerCount(),
+		ah.workspace.GetWorktreeCount(),
+		ah.workspace.GetExpiredWorkspaces(),
+		event.GetTimestamp(),
+	)
+
+	number := event.Inputs["issue"]
+	if number == "" {
+		xl.Infof("Workspace report:\n%s", report)
+		return nil
+	}
+	owner, repo, err := scheduleRepo(event)
+	if err != nil {
+		return err
+	}
+	issueNumber, err := strconv.Atoi(number)
+	if err != nil {
+		return fmt.Errorf("invalid issue input %q for workspace_report", number)
+	}
+	_, err = ah.github.CreateComment(ctx, owner, repo, issueNumber, report)
+	return err
+}
+
+// formatWorkspaceReport 生成工作空间报告
+func formatWorkspaceReport(workspaces, repos, worktrees int, expired []*models.Workspace, now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString("## Workspace Report\n\n")
+	fmt.Fprintf(&sb, "- Workspaces: %d\n", workspaces)
+	fmt.Fprintf(&sb, "- Repositories: %d\n", repos)
+	fmt.Fprintf(&sb, "- Worktrees: %d\n", worktrees)
+	fmt.Fprintf(&sb, "- Expired (pending cleanup): %d\n", len(expired))
+	if len(expired) > 0 {
+		sb.WriteString("\n| Workspace | AI | Age | Path |\n|---|---|---|---|\n")
+		for _, ws := range expired {
+			fmt.Fprintf(&sb, "| %s/%s#%d | %s | %s | `%s` |\n",
+				ws.Org, ws.Repo, ws.PRNumber, ws.AIModel, now.Sub(ws.CreatedAt).Round(time.Hour), ws.Path)
+		}
+	}
+	return sb.String()
+}
+
+// scheduleRepo 返回定时任务作用的仓库
+func scheduleRepo(event *models.ScheduleContext) (owner, repo string, err error) {
+	repository := event.GetRepository()
+	if repository.GetOwner().GetLogin() == "" || repository.GetName() == "" {
+		return "", "", fmt.Errorf("schedule %s has no repository configured", event.Name)
+	}
+	return repository.GetOwner().GetLogin(), repository.GetName(), nil
+}
+
+// hasLabel 检查 Issue 是否已有指定标签（不区分大小写）
+func hasLabel(issue *github.Issue, name string) bool {
+	for _, label := range issue.Labels {
+		if strings.EqualFold(label.GetName(), name) {
+			return true
+		}
+	}
+	return false
+}
@@ -9,7 +9,11 @@ import (
 
 	"github.com/qiniu/codeagent/internal/code"
 	ghclient "github.com/qiniu/codeagent/internal/github"
+	"github.com/qiniu/codeagent/internal/locale"
 	"github.com/qiniu/codeagent/internal/mcp"
+	"github.com/qiniu/codeagent/internal/prompt"
+	"github.com/qiniu/codeagent/internal/repoconfig"
+	"github.com/qiniu/codeagent/internal/usage"
 	"github.com/qiniu/codeagent/internal/workspace"
 	"github.com/qiniu/codeagent/pkg/models"
 
@@ -19,27 +23,39 @@ import (
 
 // TagHandler Tag模式处理器
 // 对应claude-code-action中的TagMode
-// 处理包含命令的GitHub事件（/code, /continue, /fix）
+// 处理包含命令的GitHub事件（/code, /continue, /fix, /suggest）
 type TagHandler struct {
 	*BaseHandler
 	github         *ghclient.Client
 	workspace      *workspace.Manager
 	mcpClient      mcp.MCPClient
 	sessionManager *code.SessionManager
+	repoConfigs    *repoconfig.Store
+	prompts        *prompt.Templates
+	suggester      ReviewCommentSuggester
 }
 
-// NewTagHandler 创建Tag模式处理器
-func NewTagHandler(github *ghclient.Client, workspace *workspace.Manager, mcpClient mcp.MCPClient, sessionManager *code.SessionManager) *TagHandler {
+// ReviewCommentSuggester 执行代码行评论中的 /suggest，由 agent 包实现
+type ReviewCommentSuggester interface {
+	SuggestPRFromReviewCommentWithAI(ctx context.Context, event *github.PullRequestReviewCommentEvent, aiModel, args string) error
+}
+
+// NewTagHandler 创建Tag模式处理器，repoConfigs 提供仓库级配置（默认模型、提示词中的仓库说明），prompts 为提示词模板，
+// suggester 执行 /suggest。触发用户的权限由 EnhancedAgent 在执行命令前检查
+func NewTagHandler(github *ghclient.Client, workspace *workspace.Manager, mcpClient mcp.MCPClient, sessionManager *code.SessionManager, repoConfigs *repoconfig.Store, prompts *prompt.Templates, suggester ReviewCommentSuggester) *TagHandler {
 	return &TagHandler{
 		BaseHandler: NewBaseHandler(
 			TagMode,
 			10, // 中等优先级
-			"Handle @codeagent mentions and commands (/code, /continue, /fix)",
+			"Handle @codeagent mentions and commands (/code, /continue, /fix, /suggest)",
 		),
 		github:         github,
 		workspace:      workspace,
 		mcpClient:      mcpClient,
 		sessionManager: sessionManager,
+		repoConfigs:    repoConfigs,
+		prompts:        prompts,
+		suggester:      suggester,
 	}
 }
 
@@ -48,7 +64,7 @@ func (th *TagHandler) CanHandle(ctx context.Context, event models.GitHubContext)
 	xl := xlog.NewWith(ctx)
 	
 	// 检查是否包含命令
-	cmdInfo, hasCmd := models.HasCommand(event)
+	cmdInfo, hasCmd := models.HasCommand(event, code.Providers())
 	if !hasCmd {
 		xl.Debugf("No command found in event")
 		return false
@@ -56,6 +72,23 @@ func (th *TagHandler) CanHandle(ctx context.Context, event models.GitHubContext)
 	
 	xl.Infof("Found command: %s with AI model: %s", cmdInfo.Command, cmdInfo.AIModel)
 	
+	// CodeAgent 自己发布的评论可能引用命令文本，不能触发新的任务
+	if th.github.IsAgent(ctx, event.GetSender()) {
+		xl.Infof("Ignoring command from CodeAgent account %s", event.GetSender().GetLogin())
+		return false
+	}
+	
+	// /cancel 在 webhook 入口同步处理，不作为任务执行
+	if cmdInfo.Command == models.CommandCancel {
+		return false
+	}
+	
+	// /suggest 只能用于代码行评论
+	if cmdInfo.Command == models.CommandSuggest && event.GetEventType() != models.EventPullRequestReviewComment {
+		xl.Debugf("Ignoring %s outside of a PR review comment", cmdInfo.Command)
+		return false
+	}
+	
 	// Tag模式处理所有包含命令的事件
 	switch event.GetEventType() {
 	case models.EventIssueComment,
@@ -74,15 +107,16 @@ func (th *TagHandler) Execute(ctx context.Context, event models.GitHubContext) e
 	xl.Infof("TagHandler executing for event type: %s", event.GetEventType())
 	
 	// 提取命令信息
-	cmdInfo, hasCmd := models.HasCommand(event)
+	cmdInfo, hasCmd := models.HasCommand(event, code.Providers())
 	if !hasCmd {
 		return fmt.Errorf("no command found in event")
 	}
 	
-	// 设置默认AI模型（如果未指定）
+	// 设置默认AI模型（如果未指定），仓库级配置优先于全局配置
 	aiModel := cmdInfo.AIModel
 	if aiModel == "" {
-		aiModel = "claude" // 默认使用claude，实际应该从配置获取
+		repo := event.GetRepository()
+		aiModel = defaultAIModel(ctx, th.repoConfigs, th.sessionManager, repo.GetOwner().GetLogin(), repo.GetName())
 	}
 	
 	xl.Infof("Executing command: %s with AI model: %s, args: %s", 
@@ -195,6 +229,10 @@ func (th *TagHandler) handlePRReviewComment(
 		// 实现PR Review评论修复逻辑，集成原姻Agent功能
 		xl.Infof("Processing PR review comment fix with new architecture")
 		return th.processPRReviewCommentCommand(ctx, event, cmdInfo, aiModel, "Fix")
+	case models.CommandSuggest:
+		// 以 suggestion 代码块回复评论，不提交到 PR 分支；未指定模型时由 suggester 按 PR 分支确定
+		xl.Infof("Processing PR review comment suggest")
+		return th.suggester.SuggestPRFromReviewCommentWithAI(ctx, event.RawEvent.(*github.PullRequestReviewCommentEvent), cmdInfo.AIModel, cmdInfo.Args)
 	default:
 		return fmt.Errorf("unsupported command for PR review comment: %s", cmdInfo.Command)
 	}
@@ -207,16 +245,34 @@ func (th *TagHandler) processIssueCodeCommand(
 	cmdInfo *models.CommandInfo,
 	aiModel string,
 ) error {
+	return th.ProcessIssue(ctx, event.Issue, aiModel)
+}
+
+// ProcessIssue 执行 Issue 到 PR 的完整流程：创建分支和 PR，由 AI 修改代码后更新 PR 描述；
+// /code 命令和 AgentHandler 的自动处理共用
+func (th *TagHandler) ProcessIssue(ctx context.Context, issue *github.Issue, aiModel string) error {
+	return th.ProcessIssueOnBranch(ctx, issue, aiModel, "")
+}
+
+// ProcessIssueOnBranch 与 ProcessIssue 相同，但基于 base 分支工作并向其提交 PR，base 为空时使用默认分支
+func (th *TagHandler) ProcessIssueOnBranch(ctx context.Context, issue *github.Issue, aiModel, base string) error {
 	xl := xlog.NewWith(ctx)
 	
-	issueNumber := event.Issue.GetNumber()
-	issueTitle := event.Issue.GetTitle()
+	owner, repoName := issueRepo(issue)
+	repoConfig := th.repoConfigs.Get(ctx, owner, repoName)
+	if aiModel == "" {
+		aiModel = repoConfig.Provider(th.sessionManager.DefaultProvider())
+	}
+	msgs := th.prompts.Messages(repoConfig)
+	
+	issueNumber := issue.GetNumber()
+	issueTitle := issue.GetTitle()
 	
 	xl.Infof("Starting issue code processing: issue=#%d, title=%s, AI model=%s", 
 		issueNumber, issueTitle, aiModel)
 	
 	// 1. 创建Issue工作空间，包含AI模型信息
-	ws := th.workspace.CreateWorkspaceFromIssueWithAI(event.Issue, aiModel)
+	ws := th.workspace.CreateWorkspaceFromIssueOnBranch(issue, aiModel, base)
 	if ws == nil {
 		xl.Errorf("Failed to create workspace from issue")
 		return fmt.Errorf("failed to create workspace from issue")
@@ -233,7 +289,7 @@ func (th *TagHandler) processIssueCodeCommand(
 	
 	// 3. 创建初始PR
 	xl.Infof("Creating initial PR")
-	pr, err := th.github.CreatePullRequest(ws)
+	pr, err := th.github.CreatePullRequest(ws, msgs)
 	if err != nil {
 		xl.Errorf("Failed to create PR: %v", err)
 		return err
@@ -275,17 +331,11 @@ func (th *TagHandler) processIssueCodeCommand(
 	xl.Infof("Code client initialized successfully")
 	
 	// 8. 执行代码修改
-	codePrompt := fmt.Sprintf(`根据Issue修改代码：
-
-标题：%s
-描述：%s
-
-输出格式：
-%s
-简要说明改动内容
-
-%s
-- 列出修改的文件和具体变动`, event.Issue.GetTitle(), event.Issue.GetBody(), models.SectionSummary, models.SectionChanges)
+	codePrompt, err := th.prompts.Render(prompt.IssueCode, prompt.Data{Issue: prompt.NewIssue(issue)}, repoConfig)
+	if err != nil {
+		xl.Errorf("Failed to build prompt: %v", err)
+		return err
+	}
 	
 	xl.Infof("Executing code modification with AI")
 	codeResp, err := th.promptWithRetry(ctx, codeClient, codePrompt, 3)
@@ -312,19 +362,20 @@ func (th *TagHandler) processIssueCodeCommand(
 	// 构建PR Body
 	prBody := ""
 	if summary != "" {
-		prBody += models.SectionSummary + "\n\n" + summary + "\n\n"
+		prBody += msgs.SectionSummary + "\n\n" + summary + "\n\n"
 	}
 	
 	if changes != "" {
-		prBody += models.SectionChanges + "\n\n" + changes + "\n\n"
+		prBody += msgs.SectionChanges + "\n\n" + changes + "\n\n"
 	}
 	
 	if testPlan != "" {
-		prBody += models.SectionTestPlan + "\n\n" + testPlan + "\n\n"
+		prBody += msgs.SectionTestPlan + "\n\n" + testPlan + "\n\n"
 	}
 	
 	// 10. 使用MCP工具更新PR描述和提交代码变更
 	xl.Infof("Updating PR description with MCP tools")
+	prBody += usage.Footer(ctx)
 	err = th.updatePRWithMCP(ctx, ws, pr, prBody, aiStr)
 	if err != nil {
 		xl.Errorf("Failed to update PR with MCP: %v", err)
@@ -343,7 +394,12 @@ func (th *TagHandler) promptWithRetry(ctx context.Context, codeClient code.Code,
 	for i := 0; i < maxRetries; i++ {
 		xl.Infof("Executing prompt (attempt %d/%d)", i+1, maxRetries)
 		
-		resp, err := codeClient.Prompt(prompt)
+		// 任务被取消或超时后不再重试
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("prompt aborted: %w", context.Cause(ctx))
+		}
+		
+		resp, err := codeClient.Prompt(ctx, prompt, code.PromptOptions{})
 		if err == nil {
 			xl.Infof("Prompt executed successfully on attempt %d", i+1)
 			return resp, nil
@@ -372,27 +428,22 @@ func (th *TagHandler) parseStructuredOutput(output string) (summary, changes, te
 	for _, line := range lines {
 		trimmed := strings.TrimSpace(line)
 		
-		if strings.Contains(trimmed, models.SectionSummary) {
-			currentSection = "summary"
-			continue
-		} else if strings.Contains(trimmed, models.SectionChanges) {
-			currentSection = "changes"
-			continue
-		} else if strings.Contains(trimmed, models.SectionTestPlan) {
-			currentSection = "testplan"
+		// 识别所有语言的章节标题
+		if section := locale.Section(trimmed); section != "" {
+			currentSection = section
 			continue
 		}
 		
 		switch currentSection {
-		case "summary":
+		case models.SectionSummaryID:
 			if trimmed != "" {
 				summaryLines = append(summaryLines, trimmed)
 			}
-		case "changes":
+		case models.SectionChangesID:
 			if trimmed != "" {
 				changesLines = append(changesLines, trimmed)
 			}
-		case "testplan":
+		case models.SectionTestPlanID:
 			if trimmed != "" {
 				testPlanLines = append(testPlanLines, trimmed)
 			}
@@ -498,8 +549,8 @@ func (th *TagHandler) processPRCommand(
 		branchName := pr.GetHead().GetRef()
 		aiModel = th.workspace.ExtractAIModelFromBranch(branchName)
 		if aiModel == "" {
-			// 使用默认值
-			aiModel = "claude"
+			// 使用仓库或全局的默认值
+			aiModel = defaultAIModel(ctx, th.repoConfigs, th.sessionManager, repoOwner, repoName)
 		}
 		xl.Infof("Extracted AI model from branch: %s", aiModel)
 	}
@@ -544,8 +595,11 @@ func (th *TagHandler) processPRCommand(
 	if event.Comment != nil {
 		currentCommentID = event.Comment.GetID()
 	}
-	historicalContext := th.formatHistoricalComments(allComments, currentCommentID)
-	prompt := th.buildPrompt(mode, cmdInfo.Args, historicalContext)
+	prompt, err := th.buildPrompt(ctx, pr, mode, cmdInfo.Args, allComments, currentCommentID)
+	if err != nil {
+		xl.Errorf("Failed to build prompt: %v", err)
+		return err
+	}
 	
 	xl.Infof("Using %s prompt with args and historical context", strings.ToLower(mode))
 	
@@ -573,7 +627,7 @@ func (th *TagHandler) processPRCommand(
 	}
 	
 	xl.Infof("Committing and pushing changes for PR %s", strings.ToLower(mode))
-	if err := th.github.CommitAndPush(ws, result, codeClient); err != nil {
+	if err := th.github.CommitAndPush(ctx, ws, result, codeClient, th.prompts.Messages(th.repoConfigs.Get(ctx, repoOwner, repoName))); err != nil {
 		xl.Errorf("Failed to commit and push changes: %v", err)
 		if mode == "Fix" {
 			return err
@@ -585,7 +639,7 @@ func (th *TagHandler) processPRCommand(
 	
 	// 12. 使用MCP工具评论到PR
 	xl.Infof("Adding comment to PR using MCP tools")
-	err = th.addPRCommentWithMCP(ctx, ws, pr, string(output))
+	err = th.addPRCommentWithMCP(ctx, ws, pr, string(output)+usage.Footer(ctx))
 	if err != nil {
 		xl.Errorf("Failed to add comment via MCP: %v", err)
 		// 不返回错误，因为这不是致命的
@@ -629,90 +683,17 @@ func (th *TagHandler) processPRReviewCommentCommand(
 	return nil
 }
 
-// buildPrompt 构建不同模式的prompt
-func (th *TagHandler) buildPrompt(mode string, args string, historicalContext string) string {
-	var prompt string
-	var taskDescription string
-	var defaultTask string
-	
-	switch mode {
-	case "Continue":
-		taskDescription = "请根据上述PR描述、历史讨论和当前指令，进行相应的代码修改。"
-		defaultTask = "继续处理PR，分析代码变更并改进"
-	case "Fix":
-		taskDescription = "请根据上述PR描述、历史讨论和当前指令，进行相应的代码修复。"
-		defaultTask = "分析并修复代码问题"
-	default:
-		taskDescription = "请根据上述PR描述、历史讨论和当前指令，进行相应的代码处理。"
-		defaultTask = "处理代码任务"
-	}
-	
-	if args != "" {
-		if historicalContext != "" {
-			prompt = fmt.Sprintf(`作为PR代码审查助手，请基于以下完整上下文来%s：
-
-%s
-
-## 当前指令
-%s
-
-%s注意：
-1. 当前指令是主要任务，历史信息仅作为上下文参考
-2. 请确保修改符合PR的整体目标和已有的讨论共识
-3. 如果发现与历史讨论有冲突，请优先执行当前指令并在回复中说明`,
-				strings.ToLower(mode), historicalContext, args, taskDescription)
-		} else {
-			prompt = fmt.Sprintf("根据指令%s：\n\n%s", strings.ToLower(mode), args)
-		}
-	} else {
-		if historicalContext != "" {
-			prompt = fmt.Sprintf(`作为PR代码审查助手，请基于以下完整上下文来%s：
-
-%s
-
-%s`, strings.ToLower(mode), historicalContext, taskDescription)
-		} else {
-			prompt = fmt.Sprintf("%s", defaultTask)
-		}
-	}
-	
-	return prompt
-}
-
-// formatHistoricalComments 格式化历史评论
-func (th *TagHandler) formatHistoricalComments(allComments *models.PRAllComments, currentCommentID int64) string {
-	if allComments == nil {
-		return ""
-	}
-	
-	var contextParts []string
-	
-	// 添加PR描述
-	if allComments.PRBody != "" {
-		contextParts = append(contextParts, "## PR描述\n"+allComments.PRBody)
-	}
-	
-	// 添加Issue评论
-	if len(allComments.IssueComments) > 0 {
-		contextParts = append(contextParts, "## PR讨论")
-		for _, comment := range allComments.IssueComments {
-			if comment.GetID() != currentCommentID {
-				contextParts = append(contextParts, fmt.Sprintf("**%s**: %s", 
-					comment.User.GetLogin(), comment.GetBody()))
-			}
-		}
-	}
-	
-	// 添加Review评论
-	if len(allComments.ReviewComments) > 0 {
-		contextParts = append(contextParts, "## 代码审查评论")
-		for _, comment := range allComments.ReviewComments {
-			contextParts = append(contextParts, fmt.Sprintf("**%s** (文件: %s): %s", 
-				comment.User.GetLogin(), comment.GetPath(), comment.GetBody()))
-		}
-	}
-	
-	return strings.Join(contextParts, "\n\n")
+// buildPrompt 使用 pr_command 模板构建不同模式的prompt，历史上下文中不包含当前评论
+func (th *TagHandler) buildPrompt(ctx context.Context, pr *github.PullRequest, mode string, args string, allComments *models.PRAllComments, currentCommentID int64) (string, error) {
+	repo := pr.GetBase().GetRepo()
+	repoConfig := th.repoConfigs.Get(ctx, repo.GetOwner().GetLogin(), repo.GetName())
+	return th.prompts.Render(prompt.PRCommand, prompt.Data{
+		Mode:     mode,
+		Args:     args,
+		PR:       prompt.NewPullRequest(pr),
+		History:  prompt.FormatHistory(allComments, currentCommentID, th.prompts.Messages(repoConfig)),
+		Comments: prompt.NewComments(allComments, currentCommentID),
+	}, repoConfig)
 }
 
 // addPRCommentWithMCP 使用MCP工具添加PR评论
@@ -0,0 +1,56 @@
+package modes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSuggester 记录收到的 /suggest 请求
+type fakeSuggester struct {
+	events   []*github.PullRequestReviewCommentEvent
+	aiModels []string
+	args     []string
+}
+
+func (f *fakeSuggester) SuggestPRFromReviewCommentWithAI(ctx context.Context, event *github.PullRequestReviewCommentEvent, aiModel, args string) error {
+	f.events = append(f.events, event)
+	f.aiModels = append(f.aiModels, aiModel)
+	f.args = append(f.args, args)
+	return nil
+}
+
+func TestTagHandler_ExecuteSuggestFromReviewComment(t *testing.T) {
+	suggester := &fakeSuggester{}
+	handler := NewTagHandler(nil, nil, nil, nil, nil, nil, suggester)
+
+	comment := &github.PullRequestComment{
+		Body: github.String("/suggest -gemini use a constant"),
+		Path: github.String("main.go"),
+		Line: github.Int(12),
+	}
+	raw := &github.PullRequestReviewCommentEvent{
+		Action:  github.String("created"),
+		Comment: comment,
+	}
+	event := &models.PullRequestReviewCommentContext{
+		BaseContext: models.BaseContext{
+			Type:       models.EventPullRequestReviewComment,
+			Repository: &github.Repository{Name: github.String("repo"), Owner: &github.User{Login: github.String("org")}},
+			RawEvent:   raw,
+		},
+		PullRequest: &github.PullRequest{Number: github.Int(1)},
+		Comment:     comment,
+	}
+
+	require.NoError(t, handler.Execute(context.Background(), event))
+	require.Len(t, suggester.events, 1)
+	assert.Same(t, raw, suggester.events[0])
+	assert.Equal(t, "gemini", suggester.aiModels[0])
+	assert.Equal(t, "use a constant", suggester.args[0])
+}
@@ -0,0 +1,119 @@
+package permission
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/qiniu/codeagent/internal/config"
+	ghclient "github.com/qiniu/codeagent/internal/github"
+)
+
+// levels 仓库权限，从低到高排列
+var levels = []string{"read", "triage", "write", "maintain", "admin"}
+
+// Levels 返回可以配置的仓库权限
+func Levels() []string {
+	return slices.Clone(levels)
+}
+
+// ValidLevel 判断是否为可以配置的仓库权限
+func ValidLevel(level string) bool {
+	return slices.Contains(levels, level)
+}
+
+// githubAPI 检查权限需要的 GitHub 接口
+type githubAPI interface {
+	GetPermissionLevel(ctx context.Context, owner, repo, user string) (string, error)
+	IsTeamMember(ctx context.Context, org, team, user string) (bool, error)
+}
+
+// DeniedError 用户没有触发命令的权限
+type DeniedError struct {
+	User   string
+	Reason string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("%s is not allowed to trigger commands: %s", e.User, e.Reason)
+}
+
+// Checker 检查用户是否可以在仓库中触发命令
+type Checker struct {
+	cfg    config.PermissionConfig
+	github githubAPI
+}
+
+// NewChecker 创建权限检查
+func NewChecker(cfg config.PermissionConfig, github *ghclient.Client) *Checker {
+	return newChecker(cfg, github)
+}
+
+func newChecker(cfg config.PermissionConfig, github githubAPI) *Checker {
+	if cfg.MinPermission == "" {
+		cfg.MinPermission = "write"
+	}
+	return &Checker{cfg: cfg, github: github}
+}
+
+// Check 检查 user 是否可以在 owner/repo 中触发命令，依次检查：禁止列表、允许列表、仓库权限。
+// 没有权限时返回 *DeniedError，无法查询权限时返回其他错误。Checker 为 nil 时不做限制
+func (c *Checker) Check(ctx context.Context, owner, repo, user string) error {
+	if c == nil {
+		return nil
+	}
+	if user == "" {
+		return &DeniedError{Reason: "unknown sender"}
+	}
+
+	if containsUser(c.cfg.DenyUsers, user) {
+		return &DeniedError{User: user, Reason: "user is in deny_users"}
+	}
+	if team, err := c.memberOf(ctx, c.cfg.DenyTeams, owner, user); err != nil {
+		return err
+	} else if team != "" {
+		return &DeniedError{User: user, Reason: "member of denied team " + team}
+	}
+
+	if containsUser(c.cfg.AllowUsers, user) {
+		return nil
+	}
+	if team, err := c.memberOf(ctx, c.cfg.AllowTeams, owner, user); err != nil {
+		return err
+	} else if team != "" {
+		return nil
+	}
+
+	level, err := c.github.GetPermissionLevel(ctx, owner, repo, user)
+	if err != nil {
+		return err
+	}
+	if slices.Index(levels, level) < slices.Index(levels, c.cfg.MinPermission) {
+		return &DeniedError{User: user, Reason: fmt.Sprintf("has %s permission on %s/%s, %s required", level, owner, repo, c.cfg.MinPermission)}
+	}
+	return nil
+}
+
+// memberOf 返回 user 所属的第一个团队，团队格式为 org/team-slug，省略 org 时为仓库所属组织
+func (c *Checker) memberOf(ctx context.Context, teams []string, owner, user string) (string, error) {
+	for _, team := range teams {
+		org, slug, ok := strings.Cut(team, "/")
+		if !ok {
+			org, slug = owner, team
+		}
+		member, err := c.github.IsTeamMember(ctx, org, slug, user)
+		if err != nil {
+			return "", err
+		}
+		if member {
+			return org + "/" + slug, nil
+		}
+	}
+	return "", nil
+}
+
+// containsUser GitHub 用户名不区分大小写
+func containsUser(users []string, user string) bool {
+	return slices.ContainsFunc(users, func(u string) bool { return strings.EqualFold(u, user) })
+}
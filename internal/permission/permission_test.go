@@ -0,0 +1,115 @@
+package permission
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/qiniu/codeagent/internal/config"
+)
+
+type fakeGitHub struct {
+	levels map[string]string // user -> 仓库权限
+	teams  map[string][]string
+	err    error
+}
+
+func (f *fakeGitHub) GetPermissionLevel(ctx context.Context, owner, repo, user string) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	if level, ok := f.levels[user]; ok {
+		return level, nil
+	}
+	return "none", nil
+}
+
+func (f *fakeGitHub) IsTeamMember(ctx context.Context, org, team, user string) (bool, error) {
+	for _, member := range f.teams[org+"/"+team] {
+		if member == user {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestCheck(t *testing.T) {
+	github := &fakeGitHub{
+		levels: map[string]string{
+			"maintainer": "maintain",
+			"writer":     "write",
+			"triager":    "triage",
+			"reader":     "read",
+			"banned":     "admin",
+			"contractor": "write",
+		},
+		teams: map[string][]string{
+			"org/ai-users":    {"outsider"},
+			"org/contractors": {"contractor"},
+		},
+	}
+	checker := newChecker(config.PermissionConfig{
+		AllowUsers: []string{"Friend"},
+		AllowTeams: []string{"ai-users"},
+		DenyUsers:  []string{"banned"},
+		DenyTeams:  []string{"org/contractors"},
+	}, github)
+
+	tests := []struct {
+		user    string
+		allowed bool
+	}{
+		{"maintainer", true},
+		{"writer", true},
+		{"triager", false},
+		{"reader", false},
+		{"stranger", false},
+		{"friend", true},      // 允许列表不区分大小写
+		{"outsider", true},    // 允许的团队成员
+		{"banned", false},     // 禁止列表优先于仓库权限
+		{"contractor", false}, // 禁止的团队优先于仓库权限
+		{"", false},
+	}
+	for _, tt := range tests {
+		err := checker.Check(context.Background(), "org", "repo", tt.user)
+		var denied *DeniedError
+		if tt.allowed && err != nil {
+			t.Errorf("Expected %q to be allowed, got %v", tt.user, err)
+		}
+		if !tt.allowed && !errors.As(err, &denied) {
+			t.Errorf("Expected %q to be denied, got %v", tt.user, err)
+		}
+	}
+}
+
+func TestCheckMinPermission(t *testing.T) {
+	github := &fakeGitHub{levels: map[string]string{"triager": "triage", "writer": "write"}}
+	checker := newChecker(config.PermissionConfig{MinPermission: "maintain"}, github)
+
+	if err := checker.Check(context.Background(), "org", "repo", "writer"); err == nil {
+		t.Error("Expected write permission to be denied when maintain is required")
+	}
+
+	checker = newChecker(config.PermissionConfig{MinPermission: "triage"}, github)
+	if err := checker.Check(context.Background(), "org", "repo", "triager"); err != nil {
+		t.Errorf("Expected triage permission to be allowed, got %v", err)
+	}
+}
+
+func TestCheckAPIError(t *testing.T) {
+	github := &fakeGitHub{err: errors.New("rate limited")}
+	checker := newChecker(config.PermissionConfig{}, github)
+
+	err := checker.Check(context.Background(), "org", "repo", "writer")
+	var denied *DeniedError
+	if err == nil || errors.As(err, &denied) {
+		t.Errorf("Expected API error, got %v", err)
+	}
+}
+
+func TestNilChecker(t *testing.T) {
+	var checker *Checker
+	if err := checker.Check(context.Background(), "org", "repo", "anyone"); err != nil {
+		t.Errorf("Expected nil checker to allow everyone, got %v", err)
+	}
+}
@@ -0,0 +1,409 @@
+// Package prompt 渲染发送给 AI 的提示词。
+//
+// 提示词使用 text/template 编写，每种语言内置一套默认模板，服务端可以通过 prompts.dir 覆盖，
+// 仓库可以通过 .codeagent.yaml 的 prompts 再次覆盖。模板中可以使用 Data 的字段，
+// 以及 lower（转小写）和 add（整数相加）两个函数。
+package prompt
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/internal/locale"
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/google/go-github/v58/github"
+)
+
+// 模板名称，同时是模板文件名（{name}.tmpl）和 .codeagent.yaml 中 prompts 的 key
+const (
+	// IssueCode Issue 中的 /code 命令，以及自动处理的 Issue
+	IssueCode = "issue_code"
+	// PRCommand PR 评论中的 /continue、/fix 命令
+	PRCommand = "pr_command"
+	// ReviewComment 代码行评论中的 /continue、/fix 命令
+	ReviewComment = "review_comment"
+	// ReviewBatch PR Review 中的 /continue、/fix 命令，批量处理 Review 的所有代码行评论
+	ReviewBatch = "review_batch"
+	// Suggest 代码行评论中的 /suggest 命令
+	Suggest = "suggest"
+	// PRReview PR 的自动审查，要求 AI 以 JSON 返回总结和行内意见
+	PRReview = "pr_review"
+	// PushAnalysis 推送后分析，要求 AI 以 JSON 返回发现的问题
+	PushAnalysis = "push_analysis"
+)
+
+var names = []string{IssueCode, PRCommand, ReviewComment, ReviewBatch, Suggest, PRReview, PushAnalysis}
+
+//go:embed templates/*/*.tmpl
+var defaultFS embed.FS
+
+var funcs = template.FuncMap{
+	"lower": strings.ToLower,
+	"add":   func(a, b int) int { return a + b },
+}
+
+// Data 渲染模板时可以使用的数据，与模板无关的字段为零值
+type Data struct {
+	// 命令模式：Continue 或 Fix，issue_code 中为空
+	Mode string
+	// 命令后附加的指令，例如 "/fix 处理空指针" 中的 "处理空指针"
+	Args string
+	// 需要处理的 Issue（issue_code）
+	Issue Issue
+	// 命令所在的 PR（pr_command、review_comment、review_batch）
+	PR PullRequest
+	// PR 描述和历史评论格式化后的 Markdown（pr_command），不包含触发命令的评论
+	History string
+	// 历史评论（pr_command），不包含触发命令的评论
+	Comments []Comment
+	// 触发命令的代码行评论（review_comment、suggest）
+	ReviewComment Comment
+	// 触发命令的 PR Review（review_batch）
+	Review Review
+	// 需要审查或分析的 diff（pr_review、push_analysis）
+	Diff string
+	// Diff 过长时被截断，其余变更由 AI 在工作空间中查看
+	DiffTruncated bool
+	// 上次审查的提交（pr_review），非空时 Diff 只包含之后的新变更
+	ReviewedSHA string
+	// 推送的分支和提交（push_analysis）
+	Push Push
+	// PR 描述中各部分的标题，CodeAgent 按这些标题从 AI 输出中提取 PR 描述
+	Sections Sections
+}
+
+// Issue Issue 信息
+type Issue struct {
+	Number int
+	Title  string
+	Body   string
+}
+
+// PullRequest PR 信息
+type PullRequest struct {
+	Number int
+	Title  string
+	Body   string
+	// 源分支和目标分支
+	Head string
+	Base string
+}
+
+// Comment 评论，一般评论的 Path 和行号为空
+type Comment struct {
+	Author string
+	Body   string
+	// 代码行评论所在的文件
+	Path string
+	// 多行评论的起始行，单行评论为 0
+	StartLine int
+	// 评论的（结束）行号
+	Line      int
+	CreatedAt time.Time
+}
+
+// Review PR Review 的总体说明和其中的代码行评论
+type Review struct {
+	Body     string
+	Comments []Comment
+}
+
+// Push 推送的分支和提交
+type Push struct {
+	Branch string
+	// 推送前后的提交
+	Before string
+	After  string
+	// 推送的提交，SHA 为缩写，Message 只包含第一行
+	Commits []Commit
+}
+
+// Commit 提交信息
+type Commit struct {
+	SHA     string
+	Message string
+}
+
+// Sections PR 描述中各部分的标题
+type Sections struct {
+	Summary  string
+	Changes  string
+	TestPlan string
+}
+
+// IsRange 评论是否选择了多行
+func (c Comment) IsRange() bool {
+	return c.StartLine != 0 && c.Line != 0 && c.StartLine != c.Line
+}
+
+// Lines 评论的行号，多行评论为 "起始行-结束行"
+func (c Comment) Lines() string {
+	if c.IsRange() {
+		return fmt.Sprintf("%d-%d", c.StartLine, c.Line)
+	}
+	return fmt.Sprintf("%d", c.Line)
+}
+
+// NewIssue 从 GitHub Issue 构建模板数据
+func NewIssue(issue *github.Issue) Issue {
+	return Issue{Number: issue.GetNumber(), Title: issue.GetTitle(), Body: issue.GetBody()}
+}
+
+// NewPullRequest 从 GitHub PR 构建模板数据
+func NewPullRequest(pr *github.PullRequest) PullRequest {
+	return PullRequest{
+		Number: pr.GetNumber(),
+		Title:  pr.GetTitle(),
+		Body:   pr.GetBody(),
+		Head:   pr.GetHead().GetRef(),
+		Base:   pr.GetBase().GetRef(),
+	}
+}
+
+// NewReviewComment 从 GitHub 代码行评论构建模板数据
+func NewReviewComment(comment *github.PullRequestComment) Comment {
+	return Comment{
+		Author:    comment.GetUser().GetLogin(),
+		Body:      comment.GetBody(),
+		Path:      comment.GetPath(),
+		StartLine: comment.GetStartLine(),
+		Line:      comment.GetLine(),
+		CreatedAt: comment.GetCreatedAt().Time,
+	}
+}
+
+// NewComments 返回 PR 的一般评论和代码行评论，排除 ID 为 currentCommentID 的评论
+func NewComments(all *models.PRAllComments, currentCommentID int64) []Comment {
+	if all == nil {
+		return nil
+	}
+	var comments []Comment
+	for _, c := range all.IssueComments {
+		if c.GetID() == currentCommentID {
+			continue
+		}
+		comments = append(comments, Comment{
+			Author:    c.GetUser().GetLogin(),
+			Body:      c.GetBody(),
+			CreatedAt: c.GetCreatedAt().Time,
+		})
+	}
+	for _, c := range all.ReviewComments {
+		if c.GetID() == currentCommentID {
+			continue
+		}
+		comments = append(comments, NewReviewComment(c))
+	}
+	return comments
+}
+
+// FormatHistory 将 PR 描述、历史评论、代码行评论和 Review 格式化为 Markdown，排除 ID 为 currentCommentID 的评论
+func FormatHistory(allComments *models.PRAllComments, currentCommentID int64, msgs *locale.Messages) string {
+	if allComments == nil {
+		return ""
+	}
+	var contextParts []string
+
+	// 添加 PR 描述
+	if allComments.PRBody != "" {
+		contextParts = append(contextParts, fmt.Sprintf("%s\n%s", msgs.HistoryDescription, allComments.PRBody))
+	}
+
+	// 添加历史的一般评论（排除当前评论）
+	var historyComments []string
+	for _, comment := range allComments.IssueComments {
+		if comment.GetID() != currentCommentID {
+			user := comment.GetUser().GetLogin()
+			createdAt := comment.GetCreatedAt().Format("2006-01-02 15:04:05")
+			historyComments = append(historyComments, fmt.Sprintf("**%s** (%s):\n%s", user, createdAt, comment.GetBody()))
+		}
+	}
+	if len(historyComments) > 0 {
+		contextParts = append(contextParts, fmt.Sprintf("%s\n%s", msgs.HistoryComments, strings.Join(historyComments, "\n\n")))
+	}
+
+	// 添加代码行评论
+	var reviewComments []string
+	for _, comment := range allComments.ReviewComments {
+		if comment.GetID() != currentCommentID {
+			user := comment.GetUser().GetLogin()
+			createdAt := comment.GetCreatedAt().Format("2006-01-02 15:04:05")
+			reviewComments = append(reviewComments, fmt.Sprintf("**%s** (%s) - %s:%d:\n%s", user, createdAt, comment.GetPath(), comment.GetLine(), comment.GetBody()))
+		}
+	}
+	if len(reviewComments) > 0 {
+		contextParts = append(contextParts, fmt.Sprintf("%s\n%s", msgs.HistoryReviewComments, strings.Join(reviewComments, "\n\n")))
+	}
+
+	// 添加 Review 评论
+	var reviews []string
+	for _, review := range allComments.Reviews {
+		if review.GetBody() != "" {
+			user := review.GetUser().GetLogin()
+			createdAt := review.GetSubmittedAt().Format("2006-01-02 15:04:05")
+			reviews = append(reviews, fmt.Sprintf("**%s** (%s) - %s:\n%s", user, createdAt, review.GetState(), review.GetBody()))
+		}
+	}
+	if len(reviews) > 0 {
+		contextParts = append(contextParts, fmt.Sprintf("%s\n%s", msgs.HistoryReviews, strings.Join(reviews, "\n\n")))
+	}
+
+	return strings.Join(contextParts, "\n\n")
+}
+
+// Templates 服务端使用的提示词模板
+type Templates struct {
+	// 服务端配置的语言，仓库没有配置语言时使用
+	locale string
+	// prompts.dir 中覆盖内置模板的模板，适用于所有语言
+	overrides map[string]*template.Template
+}
+
+// builtin 各语言的内置模板，语言 -> 模板名称 -> 模板
+var builtin = mustLoadBuiltin()
+
+func mustLoadBuiltin() map[string]map[string]*template.Template {
+	builtin := make(map[string]map[string]*template.Template)
+	for _, lang := range locale.Names() {
+		builtin[lang] = make(map[string]*template.Template, len(names))
+		for _, name := range names {
+			text, err := defaultFS.ReadFile("templates/" + lang + "/" + name + ".tmpl")
+			if err != nil {
+				panic(err)
+			}
+			builtin[lang][name] = template.Must(parse(name, string(text)))
+		}
+	}
+	return builtin
+}
+
+// Load 加载提示词模板，dir 中的 {name}.tmpl 覆盖同名的内置模板，dir 为空时只使用内置模板；
+// defaultLocale 为服务端配置的语言
+func Load(dir, defaultLocale string) (*Templates, error) {
+	if defaultLocale != "" && !locale.Supported(defaultLocale) {
+		return nil, fmt.Errorf("unsupported locale: %s (available: %s)", defaultLocale, strings.Join(locale.Names(), ", "))
+	}
+	t := &Templates{locale: defaultLocale, overrides: make(map[string]*template.Template)}
+	if dir == "" {
+		return t, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompts directory: %w", err)
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".tmpl")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		text, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt template: %w", err)
+		}
+		tmpl, err := validate(name, string(text))
+		if err != nil {
+			return nil, err
+		}
+		t.overrides[name] = tmpl
+	}
+	return t, nil
+}
+
+// Messages 返回仓库使用的语言的文本，仓库级配置优先于服务端配置。Templates 为 nil 时使用默认语言
+func (t *Templates) Messages(repoConfig *config.RepoConfig) *locale.Messages {
+	def := ""
+	if t != nil {
+		def = t.locale
+	}
+	return locale.Get(repoConfig.Language(def))
+}
+
+// Validate 检查模板名称和内容，模板会使用示例数据执行一次以发现不存在的字段
+func Validate(name, text string) error {
+	_, err := validate(name, text)
+	return err
+}
+
+func validate(name, text string) (*template.Template, error) {
+	if _, ok := builtin[locale.Default][name]; !ok {
+		return nil, fmt.Errorf("unknown prompt template: %s (available: %s)", name, strings.Join(names, ", "))
+	}
+	tmpl, err := parse(name, text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, sampleData); err != nil {
+		return nil, fmt.Errorf("invalid prompt template %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+func parse(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt template %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// Render 使用仓库的语言渲染提示词：仓库级配置中的模板优先于服务端模板，服务端模板优先于内置模板，
+// 最后追加仓库说明。Templates 为 nil 时使用内置模板
+func (t *Templates) Render(name string, data Data, repoConfig *config.RepoConfig) (string, error) {
+	msgs := t.Messages(repoConfig)
+	tmpl, ok := builtin[msgs.Name][name]
+	if !ok {
+		return "", fmt.Errorf("unknown prompt template: %s", name)
+	}
+	if t != nil && t.overrides[name] != nil {
+		tmpl = t.overrides[name]
+	}
+	if text, ok := repoConfig.Prompt(name); ok {
+		repoTmpl, err := parse(name, text)
+		if err != nil {
+			return "", fmt.Errorf("failed to use prompt template from %s: %w", config.RepoConfigFile, err)
+		}
+		tmpl = repoTmpl
+	}
+
+	data.Sections = Sections{
+		Summary:  msgs.SectionSummary,
+		Changes:  msgs.SectionChanges,
+		TestPlan: msgs.SectionTestPlan,
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %s: %w", name, err)
+	}
+	prompt := strings.TrimSpace(buf.String())
+	if prompt == "" {
+		return "", fmt.Errorf("prompt template %s rendered an empty prompt", name)
+	}
+	return repoConfig.AppendInstructions(prompt, msgs.RepoInstructions), nil
+}
+
+// sampleData 校验模板时使用的示例数据，尽量让模板的各个分支都能执行到
+var sampleData = Data{
+	Mode:          "Fix",
+	Args:          "args",
+	Issue:         Issue{Number: 1, Title: "title", Body: "body"},
+	PR:            PullRequest{Number: 2, Title: "title", Body: "body", Head: "feature", Base: "main"},
+	History:       "history",
+	Comments:      []Comment{{Author: "user", Body: "comment", Path: "main.go", StartLine: 1, Line: 2}},
+	ReviewComment: Comment{Author: "user", Body: "comment", Path: "main.go", StartLine: 1, Line: 2},
+	Review:        Review{Body: "review", Comments: []Comment{{Author: "user", Body: "comment", Path: "main.go", Line: 2}}},
+	Diff:          "diff",
+	DiffTruncated: true,
+	ReviewedSHA:   "abc1234",
+	Push:          Push{Branch: "main", Before: "before", After: "after", Commits: []Commit{{SHA: "abc1234", Message: "message"}}},
+	Sections:      Sections{Summary: models.SectionSummary, Changes: models.SectionChanges, TestPlan: models.SectionTestPlan},
+}
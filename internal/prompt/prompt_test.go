@@ -0,0 +1,176 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/internal/locale"
+)
+
+func TestRenderDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		data     Data
+		expected string
+	}{
+		{
+			name:     "issue code",
+			template: IssueCode,
+			data:     Data{Issue: Issue{Title: "Add cache", Body: "Cache results"}},
+			expected: "根据Issue修改代码：\n\n标题：Add cache\n描述：Cache results\n\n输出格式：\n## 改动摘要\n简要说明改动内容\n\n## 具体改动\n- 列出修改的文件和具体变动",
+		},
+		{
+			name:     "pr command without context",
+			template: PRCommand,
+			data:     Data{Mode: "Fix"},
+			expected: "分析并修复代码问题",
+		},
+		{
+			name:     "pr command with args",
+			template: PRCommand,
+			data:     Data{Mode: "Continue", Args: "add tests"},
+			expected: "根据指令continue：\n\nadd tests",
+		},
+		{
+			name:     "pr command with history",
+			template: PRCommand,
+			data:     Data{Mode: "Continue", History: "## PR 描述\nbody"},
+			expected: "作为PR代码审查助手，请基于以下完整上下文来continue：\n\n## PR 描述\nbody\n\n## 任务\n继续处理PR，分析代码变更并改进\n\n请根据上述PR描述和历史讨论，进行相应的代码修改和改进。",
+		},
+		{
+			name:     "pr command with history and args",
+			template: PRCommand,
+			data:     Data{Mode: "Fix", Args: "handle nil", History: "## PR 描述\nbody"},
+			expected: "作为PR代码审查助手，请基于以下完整上下文来fix：\n\n## PR 描述\nbody\n\n## 当前指令\nhandle nil\n\n请根据上述PR描述、历史讨论和当前指令，进行相应的代码修复。\n\n注意：\n1. 当前指令是主要任务，历史信息仅作为上下文参考\n2. 请确保修改符合PR的整体目标和已有的讨论共识\n3. 如果发现与历史讨论有冲突，请优先执行当前指令并在回复中说明",
+		},
+		{
+			name:     "review comment",
+			template: ReviewComment,
+			data:     Data{Mode: "Fix", Args: "use a constant", ReviewComment: Comment{Body: "magic number", Path: "main.go", StartLine: 10, Line: 12}},
+			expected: "根据代码行评论和指令修复：\n\n代码行评论：magic number\n文件：main.go\n行号范围：10-12\n\n指令：use a constant",
+		},
+		{
+			name:     "review batch",
+			template: ReviewBatch,
+			data:     Data{Mode: "Continue", Review: Review{Body: "see comments", Comments: []Comment{{Body: "rename", Path: "a.go", Line: 3}}}},
+			expected: "请根据以下 PR Review 的批量评论继续处理代码：\n\nReview 总体说明：see comments\n\n评论 1：\n文件：a.go\n行号：3\n内容：rename\n\n请一次性处理所有评论中提到的问题，回复要简洁明了。",
+		},
+		{
+			name:     "suggest",
+			template: Suggest,
+			data:     Data{Args: "use a constant", ReviewComment: Comment{Body: "magic number", Path: "main.go", Line: 12}},
+			expected: "根据代码行评论修改代码：\n\n代码行评论：magic number\n文件：main.go\n行号：12\n\n只修改该文件第 12 行的代码，不要修改其他行或其他文件，不要提交改动。\n\n指令：use a constant",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (*Templates)(nil).Render(tt.template, tt.data, nil)
+			if err != nil {
+				t.Fatalf("Render() error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Render() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRenderLocale(t *testing.T) {
+	templates, err := Load("", locale.English)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	data := Data{Issue: Issue{Title: "Add cache", Body: "Cache results"}}
+
+	// 服务端配置的语言
+	expected := "Modify the code to resolve the issue:\n\nTitle: Add cache\nDescription: Cache results\n\nOutput format:\n## Summary\nA brief description of the changes\n\n## Changes\n- List the modified files and what changed in each"
+	if got, _ := templates.Render(IssueCode, data, nil); got != expected {
+		t.Errorf("Render() = %q, want %q", got, expected)
+	}
+
+	// 仓库级配置的语言优先
+	rc := &config.RepoConfig{Locale: locale.Chinese}
+	if got, _ := templates.Render(PRCommand, Data{Mode: "Fix"}, rc); got != "分析并修复代码问题" {
+		t.Errorf("Unexpected repo locale output: %q", got)
+	}
+	if got := templates.Messages(rc).Name; got != locale.Chinese {
+		t.Errorf("Messages() = %q, want %q", got, locale.Chinese)
+	}
+
+	// 仓库说明的标题使用仓库的语言
+	rc = &config.RepoConfig{Instructions: "Run make test.", Prompts: map[string]string{PRCommand: "Fix it"}}
+	if got, _ := templates.Render(PRCommand, Data{Mode: "Fix"}, rc); got != "Fix it\n\n## Repository instructions\nRun make test." {
+		t.Errorf("Unexpected instructions heading: %q", got)
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, IssueCode+".tmpl"), []byte("Implement #{{.Issue.Number}}: {{.Issue.Title}}\n"), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	templates, err := Load(dir, "")
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	data := Data{Issue: Issue{Number: 7, Title: "Add cache"}}
+
+	// 服务端模板覆盖内置模板，未覆盖的模板保持不变
+	if got, _ := templates.Render(IssueCode, data, nil); got != "Implement #7: Add cache" {
+		t.Errorf("Unexpected server template output: %q", got)
+	}
+	if got, _ := templates.Render(PRCommand, Data{Mode: "Fix"}, nil); got != "分析并修复代码问题" {
+		t.Errorf("Unexpected default template output: %q", got)
+	}
+
+	// 仓库级模板优先，并追加仓库说明
+	rc := &config.RepoConfig{
+		Prompts:      map[string]string{IssueCode: "Fix {{.Issue.Title}}"},
+		Instructions: "Run make test.",
+	}
+	if got, _ := templates.Render(IssueCode, data, rc); got != "Fix Add cache\n\n## 仓库说明\nRun make test." {
+		t.Errorf("Unexpected repo template output: %q", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		text     string
+		errorMsg string
+	}{
+		{"valid", IssueCode, "{{.Issue.Title}} {{range .Comments}}{{.Author}}{{end}}", ""},
+		{"unknown template", "issue", "{{.Issue.Title}}", "unknown prompt template"},
+		{"syntax error", IssueCode, "{{.Issue.Title", "failed to parse"},
+		{"unknown field", IssueCode, "{{.Issue.Name}}", "invalid prompt template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.template, tt.text)
+			if tt.errorMsg == "" {
+				if err != nil {
+					t.Errorf("Validate() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.errorMsg)
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing"), ""); err == nil {
+		t.Error("Expected error for missing prompts directory")
+	}
+	if _, err := Load("", "fr"); err == nil {
+		t.Error("Expected error for unsupported locale")
+	}
+}
@@ -0,0 +1,392 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qiniu/x/log"
+)
+
+// Status 任务状态
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+var (
+	// ErrClosed 队列已关闭
+	ErrClosed = errors.New("queue closed")
+	// ErrCancelled 任务被用户取消，Complete 时任务会被标记为 cancelled
+	ErrCancelled = errors.New("job cancelled")
+)
+
+// Job 持久化的任务
+type Job struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	TraceID   string          `json:"trace_id"`
+	Payload   json.RawMessage `json:"payload"`
+	Status    Status          `json:"status"`
+	Attempts  int             `json:"attempts"`
+	Error     string          `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Finished 任务是否已结束
+func (j *Job) Finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed || j.Status == StatusCancelled
+}
+
+// Queue 基于本地磁盘的任务队列，每个任务对应目录下的一个 JSON 文件
+type Queue struct {
+	mu          sync.Mutex
+	dir         string
+	maxAttempts int
+	jobs        map[string]*Job
+	pending     []string
+	notify      chan struct{}
+	closed      bool
+}
+
+// New 打开（或创建）任务队列，并恢复上次退出前未完成的任务
+func New(dir string, maxAttempts int) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	q := &Queue{
+		dir:         dir,
+		maxAttempts: maxAttempts,
+		jobs:        make(map[string]*Job),
+		notify:      make(chan struct{}, 1),
+	}
+	if err := q.recover(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// recover 加载磁盘上的任务：排队中的任务重新入队，
+// 运行中的任务说明进程在执行过程中退出，未超过重试次数则恢复执行，否则标记失败
+func (q *Queue) recover() error {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read queue directory: %w", err)
+	}
+
+	var pending []*Job
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		path := filepath.Join(q.dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Warnf("Failed to read job file %s: %v", path, err)
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			log.Warnf("Failed to parse job file %s: %v", path, err)
+			continue
+		}
+
+		switch job.Status {
+		case StatusRunning:
+			if job.Attempts >= q.maxAttempts {
+				job.Status = StatusFailed
+				job.Error = "interrupted by server restart"
+				log.Warnf("Job %s (%s) was interrupted and exceeded max attempts, marking as failed", job.ID, job.Type)
+			} else {
+				job.Status = StatusQueued
+				log.Infof("Resuming interrupted job %s (%s), attempts: %d", job.ID, job.Type, job.Attempts)
+			}
+			job.UpdatedAt = time.Now()
+			if err := q.save(&job); err != nil {
+				return err
+			}
+		case StatusQueued:
+			log.Infof("Recovered queued job %s (%s)", job.ID, job.Type)
+		}
+
+		q.jobs[job.ID] = &job
+		if job.Status == StatusQueued {
+			pending = append(pending, &job)
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+	for _, job := range pending {
+		q.pending = append(q.pending, job.ID)
+	}
+	if len(q.pending) > 0 {
+		q.signal()
+	}
+	return nil
+}
+
+// Enqueue 创建一个新任务并持久化
+func (q *Queue) Enqueue(jobType, traceID string, payload interface{}) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job payload: %w", err)
+	}
+
+	now := time.Now()
+	job := &Job{
+		ID:        newJobID(now),
+		Type:      jobType,
+		TraceID:   traceID,
+		Payload:   data,
+		Status:    StatusQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil, ErrClosed
+	}
+	if err := q.save(job); err != nil {
+		return nil, err
+	}
+	q.jobs[job.ID] = job
+	q.pending = append(q.pending, job.ID)
+	q.signal()
+	return job.clone(), nil
+}
+
+// Dequeue 阻塞直到取到一个任务，取到的任务被标记为 running
+func (q *Queue) Dequeue(ctx context.Context) (*Job, error) {
+	return q.DequeueFunc(ctx, nil)
+}
+
+// DequeueFunc 按入队顺序取出第一个 accept 返回 true 的任务；
+// 被拒绝的任务留在队列中保持原有顺序，直到有新任务入队或调用 Wake 后重新检查。
+// accept 在队列锁内调用，不能再访问队列
+func (q *Queue) DequeueFunc(ctx context.Context, accept func(*Job) bool) (*Job, error) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return nil, ErrClosed
+		}
+		for i, id := range q.pending {
+			job := q.jobs[id]
+			if accept != nil && !accept(job.clone()) {
+				continue
+			}
+			q.pending = append(q.pending[:i:i], q.pending[i+1:]...)
+			job.Status = StatusRunning
+			job.Attempts++
+			job.UpdatedAt = time.Now()
+			err := q.save(job)
+			// 还有剩余任务时继续唤醒其他 worker
+			if len(q.pending) > 0 {
+				q.signal()
+			}
+			q.mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			return job.clone(), nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-q.notify:
+		}
+	}
+}
+
+// Wake 唤醒等待中的 DequeueFunc 重新检查被拒绝的任务，例如有任务结束释放了并发槽位
+func (q *Queue) Wake() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.closed && len(q.pending) > 0 {
+		q.signal()
+	}
+}
+
+// Pending 按排队顺序返回等待中的任务快照
+func (q *Queue) Pending() []*Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]*Job, 0, len(q.pending))
+	for _, id := range q.pending {
+		jobs = append(jobs, q.jobs[id].clone())
+	}
+	return jobs
+}
+
+// Cancel 取消排队中的任务，任务已被取出或已结束时返回 false
+func (q *Queue) Cancel(id string, reason error) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, pendingID := range q.pending {
+		if pendingID != id {
+			continue
+		}
+		q.pending = append(q.pending[:i:i], q.pending[i+1:]...)
+		job := q.jobs[id]
+		job.Status = StatusCancelled
+		job.Error = reason.Error()
+		job.UpdatedAt = time.Now()
+		return true, q.save(job)
+	}
+	return false, nil
+}
+
+// Complete 根据执行结果将任务标记为 succeeded、failed 或 cancelled
+func (q *Queue) Complete(id string, jobErr error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return fmt.Errorf("job %s not found", id)
+	}
+	if errors.Is(jobErr, ErrCancelled) {
+		job.Status = StatusCancelled
+		job.Error = jobErr.Error()
+	} else if jobErr != nil {
+		job.Status = StatusFailed
+		job.Error = jobErr.Error()
+	} else {
+		job.Status = StatusSucceeded
+		job.Error = ""
+	}
+	job.UpdatedAt = time.Now()
+	return q.save(job)
+}
+
+// Get 获取任务快照
+func (q *Queue) Get(id string) (*Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	return job.clone(), true
+}
+
+// List 按创建时间返回所有任务快照
+func (q *Queue) List() []*Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]*Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, job.clone())
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// Prune 删除结束时间早于 retention 的已完成任务，返回删除数量
+func (q *Queue) Prune(retention time.Duration) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cutoff := time.Now().Add(-retention)
+	removed := 0
+	for id, job := range q.jobs {
+		if !job.Finished() || job.UpdatedAt.After(cutoff) {
+			continue
+		}
+		if err := os.Remove(q.jobPath(id)); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Failed to remove job file for %s: %v", id, err)
+			continue
+		}
+		delete(q.jobs, id)
+		removed++
+	}
+	return removed
+}
+
+// Close 关闭队列，阻塞中的 Dequeue 会返回 ErrClosed
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return
+	}
+	q.closed = true
+	close(q.notify)
+}
+
+func (q *Queue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue) jobPath(id string) string {
+	return filepath.Join(q.dir, id+".json")
+}
+
+// save 先写临时文件再 rename，保证任务文件不会被写坏
+func (q *Queue) save(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	tmp := q.jobPath(job.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write job file: %w", err)
+	}
+	if err := os.Rename(tmp, q.jobPath(job.ID)); err != nil {
+		return fmt.Errorf("failed to persist job file: %w", err)
+	}
+	return nil
+}
+
+func (j *Job) clone() *Job {
+	c := *j
+	c.Payload = append(json.RawMessage(nil), j.Payload...)
+	return &c
+}
+
+func newJobID(now time.Time) string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", now.UnixNano())
+	}
+	return fmt.Sprintf("%d-%s", now.UnixNano(), hex.EncodeToString(b))
+}
@@ -0,0 +1,222 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPayload struct {
+	Command string `json:"command"`
+}
+
+func TestEnqueueDequeueComplete(t *testing.T) {
+	q, err := New(t.TempDir(), 3)
+	require.NoError(t, err)
+
+	job, err := q.Enqueue("issue_code", "abcd1234", testPayload{Command: "/code"})
+	require.NoError(t, err)
+	assert.Equal(t, StatusQueued, job.Status)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	got, err := q.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, job.ID, got.ID)
+	assert.Equal(t, StatusRunning, got.Status)
+	assert.Equal(t, 1, got.Attempts)
+	assert.Equal(t, "abcd1234", got.TraceID)
+
+	var payload testPayload
+	require.NoError(t, json.Unmarshal(got.Payload, &payload))
+	assert.Equal(t, "/code", payload.Command)
+
+	require.NoError(t, q.Complete(got.ID, nil))
+	done, ok := q.Get(got.ID)
+	require.True(t, ok)
+	assert.Equal(t, StatusSucceeded, done.Status)
+
+	failed, err := q.Enqueue("pr_fix", "", testPayload{})
+	require.NoError(t, err)
+	_, err = q.Dequeue(ctx)
+	require.NoError(t, err)
+	require.NoError(t, q.Complete(failed.ID, errors.New("boom")))
+	failed, _ = q.Get(failed.ID)
+	assert.Equal(t, StatusFailed, failed.Status)
+	assert.Equal(t, "boom", failed.Error)
+
+	cancelled, err := q.Enqueue("pr_fix", "", testPayload{})
+	require.NoError(t, err)
+	_, err = q.Dequeue(ctx)
+	require.NoError(t, err)
+	require.NoError(t, q.Complete(cancelled.ID, fmt.Errorf("aborted by user: %w", ErrCancelled)))
+	cancelled, _ = q.Get(cancelled.ID)
+	assert.Equal(t, StatusCancelled, cancelled.Status)
+	assert.True(t, cancelled.Finished())
+}
+
+func TestDequeueOrderAndCancel(t *testing.T) {
+	q, err := New(t.TempDir(), 3)
+	require.NoError(t, err)
+
+	first, _ := q.Enqueue("a", "", nil)
+	second, _ := q.Enqueue("b", "", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	got, err := q.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, got.ID)
+	got, err = q.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, got.ID)
+
+	emptyCtx, emptyCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer emptyCancel()
+	_, err = q.Dequeue(emptyCtx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	q.Close()
+	_, err = q.Dequeue(context.Background())
+	assert.ErrorIs(t, err, ErrClosed)
+	_, err = q.Enqueue("c", "", nil)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestDequeueFuncSkipsRejectedJobs(t *testing.T) {
+	q, err := New(t.TempDir(), 3)
+	require.NoError(t, err)
+
+	blocked, _ := q.Enqueue("busy", "", nil)
+	ready, _ := q.Enqueue("quiet", "", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	allowBusy := false
+	accept := func(job *Job) bool {
+		return job.Type != "busy" || allowBusy
+	}
+	got, err := q.DequeueFunc(ctx, accept)
+	require.NoError(t, err)
+	assert.Equal(t, ready.ID, got.ID)
+
+	pending := q.Pending()
+	require.Len(t, pending, 1)
+	assert.Equal(t, blocked.ID, pending[0].ID)
+
+	done := make(chan *Job, 1)
+	go func() {
+		job, err := q.DequeueFunc(ctx, accept)
+		if err == nil {
+			done <- job
+		}
+	}()
+	select {
+	case <-done:
+		t.Fatal("rejected job should stay in the queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	q.mu.Lock()
+	allowBusy = true
+	q.mu.Unlock()
+	q.Wake()
+	select {
+	case job := <-done:
+		assert.Equal(t, blocked.ID, job.ID)
+	case <-time.After(time.Second):
+		t.Fatal("job was not dequeued after Wake")
+	}
+	assert.Empty(t, q.Pending())
+}
+
+func TestCancelPendingJob(t *testing.T) {
+	q, err := New(t.TempDir(), 3)
+	require.NoError(t, err)
+
+	job, _ := q.Enqueue("a", "", nil)
+	ok, err := q.Cancel(job.ID, fmt.Errorf("cancelled by alice: %w", ErrCancelled))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, q.Pending())
+
+	cancelled, _ := q.Get(job.ID)
+	assert.Equal(t, StatusCancelled, cancelled.Status)
+	assert.Equal(t, "cancelled by alice: job cancelled", cancelled.Error)
+
+	running, _ := q.Enqueue("b", "", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = q.Dequeue(ctx)
+	require.NoError(t, err)
+	ok, err = q.Cancel(running.ID, ErrCancelled)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestRecoverAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	q, err := New(dir, 2)
+	require.NoError(t, err)
+
+	queued, _ := q.Enqueue("queued", "", nil)
+	interrupted, _ := q.Enqueue("interrupted", "", nil)
+	exhausted, _ := q.Enqueue("exhausted", "", nil)
+
+	ctx := context.Background()
+	// queued 仍在排队；interrupted 运行一次；exhausted 已运行到最大次数
+	q.mu.Lock()
+	q.pending = []string{queued.ID}
+	q.jobs[interrupted.ID].Status = StatusRunning
+	q.jobs[interrupted.ID].Attempts = 1
+	require.NoError(t, q.save(q.jobs[interrupted.ID]))
+	q.jobs[exhausted.ID].Status = StatusRunning
+	q.jobs[exhausted.ID].Attempts = 2
+	require.NoError(t, q.save(q.jobs[exhausted.ID]))
+	q.mu.Unlock()
+
+	// 模拟进程重启
+	restarted, err := New(dir, 2)
+	require.NoError(t, err)
+
+	job, ok := restarted.Get(exhausted.ID)
+	require.True(t, ok)
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.NotEmpty(t, job.Error)
+
+	dequeueCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	first, err := restarted.Dequeue(dequeueCtx)
+	require.NoError(t, err)
+	assert.Equal(t, queued.ID, first.ID)
+	second, err := restarted.Dequeue(dequeueCtx)
+	require.NoError(t, err)
+	assert.Equal(t, interrupted.ID, second.ID)
+	assert.Equal(t, 2, second.Attempts)
+}
+
+func TestPrune(t *testing.T) {
+	q, err := New(t.TempDir(), 1)
+	require.NoError(t, err)
+
+	done, _ := q.Enqueue("done", "", nil)
+	pending, _ := q.Enqueue("pending", "", nil)
+	require.NoError(t, q.Complete(done.ID, nil))
+
+	assert.Equal(t, 0, q.Prune(time.Hour))
+	assert.Equal(t, 1, q.Prune(0))
+
+	_, ok := q.Get(done.ID)
+	assert.False(t, ok)
+	_, ok = q.Get(pending.ID)
+	assert.True(t, ok)
+}
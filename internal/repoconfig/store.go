@@ -0,0 +1,126 @@
+package repoconfig
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/qiniu/codeagent/internal/code"
+	"github.com/qiniu/codeagent/internal/config"
+	ghclient "github.com/qiniu/codeagent/internal/github"
+	"github.com/qiniu/codeagent/internal/locale"
+	"github.com/qiniu/codeagent/internal/prompt"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/qiniu/x/xlog"
+)
+
+// cacheTTL 缓存的最长有效期，未订阅 push 事件时也能在一段时间后读取到新的配置
+const cacheTTL = time.Hour
+
+// fileGetter 读取仓库文件内容，文件不存在时返回 nil, nil
+type fileGetter interface {
+	GetFileContent(ctx context.Context, owner, repo, path, ref string) ([]byte, error)
+}
+
+type entry struct {
+	config    *config.RepoConfig
+	fetchedAt time.Time
+}
+
+// Store 缓存各仓库默认分支上的 .codeagent.yaml，推送到默认分支时失效
+type Store struct {
+	files fileGetter
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu    sync.Mutex
+	repos map[string]entry // org/repo -> 配置，仓库没有配置文件时为 nil
+}
+
+// NewStore 创建仓库级配置缓存
+func NewStore(github *ghclient.Client) *Store {
+	return newStore(github)
+}
+
+func newStore(files fileGetter) *Store {
+	return &Store{
+		files: files,
+		ttl:   cacheTTL,
+		now:   time.Now,
+		repos: make(map[string]entry),
+	}
+}
+
+// Get 返回仓库的配置，仓库没有配置文件、配置无效或读取失败时返回 nil（使用全局配置）。
+// Store 为 nil 时同样返回 nil
+func (s *Store) Get(ctx context.Context, owner, repo string) *config.RepoConfig {
+	if s == nil || owner == "" || repo == "" {
+		return nil
+	}
+	xl := xlog.NewWith(ctx)
+	key := owner + "/" + repo
+
+	s.mu.Lock()
+	e, ok := s.repos[key]
+	s.mu.Unlock()
+	if ok && s.now().Sub(e.fetchedAt) < s.ttl {
+		return e.config
+	}
+
+	data, err := s.files.GetFileContent(ctx, owner, repo, config.RepoConfigFile, "")
+	if err != nil {
+		// 读取失败时不缓存，下次重试
+		xl.Warnf("Failed to load %s for %s, using global config: %v", config.RepoConfigFile, key, err)
+		return nil
+	}
+
+	var rc *config.RepoConfig
+	if data != nil {
+		if rc, err = config.ParseRepoConfig(data); err != nil {
+			xl.Warnf("Invalid %s in %s, using global config: %v", config.RepoConfigFile, key, err)
+		} else {
+			dropUnsupported(xl, key, rc)
+			xl.Infof("Loaded %s for %s", config.RepoConfigFile, key)
+		}
+	}
+
+	s.mu.Lock()
+	s.repos[key] = entry{config: rc, fetchedAt: s.now()}
+	s.mu.Unlock()
+	return rc
+}
+
+// dropUnsupported 清除服务端不支持的配置项，这些配置项使用全局配置
+func dropUnsupported(xl *xlog.Logger, key string, rc *config.RepoConfig) {
+	if rc.CodeProvider != "" {
+		if _, ok := code.Lookup(rc.CodeProvider); !ok {
+			xl.Warnf("Unsupported code_provider %q in %s of %s, using global default", rc.CodeProvider, config.RepoConfigFile, key)
+			rc.CodeProvider = ""
+		}
+	}
+	if rc.Locale != "" && !locale.Supported(rc.Locale) {
+		xl.Warnf("Unsupported locale %q in %s of %s, using global default", rc.Locale, config.RepoConfigFile, key)
+		rc.Locale = ""
+	}
+	for name, text := range rc.Prompts {
+		if err := prompt.Validate(name, text); err != nil {
+			xl.Warnf("Ignoring prompt template in %s of %s: %v", config.RepoConfigFile, key, err)
+			delete(rc.Prompts, name)
+		}
+	}
+}
+
+// InvalidateOnPush 推送到默认分支时清除该仓库的缓存，下次使用时重新读取配置
+func (s *Store) InvalidateOnPush(event *github.PushEvent) {
+	if s == nil || event == nil {
+		return
+	}
+	repo := event.GetRepo()
+	if event.GetRef() != "refs/heads/"+repo.GetDefaultBranch() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.repos, repo.GetOwner().GetLogin()+"/"+repo.GetName())
+}
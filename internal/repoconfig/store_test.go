@@ -0,0 +1,117 @@
+package repoconfig
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFiles 模拟仓库文件，记录读取次数
+type fakeFiles struct {
+	files map[string]string // org/repo -> .codeagent.yaml 内容
+	err   error
+	calls int
+}
+
+func (f *fakeFiles) GetFileContent(ctx context.Context, owner, repo, path, ref string) ([]byte, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	content, ok := f.files[owner+"/"+repo]
+	if !ok {
+		return nil, nil
+	}
+	return []byte(content), nil
+}
+
+func TestStore_Get(t *testing.T) {
+	files := &fakeFiles{files: map[string]string{
+		"org/custom":  "code_provider: gemini\nmodes: [tag]\ninstructions: Run make lint before committing.\n",
+		"org/invalid": "modes: [everything]\n",
+		"org/unknown": "code_provider: nope\n",
+		"org/prompts": "prompts:\n  issue_code: 'Implement {{.Issue.Title}}'\n  pr_command: '{{.Issue.Name}}'\n",
+	}}
+	s := newStore(files)
+	ctx := context.Background()
+
+	rc := s.Get(ctx, "org", "custom")
+	require.NotNil(t, rc)
+	assert.Equal(t, "gemini", rc.Provider("claude"))
+	assert.True(t, rc.ModeEnabled("tag"))
+	assert.False(t, rc.ModeEnabled("review"))
+
+	// 缓存命中不再读取
+	s.Get(ctx, "org", "custom")
+	assert.Equal(t, 1, files.calls)
+
+	// 没有配置文件、配置无效时使用全局配置，结果同样被缓存
+	assert.Nil(t, s.Get(ctx, "org", "plain"))
+	assert.Nil(t, s.Get(ctx, "org", "invalid"))
+	s.Get(ctx, "org", "plain")
+	assert.Equal(t, 3, files.calls)
+
+	// 不支持的模型被忽略
+	assert.Equal(t, "claude", s.Get(ctx, "org", "unknown").Provider("claude"))
+
+	// 无效的提示词模板被忽略，其余模板仍然生效
+	rc = s.Get(ctx, "org", "prompts")
+	_, ok := rc.Prompt("issue_code")
+	assert.True(t, ok)
+	_, ok = rc.Prompt("pr_command")
+	assert.False(t, ok)
+
+	// nil Store 使用全局配置
+	var nilStore *Store
+	assert.Nil(t, nilStore.Get(ctx, "org", "custom"))
+}
+
+func TestStore_GetErrorIsNotCached(t *testing.T) {
+	files := &fakeFiles{err: errors.New("rate limited")}
+	s := newStore(files)
+
+	assert.Nil(t, s.Get(context.Background(), "org", "repo"))
+	files.err = nil
+	files.files = map[string]string{"org/repo": "code_provider: gemini\n"}
+	assert.Equal(t, "gemini", s.Get(context.Background(), "org", "repo").Provider("claude"))
+}
+
+func TestStore_Refresh(t *testing.T) {
+	files := &fakeFiles{files: map[string]string{"org/repo": "code_provider: gemini\n"}}
+	s := newStore(files)
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	s.Get(ctx, "org", "repo")
+	push := func(ref string) *github.PushEvent {
+		return &github.PushEvent{
+			Ref: github.String(ref),
+			Repo: &github.PushEventRepository{
+				Name:          github.String("repo"),
+				DefaultBranch: github.String("main"),
+				Owner:         &github.User{Login: github.String("org")},
+			},
+		}
+	}
+
+	// 推送到其他分支不影响缓存
+	s.InvalidateOnPush(push("refs/heads/feature"))
+	s.Get(ctx, "org", "repo")
+	assert.Equal(t, 1, files.calls)
+
+	files.files["org/repo"] = "code_provider: claude\n"
+	s.InvalidateOnPush(push("refs/heads/main"))
+	assert.Equal(t, "claude", s.Get(ctx, "org", "repo").Provider("gemini"))
+	assert.Equal(t, 2, files.calls)
+
+	// 超过有效期后重新读取
+	now = now.Add(cacheTTL)
+	s.Get(ctx, "org", "repo")
+	assert.Equal(t, 3, files.calls)
+}
@@ -0,0 +1,76 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/qiniu/codeagent/internal/config"
+)
+
+// LoopGuard 限制同一 Issue/PR 在一段时间内执行的任务数。
+// 机器人和 CodeAgent 自己的事件已被忽略，这是防止循环触发的最后一道防线：超过限制说明很可能出现了循环
+type LoopGuard struct {
+	limits config.LoopGuardConfig
+	now    func() time.Time
+
+	mu       sync.Mutex
+	runs     map[string][]time.Time // Issue/PR -> window 内任务开始的时间
+	notified map[string]time.Time   // Issue/PR -> 最近一次答复被拒绝的时间
+}
+
+// NewLoopGuard 创建任务次数限制
+func NewLoopGuard(limits config.LoopGuardConfig) *LoopGuard {
+	return &LoopGuard{
+		limits:   limits,
+		now:      time.Now,
+		runs:     make(map[string][]time.Time),
+		notified: make(map[string]time.Time),
+	}
+}
+
+// Allow 判断 Issue/PR 上是否还可以执行任务，允许时记录一次任务。
+// 被拒绝时 notify 在每个 window 内只有第一次为 true，用于只在 Issue/PR 上答复一次。
+// 不属于 Issue/PR 的任务（如推送分析）和 LoopGuard 为 nil 时不做限制
+func (g *LoopGuard) Allow(key Key) (ok, notify bool) {
+	if g == nil || g.limits.MaxRuns <= 0 || key.Number == 0 {
+		return true, false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.prune(now)
+
+	pr := key.pr()
+	if len(g.runs[pr]) >= g.limits.MaxRuns {
+		if _, ok := g.notified[pr]; ok {
+			return false, false
+		}
+		g.notified[pr] = now
+		return false, true
+	}
+	g.runs[pr] = append(g.runs[pr], now)
+	return true, false
+}
+
+// prune 清除 window 之前的记录
+func (g *LoopGuard) prune(now time.Time) {
+	since := now.Add(-g.limits.Window)
+	for pr, runs := range g.runs {
+		i := 0
+		for i < len(runs) && !runs[i].After(since) {
+			i++
+		}
+		if i == len(runs) {
+			delete(g.runs, pr)
+		} else {
+			g.runs[pr] = runs[i:]
+		}
+	}
+	for pr, at := range g.notified {
+		if !at.After(since) {
+			delete(g.notified, pr)
+		}
+	}
+}
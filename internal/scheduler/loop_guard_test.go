@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/qiniu/codeagent/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoopGuardLimitsRunsPerPR(t *testing.T) {
+	g := NewLoopGuard(config.LoopGuardConfig{MaxRuns: 2, Window: time.Hour})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	g.now = func() time.Time { return now }
+
+	pr := Key{Org: "o", Repo: "r", Number: 1}
+	for i := 0; i < 2; i++ {
+		ok, _ := g.Allow(pr)
+		assert.True(t, ok)
+	}
+
+	// 超过限制后拒绝，只答复一次
+	ok, notify := g.Allow(pr)
+	assert.False(t, ok)
+	assert.True(t, notify)
+	ok, notify = g.Allow(pr)
+	assert.False(t, ok)
+	assert.False(t, notify)
+
+	// 其他 PR 和不属于 PR 的任务不受影响
+	ok, _ = g.Allow(Key{Org: "o", Repo: "r", Number: 2})
+	assert.True(t, ok)
+	ok, _ = g.Allow(Key{Org: "o", Repo: "r"})
+	assert.True(t, ok)
+
+	// 窗口过去后恢复
+	now = now.Add(time.Hour + time.Second)
+	ok, _ = g.Allow(pr)
+	assert.True(t, ok)
+}
+
+func TestLoopGuardUnlimited(t *testing.T) {
+	g := NewLoopGuard(config.LoopGuardConfig{MaxRuns: -1, Window: time.Hour})
+	pr := Key{Org: "o", Repo: "r", Number: 1}
+	for i := 0; i < 100; i++ {
+		ok, _ := g.Allow(pr)
+		assert.True(t, ok)
+	}
+
+	var nilGuard *LoopGuard
+	ok, _ := nilGuard.Allow(pr)
+	assert.True(t, ok)
+}
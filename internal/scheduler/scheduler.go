@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/qiniu/codeagent/internal/config"
+)
+
+// Key 标识任务所属的仓库和 Issue/PR
+type Key struct {
+	Org    string
+	Repo   string
+	Number int
+}
+
+func (k Key) repo() string {
+	return k.Org + "/" + k.Repo
+}
+
+func (k Key) pr() string {
+	return fmt.Sprintf("%s/%s/%d", k.Org, k.Repo, k.Number)
+}
+
+// Scheduler 按全局、组织、仓库、PR 维度限制任务并发，超出限制的任务留在任务队列中，
+// 由 worker 在有空闲槽位时取出
+type Scheduler struct {
+	mu      sync.Mutex
+	limits  config.ConcurrencyConfig
+	running int
+	byOrg   map[string]int
+	byRepo  map[string]int
+	byPR    map[string]int
+}
+
+// New 创建调度器
+func New(limits config.ConcurrencyConfig) *Scheduler {
+	return &Scheduler{
+		limits: limits,
+		byOrg:  make(map[string]int),
+		byRepo: make(map[string]int),
+		byPR:   make(map[string]int),
+	}
+}
+
+// TryAcquire 在有空闲槽位时立即获取，否则返回 false，不会排队；
+// 返回的 release 必须在任务结束后调用
+func (s *Scheduler) TryAcquire(key Key) (release func(), ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.fits(key) {
+		return nil, false
+	}
+	s.start(key)
+	return s.releaseFunc(key), true
+}
+
+// Running 返回正在执行的任务数
+func (s *Scheduler) Running() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+func (s *Scheduler) releaseFunc(key Key) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.finish(key)
+		})
+	}
+}
+
+// repoLimit 返回仓库的并发限制，优先使用按仓库单独配置的值
+func (s *Scheduler) repoLimit(key Key) int {
+	if limit, ok := s.limits.Repos[key.repo()]; ok {
+		return limit
+	}
+	return s.limits.PerRepo
+}
+
+func (s *Scheduler) fits(key Key) bool {
+	if s.limits.Global > 0 && s.running >= s.limits.Global {
+		return false
+	}
+	if s.limits.PerOrg > 0 && s.byOrg[key.Org] >= s.limits.PerOrg {
+		return false
+	}
+	if limit := s.repoLimit(key); limit > 0 && s.byRepo[key.repo()] >= limit {
+		return false
+	}
+	if s.limits.PerPR > 0 && s.byPR[key.pr()] >= s.limits.PerPR {
+		return false
+	}
+	return true
+}
+
+func (s *Scheduler) start(key Key) {
+	s.running++
+	s.byOrg[key.Org]++
+	s.byRepo[key.repo()]++
+	s.byPR[key.pr()]++
+}
+
+func (s *Scheduler) finish(key Key) {
+	s.running--
+	decrement(s.byOrg, key.Org)
+	decrement(s.byRepo, key.repo())
+	decrement(s.byPR, key.pr())
+}
+
+func decrement(m map[string]int, key string) {
+	if m[key] <= 1 {
+		delete(m, key)
+		return
+	}
+	m[key]--
+}
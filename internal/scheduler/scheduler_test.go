@@ -0,0 +1,65 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/qiniu/codeagent/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTryAcquireWithinLimits(t *testing.T) {
+	s := New(config.ConcurrencyConfig{Global: 2})
+
+	release1, ok := s.TryAcquire(Key{Org: "o", Repo: "r", Number: 1})
+	require.True(t, ok)
+	release2, ok := s.TryAcquire(Key{Org: "o", Repo: "r", Number: 2})
+	require.True(t, ok)
+	assert.Equal(t, 2, s.Running())
+
+	_, ok = s.TryAcquire(Key{Org: "o", Repo: "r", Number: 3})
+	assert.False(t, ok)
+
+	release1()
+	release1() // 重复释放无副作用
+	release2()
+	assert.Equal(t, 0, s.Running())
+}
+
+func TestPerPRLimitDoesNotBlockOtherPRs(t *testing.T) {
+	s := New(config.ConcurrencyConfig{PerPR: 1})
+
+	release, ok := s.TryAcquire(Key{Org: "o", Repo: "r", Number: 1})
+	require.True(t, ok)
+
+	_, ok = s.TryAcquire(Key{Org: "o", Repo: "r", Number: 1})
+	assert.False(t, ok)
+
+	other, ok := s.TryAcquire(Key{Org: "o", Repo: "r", Number: 2})
+	require.True(t, ok)
+	other()
+
+	release()
+	next, ok := s.TryAcquire(Key{Org: "o", Repo: "r", Number: 1})
+	require.True(t, ok)
+	next()
+}
+
+func TestRepoOverrideLimit(t *testing.T) {
+	s := New(config.ConcurrencyConfig{
+		PerRepo: 5,
+		Repos:   map[string]int{"o/busy": 1},
+	})
+
+	release, ok := s.TryAcquire(Key{Org: "o", Repo: "busy", Number: 1})
+	require.True(t, ok)
+	defer release()
+
+	_, ok = s.TryAcquire(Key{Org: "o", Repo: "busy", Number: 2})
+	assert.False(t, ok)
+
+	quiet, ok := s.TryAcquire(Key{Org: "o", Repo: "quiet", Number: 1})
+	require.True(t, ok)
+	quiet()
+}
@@ -0,0 +1,315 @@
+package secretscan
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/internal/locale"
+)
+
+// 通用密钥规则：变量名像密钥、值足够长且足够随机时才视为密钥，避免误报占位符和变量引用
+const (
+	genericMinLength  = 16
+	genericMinEntropy = 3.5
+)
+
+// rule 匹配新增行内容的规则
+type rule struct {
+	name    string
+	pattern *regexp.Regexp
+	// 密钥所在的子匹配下标，0 表示整个匹配
+	group int
+	// 密钥的最低熵，0 表示不检查
+	minEntropy float64
+}
+
+// builtinRules 内置规则
+var builtinRules = []rule{
+	{name: "aws-access-key-id", pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`)},
+	{name: "aws-secret-access-key", pattern: regexp.MustCompile(`(?i)aws.{0,20}(?:secret|sk).{0,20}[:=]\s*['"]?([0-9a-zA-Z/+]{40})\b`), group: 1},
+	{name: "github-token", pattern: regexp.MustCompile(`\b(?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36,}\b`)},
+	{name: "github-fine-grained-token", pattern: regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`)},
+	{name: "slack-token", pattern: regexp.MustCompile(`\bxox[baprs]-[A-Za-z0-9-]{10,}\b`)},
+	{name: "private-key", pattern: regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |PGP |ENCRYPTED )?PRIVATE KEY(?: BLOCK)?-----`)},
+	{
+		name:       "high-entropy-secret",
+		pattern:    regexp.MustCompile(`(?i)(?:secret|token|passw(?:or)?d|api[_-]?key|access[_-]?key|private[_-]?key|credential)[A-Za-z0-9_-]*['"]?\s*(?::=|[:=])\s*['"]?([A-Za-z0-9/+_=.-]{16,})`),
+		group:      1,
+		minEntropy: genericMinEntropy,
+	},
+}
+
+// sensitiveFiles 不应提交到仓库的文件，按文件名匹配
+var sensitiveFiles = []string{
+	".env", ".env.*", "*.pem", "*.key", "*.p12", "*.pfx", "*.jks", "*.keystore",
+	"id_rsa", "id_dsa", "id_ecdsa", "id_ed25519", ".netrc", ".git-credentials",
+}
+
+// safeFiles 常见的示例配置文件，不视为敏感文件
+var safeFiles = []string{".env.example", ".env.sample", ".env.template", ".env.dist"}
+
+// defaultAllowPaths 内容为校验和等随机字符串的文件
+var defaultAllowPaths = []string{"go.sum", "*.lock", "package-lock.json", "pnpm-lock.yaml"}
+
+// Finding 扫描发现的疑似密钥
+type Finding struct {
+	File string
+	// 新文件中的行号，敏感文件为 0
+	Line int
+	Rule string
+	// 脱敏后的匹配内容
+	Secret string
+}
+
+// FoundError 改动中包含疑似密钥，提交被阻止
+type FoundError struct {
+	Findings []Finding
+}
+
+func (e *FoundError) Error() string {
+	return fmt.Sprintf("found %d potential secrets in changes (%s), push blocked", len(e.Findings), strings.Join(Files(e.Findings), ", "))
+}
+
+// Scanner 扫描 git diff 中新增的内容
+type Scanner struct {
+	rules      []rule
+	allowPaths []string
+	allowlist  []*regexp.Regexp
+}
+
+// New 根据配置创建扫描器，关闭扫描时返回 nil
+func New(cfg config.SecretScanConfig) (*Scanner, error) {
+	if cfg.Disabled {
+		return nil, nil
+	}
+	s := &Scanner{
+		rules:      append([]rule(nil), builtinRules...),
+		allowPaths: append(append([]string(nil), defaultAllowPaths...), cfg.AllowPaths...),
+	}
+	for _, r := range cfg.Rules {
+		if r.Name == "" || r.Pattern == "" {
+			return nil, fmt.Errorf("secret_scan rule requires name and pattern")
+		}
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret_scan rule %s: %w", r.Name, err)
+		}
+		s.rules = append(s.rules, rule{name: r.Name, pattern: pattern})
+	}
+	for _, p := range cfg.Allowlist {
+		pattern, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret_scan allowlist pattern %q: %w", p, err)
+		}
+		s.allowlist = append(s.allowlist, pattern)
+	}
+	for _, p := range s.allowPaths {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid secret_scan allow path %q: %w", p, err)
+		}
+	}
+	return s, nil
+}
+
+// Scan 扫描 git diff 输出（git diff --cached -U0）中新增的文件和行，Scanner 为 nil 时不扫描
+func (s *Scanner) Scan(diff string) []Finding {
+	if s == nil {
+		return nil
+	}
+
+	var findings []Finding
+	var file string
+	var skip, deleted, reported bool
+	line := 0
+	startFile := func(name string) {
+		file, deleted, reported, line = name, false, false, 0
+		skip = matchAny(s.allowPaths, name)
+	}
+	// 新增、重命名或修改敏感文件时报告一次，空文件和纯重命名没有内容行，需要根据文件头判断
+	checkFile := func() {
+		if !reported && !deleted && !skip && isSensitiveFile(file) {
+			reported = true
+			findings = append(findings, Finding{File: file, Rule: "sensitive-file"})
+		}
+	}
+
+	for _, text := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(text, "diff --git "):
+			if i := strings.LastIndex(text, " b/"); i >= 0 {
+				startFile(text[i+len(" b/"):])
+			}
+			continue
+		case strings.HasPrefix(text, "deleted file mode"):
+			deleted = true
+			continue
+		case strings.HasPrefix(text, "new file mode"):
+			checkFile()
+			continue
+		case strings.HasPrefix(text, "rename to "), strings.HasPrefix(text, "copy to "):
+			_, name, _ := strings.Cut(text, " to ")
+			startFile(name)
+			checkFile()
+			continue
+		case strings.HasPrefix(text, "+++ "):
+			if name, ok := strings.CutPrefix(text, "+++ b/"); ok && name != file {
+				startFile(name)
+			}
+			checkFile()
+			continue
+		case strings.HasPrefix(text, "Binary files "):
+			checkFile()
+			continue
+		case strings.HasPrefix(text, "@@"):
+			line = hunkStart(text)
+			continue
+		case strings.HasPrefix(text, "+"):
+		case strings.HasPrefix(text, " "):
+			line++
+			continue
+		default:
+			continue
+		}
+
+		if !skip && file != "" {
+			findings = append(findings, s.scanLine(file, line, text[1:])...)
+		}
+		line++
+	}
+	return findings
+}
+
+// scanLine 使用所有规则扫描一行新增内容
+func (s *Scanner) scanLine(file string, line int, text string) []Finding {
+	var findings []Finding
+	var found []string
+	for _, r := range s.rules {
+		for _, m := range r.pattern.FindAllStringSubmatch(text, -1) {
+			secret := m[r.group]
+			if r.minEntropy > 0 && (len(secret) < genericMinLength || entropy(secret) < r.minEntropy) {
+				continue
+			}
+			if s.allowed(secret) || overlaps(found, secret) {
+				continue
+			}
+			found = append(found, secret)
+			findings = append(findings, Finding{File: file, Line: line, Rule: r.name, Secret: redact(secret)})
+		}
+	}
+	return findings
+}
+
+func (s *Scanner) allowed(secret string) bool {
+	for _, pattern := range s.allowlist {
+		if pattern.MatchString(secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps 同一内容被多条规则匹配时（如 GitHub 令牌也满足通用规则）只报告第一条
+func overlaps(found []string, secret string) bool {
+	for _, f := range found {
+		if strings.Contains(f, secret) || strings.Contains(secret, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// Files 返回包含疑似密钥的文件，按首次出现的顺序去重
+func Files(findings []Finding) []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		if !seen[f.File] {
+			seen[f.File] = true
+			files = append(files, f.File)
+		}
+	}
+	return files
+}
+
+// Report 生成在 Issue/PR 上报告扫描结果的评论，不包含密钥原文
+func Report(findings []Finding, msgs *locale.Messages) string {
+	var rows strings.Builder
+	for _, f := range findings {
+		line := "-"
+		if f.Line > 0 {
+			line = strconv.Itoa(f.Line)
+		}
+		secret := "-"
+		if f.Secret != "" {
+			secret = "`" + f.Secret + "`"
+		}
+		fmt.Fprintf(&rows, "| `%s` | %s | %s | %s |\n", f.File, line, f.Rule, secret)
+	}
+	return fmt.Sprintf(msgs.SecretScanBlocked, rows.String())
+}
+
+// hunkStart 解析 @@ -a,b +c,d @@ 中新文件的起始行号
+func hunkStart(header string) int {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+		return 0
+	}
+	start, _, _ := strings.Cut(fields[2][1:], ",")
+	n, _ := strconv.Atoi(start)
+	return n
+}
+
+func isSensitiveFile(file string) bool {
+	if file == "" {
+		return false
+	}
+	name := path.Base(file)
+	for _, safe := range safeFiles {
+		if name == safe {
+			return false
+		}
+	}
+	return matchAny(sensitiveFiles, file)
+}
+
+// matchAny 判断文件的相对路径或文件名是否匹配任意 glob
+func matchAny(patterns []string, file string) bool {
+	name := path.Base(file)
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, file); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// entropy 计算字符串的香农熵（每个字符的比特数）
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	var h float64
+	n := float64(len([]rune(s)))
+	for _, c := range counts {
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// redact 只保留开头几个字符
+func redact(secret string) string {
+	if len(secret) <= 8 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:4] + strings.Repeat("*", 8) + fmt.Sprintf(" (%d chars)", len(secret))
+}
@@ -0,0 +1,146 @@
+package usage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qiniu/codeagent/internal/config"
+)
+
+// 预算的统计对象
+const (
+	ScopeRepo = "repository"
+	ScopeOrg  = "organization"
+	ScopeUser = "user"
+)
+
+// 预算的统计周期
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+)
+
+// ExceededError 已用完或执行新任务后会超出的预算
+type ExceededError struct {
+	Scope    string // ScopeRepo、ScopeOrg 或 ScopeUser
+	Name     string // org/repo、org 或用户名
+	Period   string // PeriodDaily 或 PeriodMonthly
+	Unit     string // tokens 或 minutes
+	Used     int
+	Limit    int
+	Estimate int       // 新任务的预计用量，即本周期内任务的平均用量
+	ResetAt  time.Time // 预算重置时间
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s %s would exceed its %s budget: %d of %d %s used, about %d per task", e.Scope, e.Name, e.Period, e.Used, e.Limit, e.Unit, e.Estimate)
+}
+
+// Budget 根据用量记录检查仓库、组织和用户的预算
+type Budget struct {
+	config config.BudgetConfig
+	store  *Store
+	now    func() time.Time
+}
+
+// NewBudget 创建预算检查器
+func NewBudget(cfg config.BudgetConfig, store *Store) *Budget {
+	return &Budget{config: cfg, store: store, now: time.Now}
+}
+
+// Check 检查新任务是否可以执行，有预算已用完，或加上新任务的预计用量后会超出时返回 *ExceededError。
+// 任务执行前无法知道实际用量，预计用量按本周期内任务的平均用量估算，因此单个任务仍可能超出预算；
+// 豁免用户（不区分大小写）和未配置的预算不受限制
+func (b *Budget) Check(org, repo, user string) error {
+	if b == nil || b.store == nil {
+		return nil
+	}
+	for _, exempt := range b.config.Exempt {
+		if user != "" && strings.EqualFold(exempt, user) {
+			return nil
+		}
+	}
+
+	type target struct {
+		scope string
+		name  string
+		limit config.BudgetLimit
+	}
+	targets := []target{
+		{ScopeRepo, org + "/" + repo, limitFor(b.config.Repos, org+"/"+repo, b.config.PerRepo)},
+		{ScopeOrg, org, limitFor(b.config.Orgs, org, b.config.PerOrg)},
+	}
+	if user != "" {
+		targets = append(targets, target{ScopeUser, user, limitFor(b.config.Users, user, b.config.PerUser)})
+	}
+
+	now := b.now()
+	for _, t := range targets {
+		periods := []struct {
+			name    string
+			tokens  int
+			minutes int
+		}{
+			{PeriodDaily, t.limit.DailyTokens, t.limit.DailyMinutes},
+			{PeriodMonthly, t.limit.MonthlyTokens, t.limit.MonthlyMinutes},
+		}
+		for _, p := range periods {
+			if p.tokens <= 0 && p.minutes <= 0 {
+				continue
+			}
+			start := periodStart(p.name, now)
+			total := b.store.Total(t.scope, t.name, p.name, start)
+			exceeded := &ExceededError{Scope: t.scope, Name: t.name, Period: p.name, ResetAt: periodEnd(p.name, start)}
+			tokens := total.Usage.InputTokens + total.Usage.OutputTokens
+			if estimate := average(tokens, total.Tasks); p.tokens > 0 && wouldExceed(tokens, estimate, p.tokens) {
+				exceeded.Unit, exceeded.Used, exceeded.Limit, exceeded.Estimate = "tokens", tokens, p.tokens, estimate
+				return exceeded
+			}
+			minutes := int(total.Duration / time.Minute)
+			if estimate := average(minutes, total.Tasks); p.minutes > 0 && wouldExceed(minutes, estimate, p.minutes) {
+				exceeded.Unit, exceeded.Used, exceeded.Limit, exceeded.Estimate = "minutes", minutes, p.minutes, estimate
+				return exceeded
+			}
+		}
+	}
+	return nil
+}
+
+// average 返回每个任务的平均用量，没有任务时为 0
+func average(used, tasks int) int {
+	if tasks == 0 {
+		return 0
+	}
+	return used / tasks
+}
+
+// wouldExceed 判断预算是否已用完，或加上新任务的预计用量后会超出
+func wouldExceed(used, estimate, limit int) bool {
+	return used >= limit || used+estimate > limit
+}
+
+// periodStart 返回 t 所在统计周期（UTC 自然日或自然月）的开始时间
+func periodStart(period string, t time.Time) time.Time {
+	t = t.UTC()
+	if period == PeriodMonthly {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// periodEnd 返回统计周期的结束时间，即预算重置时间
+func periodEnd(period string, start time.Time) time.Time {
+	if period == PeriodMonthly {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// limitFor 返回单独配置的预算，没有时返回默认预算
+func limitFor(overrides map[string]config.BudgetLimit, key string, fallback config.BudgetLimit) config.BudgetLimit {
+	if limit, ok := overrides[key]; ok {
+		return limit
+	}
+	return fallback
+}
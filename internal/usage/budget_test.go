@@ -0,0 +1,73 @@
+package usage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudgetCheck(t *testing.T) {
+	s, err := NewStore("", 0)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		// 上个月的用量不计入本月预算
+		{Time: now.AddDate(0, -1, 0), Org: "org", Repo: "a", User: "alice", Usage: models.TokenUsage{InputTokens: 10000}},
+		{Time: now.AddDate(0, 0, -3), Org: "org", Repo: "a", User: "alice", Usage: models.TokenUsage{InputTokens: 600, CacheReadInputTokens: 5000}, Duration: 20 * time.Minute},
+		{Time: now.Add(-time.Hour), Org: "org", Repo: "b", User: "bob", Usage: models.TokenUsage{InputTokens: 300, OutputTokens: 100}, Duration: 5 * time.Minute},
+	}
+	for _, e := range entries {
+		require.NoError(t, s.Add(e))
+	}
+
+	cfg := config.BudgetConfig{
+		PerRepo: config.BudgetLimit{MonthlyTokens: 500},
+		PerUser: config.BudgetLimit{DailyMinutes: 5},
+		Repos:   map[string]config.BudgetLimit{"org/b": {}},
+		Exempt:  []string{"admin"},
+	}
+	b := NewBudget(cfg, s)
+	b.now = func() time.Time { return now }
+
+	var exceeded *ExceededError
+	err = b.Check("org", "a", "carol")
+	require.True(t, errors.As(err, &exceeded))
+	assert.Equal(t, ScopeRepo, exceeded.Scope)
+	assert.Equal(t, "org/a", exceeded.Name)
+	assert.Equal(t, PeriodMonthly, exceeded.Period)
+	assert.Equal(t, "tokens", exceeded.Unit)
+	assert.Equal(t, 600, exceeded.Used)
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), exceeded.ResetAt)
+
+	// 单独配置的仓库预算覆盖默认值
+	assert.NoError(t, b.Check("org", "b", "carol"))
+
+	err = b.Check("org", "b", "bob")
+	require.True(t, errors.As(err, &exceeded))
+	assert.Equal(t, ScopeUser, exceeded.Scope)
+	assert.Equal(t, "minutes", exceeded.Unit)
+	assert.Equal(t, 5, exceeded.Used)
+
+	// 豁免用户不受限制，用户名不区分大小写
+	assert.NoError(t, b.Check("org", "a", "admin"))
+	assert.NoError(t, b.Check("org", "a", "Admin"))
+
+	// 已用量未达到上限，但加上平均每个任务的用量后会超出
+	require.NoError(t, s.Add(Entry{Time: now.Add(-time.Hour), Org: "other", Repo: "c", User: "dave", Usage: models.TokenUsage{InputTokens: 300}}))
+	require.NoError(t, s.Add(Entry{Time: now.Add(-time.Hour), Org: "other", Repo: "c", User: "dave", Usage: models.TokenUsage{InputTokens: 100}}))
+	err = b.Check("other", "c", "erin")
+	require.True(t, errors.As(err, &exceeded))
+	assert.Equal(t, "other/c", exceeded.Name)
+	assert.Equal(t, 400, exceeded.Used)
+	assert.Equal(t, 200, exceeded.Estimate)
+
+	var nilBudget *Budget
+	assert.NoError(t, nilBudget.Check("org", "a", "carol"))
+}
@@ -0,0 +1,72 @@
+package usage
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Handler 用量查询接口：GET /usage?org=&repo=&user=&since=&group_by=
+// since 支持 RFC3339 时间或相对时长（如 720h），group_by 可选 org、repo、pr、user
+type Handler struct {
+	store *Store
+	token string
+	now   func() time.Time
+}
+
+// NewHandler 创建用量查询接口，请求需要携带 Authorization: Bearer <token>，token 为空时接口关闭
+func NewHandler(store *Store, token string) *Handler {
+	return &Handler{store: store, token: token, now: time.Now}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.token == "" {
+		http.Error(w, "usage API is disabled", http.StatusNotFound)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+h.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	params := r.URL.Query()
+	q := Query{
+		Org:     params.Get("org"),
+		Repo:    params.Get("repo"),
+		User:    params.Get("user"),
+		GroupBy: params.Get("group_by"),
+	}
+	if since := params.Get("since"); since != "" {
+		t, err := h.parseSince(since)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q.Since = t
+	}
+
+	report, err := h.store.Query(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func (h *Handler) parseSince(since string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(since); err == nil && d > 0 {
+		return h.now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since: %s", since)
+}
@@ -0,0 +1,308 @@
+package usage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/qiniu/x/log"
+)
+
+// Entry 一个任务的用量记录
+type Entry struct {
+	Time     time.Time         `json:"time"`
+	JobID    string            `json:"job_id,omitempty"`
+	Org      string            `json:"org"`
+	Repo     string            `json:"repo"`
+	Number   int               `json:"number"`
+	User     string            `json:"user,omitempty"`
+	Command  string            `json:"command,omitempty"`
+	Provider string            `json:"provider,omitempty"`
+	Usage    models.TokenUsage `json:"usage"`
+	Duration time.Duration     `json:"duration,omitempty"` // AI 调用的累计运行时长
+}
+
+// 聚合维度
+const (
+	GroupByOrg  = "org"
+	GroupByRepo = "repo"
+	GroupByPR   = "pr"
+	GroupByUser = "user"
+)
+
+// Query 用量查询条件，空字段表示不过滤
+type Query struct {
+	Org     string
+	Repo    string
+	User    string
+	Since   time.Time
+	GroupBy string
+}
+
+// Aggregate 一组任务的用量汇总
+type Aggregate struct {
+	Key      string            `json:"key,omitempty"`
+	Tasks    int               `json:"tasks"`
+	Usage    models.TokenUsage `json:"usage"`
+	Duration time.Duration     `json:"duration"`
+}
+
+// Report 用量查询结果
+type Report struct {
+	Total  Aggregate   `json:"total"`
+	Groups []Aggregate `json:"groups,omitempty"`
+}
+
+// pruneInterval 清理过期用量记录的最小间隔
+const pruneInterval = time.Hour
+
+// totalKey 预算统计对象在一个统计周期内的用量
+type totalKey struct {
+	scope  string
+	name   string
+	period string
+	start  time.Time
+}
+
+// Store 按任务记录用量，以 JSON Lines 追加写入本地文件。
+// 超过保留时间的记录会被清理，预算检查使用按统计周期累加的用量，不需要遍历记录
+type Store struct {
+	mu        sync.Mutex
+	path      string
+	retention time.Duration
+	entries   []Entry
+	totals    map[totalKey]*Aggregate
+	pruned    time.Time
+}
+
+// NewStore 创建用量存储，path 为空时仅保存在内存中；retention 为记录的保留时间，0 表示不清理
+func NewStore(path string, retention time.Duration) (*Store, error) {
+	s := &Store{path: path, retention: retention, totals: make(map[totalKey]*Aggregate)}
+	if path == "" {
+		return s, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to open usage store: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse usage store line %d: %w", line, err)
+		}
+		s.entries = append(s.entries, entry)
+		s.addTotals(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage store: %w", err)
+	}
+
+	if err := s.prune(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add 追加一条用量记录
+func (s *Store) Add(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path != "" {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to marshal usage entry: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+			return fmt.Errorf("failed to create usage store directory: %w", err)
+		}
+		f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open usage store: %w", err)
+		}
+		_, err = f.Write(append(data, '\n'))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write usage entry: %w", err)
+		}
+	}
+
+	s.entries = append(s.entries, entry)
+	s.addTotals(entry)
+
+	if now := time.Now(); now.Sub(s.pruned) >= pruneInterval {
+		// 记录已经写入，清理失败不影响本次记录
+		if err := s.prune(now); err != nil {
+			log.Warnf("Failed to prune usage store: %v", err)
+		}
+	}
+	return nil
+}
+
+// Total 返回预算统计对象在 start 开始的统计周期内的用量，
+// scope 为 ScopeRepo（name 为 org/repo）、ScopeOrg 或 ScopeUser，period 为 PeriodDaily 或 PeriodMonthly
+func (s *Store) Total(scope, name, period string, start time.Time) Aggregate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if total, ok := s.totals[totalKey{scope: scope, name: name, period: period, start: start}]; ok {
+		return *total
+	}
+	return Aggregate{}
+}
+
+// addTotals 将记录累加到所属仓库、组织和用户的当日、当月用量
+func (s *Store) addTotals(e Entry) {
+	names := map[string]string{
+		ScopeRepo: e.Org + "/" + e.Repo,
+		ScopeOrg:  e.Org,
+	}
+	if e.User != "" {
+		names[ScopeUser] = e.User
+	}
+	for scope, name := range names {
+		for _, period := range []string{PeriodDaily, PeriodMonthly} {
+			key := totalKey{scope: scope, name: name, period: period, start: periodStart(period, e.Time)}
+			total, ok := s.totals[key]
+			if !ok {
+				total = &Aggregate{}
+				s.totals[key] = total
+			}
+			total.Tasks++
+			total.Usage.Add(e.Usage)
+			total.Duration += e.Duration
+		}
+	}
+}
+
+// prune 删除超过保留时间的记录并重写文件，同时重新计算各统计周期的用量
+func (s *Store) prune(now time.Time) error {
+	s.pruned = now
+	if s.retention <= 0 {
+		return nil
+	}
+
+	cutoff := now.Add(-s.retention)
+	kept := s.entries[:0]
+	for _, e := range s.entries {
+		if !e.Time.Before(cutoff) {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == len(s.entries) {
+		return nil
+	}
+	s.entries = kept
+
+	s.totals = make(map[totalKey]*Aggregate)
+	for _, e := range s.entries {
+		s.addTotals(e)
+	}
+	if s.path == "" {
+		return nil
+	}
+
+	// 先写临时文件再 rename，保证记录文件不会被写坏
+	var buf bytes.Buffer
+	for _, e := range s.entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to marshal usage entry: %w", err)
+		}
+		buf.Write(append(data, '\n'))
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write usage store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to persist usage store: %w", err)
+	}
+	return nil
+}
+
+// Query 按条件汇总用量，GroupBy 为空时只返回总量
+func (s *Store) Query(q Query) (*Report, error) {
+	var keyOf func(Entry) string
+	switch q.GroupBy {
+	case "":
+	case GroupByOrg:
+		keyOf = func(e Entry) string { return e.Org }
+	case GroupByRepo:
+		keyOf = func(e Entry) string { return e.Org + "/" + e.Repo }
+	case GroupByPR:
+		keyOf = func(e Entry) string { return fmt.Sprintf("%s/%s#%d", e.Org, e.Repo, e.Number) }
+	case GroupByUser:
+		keyOf = func(e Entry) string { return e.User }
+	default:
+		return nil, fmt.Errorf("unsupported group_by: %s", q.GroupBy)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &Report{}
+	groups := make(map[string]*Aggregate)
+	for _, e := range s.entries {
+		if (q.Org != "" && e.Org != q.Org) || (q.Repo != "" && e.Repo != q.Repo) ||
+			(q.User != "" && e.User != q.User) || e.Time.Before(q.Since) {
+			continue
+		}
+		report.Total.Tasks++
+		report.Total.Usage.Add(e.Usage)
+		report.Total.Duration += e.Duration
+
+		if keyOf == nil {
+			continue
+		}
+		key := keyOf(e)
+		group, ok := groups[key]
+		if !ok {
+			group = &Aggregate{Key: key}
+			groups[key] = group
+		}
+		group.Tasks++
+		group.Usage.Add(e.Usage)
+		group.Duration += e.Duration
+	}
+
+	for _, group := range groups {
+		report.Groups = append(report.Groups, *group)
+	}
+	// 费用高的排在前面，便于定位主要消耗方
+	sort.Slice(report.Groups, func(i, j int) bool {
+		a, b := report.Groups[i], report.Groups[j]
+		if a.Usage.CostUSD != b.Usage.CostUSD {
+			return a.Usage.CostUSD > b.Usage.CostUSD
+		}
+		if a.Usage.TotalTokens() != b.Usage.TotalTokens() {
+			return a.Usage.TotalTokens() > b.Usage.TotalTokens()
+		}
+		return a.Key < b.Key
+	})
+	return report, nil
+}
@@ -0,0 +1,144 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracker(t *testing.T) {
+	ctx := context.Background()
+	assert.Nil(t, Total(ctx))
+	Record(ctx, models.TokenUsage{InputTokens: 1}) // 没有 Tracker 时忽略
+	assert.Empty(t, Footer(ctx))
+
+	ctx = WithTracker(ctx, &Tracker{})
+	assert.Nil(t, Total(ctx))
+	Record(ctx, models.TokenUsage{InputTokens: 100, OutputTokens: 10, CostUSD: 0.01})
+	Record(ctx, models.TokenUsage{InputTokens: 50, OutputTokens: 5, CacheReadInputTokens: 20, CostUSD: 0.02})
+
+	total := Total(ctx)
+	require.NotNil(t, total)
+	assert.Equal(t, 150, total.InputTokens)
+	assert.Equal(t, 15, total.OutputTokens)
+	assert.InDelta(t, 0.03, total.CostUSD, 1e-9)
+	assert.Contains(t, Footer(ctx), "Tokens: 150 input / 15 output / 20 cached · Cost: $0.0300")
+}
+
+func TestStorePersistAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	s, err := NewStore(path, 0)
+	require.NoError(t, err)
+
+	now := time.Now()
+	entries := []Entry{
+		{Time: now.Add(-48 * time.Hour), Org: "org", Repo: "a", Number: 1, User: "alice", Usage: models.TokenUsage{InputTokens: 100, CostUSD: 1}},
+		{Time: now, Org: "org", Repo: "a", Number: 2, User: "bob", Usage: models.TokenUsage{InputTokens: 200, CostUSD: 2}},
+		{Time: now, Org: "org", Repo: "b", Number: 1, User: "alice", Usage: models.TokenUsage{InputTokens: 50, CostUSD: 0.5}},
+	}
+	for _, e := range entries {
+		require.NoError(t, s.Add(e))
+	}
+
+	// 重新打开后数据仍然存在
+	s, err = NewStore(path, 0)
+	require.NoError(t, err)
+
+	report, err := s.Query(Query{GroupBy: GroupByRepo})
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Total.Tasks)
+	assert.Equal(t, 350, report.Total.Usage.InputTokens)
+	require.Len(t, report.Groups, 2)
+	assert.Equal(t, "org/a", report.Groups[0].Key)
+	assert.Equal(t, 2, report.Groups[0].Tasks)
+	assert.InDelta(t, 3.0, report.Groups[0].Usage.CostUSD, 1e-9)
+
+	report, err = s.Query(Query{User: "alice", Since: now.Add(-time.Hour), GroupBy: GroupByPR})
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Total.Tasks)
+	assert.Equal(t, "org/b#1", report.Groups[0].Key)
+
+	_, err = s.Query(Query{GroupBy: "team"})
+	assert.Error(t, err)
+}
+
+func TestStorePrunesExpiredEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	s, err := NewStore(path, 0)
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, s.Add(Entry{Time: now.Add(-60 * 24 * time.Hour), Org: "org", Repo: "a", User: "alice", Usage: models.TokenUsage{InputTokens: 100}}))
+	require.NoError(t, s.Add(Entry{Time: now, Org: "org", Repo: "a", User: "alice", Usage: models.TokenUsage{InputTokens: 20}}))
+	require.NoError(t, s.Add(Entry{Time: now, Org: "org", Repo: "b", User: "bob", Usage: models.TokenUsage{OutputTokens: 5}}))
+
+	today := periodStart(PeriodDaily, now)
+	assert.Equal(t, 20, s.Total(ScopeRepo, "org/a", PeriodDaily, today).Usage.InputTokens)
+	assert.Equal(t, 2, s.Total(ScopeOrg, "org", PeriodDaily, today).Tasks)
+	assert.Equal(t, 5, s.Total(ScopeUser, "bob", PeriodMonthly, periodStart(PeriodMonthly, now)).Usage.OutputTokens)
+
+	// 重新打开时清理超过保留时间的记录并重写文件
+	s, err = NewStore(path, 30*24*time.Hour)
+	require.NoError(t, err)
+	report, err := s.Query(Query{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Total.Tasks)
+
+	s, err = NewStore(path, 0)
+	require.NoError(t, err)
+	report, err = s.Query(Query{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Total.Tasks)
+	assert.Equal(t, 20, s.Total(ScopeUser, "alice", PeriodDaily, today).Usage.InputTokens)
+}
+
+func TestHandlerDisabledWithoutToken(t *testing.T) {
+	s, err := NewStore("", 0)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	NewHandler(s, "").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/usage", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler(t *testing.T) {
+	s, err := NewStore("", 0)
+	require.NoError(t, err)
+	require.NoError(t, s.Add(Entry{Org: "org", Repo: "a", User: "alice", Usage: models.TokenUsage{OutputTokens: 7}}))
+	require.NoError(t, s.Add(Entry{Time: time.Now().Add(-48 * time.Hour), Org: "org", Repo: "a", User: "bob", Usage: models.TokenUsage{OutputTokens: 3}}))
+
+	h := NewHandler(s, "secret")
+
+	req := httptest.NewRequest(http.MethodGet, "/usage", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/usage?group_by=user&since=24h", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var report Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, 1, report.Total.Tasks)
+	require.Len(t, report.Groups, 1)
+	assert.Equal(t, "alice", report.Groups[0].Key)
+	assert.Equal(t, 7, report.Groups[0].Usage.OutputTokens)
+
+	req = httptest.NewRequest(http.MethodGet, "/usage?since=yesterday", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,94 @@
+package usage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/qiniu/codeagent/pkg/models"
+)
+
+// Tracker 累计一个任务内所有 AI 调用的用量
+type Tracker struct {
+	mu       sync.Mutex
+	usage    models.TokenUsage
+	calls    int
+	duration time.Duration
+}
+
+// Add 累加一次调用的用量
+func (t *Tracker) Add(u models.TokenUsage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.usage.Add(u)
+	t.calls++
+}
+
+// AddDuration 累加一次调用的运行时长
+func (t *Tracker) AddDuration(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.duration += d
+}
+
+// Duration 返回 AI 调用的累计运行时长
+func (t *Tracker) Duration() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.duration
+}
+
+// Total 返回累计用量，没有任何调用报告用量时返回 nil
+func (t *Tracker) Total() *models.TokenUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.calls == 0 {
+		return nil
+	}
+	total := t.usage
+	return &total
+}
+
+type trackerContextKey struct{}
+
+// WithTracker 将 Tracker 绑定到 context，provider 报告的用量会累计到其中
+func WithTracker(ctx context.Context, t *Tracker) context.Context {
+	return context.WithValue(ctx, trackerContextKey{}, t)
+}
+
+// FromContext 获取 context 中的 Tracker，不存在时返回 nil
+func FromContext(ctx context.Context) *Tracker {
+	t, _ := ctx.Value(trackerContextKey{}).(*Tracker)
+	return t
+}
+
+// Record 将一次调用的用量记录到 context 中的 Tracker，没有 Tracker 时忽略
+func Record(ctx context.Context, u models.TokenUsage) {
+	if t := FromContext(ctx); t != nil {
+		t.Add(u)
+	}
+}
+
+// RecordDuration 将一次调用的运行时长记录到 context 中的 Tracker，没有 Tracker 时忽略
+func RecordDuration(ctx context.Context, d time.Duration) {
+	if t := FromContext(ctx); t != nil {
+		t.AddDuration(d)
+	}
+}
+
+// Total 返回 context 中 Tracker 的累计用量，没有时返回 nil
+func Total(ctx context.Context) *models.TokenUsage {
+	if t := FromContext(ctx); t != nil {
+		return t.Total()
+	}
+	return nil
+}
+
+// Footer 返回附加在评论末尾的用量说明，context 中没有用量时返回空
+func Footer(ctx context.Context) string {
+	total := Total(ctx)
+	if total == nil {
+		return ""
+	}
+	return "\n\n---\n*" + total.Summary() + "*"
+}
@@ -0,0 +1,122 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/qiniu/codeagent/internal/locale"
+	"github.com/qiniu/codeagent/internal/usage"
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/qiniu/x/xlog"
+)
+
+// budgetTarget 预算检查需要的事件字段
+type budgetTarget struct {
+	Repo    *github.Repository `json:"repository"`
+	Sender  *github.User       `json:"sender"`
+	Comment *struct {
+		Body string `json:"body"`
+	} `json:"comment"`
+	Review *struct {
+		Body string `json:"body"`
+	} `json:"review"`
+	Issue *struct {
+		Number int `json:"number"`
+	} `json:"issue"`
+	PullRequest *struct {
+		Number int `json:"number"`
+	} `json:"pull_request"`
+}
+
+// isCommand 事件是否为用户在评论中触发的 CodeAgent 命令，其他以 / 开头的评论不算
+func (t *budgetTarget) isCommand() bool {
+	switch {
+	case t.Comment != nil:
+		return models.IsCommand(t.Comment.Body)
+	case t.Review != nil:
+		return models.IsCommand(t.Review.Body)
+	}
+	return false
+}
+
+func (t *budgetTarget) number() int {
+	if t.Issue != nil {
+		return t.Issue.Number
+	}
+	if t.PullRequest != nil {
+		return t.PullRequest.Number
+	}
+	return 0
+}
+
+// checkBudget 检查事件所属仓库、组织和触发用户的预算，已用完时答复请求并返回 false；
+// 命令会在 Issue/PR 上收到说明预算限制的评论
+func (h *Handler) checkBudget(ctx context.Context, w http.ResponseWriter, event []byte) bool {
+	log := xlog.NewWith(ctx)
+
+	var target budgetTarget
+	if h.budget == nil || json.Unmarshal(event, &target) != nil || target.Repo == nil {
+		return true
+	}
+	org, repo, user := target.Repo.GetOwner().GetLogin(), target.Repo.GetName(), target.Sender.GetLogin()
+
+	err := h.budget.Check(org, repo, user)
+	var exceeded *usage.ExceededError
+	if !errors.As(err, &exceeded) {
+		if err != nil {
+			// 预算无法检查时不阻塞任务
+			log.Errorf("Failed to check budget for %s/%s: %v", org, repo, err)
+		}
+		return true
+	}
+	log.Warnf("Rejected event from %s on %s/%s: %v", user, org, repo, exceeded)
+
+	if number := target.number(); target.isCommand() && number > 0 {
+		if err := h.postComment(ctx, org, repo, number, budgetExceededComment(h.messages(ctx, org, repo), user, exceeded)); err != nil {
+			log.Errorf("Failed to post budget comment on %s/%s#%d: %v", org, repo, number, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("budget exceeded: " + exceeded.Error()))
+	return false
+}
+
+func (h *Handler) postComment(ctx context.Context, org, repo string, number int, body string) error {
+	switch {
+	case h.agent != nil:
+		return h.agent.PostComment(ctx, org, repo, number, body)
+	case h.enhancedAgent != nil:
+		return h.enhancedAgent.PostComment(ctx, org, repo, number, body)
+	}
+	return fmt.Errorf("no agent configured")
+}
+
+// messages 返回仓库使用的语言的文本，没有 Agent 时使用服务端配置的语言
+func (h *Handler) messages(ctx context.Context, org, repo string) *locale.Messages {
+	switch {
+	case h.agent != nil:
+		return h.agent.Messages(ctx, org, repo)
+	case h.enhancedAgent != nil:
+		return h.enhancedAgent.Messages(ctx, org, repo)
+	}
+	return locale.Get(h.config.Locale)
+}
+
+// budgetExceededComment 生成预算用完时的答复评论
+func budgetExceededComment(msgs *locale.Messages, user string, e *usage.ExceededError) string {
+	var b strings.Builder
+	if user != "" {
+		fmt.Fprintf(&b, "@%s ", user)
+	}
+	fmt.Fprintf(&b, msgs.BudgetExceeded,
+		msgs.BudgetTerm(e.Period), msgs.BudgetTerm(strings.TrimSuffix(e.Unit, "s")), msgs.BudgetTerm(e.Scope), e.Name,
+		e.Used, e.Limit, msgs.BudgetTerm(e.Unit), e.Estimate, e.ResetAt.Format("2006-01-02 15:04 MST"))
+	return b.String()
+}
@@ -0,0 +1,130 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/qiniu/codeagent/internal/agent"
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/qiniu/x/reqid"
+	"github.com/qiniu/x/xlog"
+)
+
+// maxDispatchBodySize 手动任务请求体的最大长度
+const maxDispatchBodySize = 1 << 20
+
+// dispatchRequest POST /dispatch 的请求体
+type dispatchRequest struct {
+	// 目标仓库 org/repo
+	Repository string `json:"repository"`
+	// 基于的分支（output 为 comment 时也可以是 tag 或提交），为空时使用默认分支
+	Ref string `json:"ref"`
+	// 发起人，用于用量统计和预算，默认为 dispatch-api
+	Sender string `json:"sender"`
+	models.DispatchInputs
+}
+
+// HandleDispatch 处理手动任务接口：POST /dispatch，需要 Authorization: Bearer <dispatch.token>。
+// 请求被转换为 workflow_dispatch 事件入队，由 Enhanced Agent 执行
+func (h *Handler) HandleDispatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := h.config.Dispatch.Token
+	if token == "" {
+		http.Error(w, "dispatch API is disabled", http.StatusNotFound)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if h.agent != nil {
+		http.Error(w, "dispatch API requires the enhanced agent", http.StatusNotImplemented)
+		return
+	}
+
+	var req dispatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxDispatchBodySize)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	event, err := req.event()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		http.Error(w, "failed to encode event", http.StatusInternalServerError)
+		return
+	}
+
+	traceID := newTraceID()
+	ctx := reqid.NewContext(context.Background(), traceID)
+	xl := xlog.NewWith(ctx)
+	xl.Infof("Received dispatched task for %s (ref: %s, output: %s) from %s", req.Repository, req.Ref, req.Output, event.Sender.GetLogin())
+
+	h.enqueueJob(ctx, w, agent.JobGitHubEvent, agent.JobPayload{
+		EventType: string(models.EventWorkflowDispatch),
+		Event:     body,
+	}, "dispatched task queued: "+traceID)
+}
+
+// event 校验请求并转换为 workflow_dispatch 事件
+func (req *dispatchRequest) event() (*github.WorkflowDispatchEvent, error) {
+	owner, name, ok := strings.Cut(req.Repository, "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return nil, errors.New("repository must be in org/repo format")
+	}
+	inputs := req.DispatchInputs
+	if strings.TrimSpace(inputs.Instruction) == "" {
+		return nil, errors.New("instruction is required")
+	}
+	switch inputs.Output {
+	case "", models.DispatchOutputPR:
+	case models.DispatchOutputComment:
+		if inputs.Issue <= 0 {
+			return nil, errors.New("issue is required for comment output")
+		}
+	default:
+		return nil, errors.New("output must be pr or comment")
+	}
+
+	data, err := json.Marshal(inputs)
+	if err != nil {
+		return nil, err
+	}
+	sender := req.Sender
+	if sender == "" {
+		sender = "dispatch-api"
+	}
+	return &github.WorkflowDispatchEvent{
+		Ref:    github.String(req.Ref),
+		Inputs: data,
+		Repo: &github.Repository{
+			Name:     github.String(name),
+			FullName: github.String(req.Repository),
+			Owner:    &github.User{Login: github.String(owner)},
+		},
+		Sender: &github.User{Login: github.String(sender)},
+	}, nil
+}
+
+// newTraceID 为手动任务生成追踪 ID（与 webhook 投递 ID 前缀同为 8 位）
+func newTraceID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "dispatch"
+	}
+	return hex.EncodeToString(b)
+}
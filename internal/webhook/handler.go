@@ -3,13 +3,18 @@ package webhook
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
 
 	"github.com/qiniu/codeagent/internal/agent"
+	"github.com/qiniu/codeagent/internal/code"
 	"github.com/qiniu/codeagent/internal/config"
-	"github.com/qiniu/codeagent/pkg/signature"
+	"github.com/qiniu/codeagent/internal/dedup"
+	"github.com/qiniu/codeagent/internal/queue"
+	"github.com/qiniu/codeagent/internal/usage"
+	"github.com/qiniu/codeagent/pkg/models"
 
 	"github.com/google/go-github/v58/github"
 	"github.com/qiniu/x/reqid"
@@ -20,40 +25,143 @@ type Handler struct {
 	config        *config.Config
 	agent         *agent.Agent
 	enhancedAgent *agent.EnhancedAgent // 新的Enhanced Agent字段
+	jobQueue      *queue.Queue         // 持久化任务队列，命令任务入队后由 agent 的 worker 池执行
+	deliveries    *dedup.Store         // 已接收的投递 ID，用于忽略 GitHub 的重复投递
+	budget        *usage.Budget        // 用量预算，用完后不再执行新任务
+	signatures    *signatureStats      // 各 webhook secret 的匹配统计
+	commands      commandGuard         // 检查命令的触发用户，未配置 agent 时为 nil
 }
 
-func NewHandler(cfg *config.Config, agent *agent.Agent) *Handler {
-	return &Handler{config: cfg, agent: agent}
+func NewHandler(cfg *config.Config, agent *agent.Agent, jobQueue *queue.Queue, deliveries *dedup.Store, budget *usage.Budget) *Handler {
+	h := &Handler{config: cfg, agent: agent, jobQueue: jobQueue, deliveries: deliveries, budget: budget, signatures: newSignatureStats()}
+	if agent != nil {
+		h.commands = agent
+	}
+	return h
 }
 
 // NewEnhancedHandler 创建Enhanced webhook处理器
-func NewEnhancedHandler(cfg *config.Config, enhancedAgent *agent.EnhancedAgent) *Handler {
-	return &Handler{
+func NewEnhancedHandler(cfg *config.Config, enhancedAgent *agent.EnhancedAgent, jobQueue *queue.Queue, deliveries *dedup.Store, budget *usage.Budget) *Handler {
+	h := &Handler{
 		config:        cfg,
 		agent:         nil, // 兼容性字段，设为nil
 		enhancedAgent: enhancedAgent,
+		jobQueue:      jobQueue,
+		deliveries:    deliveries,
+		budget:        budget,
+		signatures:    newSignatureStats(),
+	}
+	if enhancedAgent != nil {
+		h.commands = enhancedAgent
+	}
+	return h
+}
+
+// statusRecorder 记录响应状态码，用于判断投递是否被成功接收
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// acceptDelivery 基于 X-GitHub-Delivery 对投递去重。
+// 重复投递直接确认并返回 ok=false；新投递返回包装后的 ResponseWriter，
+// 处理结束后调用 done，若处理失败则删除记录以便 GitHub 重新投递
+func (h *Handler) acceptDelivery(ctx context.Context, w http.ResponseWriter, deliveryID string) (rw http.ResponseWriter, done func(), ok bool) {
+	log := xlog.NewWith(ctx)
+
+	if h.deliveries == nil || deliveryID == "" {
+		return w, func() {}, true
+	}
+
+	if !h.deliveries.Add(deliveryID) {
+		log.Infof("Dedup decision: duplicate delivery %s, acknowledged without re-execution", deliveryID)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("duplicate delivery ignored: " + deliveryID))
+		return w, nil, false
+	}
+	log.Infof("Dedup decision: new delivery %s accepted", deliveryID)
+
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	return rec, func() {
+		if rec.status >= http.StatusBadRequest {
+			log.Infof("Delivery %s was not processed (status %d), allowing redelivery", deliveryID, rec.status)
+			h.deliveries.Remove(deliveryID)
+		}
+	}, true
+}
+
+// enqueueJob 将任务写入持久化队列，服务重启后未完成的任务会被恢复执行
+func (h *Handler) enqueueJob(ctx context.Context, w http.ResponseWriter, jobType string, payload agent.JobPayload, message string) {
+	log := xlog.NewWith(ctx)
+
+	if h.jobQueue == nil {
+		log.Errorf("Job queue is not configured, cannot enqueue %s job", jobType)
+		http.Error(w, "job queue not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	if !h.checkPermission(ctx, w, payload.Event) {
+		return
+	}
+	if !h.checkBudget(ctx, w, payload.Event) {
+		return
 	}
+
+	traceID, _ := reqid.FromContext(ctx)
+	job, err := h.jobQueue.Enqueue(jobType, traceID, payload)
+	if err != nil {
+		log.Errorf("Failed to enqueue %s job: %v", jobType, err)
+		http.Error(w, "failed to enqueue job", http.StatusInternalServerError)
+		return
+	}
+	log.Infof("Enqueued job %s (%s)", job.ID, jobType)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(message))
+}
+
+// cancelTasks 同步取消 Issue/PR 上正在执行的任务，不经过任务队列，避免排在被取消的任务之后。
+// 与其他命令一样，机器人的评论被忽略，没有权限的用户不能取消任务
+func (h *Handler) cancelTasks(ctx context.Context, w http.ResponseWriter, repo *github.Repository, number int, sender *github.User) {
+	log := xlog.NewWith(ctx)
+
+	org, name, user := repo.GetOwner().GetLogin(), repo.GetName(), sender.GetLogin()
+	if h.fromAgent(ctx, sender) {
+		log.Infof("Ignoring /cancel from %s", user)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("event from bot ignored"))
+		return
+	}
+	if !h.allowCommand(ctx, w, org, name, number, user) {
+		return
+	}
+
+	var cancelled int
+	switch {
+	case h.agent != nil:
+		cancelled = h.agent.CancelTasks(ctx, org, name, number, user)
+	case h.enhancedAgent != nil:
+		cancelled = h.enhancedAgent.CancelTasks(ctx, org, name, number, user)
+	}
+	log.Infof("Received /cancel command for %s/%s#%d from %s, cancelled %d task(s)", org, name, number, user, cancelled)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("cancelled %d running task(s)", cancelled)))
 }
 
 // parseCommandArgs 解析命令参数，提取AI模型和其他参数
-func parseCommandArgs(comment, command string, defaultAIModel string) (aiModel, args string) {
+func parseCommandArgs(comment, command string) (aiModel, args string) {
 	// 提取命令参数
 	commandArgs := strings.TrimSpace(strings.TrimPrefix(comment, command))
 
-	// 检查是否包含AI模型参数
-	if strings.HasPrefix(commandArgs, "-claude") {
-		aiModel = "claude"
-		args = strings.TrimSpace(strings.TrimPrefix(commandArgs, "-claude"))
-	} else if strings.HasPrefix(commandArgs, "-gemini") {
-		aiModel = "gemini"
-		args = strings.TrimSpace(strings.TrimPrefix(commandArgs, "-gemini"))
-	} else {
-		// 没有指定AI模型，使用默认配置
-		aiModel = defaultAIModel
-		args = commandArgs
-	}
-
-	return aiModel, args
+	// 检查是否包含AI模型参数，可用参数由 code provider 注册表提供；
+	// 没有指定时返回空，由 agent 按 PR 分支、仓库级配置和全局配置确定
+	return models.ParseAIModelFlag(commandArgs, code.Providers())
 }
 
 // HandleWebhook 通用 Webhook 处理器 - 自动检测使用原始或Enhanced Agent
@@ -78,27 +186,8 @@ func (h *Handler) handleOriginalWebhook(w http.ResponseWriter, r *http.Request)
 	}
 
 	// 2. 验证 Webhook 签名
-	if h.config.Server.WebhookSecret != "" {
-		// 优先使用 SHA-256 签名
-		sig256 := r.Header.Get("X-Hub-Signature-256")
-		if sig256 != "" {
-			if err := signature.ValidateGitHubSignature(sig256, body, h.config.Server.WebhookSecret); err != nil {
-				http.Error(w, "invalid signature", http.StatusUnauthorized)
-				return
-			}
-		} else {
-			// 如果没有 SHA-256 签名，尝试 SHA-1 签名 (已弃用但仍支持)
-			sig1 := r.Header.Get("X-Hub-Signature")
-			if sig1 != "" {
-				if err := signature.ValidateGitHubSignatureSHA1(sig1, body, h.config.Server.WebhookSecret); err != nil {
-					http.Error(w, "invalid signature", http.StatusUnauthorized)
-					return
-				}
-			} else {
-				http.Error(w, "missing signature", http.StatusUnauthorized)
-				return
-			}
-		}
+	if !h.verifySignature(r.Context(), w, r, body) {
+		return
 	}
 
 	// 3. 获取事件类型
@@ -127,7 +216,14 @@ func (h *Handler) handleOriginalWebhook(w http.ResponseWriter, r *http.Request)
 	xl.Infof("Received webhook event: %s", eventType)
 	xl.Debugf("Request body size: %d bytes", len(body))
 
-	// 5. 根据事件类型分发处理
+	// 5. 投递去重，已接收过的投递不再重复执行
+	w, done, ok := h.acceptDelivery(ctx, w, deliveryID)
+	if !ok {
+		return
+	}
+	defer done()
+
+	// 6. 根据事件类型分发处理
 	switch eventType {
 	case "issue_comment":
 		h.handleIssueComment(ctx, w, body)
@@ -158,6 +254,13 @@ func (h *Handler) handleIssueComment(ctx context.Context, w http.ResponseWriter,
 		return
 	}
 
+	if h.fromAgent(ctx, event.Sender) {
+		log.Infof("Ignoring issue comment from %s", event.Sender.GetLogin())
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("event from bot ignored"))
+		return
+	}
+
 	// 检查是否包含命令
 	if event.Comment == nil || event.Issue == nil {
 		log.Debugf("Issue comment event missing comment or issue data")
@@ -172,6 +275,12 @@ func (h *Handler) handleIssueComment(ctx context.Context, w http.ResponseWriter,
 	log.Infof("Processing issue comment: issue=#%d, title=%s, comment_length=%d",
 		issueNumber, issueTitle, len(comment))
 
+	// /cancel 对 Issue 和 PR 评论都生效
+	if strings.HasPrefix(comment, models.CommandCancel) {
+		h.cancelTasks(ctx, w, event.Repo, issueNumber, event.Sender)
+		return
+	}
+
 	// 检查是否是 PR 评论（Issue 的 PullRequest 字段不为空）
 	if event.Issue.PullRequestLinks != nil {
 		log.Infof("Detected PR comment for PR #%d", issueNumber)
@@ -181,43 +290,29 @@ func (h *Handler) handleIssueComment(ctx context.Context, w http.ResponseWriter,
 			log.Infof("Received /continue command for PR #%d: %s", issueNumber, issueTitle)
 
 			// 解析AI模型参数
-			aiModel, args := parseCommandArgs(comment, "/continue", h.config.CodeProvider)
+			aiModel, args := parseCommandArgs(comment, "/continue")
 			log.Infof("Parsed AI model: %s, args: %s", aiModel, args)
 
-			// 异步执行继续任务
-			go func(event *github.IssueCommentEvent, aiModel, args string, traceCtx context.Context) {
-				traceLog := xlog.NewWith(traceCtx)
-				traceLog.Infof("Starting PR continue task with AI model: %s", aiModel)
-				if err := h.agent.ContinuePRWithArgsAndAI(traceCtx, event, aiModel, args); err != nil {
-					traceLog.Errorf("Agent continue PR error: %v", err)
-				} else {
-					traceLog.Infof("PR continue task completed successfully")
-				}
-			}(&event, aiModel, args, ctx)
-
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("pr continue started"))
+			// 入队异步执行继续任务
+			h.enqueueJob(ctx, w, agent.JobPRContinue, agent.JobPayload{
+				Event:   body,
+				AIModel: aiModel,
+				Args:    args,
+			}, "pr continue started")
 			return
 		} else if strings.HasPrefix(comment, "/fix") {
 			log.Infof("Received /fix command for PR #%d: %s", issueNumber, issueTitle)
 
 			// 解析AI模型参数
-			aiModel, args := parseCommandArgs(comment, "/fix", h.config.CodeProvider)
+			aiModel, args := parseCommandArgs(comment, "/fix")
 			log.Infof("Parsed AI model: %s, args: %s", aiModel, args)
 
-			// 异步执行修复任务
-			go func(event *github.IssueCommentEvent, aiModel, args string, traceCtx context.Context) {
-				traceLog := xlog.NewWith(traceCtx)
-				traceLog.Infof("Starting PR fix task with AI model: %s", aiModel)
-				if err := h.agent.FixPRWithArgsAndAI(traceCtx, event, aiModel, args); err != nil {
-					traceLog.Errorf("Agent fix PR error: %v", err)
-				} else {
-					traceLog.Infof("PR fix task completed successfully")
-				}
-			}(&event, aiModel, args, ctx)
-
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("pr fix started"))
+			// 入队异步执行修复任务
+			h.enqueueJob(ctx, w, agent.JobPRFix, agent.JobPayload{
+				Event:   body,
+				AIModel: aiModel,
+				Args:    args,
+			}, "pr fix started")
 			return
 		}
 	}
@@ -228,22 +323,15 @@ func (h *Handler) handleIssueComment(ctx context.Context, w http.ResponseWriter,
 			event.Issue.GetHTMLURL(), issueTitle)
 
 		// 解析AI模型参数
-		aiModel, args := parseCommandArgs(comment, "/code", h.config.CodeProvider)
+		aiModel, args := parseCommandArgs(comment, "/code")
 		log.Infof("Parsed AI model: %s, args: %s", aiModel, args)
 
-		// 异步执行 Agent 任务
-		go func(event *github.IssueCommentEvent, aiModel, args string, traceCtx context.Context) {
-			traceLog := xlog.NewWith(traceCtx)
-			traceLog.Infof("Starting issue processing task with AI model: %s", aiModel)
-			if err := h.agent.ProcessIssueCommentWithAI(traceCtx, event, aiModel, args); err != nil {
-				traceLog.Errorf("Agent process issue error: %v", err)
-			} else {
-				traceLog.Infof("Issue processing task completed successfully")
-			}
-		}(&event, aiModel, args, ctx)
-
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("issue processing started"))
+		// 入队异步执行 Agent 任务
+		h.enqueueJob(ctx, w, agent.JobIssueCode, agent.JobPayload{
+			Event:   body,
+			AIModel: aiModel,
+			Args:    args,
+		}, "issue processing started")
 		return
 	}
 
@@ -263,6 +351,13 @@ func (h *Handler) handlePRReviewComment(ctx context.Context, w http.ResponseWrit
 		return
 	}
 
+	if h.fromAgent(ctx, event.Sender) {
+		log.Infof("Ignoring PR review comment from %s", event.Sender.GetLogin())
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("event from bot ignored"))
+		return
+	}
+
 	prNumber := event.PullRequest.GetNumber()
 	prTitle := event.PullRequest.GetTitle()
 	log.Infof("Received PR review comment for PR #%d: %s", prNumber, prTitle)
@@ -280,47 +375,50 @@ func (h *Handler) handlePRReviewComment(ctx context.Context, w http.ResponseWrit
 	log.Infof("Processing PR review comment: file=%s, line=%d, comment_length=%d",
 		filePath, line, len(comment))
 
-	if strings.HasPrefix(comment, "/continue") {
+	if strings.HasPrefix(comment, models.CommandCancel) {
+		h.cancelTasks(ctx, w, event.Repo, prNumber, event.Sender)
+		return
+	} else if strings.HasPrefix(comment, "/continue") {
 		log.Infof("Received /continue command in PR review comment for PR #%d: %s", prNumber, prTitle)
 
 		// 解析AI模型参数
-		aiModel, args := parseCommandArgs(comment, "/continue", h.config.CodeProvider)
+		aiModel, args := parseCommandArgs(comment, "/continue")
 		log.Infof("Parsed AI model: %s, args: %s", aiModel, args)
 
-		// 异步执行继续任务
-		go func(event *github.PullRequestReviewCommentEvent, aiModel, args string, traceCtx context.Context) {
-			traceLog := xlog.NewWith(traceCtx)
-			traceLog.Infof("Starting PR continue from review comment task with AI model: %s", aiModel)
-			if err := h.agent.ContinuePRFromReviewCommentWithAI(traceCtx, event, aiModel, args); err != nil {
-				traceLog.Errorf("Agent continue PR from review comment error: %v", err)
-			} else {
-				traceLog.Infof("PR continue from review comment task completed successfully")
-			}
-		}(&event, aiModel, args, ctx)
-
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("pr continue from review comment started"))
+		// 入队异步执行继续任务
+		h.enqueueJob(ctx, w, agent.JobReviewCommentContinue, agent.JobPayload{
+			Event:   body,
+			AIModel: aiModel,
+			Args:    args,
+		}, "pr continue from review comment started")
 		return
 	} else if strings.HasPrefix(comment, "/fix") {
 		log.Infof("Received /fix command in PR review comment for PR #%d: %s", prNumber, prTitle)
 
 		// 解析AI模型参数
-		aiModel, args := parseCommandArgs(comment, "/fix", h.config.CodeProvider)
+		aiModel, args := parseCommandArgs(comment, "/fix")
 		log.Infof("Parsed AI model: %s, args: %s", aiModel, args)
 
-		// 异步执行修复任务
-		go func(event *github.PullRequestReviewCommentEvent, aiModel, args string, traceCtx context.Context) {
-			traceLog := xlog.NewWith(traceCtx)
-			traceLog.Infof("Starting PR fix from review comment task with AI model: %s", aiModel)
-			if err := h.agent.FixPRFromReviewCommentWithAI(traceCtx, event, aiModel, args); err != nil {
-				traceLog.Errorf("Agent fix PR from review comment error: %v", err)
-			} else {
-				traceLog.Infof("PR fix from review comment task completed successfully")
-			}
-		}(&event, aiModel, args, ctx)
+		// 入队异步执行修复任务
+		h.enqueueJob(ctx, w, agent.JobReviewCommentFix, agent.JobPayload{
+			Event:   body,
+			AIModel: aiModel,
+			Args:    args,
+		}, "pr fix from review comment started")
+		return
+	} else if strings.HasPrefix(comment, models.CommandSuggest) {
+		log.Infof("Received /suggest command in PR review comment for PR #%d: %s", prNumber, prTitle)
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("pr fix from review comment started"))
+		// 解析AI模型参数
+		aiModel, args := parseCommandArgs(comment, models.CommandSuggest)
+		log.Infof("Parsed AI model: %s, args: %s", aiModel, args)
+
+		// 入队异步执行，结果以 suggestion 代码块回复评论
+		h.enqueueJob(ctx, w, agent.JobReviewCommentSuggest, agent.JobPayload{
+			Event:   body,
+			AIModel: aiModel,
+			Args:    args,
+		}, "pr suggestion from review comment started")
 		return
 	}
 
@@ -339,6 +437,13 @@ func (h *Handler) handlePRReview(ctx context.Context, w http.ResponseWriter, bod
 		return
 	}
 
+	if h.fromAgent(ctx, event.Sender) {
+		log.Infof("Ignoring PR review from %s", event.Sender.GetLogin())
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("event from bot ignored"))
+		return
+	}
+
 	prNumber := event.PullRequest.GetNumber()
 	prTitle := event.PullRequest.GetTitle()
 	reviewID := event.Review.GetID()
@@ -371,10 +476,10 @@ func (h *Handler) handlePRReview(ctx context.Context, w http.ResponseWriter, bod
 
 		if strings.HasPrefix(reviewBody, "/continue") {
 			command = "/continue"
-			aiModel, args = parseCommandArgs(reviewBody, "/continue", h.config.CodeProvider)
+			aiModel, args = parseCommandArgs(reviewBody, "/continue")
 		} else {
 			command = "/fix"
-			aiModel, args = parseCommandArgs(reviewBody, "/fix", h.config.CodeProvider)
+			aiModel, args = parseCommandArgs(reviewBody, "/fix")
 		}
 
 		log.Infof("Received %s command in PR review for PR #%d: %s", command, prNumber, prTitle)
@@ -386,19 +491,14 @@ func (h *Handler) handlePRReview(ctx context.Context, w http.ResponseWriter, bod
 			triggerUser = event.Review.User.GetLogin()
 		}
 
-		// 异步执行批量处理任务
-		go func(event *github.PullRequestReviewEvent, cmd string, aiModel, args string, triggerUser string, traceCtx context.Context) {
-			traceLog := xlog.NewWith(traceCtx)
-			traceLog.Infof("Starting PR batch processing from review task with AI model: %s", aiModel)
-			if err := h.agent.ProcessPRFromReviewWithTriggerUserAndAI(traceCtx, event, cmd, aiModel, args, triggerUser); err != nil {
-				traceLog.Errorf("Agent process PR from review error: %v", err)
-			} else {
-				traceLog.Infof("PR batch processing from review task completed successfully")
-			}
-		}(&event, command, aiModel, args, triggerUser, ctx)
-
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("pr batch processing from review started"))
+		// 入队异步执行批量处理任务
+		h.enqueueJob(ctx, w, agent.JobPRReviewBatch, agent.JobPayload{
+			Event:       body,
+			Command:     command,
+			AIModel:     aiModel,
+			Args:        args,
+			TriggerUser: triggerUser,
+		}, "pr batch processing from review started")
 		return
 	}
 
@@ -423,32 +523,30 @@ func (h *Handler) handlePullRequest(ctx context.Context, w http.ResponseWriter,
 	prTitle := event.PullRequest.GetTitle()
 	log.Infof("Pull request event: action=%s, number=%d, title=%s", action, prNumber, prTitle)
 
+	// CodeAgent 自己创建的 PR 和推送的提交不再审查，避免审查自己的输出
+	if (action == "opened" || action == "synchronize") && h.fromAgent(ctx, event.Sender) {
+		log.Infof("Ignoring pull request %s from %s", action, event.Sender.GetLogin())
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("event from bot ignored"))
+		return
+	}
+
 	// 根据 PR 动作类型处理
 	switch action {
 	case "opened":
-		// PR 被创建，可以自动审查
-		log.Infof("PR opened, starting review process")
-		go func(pr *github.PullRequest, traceCtx context.Context) {
-			traceLog := xlog.NewWith(traceCtx)
-			traceLog.Infof("Starting PR review task")
-			if err := h.agent.ReviewPR(traceCtx, pr); err != nil {
-				traceLog.Errorf("Agent review PR error: %v", err)
-			} else {
-				traceLog.Infof("PR review task completed successfully")
-			}
-		}(event.PullRequest, ctx)
+		// PR 被创建，入队自动审查
+		log.Infof("PR opened, enqueueing review")
+		h.enqueueJob(ctx, w, agent.JobPRReview, agent.JobPayload{
+			Event: body,
+		}, "pr review started")
+		return
 	case "synchronize":
-		// PR 有新的提交，可以重新审查
-		log.Infof("PR synchronized, starting re-review process")
-		go func(pr *github.PullRequest, traceCtx context.Context) {
-			traceLog := xlog.NewWith(traceCtx)
-			traceLog.Infof("Starting PR re-review task")
-			if err := h.agent.ReviewPR(traceCtx, pr); err != nil {
-				traceLog.Errorf("Agent review PR error: %v", err)
-			} else {
-				traceLog.Infof("PR re-review task completed successfully")
-			}
-		}(event.PullRequest, ctx)
+		// PR 有新的提交，入队增量审查
+		log.Infof("PR synchronized, enqueueing re-review")
+		h.enqueueJob(ctx, w, agent.JobPRReReview, agent.JobPayload{
+			Event: body,
+		}, "pr re-review started")
+		return
 	case "closed":
 		// PR 被关闭，执行清理（无论是否合并）
 		log.Infof("PR closed, starting cleanup process (merged: %v)", event.PullRequest.GetMerged())
@@ -468,7 +566,7 @@ func (h *Handler) handlePullRequest(ctx context.Context, w http.ResponseWriter,
 	}
 
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("pr review started"))
+	w.Write([]byte("pr cleanup started"))
 }
 
 // handlePush 处理 Push 事件
@@ -487,8 +585,18 @@ func (h *Handler) handlePush(ctx context.Context, w http.ResponseWriter, body []
 	commitsCount := len(event.Commits)
 	log.Infof("Push event received: ref=%s, commits_count=%d", ref, commitsCount)
 
-	// 可以在这里处理代码推送事件
-	// 比如自动运行测试、代码质量检查等
+	if h.agent != nil {
+		// 推送到默认分支后仓库级配置（.codeagent.yaml）可能已变化
+		h.agent.InvalidateRepoConfig(&event)
+
+		// 推送到受保护分支的提交入队进行推送后分析
+		if h.agent.ShouldAnalyzePush(&event) {
+			h.enqueueJob(ctx, w, agent.JobPushAnalysis, agent.JobPayload{
+				Event: body,
+			}, "push analysis started")
+			return
+		}
+	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("push event received"))
@@ -504,27 +612,8 @@ func (h *Handler) handleEnhancedWebhook(w http.ResponseWriter, r *http.Request)
 	}
 
 	// 2. 验证 Webhook 签名
-	if h.config.Server.WebhookSecret != "" {
-		// 优先使用 SHA-256 签名
-		sig256 := r.Header.Get("X-Hub-Signature-256")
-		if sig256 != "" {
-			if err := signature.ValidateGitHubSignature(sig256, body, h.config.Server.WebhookSecret); err != nil {
-				http.Error(w, "invalid signature", http.StatusUnauthorized)
-				return
-			}
-		} else {
-			// 如果没有 SHA-256 签名，尝试 SHA-1 签名 (已弃用但仍支持)
-			sig1 := r.Header.Get("X-Hub-Signature")
-			if sig1 != "" {
-				if err := signature.ValidateGitHubSignatureSHA1(sig1, body, h.config.Server.WebhookSecret); err != nil {
-					http.Error(w, "invalid signature", http.StatusUnauthorized)
-					return
-				}
-			} else {
-				http.Error(w, "missing signature", http.StatusUnauthorized)
-				return
-			}
-		}
+	if !h.verifySignature(r.Context(), w, r, body) {
+		return
 	}
 
 	// 3. 获取事件类型
@@ -551,28 +640,66 @@ func (h *Handler) handleEnhancedWebhook(w http.ResponseWriter, r *http.Request)
 	xl.Infof("Received webhook event via Enhanced Handler: %s", eventType)
 	xl.Debugf("Request body size: %d bytes", len(body))
 
-	// 5. 解析为通用JSON以传递给Enhanced Agent
-	var rawEvent interface{}
-	if err := json.Unmarshal(body, &rawEvent); err != nil {
-		xl.Errorf("Failed to parse webhook event JSON: %v", err)
+	// 5. 投递去重，已接收过的投递不再重复执行
+	w, done, ok := h.acceptDelivery(ctx, w, deliveryID)
+	if !ok {
+		return
+	}
+	defer done()
+
+	// 6. 校验为合法JSON后传递给Enhanced Agent
+	if !json.Valid(body) {
+		xl.Errorf("Failed to parse webhook event JSON")
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte("invalid JSON"))
 		return
 	}
 
-	// 6. 使用Enhanced Agent的统一事件处理
-	go func(eventType string, rawEvent interface{}, traceCtx context.Context) {
-		traceLog := xlog.NewWith(traceCtx)
-		traceLog.Infof("Starting Enhanced Agent event processing: %s", eventType)
-		
-		if err := h.enhancedAgent.ProcessGitHubEvent(traceCtx, eventType, rawEvent); err != nil {
-			traceLog.Errorf("Enhanced Agent event processing error: %v", err)
-		} else {
-			traceLog.Infof("Enhanced Agent event processing completed successfully")
-		}
-	}(eventType, rawEvent, ctx)
+	// 7. /cancel 需要立即中止正在执行的任务，不能进入队列
+	if repo, number, sender, ok := parseCancelCommand(eventType, body); ok {
+		h.cancelTasks(ctx, w, repo, number, sender)
+		return
+	}
 
-	// 7. 返回成功响应
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("enhanced event processing started"))
+	// 8. 入队，由Enhanced Agent的统一事件处理执行
+	h.enqueueJob(ctx, w, agent.JobGitHubEvent, agent.JobPayload{
+		EventType: eventType,
+		Event:     body,
+	}, "enhanced event processing started")
+}
+
+// parseCancelCommand 识别评论中的 /cancel 命令，返回对应的仓库、Issue/PR 编号和评论人
+func parseCancelCommand(eventType string, body []byte) (repo *github.Repository, number int, sender *github.User, ok bool) {
+	var event struct {
+		Repo    *github.Repository `json:"repository"`
+		Sender  *github.User       `json:"sender"`
+		Comment *struct {
+			Body string `json:"body"`
+		} `json:"comment"`
+		Issue *struct {
+			Number int `json:"number"`
+		} `json:"issue"`
+		PullRequest *struct {
+			Number int `json:"number"`
+		} `json:"pull_request"`
+	}
+
+	switch eventType {
+	case "issue_comment", "pull_request_review_comment":
+	default:
+		return nil, 0, nil, false
+	}
+	if err := json.Unmarshal(body, &event); err != nil || event.Comment == nil {
+		return nil, 0, nil, false
+	}
+	if !strings.HasPrefix(strings.TrimSpace(event.Comment.Body), models.CommandCancel) {
+		return nil, 0, nil, false
+	}
+
+	if event.Issue != nil {
+		number = event.Issue.Number
+	} else if event.PullRequest != nil {
+		number = event.PullRequest.Number
+	}
+	return event.Repo, number, event.Sender, true
 }
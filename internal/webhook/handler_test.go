@@ -2,14 +2,28 @@ package webhook
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/qiniu/codeagent/internal/agent"
 	"github.com/qiniu/codeagent/internal/config"
+	"github.com/qiniu/codeagent/internal/dedup"
+	"github.com/qiniu/codeagent/internal/locale"
+	"github.com/qiniu/codeagent/internal/permission"
+	"github.com/qiniu/codeagent/internal/queue"
+	"github.com/qiniu/codeagent/internal/usage"
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/google/go-github/v58/github"
 )
 
 func TestHandleWebhook_SignatureValidation(t *testing.T) {
@@ -21,7 +35,7 @@ func TestHandleWebhook_SignatureValidation(t *testing.T) {
 	}
 
 	// 创建处理器
-	handler := NewHandler(cfg, nil)
+	handler := NewHandler(cfg, nil, nil, nil, nil)
 
 	// 测试数据
 	payload := []byte(`{"action":"opened","number":1}`)
@@ -94,7 +108,7 @@ func TestHandleWebhook_NoSecretConfigured(t *testing.T) {
 	}
 
 	// 创建处理器
-	handler := NewHandler(cfg, nil)
+	handler := NewHandler(cfg, nil, nil, nil, nil)
 
 	// 测试数据
 	payload := []byte(`{"action":"opened","number":1}`)
@@ -120,3 +134,542 @@ func TestHandleWebhook_NoSecretConfigured(t *testing.T) {
 		t.Errorf("Expected body %q, got %q", expectedBody, rr.Body.String())
 	}
 }
+
+func TestHandleSignatureStats_DisabledWithoutToken(t *testing.T) {
+	cfg := &config.Config{
+		Usage: config.UsageConfig{Token: "usage-token"},
+	}
+	handler := NewHandler(cfg, nil, nil, nil, nil)
+
+	req := httptest.NewRequest("GET", "/webhook/signatures", nil)
+	req.Header.Set("Authorization", "Bearer usage-token")
+	rr := httptest.NewRecorder()
+	handler.HandleSignatureStats(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestHandleWebhook_MultipleSecrets(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			WebhookSecret:       "new-secret",
+			WebhookSecrets:      []string{"old-secret"},
+			RepoWebhookSecrets:  map[string][]string{"org/private": {"repo-secret"}},
+			SignatureStatsToken: "stats-token",
+		},
+		Usage: config.UsageConfig{Token: "usage-token"},
+	}
+	handler := NewHandler(cfg, nil, nil, nil, nil)
+
+	sign := func(secret string, payload []byte) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(payload)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	deliver := func(payload []byte, sig string) int {
+		req := httptest.NewRequest("POST", "/hook", bytes.NewReader(payload))
+		req.Header.Set("X-Hub-Signature-256", sig)
+		rr := httptest.NewRecorder()
+		handler.HandleWebhook(rr, req)
+		return rr.Code
+	}
+
+	public := []byte(`{"repository":{"full_name":"org/public"}}`)
+	private := []byte(`{"repository":{"full_name":"org/private"}}`)
+
+	// 轮换期间新旧 secret 都被接受（没有 X-GitHub-Event 头，签名通过后返回 400）
+	if code := deliver(public, sign("new-secret", public)); code != http.StatusBadRequest {
+		t.Errorf("Expected new secret to be accepted, got %d", code)
+	}
+	if code := deliver(public, sign("old-secret", public)); code != http.StatusBadRequest {
+		t.Errorf("Expected old secret to be accepted, got %d", code)
+	}
+	// 仓库单独配置的 secret 只用于该仓库
+	if code := deliver(private, sign("repo-secret", private)); code != http.StatusBadRequest {
+		t.Errorf("Expected repo secret to be accepted, got %d", code)
+	}
+	if code := deliver(public, sign("repo-secret", public)); code != http.StatusUnauthorized {
+		t.Errorf("Expected repo secret to be rejected for other repos, got %d", code)
+	}
+
+	req := httptest.NewRequest("GET", "/webhook/signatures", nil)
+	rr := httptest.NewRecorder()
+	handler.HandleSignatureStats(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected stats to require the stats token, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/webhook/signatures", nil)
+	req.Header.Set("Authorization", "Bearer usage-token")
+	rr = httptest.NewRecorder()
+	handler.HandleSignatureStats(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected stats to reject the usage token, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/webhook/signatures", nil)
+	req.Header.Set("Authorization", "Bearer stats-token")
+	rr = httptest.NewRecorder()
+	handler.HandleSignatureStats(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if strings.Contains(rr.Body.String(), "new-secret") || strings.Contains(rr.Body.String(), "old-secret") {
+		t.Errorf("Stats must not expose secret values: %s", rr.Body.String())
+	}
+
+	var report signatureReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+	counts := make(map[string]int64)
+	for _, secret := range report.Secrets {
+		counts[secret.Name] = secret.Count
+	}
+	if counts["webhook_secret"] != 1 || counts["webhook_secrets#0"] != 1 || counts["repo:org/private#0"] != 1 || report.Failures != 1 {
+		t.Errorf("Unexpected stats: %s", rr.Body.String())
+	}
+}
+
+func TestHandleWebhook_EnqueuesCommandJob(t *testing.T) {
+	cfg := &config.Config{
+		CodeProvider: "claude",
+	}
+
+	jobQueue, err := queue.New(t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("Failed to create job queue: %v", err)
+	}
+	handler := NewHandler(cfg, nil, jobQueue, nil, nil)
+
+	payload := []byte(`{"action":"created","issue":{"number":1,"title":"test"},"comment":{"body":"/code -gemini implement it"}}`)
+	req := httptest.NewRequest("POST", "/hook", bytes.NewReader(payload))
+	req.Header.Set("X-GitHub-Event", "issue_comment")
+	req.Header.Set("X-GitHub-Delivery", "12345678-abcd")
+
+	rr := httptest.NewRecorder()
+	handler.HandleWebhook(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	jobs := jobQueue.List()
+	if len(jobs) != 1 {
+		t.Fatalf("Expected 1 queued job, got %d", len(jobs))
+	}
+	job := jobs[0]
+	if job.Type != agent.JobIssueCode || job.Status != queue.StatusQueued || job.TraceID != "12345678" {
+		t.Errorf("Unexpected job: type=%s status=%s trace=%s", job.Type, job.Status, job.TraceID)
+	}
+
+	var jobPayload agent.JobPayload
+	if err := json.Unmarshal(job.Payload, &jobPayload); err != nil {
+		t.Fatalf("Failed to unmarshal job payload: %v", err)
+	}
+	if jobPayload.AIModel != "gemini" || jobPayload.Args != "implement it" {
+		t.Errorf("Unexpected payload: ai_model=%s args=%s", jobPayload.AIModel, jobPayload.Args)
+	}
+}
+
+func TestHandleWebhook_IgnoresBotComments(t *testing.T) {
+	jobQueue, err := queue.New(t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("Failed to create job queue: %v", err)
+	}
+	handler := NewHandler(&config.Config{}, nil, jobQueue, nil, nil)
+
+	// CodeAgent（以 GitHub App 身份）发布的评论引用了命令文本
+	payload := []byte(`{"action":"created","issue":{"number":1,"title":"test","pull_request":{}},"comment":{"body":"/continue quoted from the original prompt"},"sender":{"login":"codeagent[bot]","type":"Bot"}}`)
+	req := httptest.NewRequest("POST", "/hook", bytes.NewReader(payload))
+	req.Header.Set("X-GitHub-Event", "issue_comment")
+
+	rr := httptest.NewRecorder()
+	handler.HandleWebhook(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "event from bot ignored" {
+		t.Errorf("Expected bot comment to be ignored, got %d %q", rr.Code, rr.Body.String())
+	}
+	if jobs := jobQueue.List(); len(jobs) != 0 {
+		t.Errorf("Expected no queued jobs, got %d", len(jobs))
+	}
+}
+
+func TestHandleWebhook_EnqueuesSuggestJob(t *testing.T) {
+	cfg := &config.Config{
+		CodeProvider: "claude",
+	}
+
+	jobQueue, err := queue.New(t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("Failed to create job queue: %v", err)
+	}
+	handler := NewHandler(cfg, nil, jobQueue, nil, nil)
+
+	payload := []byte(`{"action":"created","pull_request":{"number":2,"title":"test"},"comment":{"id":9,"path":"main.go","line":12,"body":"/suggest use a constant"}}`)
+	req := httptest.NewRequest("POST", "/hook", bytes.NewReader(payload))
+	req.Header.Set("X-GitHub-Event", "pull_request_review_comment")
+
+	rr := httptest.NewRecorder()
+	handler.HandleWebhook(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	jobs := jobQueue.List()
+	if len(jobs) != 1 || jobs[0].Type != agent.JobReviewCommentSuggest {
+		t.Fatalf("Expected 1 suggest job, got %+v", jobs)
+	}
+
+	var jobPayload agent.JobPayload
+	if err := json.Unmarshal(jobs[0].Payload, &jobPayload); err != nil {
+		t.Fatalf("Failed to unmarshal job payload: %v", err)
+	}
+	// 未指定模型时由 agent 按 PR 分支和仓库级配置确定
+	if jobPayload.AIModel != "" || jobPayload.Args != "use a constant" {
+		t.Errorf("Unexpected payload: ai_model=%s args=%s", jobPayload.AIModel, jobPayload.Args)
+	}
+}
+
+func TestHandleWebhook_CancelIsNotQueued(t *testing.T) {
+	cfg := &config.Config{
+		CodeProvider: "claude",
+	}
+
+	jobQueue, err := queue.New(t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("Failed to create job queue: %v", err)
+	}
+	handler := NewHandler(cfg, nil, jobQueue, nil, nil)
+
+	payload := []byte(`{"action":"created","repository":{"name":"repo","owner":{"login":"org"}},"sender":{"login":"alice"},"issue":{"number":1,"title":"test","pull_request":{}},"comment":{"body":"/cancel"}}`)
+	req := httptest.NewRequest("POST", "/hook", bytes.NewReader(payload))
+	req.Header.Set("X-GitHub-Event", "issue_comment")
+
+	rr := httptest.NewRecorder()
+	handler.HandleWebhook(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr.Body.String() != "cancelled 0 running task(s)" {
+		t.Errorf("Unexpected body: %q", rr.Body.String())
+	}
+	if n := len(jobQueue.List()); n != 0 {
+		t.Errorf("Expected /cancel not to enqueue a job, got %d jobs", n)
+	}
+}
+
+func TestHandleWebhook_EnqueuesPRReviewJobs(t *testing.T) {
+	jobQueue, err := queue.New(t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("Failed to create job queue: %v", err)
+	}
+	handler := NewHandler(&config.Config{}, nil, jobQueue, nil, nil)
+
+	for _, action := range []string{"opened", "synchronize"} {
+		payload := []byte(`{"action":"` + action + `","before":"aaa","repository":{"name":"repo","owner":{"login":"org"}},"pull_request":{"number":3,"title":"test"}}`)
+		req := httptest.NewRequest("POST", "/hook", bytes.NewReader(payload))
+		req.Header.Set("X-GitHub-Event", "pull_request")
+		rr := httptest.NewRecorder()
+		handler.HandleWebhook(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d for %s, got %d", http.StatusOK, action, rr.Code)
+		}
+	}
+
+	jobs := jobQueue.List()
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 queued review jobs, got %d", len(jobs))
+	}
+	types := map[string]bool{jobs[0].Type: true, jobs[1].Type: true}
+	if !types[agent.JobPRReview] || !types[agent.JobPRReReview] {
+		t.Errorf("Unexpected job types: %s, %s", jobs[0].Type, jobs[1].Type)
+	}
+}
+
+func TestHandleWebhook_IgnoresPREventsFromAgent(t *testing.T) {
+	jobQueue, err := queue.New(t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("Failed to create job queue: %v", err)
+	}
+	handler := NewHandler(&config.Config{}, nil, jobQueue, nil, nil)
+	handler.commands = &fakeGuard{}
+
+	// CodeAgent 在 /code、/fix 中推送的提交和其他机器人的 PR 都不触发审查
+	for _, sender := range []string{`{"login":"codeagent"}`, `{"login":"renovate[bot]","type":"Bot"}`} {
+		for _, action := range []string{"opened", "synchronize"} {
+			payload := []byte(`{"action":"` + action + `","before":"aaa","repository":{"name":"repo","owner":{"login":"org"}},"sender":` + sender + `,"pull_request":{"number":3,"title":"test"}}`)
+			req := httptest.NewRequest("POST", "/hook", bytes.NewReader(payload))
+			req.Header.Set("X-GitHub-Event", "pull_request")
+			rr := httptest.NewRecorder()
+			handler.HandleWebhook(rr, req)
+			if rr.Code != http.StatusOK || rr.Body.String() != "event from bot ignored" {
+				t.Errorf("Expected %s from %s to be ignored, got %d %q", action, sender, rr.Code, rr.Body.String())
+			}
+		}
+	}
+	if n := len(jobQueue.List()); n != 0 {
+		t.Errorf("Expected no review jobs for PR events from CodeAgent, got %d", n)
+	}
+}
+
+// fakeGuard 只允许 allowed 中的用户触发命令
+type fakeGuard struct {
+	allowed []string
+}
+
+func (g *fakeGuard) IsAgent(ctx context.Context, user *github.User) bool {
+	return user.GetLogin() == "codeagent"
+}
+
+func (g *fakeGuard) CheckPermission(ctx context.Context, org, repo string, number int, user string) error {
+	for _, u := range g.allowed {
+		if u == user {
+			return nil
+		}
+	}
+	return &permission.DeniedError{User: user}
+}
+
+func TestHandleWebhook_CancelRequiresPermission(t *testing.T) {
+	handler := NewHandler(&config.Config{}, nil, nil, nil, nil)
+	handler.commands = &fakeGuard{allowed: []string{"alice"}}
+
+	send := func(user string) *httptest.ResponseRecorder {
+		payload := []byte(`{"action":"created","repository":{"name":"repo","owner":{"login":"org"}},"sender":{"login":"` + user + `"},"issue":{"number":1,"title":"test","pull_request":{}},"comment":{"body":"/cancel"}}`)
+		req := httptest.NewRequest("POST", "/hook", bytes.NewReader(payload))
+		req.Header.Set("X-GitHub-Event", "issue_comment")
+		rr := httptest.NewRecorder()
+		handler.HandleWebhook(rr, req)
+		return rr
+	}
+
+	if rr := send("mallory"); rr.Code != http.StatusOK || rr.Body.String() != "permission denied" {
+		t.Errorf("Expected /cancel without permission to be refused, got %d %q", rr.Code, rr.Body.String())
+	}
+	if rr := send("codeagent"); rr.Body.String() != "event from bot ignored" {
+		t.Errorf("Expected /cancel from CodeAgent to be ignored, got %q", rr.Body.String())
+	}
+	if rr := send("alice"); rr.Body.String() != "cancelled 0 running task(s)" {
+		t.Errorf("Expected /cancel with permission to run, got %q", rr.Body.String())
+	}
+}
+
+func TestBudgetExceededComment(t *testing.T) {
+	exceeded := &usage.ExceededError{
+		Scope:    usage.ScopeRepo,
+		Name:     "org/repo",
+		Period:   usage.PeriodDaily,
+		Unit:     "tokens",
+		Used:     800,
+		Limit:    1000,
+		Estimate: 400,
+		ResetAt:  time.Date(2024, 5, 21, 0, 0, 0, 0, time.UTC),
+	}
+
+	en := budgetExceededComment(locale.Get(locale.English), "alice", exceeded)
+	if !strings.HasPrefix(en, "@alice this command was not started because it would exceed the daily token budget of repository `org/repo`: 800 of 1000 tokens are used and a task uses about 400 tokens on average.") {
+		t.Errorf("Unexpected English comment: %s", en)
+	}
+	if !strings.Contains(en, "The budget resets at 2024-05-21 00:00 UTC.") {
+		t.Errorf("Expected reset time in English comment: %s", en)
+	}
+
+	zh := budgetExceededComment(locale.Get(locale.Chinese), "alice", exceeded)
+	if !strings.HasPrefix(zh, "@alice 此命令未执行：仓库 `org/repo` 的每日预算（token）已用 800 / 1000 token，每个任务平均使用约 400 token，执行后会超出预算。") {
+		t.Errorf("Unexpected Chinese comment: %s", zh)
+	}
+}
+
+func TestBudgetTargetIsCommand(t *testing.T) {
+	cases := map[string]bool{
+		"/code implement it": true,
+		"  /continue":        true,
+		"/cancel":            true,
+		"/foo bar":           false,
+		"looks good":         false,
+	}
+	for body, want := range cases {
+		var target budgetTarget
+		if err := json.Unmarshal([]byte(`{"comment":{"body":`+strconv.Quote(body)+`}}`), &target); err != nil {
+			t.Fatalf("Failed to unmarshal event: %v", err)
+		}
+		if got := target.isCommand(); got != want {
+			t.Errorf("isCommand(%q) = %v, want %v", body, got, want)
+		}
+	}
+}
+
+func TestHandleWebhook_BudgetExceededIsNotQueued(t *testing.T) {
+	cfg := &config.Config{
+		CodeProvider: "claude",
+	}
+
+	jobQueue, err := queue.New(t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("Failed to create job queue: %v", err)
+	}
+	store, err := usage.NewStore("", 0)
+	if err != nil {
+		t.Fatalf("Failed to create usage store: %v", err)
+	}
+	if err := store.Add(usage.Entry{Org: "org", Repo: "repo", User: "bob", Usage: models.TokenUsage{InputTokens: 1000}}); err != nil {
+		t.Fatalf("Failed to add usage entry: %v", err)
+	}
+	budget := usage.NewBudget(config.BudgetConfig{PerRepo: config.BudgetLimit{DailyTokens: 1000}, Exempt: []string{"admin"}}, store)
+	handler := NewHandler(cfg, nil, jobQueue, nil, budget)
+
+	send := func(user string) *httptest.ResponseRecorder {
+		payload := []byte(`{"action":"created","repository":{"name":"repo","owner":{"login":"org"}},"sender":{"login":"` + user + `"},"issue":{"number":1,"title":"test"},"comment":{"body":"/code implement it"}}`)
+		req := httptest.NewRequest("POST", "/hook", bytes.NewReader(payload))
+		req.Header.Set("X-GitHub-Event", "issue_comment")
+		rr := httptest.NewRecorder()
+		handler.HandleWebhook(rr, req)
+		return rr
+	}
+
+	rr := send("alice")
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), "budget exceeded") {
+		t.Fatalf("Unexpected response: %d %q", rr.Code, rr.Body.String())
+	}
+	if n := len(jobQueue.List()); n != 0 {
+		t.Fatalf("Expected no job over budget, got %d jobs", n)
+	}
+
+	// 豁免用户不受预算限制
+	send("admin")
+	if n := len(jobQueue.List()); n != 1 {
+		t.Errorf("Expected exempt user to enqueue a job, got %d jobs", n)
+	}
+}
+
+func TestHandleWebhook_DuplicateDelivery(t *testing.T) {
+	cfg := &config.Config{
+		CodeProvider: "claude",
+	}
+
+	jobQueue, err := queue.New(t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("Failed to create job queue: %v", err)
+	}
+	deliveries, err := dedup.NewStore("", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create delivery store: %v", err)
+	}
+	handler := NewHandler(cfg, nil, jobQueue, deliveries, nil)
+
+	payload := []byte(`{"action":"created","issue":{"number":1,"title":"test"},"comment":{"body":"/code"}}`)
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/hook", bytes.NewReader(payload))
+		req.Header.Set("X-GitHub-Event", "issue_comment")
+		req.Header.Set("X-GitHub-Delivery", "delivery-1")
+		rr := httptest.NewRecorder()
+		handler.HandleWebhook(rr, req)
+		return rr
+	}
+
+	if rr := send(); rr.Body.String() != "issue processing started" {
+		t.Fatalf("Expected first delivery to be processed, got %q", rr.Body.String())
+	}
+
+	rr := send()
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d for duplicate delivery, got %d", http.StatusOK, rr.Code)
+	}
+	if rr.Body.String() != "duplicate delivery ignored: delivery-1" {
+		t.Errorf("Unexpected body for duplicate delivery: %q", rr.Body.String())
+	}
+	if n := len(jobQueue.List()); n != 1 {
+		t.Errorf("Expected duplicate delivery not to enqueue a job, got %d jobs", n)
+	}
+}
+
+func TestHandleWebhook_FailedDeliveryCanBeRedelivered(t *testing.T) {
+	cfg := &config.Config{}
+
+	deliveries, err := dedup.NewStore("", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create delivery store: %v", err)
+	}
+	handler := NewHandler(cfg, nil, nil, deliveries, nil)
+
+	req := httptest.NewRequest("POST", "/hook", bytes.NewReader([]byte(`not json`)))
+	req.Header.Set("X-GitHub-Event", "issue_comment")
+	req.Header.Set("X-GitHub-Delivery", "delivery-2")
+	rr := httptest.NewRecorder()
+	handler.HandleWebhook(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if deliveries.Len() != 0 {
+		t.Errorf("Expected failed delivery to be forgotten, store has %d entries", deliveries.Len())
+	}
+}
+
+func TestHandleDispatch(t *testing.T) {
+	cfg := &config.Config{Dispatch: config.DispatchConfig{Token: "secret"}}
+	jobQueue, err := queue.New(t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("Failed to create job queue: %v", err)
+	}
+	handler := NewEnhancedHandler(cfg, nil, jobQueue, nil, nil)
+
+	tests := []struct {
+		name   string
+		auth   string
+		body   string
+		status int
+	}{
+		{"unauthorized", "Bearer wrong", `{"repository":"org/repo","instruction":"do it"}`, http.StatusUnauthorized},
+		{"invalid repository", "Bearer secret", `{"repository":"repo","instruction":"do it"}`, http.StatusBadRequest},
+		{"missing instruction", "Bearer secret", `{"repository":"org/repo"}`, http.StatusBadRequest},
+		{"comment without issue", "Bearer secret", `{"repository":"org/repo","instruction":"do it","output":"comment"}`, http.StatusBadRequest},
+		{"queued", "Bearer secret", `{"repository":"org/repo","ref":"release-1.0","instruction":"Bump version","inputs":{"version":"1.0.1"},"sender":"alice"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/dispatch", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", tt.auth)
+			rr := httptest.NewRecorder()
+			handler.HandleDispatch(rr, req)
+			if rr.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	jobs := jobQueue.List()
+	if len(jobs) != 1 || jobs[0].Type != agent.JobGitHubEvent {
+		t.Fatalf("Expected 1 GitHub event job, got %+v", jobs)
+	}
+	var jobPayload agent.JobPayload
+	if err := json.Unmarshal(jobs[0].Payload, &jobPayload); err != nil {
+		t.Fatalf("Failed to unmarshal job payload: %v", err)
+	}
+	var event github.WorkflowDispatchEvent
+	if err := json.Unmarshal(jobPayload.Event, &event); err != nil {
+		t.Fatalf("Failed to unmarshal event: %v", err)
+	}
+	if jobPayload.EventType != "workflow_dispatch" || event.GetRef() != "release-1.0" ||
+		event.GetRepo().GetOwner().GetLogin() != "org" || event.GetSender().GetLogin() != "alice" {
+		t.Errorf("Unexpected event: type=%s ref=%s repo=%s sender=%s", jobPayload.EventType,
+			event.GetRef(), event.GetRepo().GetFullName(), event.GetSender().GetLogin())
+	}
+	if !strings.Contains(string(event.Inputs), `"instruction":"Bump version"`) {
+		t.Errorf("Unexpected inputs: %s", event.Inputs)
+	}
+}
+
+func TestHandleDispatch_Disabled(t *testing.T) {
+	handler := NewEnhancedHandler(&config.Config{}, nil, nil, nil, nil)
+
+	req := httptest.NewRequest("POST", "/dispatch", strings.NewReader(`{}`))
+	rr := httptest.NewRecorder()
+	handler.HandleDispatch(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
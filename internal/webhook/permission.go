@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/qiniu/codeagent/internal/permission"
+	"github.com/qiniu/codeagent/pkg/models"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/qiniu/x/xlog"
+)
+
+// commandGuard 检查命令的触发用户，由原始 Agent 和 Enhanced Agent 实现
+type commandGuard interface {
+	IsAgent(ctx context.Context, user *github.User) bool
+	CheckPermission(ctx context.Context, org, repo string, number int, user string) error
+}
+
+// fromAgent 判断事件是否由 CodeAgent 自己或其他机器人发送，这些事件不触发命令，避免循环触发
+func (h *Handler) fromAgent(ctx context.Context, sender *github.User) bool {
+	if models.IsBot(sender) {
+		return true
+	}
+	return h.commands != nil && h.commands.IsAgent(ctx, sender)
+}
+
+// checkPermission 检查入队命令的触发用户是否有权限，没有权限时答复请求并返回 false。
+// 只用于原始 Agent，Enhanced Agent 在执行入队的事件前检查
+func (h *Handler) checkPermission(ctx context.Context, w http.ResponseWriter, event []byte) bool {
+	var target budgetTarget
+	if h.agent == nil || json.Unmarshal(event, &target) != nil || target.Repo == nil || !target.isCommand() {
+		return true
+	}
+	return h.allowCommand(ctx, w, target.Repo.GetOwner().GetLogin(), target.Repo.GetName(), target.number(), target.Sender.GetLogin())
+}
+
+// allowCommand 检查 user 是否可以在 org/repo 中触发命令，没有权限时在 Issue/PR 上答复、答复请求并返回 false
+func (h *Handler) allowCommand(ctx context.Context, w http.ResponseWriter, org, repo string, number int, user string) bool {
+	log := xlog.NewWith(ctx)
+
+	if h.commands == nil {
+		return true
+	}
+	err := h.commands.CheckPermission(ctx, org, repo, number, user)
+	if err == nil {
+		return true
+	}
+	var denied *permission.DeniedError
+	if errors.As(err, &denied) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("permission denied"))
+		return false
+	}
+
+	// 无法确认权限时不执行命令，返回错误以便重新投递
+	log.Errorf("Failed to check permission of %s on %s/%s: %v", user, org, repo, err)
+	http.Error(w, "failed to check permission", http.StatusServiceUnavailable)
+	return false
+}
@@ -0,0 +1,158 @@
+package webhook
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/qiniu/codeagent/pkg/signature"
+
+	"github.com/qiniu/x/xlog"
+)
+
+// signatureTarget 选择验证签名的 secret 需要的事件字段
+type signatureTarget struct {
+	Repo *struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Installation *struct {
+		ID int64 `json:"id"`
+	} `json:"installation"`
+}
+
+// secretMatch 一个 secret 的匹配情况
+type secretMatch struct {
+	Count         int64     `json:"count"`
+	LastMatchedAt time.Time `json:"last_matched_at"`
+}
+
+// signatureStats 统计各 secret 匹配的投递数，轮换 secret 时据此判断旧 secret 是否还在使用
+type signatureStats struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	matches  map[string]*secretMatch // secret 名称 -> 匹配情况
+	failures int64
+}
+
+func newSignatureStats() *signatureStats {
+	return &signatureStats{now: time.Now, matches: make(map[string]*secretMatch)}
+}
+
+func (s *signatureStats) matched(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.matches[name]
+	if !ok {
+		m = &secretMatch{}
+		s.matches[name] = m
+	}
+	m.Count++
+	m.LastMatchedAt = s.now()
+}
+
+func (s *signatureStats) failed() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures++
+}
+
+// signatureReport GET /webhook/signatures 的响应
+type signatureReport struct {
+	Secrets  []secretReport `json:"secrets"`
+	Failures int64          `json:"failures"`
+}
+
+type secretReport struct {
+	Name string `json:"name"`
+	secretMatch
+}
+
+func (s *signatureStats) report() signatureReport {
+	report := signatureReport{Secrets: []secretReport{}}
+	if s == nil {
+		return report
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, m := range s.matches {
+		report.Secrets = append(report.Secrets, secretReport{Name: name, secretMatch: *m})
+	}
+	sort.Slice(report.Secrets, func(i, j int) bool { return report.Secrets[i].Name < report.Secrets[j].Name })
+	report.Failures = s.failures
+	return report
+}
+
+// verifySignature 使用事件所属仓库、组织、安装实例和全局配置的 secret 依次验证签名，
+// 验证失败时答复 401 并返回 false。未配置任何 secret 时不验证
+func (h *Handler) verifySignature(ctx context.Context, w http.ResponseWriter, r *http.Request, body []byte) bool {
+	if !h.config.Server.HasWebhookSecrets() {
+		return true
+	}
+	xl := xlog.NewWith(ctx)
+
+	// 负载尚未验证，只用于选择候选 secret，解析失败时只使用全局 secret
+	var target signatureTarget
+	_ = json.Unmarshal(body, &target)
+	var fullName string
+	var installationID int64
+	if target.Repo != nil {
+		fullName = target.Repo.FullName
+	}
+	if target.Installation != nil {
+		installationID = target.Installation.ID
+	}
+
+	candidates := h.config.Server.WebhookSecretsFor(fullName, installationID)
+	secrets := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		secrets[i] = candidate.Value
+	}
+
+	i, err := signature.MatchGitHubSignature(r.Header.Get("X-Hub-Signature-256"), r.Header.Get("X-Hub-Signature"), body, secrets)
+	if err != nil {
+		h.signatures.failed()
+		xl.Warnf("Rejected webhook delivery for %q: %v", fullName, err)
+		if errors.Is(err, signature.ErrMissingSignature) {
+			http.Error(w, "missing signature", http.StatusUnauthorized)
+		} else {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+		}
+		return false
+	}
+	h.signatures.matched(candidates[i].Name)
+	xl.Debugf("Webhook signature matched secret %s", candidates[i].Name)
+	return true
+}
+
+// HandleSignatureStats 返回各 webhook secret 匹配的投递数和最近匹配时间（不包含 secret 本身）：GET /webhook/signatures，
+// 需要 Authorization: Bearer <server.signature_stats_token>，未配置令牌时接口关闭
+func (h *Handler) HandleSignatureStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := h.config.Server.SignatureStatsToken
+	if token == "" {
+		http.Error(w, "signature stats API is disabled", http.StatusNotFound)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.signatures.report())
+}
@@ -24,6 +24,11 @@ func (f *dirFormatter) generatePRDirName(aiModel, repo string, prNumber int, tim
 	return fmt.Sprintf("%s-%s-pr-%d-%d", aiModel, repo, prNumber, timestamp)
 }
 
+// generatePushDirName 生成推送分析目录名
+func (f *dirFormatter) generatePushDirName(aiModel, repo, sha string, timestamp int64) string {
+	return fmt.Sprintf("%s-%s-push-%s-%d", aiModel, repo, sha, timestamp)
+}
+
 // generateSessionDirName 生成Session目录名
 func (f *dirFormatter) generateSessionDirName(aiModel, repo string, prNumber int, timestamp int64) string {
 	return fmt.Sprintf("%s-%s-session-%d-%d", aiModel, repo, prNumber, timestamp)
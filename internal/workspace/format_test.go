@@ -97,6 +97,16 @@ func TestDirectoryFormat_GenerateSessionDirName(t *testing.T) {
 	}
 }
 
+func TestDirectoryFormat_GeneratePushDirName(t *testing.T) {
+	df := newDirFormatter()
+
+	result := df.generatePushDirName("claude", "codeagent", "a1b2c3d", 1752829201)
+	expected := "claude-codeagent-push-a1b2c3d-1752829201"
+	if result != expected {
+		t.Errorf("GeneratePushDirName() = %v, want %v", result, expected)
+	}
+}
+
 func TestDirectoryFormat_ParsePRDirName(t *testing.T) {
 	df := newDirFormatter()
 
@@ -1,6 +1,7 @@
 package workspace
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -99,6 +100,12 @@ func (m *Manager) ExtractAIModelFromBranch(branchName string) string {
 	return ""
 }
 
+// GitCredentials 为访问远程仓库的 git 命令提供凭证
+type GitCredentials interface {
+	// GitEnv 返回访问 owner/repo 的 git 命令需要追加的环境变量
+	GitEnv(ctx context.Context, owner, repo string) ([]string, error)
+}
+
 type Manager struct {
 	baseDir string
 
@@ -108,17 +115,20 @@ type Manager struct {
 	repoManagers map[string]*RepoManager
 	mutex        sync.RWMutex
 	config       *config.Config
+	credentials  GitCredentials
 
 	// 目录格式管理器
 	dirFormatter *dirFormatter
 }
 
-func NewManager(cfg *config.Config) *Manager {
+// NewManager 创建工作空间管理器，克隆和拉取仓库时使用 credentials 提供的凭证
+func NewManager(cfg *config.Config, credentials GitCredentials) *Manager {
 	m := &Manager{
 		baseDir:      cfg.Workspace.BaseDir,
 		workspaces:   make(map[string]*models.Workspace),
 		repoManagers: make(map[string]*RepoManager),
 		config:       cfg,
+		credentials:  credentials,
 		dirFormatter: newDirFormatter(),
 	}
 
@@ -143,6 +153,41 @@ func (m *Manager) CleanupWorkspace(ws *models.Workspace) bool {
 	return m.cleanupWorkspaceWithWorktree(ws)
 }
 
+// RemoveTemporaryWorkspace 删除未关联 PR 的临时 Issue 工作空间（worktree、本地分支和 session 目录）
+func (m *Manager) RemoveTemporaryWorkspace(ws *models.Workspace) error {
+	if ws == nil || ws.Path == "" {
+		return fmt.Errorf("invalid workspace")
+	}
+	if ws.SessionPath != "" {
+		if err := os.RemoveAll(ws.SessionPath); err != nil {
+			log.Warnf("Failed to remove session directory %s: %v", ws.SessionPath, err)
+		}
+	}
+	return m.getOrCreateRepoManager(ws.Org, ws.Repo).RemoveWorktreeByPath(ws.Path, ws.Branch)
+}
+
+// DiscardUncommittedChanges 丢弃工作空间中未提交的改动（包括未跟踪的文件）
+func (m *Manager) DiscardUncommittedChanges(ws *models.Workspace) error {
+	if ws == nil || ws.Path == "" {
+		return fmt.Errorf("invalid workspace")
+	}
+
+	cmd := exec.Command("git", "reset", "--hard", "HEAD")
+	cmd.Dir = ws.Path
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to reset workspace: %w, output: %s", err, string(output))
+	}
+
+	cmd = exec.Command("git", "clean", "-fd")
+	cmd.Dir = ws.Path
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to clean workspace: %w, output: %s", err, string(output))
+	}
+
+	log.Infof("Discarded uncommitted changes in workspace: %s", ws.Path)
+	return nil
+}
+
 // cleanupWorkspaceWithWorktree 清理 worktree 工作空间，返回是否清理成功
 func (m *Manager) cleanupWorkspaceWithWorktree(ws *models.Workspace) bool {
 	// 从工作空间路径提取编号
@@ -306,7 +351,7 @@ func (m *Manager) recoverExistingWorkspaces() {
 					orgRepoPath := fmt.Sprintf("%s/%s", org, repoName)
 					m.mutex.Lock()
 					if m.repoManagers[orgRepoPath] == nil {
-						repoManager := NewRepoManager(repoPath, remoteURL)
+						repoManager := NewRepoManager(repoPath, remoteURL, m.credentials)
 						// 恢复 worktrees
 						if err := repoManager.RestoreWorktrees(); err != nil {
 							log.Warnf("Failed to restore worktrees for %s: %v", orgRepoPath, err)
@@ -406,7 +451,7 @@ func (m *Manager) getOrCreateRepoManager(org, repo string) *RepoManager {
 
 	// 创建新的仓库管理器
 	repoPath := filepath.Join(m.baseDir, orgRepo)
-	repoManager := NewRepoManager(repoPath, fmt.Sprintf("https://github.com/%s/%s.git", org, repo))
+	repoManager := NewRepoManager(repoPath, fmt.Sprintf("https://github.com/%s/%s.git", org, repo), m.credentials)
 	m.repoManagers[orgRepo] = repoManager
 
 	return repoManager
@@ -414,6 +459,11 @@ func (m *Manager) getOrCreateRepoManager(org, repo string) *RepoManager {
 
 // extractOrgRepoPath 从仓库 URL 中提取 org/repo 路径
 func (m *Manager) extractOrgRepoPath(repoURL string) string {
+	return orgRepoFromURL(repoURL)
+}
+
+// orgRepoFromURL 从仓库 URL 中提取 org/repo 路径
+func orgRepoFromURL(repoURL string) string {
 	// 移除 .git 后缀
 	repoURL = strings.TrimSuffix(repoURL, ".git")
 
@@ -516,7 +566,13 @@ func (m *Manager) CreateWorkspaceFromIssue(issue *github.Issue) *models.Workspac
 
 // CreateWorkspaceFromIssueWithAI 从 Issue 创建工作空间，支持指定AI模型
 func (m *Manager) CreateWorkspaceFromIssueWithAI(issue *github.Issue, aiModel string) *models.Workspace {
-	log.Infof("Creating workspace from Issue #%d with AI model: %s", issue.GetNumber(), aiModel)
+	return m.CreateWorkspaceFromIssueOnBranch(issue, aiModel, "")
+}
+
+// CreateWorkspaceFromIssueOnBranch 从 Issue 创建基于指定分支（或 tag、提交）的工作空间，
+// base 为空时基于默认分支
+func (m *Manager) CreateWorkspaceFromIssueOnBranch(issue *github.Issue, aiModel, base string) *models.Workspace {
+	log.Infof("Creating workspace from Issue #%d with AI model: %s, base: %s", issue.GetNumber(), aiModel, base)
 
 	// 从 Issue 的 HTML URL 中提取仓库信息
 	repoURL, org, repo, err := m.extractRepoURLFromIssueURL(issue.GetHTMLURL())
@@ -541,7 +597,12 @@ func (m *Manager) CreateWorkspaceFromIssueWithAI(issue *github.Issue, aiModel st
 	repoManager := m.getOrCreateRepoManager(org, repo)
 
 	// 创建 worktree
-	worktree, err := repoManager.CreateWorktreeWithName(issueDir, branchName, true)
+	var worktree *WorktreeInfo
+	if base != "" {
+		worktree, err = repoManager.CreateWorktreeFromRef(issueDir, branchName, base)
+	} else {
+		worktree, err = repoManager.CreateWorktreeWithName(issueDir, branchName, true)
+	}
 	if err != nil {
 		log.Errorf("Failed to create worktree for Issue #%d: %v", issue.GetNumber(), err)
 		return nil
@@ -557,6 +618,7 @@ func (m *Manager) CreateWorkspaceFromIssueWithAI(issue *github.Issue, aiModel st
 		SessionPath: "",
 		Repository:  repoURL,
 		Branch:      worktree.Branch,
+		BaseBranch:  base,
 		CreatedAt:   time.Now(),
 		Issue:       issue,
 	}
@@ -565,6 +627,39 @@ func (m *Manager) CreateWorkspaceFromIssueWithAI(issue *github.Issue, aiModel st
 	return ws
 }
 
+// CreateWorkspaceAtCommit 创建检出到指定提交的临时工作空间，用于推送后分析等不提交代码的任务，
+// 使用完后需要调用 RemoveTemporaryWorkspace 清理
+func (m *Manager) CreateWorkspaceAtCommit(org, repo, aiModel, sha string) *models.Workspace {
+	log.Infof("Creating workspace for %s/%s at commit %s with AI model: %s", org, repo, sha, aiModel)
+
+	short := sha
+	if len(short) > 7 {
+		short = short[:7]
+	}
+	timestamp := time.Now().Unix()
+	branchName := fmt.Sprintf("%s/%s/push-%s-%d", BranchPrefix, aiModel, short, timestamp)
+	pushDir := m.dirFormatter.generatePushDirName(aiModel, repo, short, timestamp)
+
+	worktree, err := m.getOrCreateRepoManager(org, repo).CreateWorktreeFromRef(pushDir, branchName, sha)
+	if err != nil {
+		log.Errorf("Failed to create worktree for %s/%s at %s: %v", org, repo, sha, err)
+		return nil
+	}
+
+	ws := &models.Workspace{
+		Org:        org,
+		Repo:       repo,
+		AIModel:    aiModel,
+		Path:       worktree.Worktree,
+		Repository: fmt.Sprintf("https://github.com/%s/%s.git", org, repo),
+		Branch:     worktree.Branch,
+		CreatedAt:  time.Now(),
+	}
+
+	log.Infof("Created workspace for %s/%s at commit %s: %s", org, repo, sha, ws.Path)
+	return ws
+}
+
 // MoveIssueToPR 使用 git worktree move 将 Issue 工作空间移动到 PR 工作空间
 func (m *Manager) MoveIssueToPR(ws *models.Workspace, prNumber int) error {
 	// 构建新的命名: aimodel-repo-issue-number-timestamp -> aimodel-repo-pr-number-timestamp
@@ -1,7 +1,12 @@
 package workspace
 
 import (
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
+
+	"github.com/qiniu/codeagent/pkg/models"
 )
 
 func TestExtractOrgRepoPath(t *testing.T) {
@@ -79,3 +84,46 @@ func TestKeyFunction(t *testing.T) {
 		})
 	}
 }
+
+func TestDiscardUncommittedChanges(t *testing.T) {
+	dir := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v, output: %s", args, err, output)
+		}
+	}
+
+	run("init")
+	run("config", "user.email", "test@example.com")
+	run("config", "user.name", "test")
+	tracked := filepath.Join(dir, "tracked.txt")
+	if err := os.WriteFile(tracked, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run("add", "tracked.txt")
+	run("commit", "-m", "init")
+
+	// 模拟被取消任务留下的改动
+	if err := os.WriteFile(tracked, []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	untracked := filepath.Join(dir, "new.txt")
+	if err := os.WriteFile(untracked, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := &Manager{}
+	if err := manager.DiscardUncommittedChanges(&models.Workspace{Path: dir}); err != nil {
+		t.Fatalf("DiscardUncommittedChanges failed: %v", err)
+	}
+
+	content, err := os.ReadFile(tracked)
+	if err != nil || string(content) != "original" {
+		t.Errorf("Expected tracked file to be reverted, got %q (err: %v)", content, err)
+	}
+	if _, err := os.Stat(untracked); !os.IsNotExist(err) {
+		t.Errorf("Expected untracked file to be removed")
+	}
+}
@@ -17,10 +17,11 @@ import (
 
 // RepoManager 仓库管理器，负责管理单个仓库的 worktree
 type RepoManager struct {
-	repoPath  string
-	repoURL   string
-	worktrees map[string]*WorktreeInfo // key: "aiModel-prNumber" 或 "prNumber" (向后兼容)
-	mutex     sync.RWMutex
+	repoPath    string
+	repoURL     string
+	credentials GitCredentials           // 访问远程仓库的凭证，为 nil 时使用主机上的 git 凭证配置
+	worktrees   map[string]*WorktreeInfo // key: "aiModel-prNumber" 或 "prNumber" (向后兼容)
+	mutex       sync.RWMutex
 }
 
 // WorktreeInfo worktree 信息
@@ -47,14 +48,32 @@ func generateWorktreeKey(aiModel string, prNumber int) string {
 }
 
 // NewRepoManager 创建新的仓库管理器
-func NewRepoManager(repoPath, repoURL string) *RepoManager {
+func NewRepoManager(repoPath, repoURL string, credentials GitCredentials) *RepoManager {
 	return &RepoManager{
-		repoPath:  repoPath,
-		repoURL:   repoURL,
-		worktrees: make(map[string]*WorktreeInfo),
+		repoPath:    repoPath,
+		repoURL:     repoURL,
+		credentials: credentials,
+		worktrees:   make(map[string]*WorktreeInfo),
 	}
 }
 
+// remoteCommand 创建访问远程仓库的 git 命令，附加仓库的凭证
+func (r *RepoManager) remoteCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = r.repoPath
+	if r.credentials == nil {
+		return cmd
+	}
+	owner, repo, _ := strings.Cut(orgRepoFromURL(r.repoURL), "/")
+	env, err := r.credentials.GitEnv(ctx, owner, repo)
+	if err != nil {
+		log.Errorf("Failed to get git credentials for %s/%s: %v", owner, repo, err)
+	} else if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd
+}
+
 // Initialize 初始化仓库（首次克隆）
 func (r *RepoManager) Initialize() error {
 	log.Infof("Starting repository initialization: %s", r.repoPath)
@@ -68,8 +87,7 @@ func (r *RepoManager) Initialize() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "git", "clone", r.repoURL, ".")
-	cmd.Dir = r.repoPath
+	cmd := r.remoteCommand(ctx, "clone", r.repoURL, ".")
 
 	log.Infof("Executing git clone: %s", strings.Join(cmd.Args, " "))
 
@@ -179,6 +197,29 @@ func (r *RepoManager) RemoveWorktreeWithAI(prNumber int, aiModel string) error {
 	return nil
 }
 
+// RemoveWorktreeByPath 移除未注册的 worktree 及其本地分支，用于临时工作空间
+func (r *RepoManager) RemoveWorktreeByPath(worktreePath, branch string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cmd := exec.Command("git", "worktree", "remove", "--force", worktreePath)
+	cmd.Dir = r.repoPath
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remove worktree: %w, output: %s", err, string(output))
+	}
+
+	if branch != "" {
+		cmd = exec.Command("git", "branch", "-D", branch)
+		cmd.Dir = r.repoPath
+		if output, err := cmd.CombinedOutput(); err != nil {
+			log.Warnf("Failed to delete local branch %s: %v, output: %s", branch, err, string(output))
+		}
+	}
+
+	log.Infof("Removed worktree: %s", worktreePath)
+	return nil
+}
+
 // ListWorktrees 列出所有 worktree
 func (r *RepoManager) ListWorktrees() ([]*WorktreeInfo, error) {
 	r.mutex.RLock()
@@ -314,8 +355,7 @@ func (r *RepoManager) CreateWorktreeWithName(worktreeName string, branch string,
 		} else {
 			// 本地分支不存在，检查远程分支是否存在
 			log.Infof("Local branch does not exist, checking if remote branch exists: origin/%s", branch)
-			checkCmd := exec.Command("git", "ls-remote", "--heads", "origin", branch)
-			checkCmd.Dir = r.repoPath
+			checkCmd := r.remoteCommand(context.Background(), "ls-remote", "--heads", "origin", branch)
 			checkOutput, err := checkCmd.CombinedOutput()
 			if err != nil {
 				log.Errorf("Failed to check remote branch: %v, output: %s", err, string(checkOutput))
@@ -347,6 +387,34 @@ func (r *RepoManager) CreateWorktreeWithName(worktreeName string, branch string,
 		cmd = exec.Command("git", "worktree", "add", "-b", branch, worktreePath, "main")
 	}
 
+	return r.addWorktree(cmd, worktreePath, branch)
+}
+
+// CreateWorktreeFromRef 基于远程的分支、tag 或提交创建新分支的 worktree
+func (r *RepoManager) CreateWorktreeFromRef(worktreeName, branch, ref string) (*WorktreeInfo, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	log.Infof("Creating worktree with name: %s, branch: %s, from ref: %s", worktreeName, branch, ref)
+
+	if !r.isInitialized() {
+		if err := r.Initialize(); err != nil {
+			return nil, err
+		}
+	}
+
+	cmd := r.remoteCommand(context.Background(), "fetch", "origin", ref)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w, output: %s", ref, err, string(output))
+	}
+
+	worktreePath := filepath.Join(filepath.Dir(r.repoPath), worktreeName)
+	cmd = exec.Command("git", "worktree", "add", "-b", branch, worktreePath, "FETCH_HEAD")
+	return r.addWorktree(cmd, worktreePath, branch)
+}
+
+// addWorktree 执行 git worktree add 命令并配置 worktree
+func (r *RepoManager) addWorktree(cmd *exec.Cmd, worktreePath, branch string) (*WorktreeInfo, error) {
 	cmd.Dir = r.repoPath
 
 	log.Infof("Executing command: %s", strings.Join(cmd.Args, " "))
@@ -413,8 +481,7 @@ func (r *RepoManager) updateMainRepository() error {
 	log.Infof("Updating main repository: %s", r.repoPath)
 
 	// 1. 获取远程最新引用
-	cmd := exec.Command("git", "fetch", "--all", "--prune")
-	cmd.Dir = r.repoPath
+	cmd := r.remoteCommand(context.Background(), "fetch", "--all", "--prune")
 	fetchOutput, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to fetch latest changes: %w, output: %s", err, string(fetchOutput))
@@ -110,13 +110,39 @@ type PullRequestContext struct {
 // WorkflowDispatchContext workflow_dispatch事件上下文
 type WorkflowDispatchContext struct {
 	BaseContext
+	Ref    string                 `json:"ref"`
 	Inputs map[string]interface{} `json:"inputs"`
 }
 
+// 手动任务的输出方式
+const (
+	DispatchOutputPR      = "pr"
+	DispatchOutputComment = "comment"
+)
+
+// DispatchInputs 通过 /dispatch 接口触发的手动任务参数，作为 workflow_dispatch 事件的 inputs 传递
+type DispatchInputs struct {
+	// 自由格式的任务说明
+	Instruction string `json:"instruction"`
+	// 结构化参数，会附加到 prompt 中
+	Inputs map[string]interface{} `json:"inputs,omitempty"`
+	// DispatchOutputPR（默认）或 DispatchOutputComment
+	Output string `json:"output,omitempty"`
+	// Output 为 comment 时发布结果的 Issue/PR 编号
+	Issue int `json:"issue,omitempty"`
+	// PR 和跟踪 Issue 的标题，默认取 Instruction 的第一行
+	Title   string `json:"title,omitempty"`
+	AIModel string `json:"ai_model,omitempty"`
+}
+
 // ScheduleContext schedule事件上下文
 type ScheduleContext struct {
 	BaseContext
 	Cron string `json:"cron"`
+	// 定时任务名称和类型，以及配置中的任务参数
+	Name   string            `json:"name"`
+	Task   string            `json:"task"`
+	Inputs map[string]string `json:"inputs,omitempty"`
 }
 
 // PushContext push事件上下文
@@ -130,7 +156,7 @@ type PushContext struct {
 
 // CommandInfo 提取的命令信息
 type CommandInfo struct {
-	Command   string `json:"command"`    // /code, /continue, /fix
+	Command   string `json:"command"`    // /code, /continue, /fix, /cancel
 	AIModel   string `json:"ai_model"`   // claude, gemini
 	Args      string `json:"args"`       // 命令参数
 	RawText   string `json:"raw_text"`   // 原始文本
@@ -141,16 +167,57 @@ const (
 	CommandCode     = "/code"
 	CommandContinue = "/continue"
 	CommandFix      = "/fix"
+	CommandCancel   = "/cancel"
+	CommandSuggest  = "/suggest"
 )
 
+// commands 支持的命令
+var commands = []string{CommandCode, CommandContinue, CommandFix, CommandCancel, CommandSuggest}
+
+// IsCommand 判断内容是否以支持的命令开头
+func IsCommand(content string) bool {
+	content = strings.TrimSpace(content)
+	for _, command := range commands {
+		if strings.HasPrefix(content, command) {
+			return true
+		}
+	}
+	return false
+}
+
 // AI模型类型
 const (
 	AIModelClaude = "claude"
 	AIModelGemini = "gemini"
 )
 
-// HasCommand 检查上下文是否包含命令
-func HasCommand(ctx GitHubContext) (*CommandInfo, bool) {
+// ParseAIModelFlag 解析命令参数开头选择 AI 模型的参数（- 加 provider 名称，如 -claude），
+// providers 为可用的 provider 名称，未指定时 aiModel 为空，args 为原参数
+func ParseAIModelFlag(commandArgs string, providers []string) (aiModel, args string) {
+	// 优先匹配最长的名称，避免前缀相同的参数互相覆盖
+	for _, provider := range providers {
+		if strings.HasPrefix(commandArgs, "-"+provider) && len(provider) > len(aiModel) {
+			aiModel = provider
+		}
+	}
+	if aiModel == "" {
+		return "", commandArgs
+	}
+	return aiModel, strings.TrimSpace(strings.TrimPrefix(commandArgs, "-"+aiModel))
+}
+
+// IsBot 判断用户是否为机器人账号（GitHub App、Actions 等，包括以 GitHub App 身份运行的 CodeAgent）
+func IsBot(user *github.User) bool {
+	return user.GetType() == "Bot" || strings.HasSuffix(user.GetLogin(), "[bot]")
+}
+
+// HasCommand 检查上下文是否包含命令，providers 为可用的 provider 名称，用于解析 AI 模型参数；
+// 机器人发布的内容（例如 CodeAgent 引用的提示词）不视为命令，避免循环触发
+func HasCommand(ctx GitHubContext, providers []string) (*CommandInfo, bool) {
+	if IsBot(ctx.GetSender()) {
+		return nil, false
+	}
+
 	var content string
 	
 	switch c := ctx.(type) {
@@ -170,11 +237,11 @@ func HasCommand(ctx GitHubContext) (*CommandInfo, bool) {
 		return nil, false
 	}
 	
-	return parseCommand(content)
+	return parseCommand(content, providers)
 }
 
 // parseCommand 解析命令字符串
-func parseCommand(content string) (*CommandInfo, bool) {
+func parseCommand(content string, providers []string) (*CommandInfo, bool) {
 	content = strings.TrimSpace(content)
 	
 	var command string
@@ -190,25 +257,19 @@ func parseCommand(content string) (*CommandInfo, bool) {
 	} else if strings.HasPrefix(content, CommandFix) {
 		command = CommandFix
 		remaining = strings.TrimSpace(strings.TrimPrefix(content, CommandFix))
+	} else if strings.HasPrefix(content, CommandCancel) {
+		command = CommandCancel
+		remaining = strings.TrimSpace(strings.TrimPrefix(content, CommandCancel))
+	} else if strings.HasPrefix(content, CommandSuggest) {
+		command = CommandSuggest
+		remaining = strings.TrimSpace(strings.TrimPrefix(content, CommandSuggest))
 	} else {
 		return nil, false
 	}
 	
 	// 解析AI模型
-	var aiModel string
-	var args string
-	
-	if strings.HasPrefix(remaining, "-claude") {
-		aiModel = AIModelClaude
-		args = strings.TrimSpace(strings.TrimPrefix(remaining, "-claude"))
-	} else if strings.HasPrefix(remaining, "-gemini") {
-		aiModel = AIModelGemini
-		args = strings.TrimSpace(strings.TrimPrefix(remaining, "-gemini"))
-	} else {
-		// 没有指定AI模型，使用默认
-		aiModel = "" // 将在后续处理中设置默认值
-		args = remaining
-	}
+	// 没有指定AI模型时 aiModel 为空，将在后续处理中设置默认值
+	aiModel, args := ParseAIModelFlag(remaining, providers)
 	
 	return &CommandInfo{
 		Command: command,
@@ -312,6 +312,7 @@ func (pt *ProgressTracker) HasErrors() bool {
 // ProgressExecutionResult 带进度信息的执行结果
 type ProgressExecutionResult struct {
 	Success        bool                  `json:"success"`
+	Cancelled      bool                  `json:"cancelled,omitempty"` // 任务被 /cancel 中止
 	Output         string                `json:"output"`
 	Error          string                `json:"error,omitempty"`
 	FilesChanged   []string              `json:"files_changed"`
@@ -322,6 +323,7 @@ type ProgressExecutionResult struct {
 	PullRequestURL string                `json:"pull_request_url,omitempty"`
 	TaskResults    []*Task               `json:"task_results"`
 	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	Usage          *TokenUsage           `json:"usage,omitempty"`
 }
 
 // CommentContext 评论上下文
@@ -0,0 +1,43 @@
+package models
+
+import "fmt"
+
+// TokenUsage 一次或多次 AI 调用的 token 用量和费用
+type TokenUsage struct {
+	InputTokens              int     `json:"input_tokens"`
+	OutputTokens             int     `json:"output_tokens"`
+	CacheCreationInputTokens int     `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int     `json:"cache_read_input_tokens,omitempty"`
+	CostUSD                  float64 `json:"cost_usd,omitempty"` // provider 未报告费用时为 0
+}
+
+// Add 累加另一次调用的用量
+func (u *TokenUsage) Add(other TokenUsage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheCreationInputTokens += other.CacheCreationInputTokens
+	u.CacheReadInputTokens += other.CacheReadInputTokens
+	u.CostUSD += other.CostUSD
+}
+
+// IsZero 是否没有任何用量
+func (u TokenUsage) IsZero() bool {
+	return u == TokenUsage{}
+}
+
+// TotalTokens 所有 token 数之和
+func (u TokenUsage) TotalTokens() int {
+	return u.InputTokens + u.OutputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// Summary 返回适合展示在评论中的简短用量说明
+func (u TokenUsage) Summary() string {
+	s := fmt.Sprintf("Tokens: %d input / %d output", u.InputTokens, u.OutputTokens)
+	if cached := u.CacheCreationInputTokens + u.CacheReadInputTokens; cached > 0 {
+		s += fmt.Sprintf(" / %d cached", cached)
+	}
+	if u.CostUSD > 0 {
+		s += fmt.Sprintf(" · Cost: $%.4f", u.CostUSD)
+	}
+	return s
+}
@@ -22,7 +22,9 @@ type Workspace struct {
 	// github repo url
 	Repository string `json:"repository"`
 	// github branch name
-	Branch      string              `json:"branch"`
+	Branch string `json:"branch"`
+	// 创建 PR 时的目标分支，为空时使用仓库默认分支
+	BaseBranch  string              `json:"base_branch,omitempty"`
 	Issue       *github.Issue       `json:"issue"`
 	PullRequest *github.PullRequest `json:"pull_request"`
 	CreatedAt   time.Time           `json:"created_at"`
@@ -34,6 +36,7 @@ type ExecutionResult struct {
 	Error        string        `json:"error,omitempty"`
 	FilesChanged []string      `json:"files_changed"`
 	Duration     time.Duration `json:"duration"`
+	Usage        *TokenUsage   `json:"usage,omitempty"`
 }
 
 // PRAllComments 包含 PR 的所有评论信息
@@ -89,3 +89,28 @@ func ValidateGitHubSignatureSHA1(signature string, payload []byte, secret string
 
 	return nil
 }
+
+// MatchGitHubSignature 依次使用 secrets 验证GitHub webhook签名，返回第一个匹配的 secret 的下标，用于轮换 secret 期间同时接受新旧 secret
+// signature256: 来自请求头 X-Hub-Signature-256 的签名，为空时使用 signature1
+// signature1: 来自请求头 X-Hub-Signature 的签名 (SHA1, 已弃用但仍支持)
+func MatchGitHubSignature(signature256, signature1 string, payload []byte, secrets []string) (int, error) {
+	validate, sig := ValidateGitHubSignature, signature256
+	if signature256 == "" {
+		validate, sig = ValidateGitHubSignatureSHA1, signature1
+	}
+	if sig == "" {
+		return -1, ErrMissingSignature
+	}
+
+	for i, secret := range secrets {
+		err := validate(sig, payload, secret)
+		if err == nil {
+			return i, nil
+		}
+		if !errors.Is(err, ErrInvalidSignature) {
+			// 签名格式错误时换一个 secret 也不会通过
+			return -1, err
+		}
+	}
+	return -1, ErrInvalidSignature
+}
@@ -143,3 +143,45 @@ func TestValidateGitHubSignatureSHA1(t *testing.T) {
 		})
 	}
 }
+
+func TestMatchGitHubSignature(t *testing.T) {
+	payload := []byte(`{"action":"opened","number":1}`)
+	sign := func(secret string) (string, string) {
+		mac256 := hmac.New(sha256.New, []byte(secret))
+		mac256.Write(payload)
+		mac1 := hmac.New(sha1.New, []byte(secret))
+		mac1.Write(payload)
+		return "sha256=" + hex.EncodeToString(mac256.Sum(nil)), "sha1=" + hex.EncodeToString(mac1.Sum(nil))
+	}
+	new256, new1 := sign("new-secret")
+	old256, _ := sign("old-secret")
+	secrets := []string{"new-secret", "old-secret"}
+
+	tests := []struct {
+		name         string
+		signature256 string
+		signature1   string
+		expected     int
+		expectedErr  error
+	}{
+		{"current secret", new256, "", 0, nil},
+		{"retiring secret", old256, "", 1, nil},
+		{"sha1 fallback", "", new1, 0, nil},
+		{"sha256 takes precedence", old256, new1, 1, nil},
+		{"unknown secret", "sha256=0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", "", -1, ErrInvalidSignature},
+		{"invalid format", "invalid-format", "", -1, ErrInvalidFormat},
+		{"missing signature", "", "", -1, ErrMissingSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MatchGitHubSignature(tt.signature256, tt.signature1, payload, secrets)
+			if err != tt.expectedErr {
+				t.Errorf("MatchGitHubSignature() error = %v, expectedErr %v", err, tt.expectedErr)
+			}
+			if got != tt.expected {
+				t.Errorf("MatchGitHubSignature() = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}